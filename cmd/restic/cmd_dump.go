@@ -64,12 +64,14 @@ type DumpOptions struct {
 	data.SnapshotFilter
 	Archive string
 	Target  string
+	Dedup   bool
 }
 
 func (opts *DumpOptions) AddFlags(f *pflag.FlagSet) {
 	initSingleSnapshotFilter(f, &opts.SnapshotFilter)
 	f.StringVarP(&opts.Archive, "archive", "a", "tar", "set archive `format` as \"tar\" or \"zip\"")
 	f.StringVarP(&opts.Target, "target", "t", "", "write the output to target `path`")
+	f.BoolVar(&opts.Dedup, "dedup", false, "store files with identical content only once in tar archives, using hard links")
 }
 
 func splitPath(p string) []string {
@@ -144,6 +146,9 @@ func runDump(ctx context.Context, opts DumpOptions, gopts global.Options, args [
 	default:
 		return fmt.Errorf("unknown archive format %q", opts.Archive)
 	}
+	if opts.Dedup && opts.Archive != "tar" {
+		return errors.Fatal("--dedup is only supported for tar archives")
+	}
 
 	snapshotIDString := args[0]
 	pathToPrint := args[1]
@@ -195,6 +200,9 @@ func runDump(ctx context.Context, opts DumpOptions, gopts global.Options, args [
 	}
 
 	d := dump.New(opts.Archive, repo, outputFileWriter)
+	if opts.Dedup {
+		d.DeduplicateContent()
+	}
 	err = printFromTree(ctx, tree, repo, "/", splittedPath, d, canWriteArchiveFunc)
 	if err != nil {
 		return errors.Fatalf("cannot dump file: %v", err)
@@ -2,15 +2,29 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/backend/limiter"
 	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
+	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/global"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/restorer"
 	"github.com/restic/restic/internal/ui"
@@ -47,6 +61,7 @@ Exit status is 1 if there was any error.
 Exit status is 10 if the repository does not exist.
 Exit status is 11 if the repository is already locked.
 Exit status is 12 if the password is incorrect.
+Exit status is 13 if the restore exceeded --max-duration.
 `,
 		GroupID:           cmdGroupDefault,
 		DisableAutoGenTag: true,
@@ -64,20 +79,105 @@ Exit status is 12 if the password is incorrect.
 type RestoreOptions struct {
 	filter.ExcludePatternOptions
 	filter.IncludePatternOptions
-	Target string
+	Target       string
+	TargetSubdir string
 	data.SnapshotFilter
 	DryRun              bool
+	List                bool
 	Sparse              bool
+	SparseHoleThreshold string
+	SparseUnsupported   restorer.SparseUnsupportedBehavior
 	Verify              bool
 	Overwrite           restorer.OverwriteBehavior
+	Immutable           restorer.ImmutableBehavior
 	Delete              bool
+	DeleteAll           bool
 	ExcludeXattrPattern []string
 	IncludeXattrPattern []string
 	OwnershipByName     bool
+	UIDMap              []string
+	GIDMap              []string
+	OwnerUIDs           []string
+	OwnerGIDs           []string
+	OwnerMatchAny       bool
+	SkipInodeCheck      bool
+	Unprivileged        bool
+	Umask               string
+	PathsFromStdin      bool
+	RechunkSizeLimit    string
+	ChunkerPolynomial   string
+	QuickCheckChecksum  bool
+	PatchFrom           string
+	DeltaFrom           string
+	DeltaDelete         bool
+	SizeQuota           string
+	CheckMissingBlobs   bool
+	Journal             string
+	Deadline            time.Duration
+	DeadlineGracePeriod time.Duration
+	MaxDuration         time.Duration
+	OutageRetries       int
+	OutageBackoff       time.Duration
+	DecodeWorkers       int
+	Watchdog            time.Duration
+	WatchdogOutput      string
+	WatchdogAbort       bool
+	DownloadSchedule    string
+	MinFreeSpace        string
+	FreeSpaceInterval   time.Duration
+	LogSlowFiles        time.Duration
+	EstimateSamples     int
+	SequentialFiles     int
+	BlobCacheSize       string
+	StructureOnly       bool
+	WriteAlignment      string
+	SortWrites          bool
+	Subvolumes          []string
+	ReportChanges       bool
+	Report              string
+	DirCreateLimit      int
+	ListTargetDirs      int
+	DirOwnerPolicy      restorer.DirOwnerPolicy
+	ProgressBatch       int
+	ProgressInterval    time.Duration
+	WebhookURL          string
+	WebhookHeaders      []string
+	WebhookEvents       string
+	WebhookInterval     time.Duration
+	SortedEntries       bool
+	Flatten             bool
+	FlattenCollision    restorer.FlattenCollisionBehavior
+	PathMap             string
+	Seed                string
+	SeedIndex           string
+	Salvage             bool
+	AlternatePacks      bool
+	CoalescePacks       bool
+	CacheAdvice         restorer.CacheAdvice
+	VerifyPacks         bool
+	TargetFDs           []string
+	ReadOnly            bool
+	UndoReadOnly        bool
+	ScanCommand         string
+	PackOrder           restorer.PackOrder
+	Quarantine          string
+	LazyIndex           bool
+	ReuseBuffers        bool
+	ProbeTargets        bool
+	PreviewPatch        string
+	LongPaths           restorer.LongPathBehavior
+	VerifyWrites        bool
+	VerifyWritesPattern []string
+	Provenance          restorer.ProvenanceStorage
+	ProvenanceManifest  string
+	TreeHash            bool
+	ExpectTreeHash      string
+	OutputFormat        restoreui.OutputFormat
 }
 
 func (opts *RestoreOptions) AddFlags(f *pflag.FlagSet) {
 	f.StringVarP(&opts.Target, "target", "t", "", "directory to extract data to")
+	f.StringVar(&opts.TargetSubdir, "target-subdir", "", "restore into a per-snapshot subdirectory of the target, named by the `template`, for example '{{.Timestamp}}_{{.ID}}'")
 
 	opts.ExcludePatternOptions.Add(f)
 	opts.IncludePatternOptions.Add(f)
@@ -87,21 +187,114 @@ func (opts *RestoreOptions) AddFlags(f *pflag.FlagSet) {
 
 	initSingleSnapshotFilter(f, &opts.SnapshotFilter)
 	f.BoolVar(&opts.DryRun, "dry-run", false, "do not write any data, just show what would be done")
+	f.BoolVar(&opts.List, "list", false, "only list the items which would be restored, like 'tar -tv', without restoring them or requiring --target")
+	f.BoolVar(&opts.ProbeTargets, "probe-targets", false, "with --dry-run, check that files can be created in all target directories")
+	f.StringVar(&opts.PreviewPatch, "preview-patch", "", "with --dry-run, write the changes of the file contents as a binary patch to `file`")
+	f.Var(&opts.LongPaths, "long-paths", "behavior for items whose name or path is too long for the target platform, one of (fail|truncate|hash|skip)")
+	f.IntVar(&opts.EstimateSamples, "estimate-samples", 0, "estimate the restore duration during a dry-run by downloading `n` packs (default: no estimate)")
+	f.BoolVar(&opts.StructureOnly, "structure-only", false, "only restore the directory structure, create empty placeholders instead of restoring file content")
+	f.BoolVar(&opts.ReportChanges, "report-changes", false, "report which files are created, modified or left unchanged in the target, also works with --dry-run")
+	f.StringVar(&opts.Report, "report", "", "write a JSON report with the status of every restored file to `file` once the restore has completed")
 	f.BoolVar(&opts.Sparse, "sparse", false, "restore files as sparse")
+	f.StringVar(&opts.SparseHoleThreshold, "sparse-hole-threshold", "", "with --sparse, also skip runs of at least `size` zero bytes within file chunks (allowed suffixes: k/K, m/M, g/G, t/T, default: disabled)")
+	f.Var(&opts.SparseUnsupported, "sparse-unsupported", "with --sparse, behavior if the target filesystem does not support sparse files, one of (fallback|warn|fail)")
 	f.BoolVar(&opts.Verify, "verify", false, "verify restored files content")
-	f.Var(&opts.Overwrite, "overwrite", "overwrite behavior, one of (always|if-changed|if-newer|never)")
+	f.BoolVar(&opts.TreeHash, "tree-hash", false, "compute a tree hash of the restored files and compare it with the hash computed from the snapshot")
+	f.StringVar(&opts.ExpectTreeHash, "expect-tree-hash", "", "fail unless the tree hash of the restored files is `hash` (implies --tree-hash)")
+	f.BoolVar(&opts.VerifyWrites, "verify-writes", false, "read back each blob right after writing it and compare the data (slow)")
+	f.StringArrayVar(&opts.VerifyWritesPattern, "verify-writes-pattern", nil, "only verify the writes of files matching `pattern` with --verify-writes (can be specified multiple times)")
+	f.Var(&opts.Overwrite, "overwrite", "overwrite behavior, one of (always|if-changed|if-newer|if-newer-and-changed|never|if-content-differs|quick-check)")
+	f.Var(&opts.Immutable, "immutable", "behavior for existing files with the immutable or append-only attribute, one of (fail|clear|reapply)")
 	f.BoolVar(&opts.Delete, "delete", false, "delete files from target directory if they do not exist in snapshot. Use '--dry-run -vv' to check what would be deleted")
+	f.BoolVar(&opts.DeleteAll, "delete-all", false, "allow --delete to remove all items of the target directory, if none of them exists in the snapshot")
+	f.StringVar(&opts.RechunkSizeLimit, "rechunk-size-limit", "", "only use '--overwrite if-content-differs' for files up to `size` (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.StringVar(&opts.ChunkerPolynomial, "chunker-polynomial", "", "expect the repository to use the chunker `polynomial` for '--overwrite if-content-differs', given in hex like in 'restic cat config'")
+	f.BoolVar(&opts.QuickCheckChecksum, "quick-check-checksum", false, "verify the content of files whose size matches but whose mtime differs for '--overwrite quick-check', instead of restoring them from scratch")
+	f.StringVar(&opts.PatchFrom, "patch-from", "", "only restore content which differs from `snapshot`, assuming the target contains a restore of it")
+	f.StringVar(&opts.DeltaFrom, "delta-from", "", "only restore items which changed since `snapshot`, assuming the target contains a restore of it")
+	f.BoolVar(&opts.DeltaDelete, "delta-delete", false, "remove items which were deleted since the snapshot passed to --delta-from")
+	f.Var(&opts.PackOrder, "pack-order", "order in which to download the packs, one of (first-access|pack-id|smallest-first)")
+	f.IntVar(&opts.SequentialFiles, "sequential-files", 0, "restore files in snapshot order, completing `n` files at a time before starting the next ones (default: all at once)")
+	f.StringVar(&opts.BlobCacheSize, "blob-cache-size", "", "keep up to `size` of recently downloaded blobs in memory to avoid downloading them again (allowed suffixes: k/K, m/M, g/G, t/T, default: disabled)")
+	f.StringVar(&opts.SizeQuota, "size-quota", "", "restore at most `size` of file content, most recently modified files first (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.StringVar(&opts.WriteAlignment, "write-alignment", "", "coalesce file content into writes of `size` at offsets which are a multiple of it (allowed suffixes: k/K, m/M, g/G, t/T)")
+	f.BoolVar(&opts.SortWrites, "sort-writes", false, "write the blobs of each downloaded pack ordered by file and offset, which can reduce seeking on hard disks")
+	f.StringArrayVar(&opts.Subvolumes, "btrfs-subvolume", nil, "create the directory at snapshot `path` as a btrfs subvolume (can be specified multiple times)")
+	f.BoolVar(&opts.Flatten, "flatten", false, "restore all files directly into the target directory, naming them after their path with slashes replaced by underscores")
+	f.Var(&opts.FlattenCollision, "flatten-collision", "behavior for files whose name is already used with --flatten, one of (suffix|fail)")
+	f.StringVar(&opts.Seed, "seed", "", "copy file content contained in the files below `directory` instead of downloading it")
+	f.StringVar(&opts.SeedIndex, "seed-index", "", "load the index of --seed from `file`, or save it there if the file does not exist")
+	f.StringVar(&opts.PathMap, "path-map", "", "restore the files listed in `file` to individual target paths, one 'snapshot-path => target-path' per line")
+	f.BoolVar(&opts.ReadOnly, "read-only", false, "remove the write permissions from all restored files and directories once the restore has completed")
+	f.BoolVar(&opts.UndoReadOnly, "undo-read-only", false, "make the directories of a target restored with --read-only writable again before restoring")
+	f.StringVar(&opts.ScanCommand, "scan-command", "", "run `command` with the path of each restored file as last argument, files for which it fails are removed")
+	f.StringVar(&opts.Quarantine, "quarantine", "", "move the files rejected by --scan-command to `directory` instead of removing them")
+	f.Var(&opts.Provenance, "provenance", "record the snapshot, repository and time of the restore for each restored file, one of (none|xattr|sidecar|manifest)")
+	f.StringVar(&opts.ProvenanceManifest, "provenance-manifest", "", "append the provenance of the restored files to `file` for '--provenance manifest'")
+	f.IntVar(&opts.ProgressBatch, "progress-batch", 0, "report the progress of the file content after `n` updates at once, to reduce the overhead for many small files (default: report each update)")
+	f.DurationVar(&opts.ProgressInterval, "progress-batch-interval", 0, "report the progress of the file content at most every `duration` (default: report each update)")
+	f.StringVar(&opts.WebhookURL, "webhook-url", "", "send the start, progress, completion and failure of the restore as JSON to `url` using POST requests")
+	f.StringArrayVar(&opts.WebhookHeaders, "webhook-header", nil, "add the `header` like 'Authorization: Bearer token' to the requests of --webhook-url (can be specified multiple times)")
+	f.StringVar(&opts.WebhookEvents, "webhook-events", "start,progress,completed,failed", "comma separated list of `events` to send to --webhook-url")
+	f.DurationVar(&opts.WebhookInterval, "webhook-interval", time.Minute, "send a progress event to --webhook-url every `duration`")
+	f.IntVar(&opts.ListTargetDirs, "list-target-dirs", 0, "check which files exist by listing each target directory with up to `n` entries once, instead of checking each file (default: disabled)")
+	f.IntVar(&opts.DirCreateLimit, "dir-create-limit", 0, "create at most `n` files concurrently in the same directory (default: unlimited)")
+	f.BoolVar(&opts.SortedEntries, "sorted-entries", false, "create the entries of each directory in the order of their names, this slows down restoring many small files")
+	f.BoolVar(&opts.PathsFromStdin, "paths-from-stdin", false, "only restore the newline-separated snapshot paths read from stdin")
+	f.DurationVar(&opts.Deadline, "deadline", 0, "stop restoring file content after `duration`, takes a value like 30m or 2h (default: no deadline)")
+	f.DurationVar(&opts.DeadlineGracePeriod, "deadline-grace-period", 0, "wait at most `duration` for in-progress downloads once the deadline has passed (default: wait until completed)")
+	f.DurationVar(&opts.MaxDuration, "max-duration", 0, "abort the restore after `duration`, takes a value like 30m or 2h (default: no limit)")
+	f.IntVar(&opts.OutageRetries, "outage-retries", 0, "restart the restore up to `n` times if the repository backend is unreachable")
+	f.IntVar(&opts.DecodeWorkers, "decode-workers", 0, "decrypt and decompress the downloaded packs using `n` separate workers instead of the download workers")
+	f.DurationVar(&opts.OutageBackoff, "outage-backoff", time.Minute, "wait `duration` before the first restart of --outage-retries, doubled for each further restart")
+	f.DurationVar(&opts.Watchdog, "watchdog", 0, "dump the goroutine stacks if no file content was written for `duration`, to diagnose a stalled restore (default: disabled)")
+	f.StringVar(&opts.WatchdogOutput, "watchdog-output", "", "write the dumps of --watchdog to `file` (default: stderr)")
+	f.BoolVar(&opts.WatchdogAbort, "watchdog-abort", false, "abort the restore after the first dump of --watchdog")
+	f.StringVar(&opts.DownloadSchedule, "limit-download-schedule", "", "vary the download limit by a `schedule` like 'mon-fri 08:00-18:00=1024,18:00-08:00=0' in KiB/s, --limit-download applies outside of it (default: none)")
+	f.StringVar(&opts.MinFreeSpace, "min-free-space", "", "pause downloading while less than `size` is free in the target directory (allowed suffixes: k/K, m/M, g/G, t/T, default: disabled)")
+	f.DurationVar(&opts.FreeSpaceInterval, "free-space-interval", 0, "check the free space for --min-free-space every `duration` (default: 10s)")
+	f.DurationVar(&opts.LogSlowFiles, "log-slow-files", 0, "report files whose content takes longer than `duration` to restore (default: disabled)")
+	f.StringVar(&opts.Journal, "journal", "", "record restored file content in `file` to quickly resume an interrupted restore")
+	f.BoolVar(&opts.VerifyPacks, "verify-packs", false, "also check the blobs of each downloaded pack file which are not required for the restored files (downloads more data)")
+	f.BoolVar(&opts.Salvage, "salvage", false, "restore the intact parts of files containing damaged blobs, filling the damaged parts with zeros")
+	f.BoolVar(&opts.AlternatePacks, "retry-alternate-packs", false, "load damaged blobs from other pack files which contain a copy of them according to the index")
+	f.BoolVar(&opts.CoalescePacks, "coalesce-packs", false, "load blobs stored in multiple pack files, for example after a repack, from pack files which are downloaded anyway")
+	f.BoolVar(&opts.LazyIndex, "lazy-index", false, "start restoring while the index is still being loaded, which reduces the startup time for large repositories")
+	f.Var(&opts.CacheAdvice, "cache-advice", "advise the page cache how the restored files are used, one of (none|sequential|dont-need), only supported on Linux")
+	f.BoolVar(&opts.ReuseBuffers, "reuse-buffers", false, "recycle the buffers for downloading pack files, which reduces the garbage collection overhead for large restores")
+	f.BoolVar(&opts.CheckMissingBlobs, "check-missing-blobs", false, "report all data blobs missing from the index before restoring any file content")
+	f.BoolVar(&opts.Unprivileged, "unprivileged", false, "skip items which require root privileges to restore, like device nodes and file ownership")
+	f.StringVar(&opts.Umask, "umask", "", "remove the permission bits of the octal `mask` from all restored items, for example 027")
+	f.BoolVar(&opts.SkipInodeCheck, "skip-inode-check", false, "do not check whether the target filesystem has enough free inodes")
+	f.Var(&opts.OutputFormat, "output-format", "print the progress and messages in the given `format`, one of (text|json|logfmt), json is the same as --json")
 	if runtime.GOOS != "windows" {
 		f.BoolVar(&opts.OwnershipByName, "ownership-by-name", false, "restore file ownership by user name and group name (except POSIX ACLs)")
+		f.StringArrayVar(&opts.UIDMap, "uid-map", nil, "translate the user ids of restored files using the `from:to:count` range, like for idmapped mounts (can be specified multiple times)")
+		f.StringArrayVar(&opts.GIDMap, "gid-map", nil, "translate the group ids of restored files using the `from:to:count` range, like for idmapped mounts (can be specified multiple times)")
+		f.StringArrayVar(&opts.OwnerUIDs, "owner-uid", nil, "only restore files owned by the user `id` stored in the snapshot (can be specified multiple times)")
+		f.StringArrayVar(&opts.OwnerGIDs, "owner-gid", nil, "only restore files owned by the group `id` stored in the snapshot (can be specified multiple times)")
+		f.BoolVar(&opts.OwnerMatchAny, "owner-match-any", false, "restore files matching --owner-uid or --owner-gid, instead of requiring both to match")
+		f.Var(&opts.DirOwnerPolicy, "dir-owner-policy", "check that the parent directory of each file is owned by root, the current user or the owner in the snapshot before writing the file, one of (ignore|warn|enforce)")
+		f.StringArrayVar(&opts.TargetFDs, "target-fd", nil, "restore the file at snapshot `path=fd` into the already open file descriptor fd (can be specified multiple times)")
 	}
 }
 
 func runRestore(ctx context.Context, opts RestoreOptions, gopts global.Options,
-	term ui.Terminal, args []string) error {
+	term ui.Terminal, args []string) (err error) {
+
+	switch {
+	case opts.OutputFormat == restoreui.OutputJSON:
+		gopts.JSON = true
+	case opts.OutputFormat == restoreui.OutputLogfmt && gopts.JSON:
+		return errors.Fatal("--output-format logfmt cannot be combined with --json")
+	}
+	logfmt := opts.OutputFormat == restoreui.OutputLogfmt
 
 	var printer restoreui.ProgressPrinter
 	if gopts.JSON {
 		printer = restoreui.NewJSONProgress(term, gopts.Verbosity)
+	} else if logfmt {
+		printer = restoreui.NewLogfmtProgress(term, gopts.Verbosity)
 	} else {
 		printer = restoreui.NewTextProgress(term, gopts.Verbosity)
 	}
@@ -126,22 +319,319 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts global.Options,
 		return errors.Fatalf("more than one snapshot ID specified: %v", args)
 	}
 
-	if opts.Target == "" {
+	if opts.Target == "" && !opts.List {
 		return errors.Fatal("please specify a directory to restore to (--target)")
 	}
 
+	if opts.List && (opts.DryRun || opts.Verify || opts.Delete) {
+		return errors.Fatal("--list cannot be combined with --dry-run, --verify or --delete")
+	}
+
+	var targetSubdir *restorer.TargetTemplate
+	if opts.TargetSubdir != "" {
+		targetSubdir, err = restorer.NewTargetTemplate(opts.TargetSubdir)
+		if err != nil {
+			return errors.Fatalf("invalid --target-subdir: %v", err)
+		}
+	}
+
 	if hasExcludes && hasIncludes {
 		return errors.Fatal("exclude and include patterns are mutually exclusive")
 	}
 
+	if opts.PathsFromStdin && (hasExcludes || hasIncludes) {
+		return errors.Fatal("--paths-from-stdin cannot be combined with include or exclude patterns")
+	}
+
+	if opts.PathsFromStdin && gopts.Password == "" && !gopts.InsecureNoPassword {
+		return errors.Fatal("unable to read password from stdin when paths are to be read from stdin, use --password-file or $RESTIC_PASSWORD")
+	}
+
 	if opts.DryRun && opts.Verify {
 		return errors.Fatal("--dry-run and --verify are mutually exclusive")
 	}
 
-	if opts.Delete && filepath.Clean(opts.Target) == "/" && !hasExcludes && !hasIncludes {
+	if opts.StructureOnly && opts.Verify {
+		return errors.Fatal("--structure-only and --verify are mutually exclusive")
+	}
+
+	if opts.ExpectTreeHash != "" {
+		opts.TreeHash = true
+	}
+	var expectedTreeHash restic.ID
+	if opts.ExpectTreeHash != "" {
+		expectedTreeHash, err = restic.ParseID(opts.ExpectTreeHash)
+		if err != nil {
+			return errors.Fatalf("invalid --expect-tree-hash: %v", err)
+		}
+	}
+
+	if opts.TreeHash && (opts.DryRun || opts.StructureOnly || opts.Flatten) {
+		return errors.Fatal("--tree-hash cannot be combined with --dry-run, --structure-only or --flatten")
+	}
+
+	if opts.SequentialFiles < 0 {
+		return errors.Fatal("--sequential-files must not be negative")
+	}
+
+	if opts.DirCreateLimit < 0 {
+		return errors.Fatal("--dir-create-limit must not be negative")
+	}
+
+	if opts.ListTargetDirs < 0 {
+		return errors.Fatal("--list-target-dirs must not be negative")
+	}
+
+	if opts.ProgressBatch < 0 || opts.ProgressInterval < 0 {
+		return errors.Fatal("--progress-batch and --progress-batch-interval must not be negative")
+	}
+
+	var webhookOpts restoreui.WebhookOptions
+	if opts.WebhookURL != "" {
+		webhookOpts, err = parseWebhookOptions(opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.OutageRetries < 0 {
+		return errors.Fatal("--outage-retries must not be negative")
+	}
+	if opts.OutageRetries > 0 && opts.OutageBackoff <= 0 {
+		return errors.Fatal("--outage-backoff must be positive")
+	}
+	if opts.DecodeWorkers < 0 {
+		return errors.Fatal("--decode-workers must not be negative")
+	}
+
+	if opts.Flatten && (opts.Delete || len(opts.Subvolumes) > 0) {
+		return errors.Fatal("--flatten cannot be combined with --delete or --btrfs-subvolume")
+	}
+
+	if opts.ReadOnly && opts.Flatten {
+		return errors.Fatal("--read-only cannot be combined with --flatten")
+	}
+
+	if opts.SeedIndex != "" && opts.Seed == "" {
+		return errors.Fatal("--seed-index requires --seed")
+	}
+
+	if opts.PathMap != "" && opts.Flatten {
+		return errors.Fatal("--path-map cannot be combined with --flatten")
+	}
+
+	if opts.SortedEntries && opts.Flatten {
+		return errors.Fatal("--sorted-entries cannot be combined with --flatten")
+	}
+
+	if opts.DeltaFrom != "" && (opts.PatchFrom != "" || opts.Flatten) {
+		return errors.Fatal("--delta-from cannot be combined with --patch-from or --flatten")
+	}
+
+	if opts.LongPaths != restorer.LongPathFail && (opts.Flatten || opts.DeltaFrom != "") {
+		return errors.Fatal("--long-paths cannot be combined with --flatten or --delta-from")
+	}
+
+	if len(opts.VerifyWritesPattern) > 0 {
+		if !opts.VerifyWrites {
+			return errors.Fatal("--verify-writes-pattern requires --verify-writes")
+		}
+		if err := filter.ValidatePatterns(opts.VerifyWritesPattern); err != nil {
+			return errors.Fatalf("--verify-writes-pattern: %s", err)
+		}
+	}
+
+	if opts.DeltaDelete && opts.DeltaFrom == "" {
+		return errors.Fatal("--delta-delete requires --delta-from")
+	}
+
+	if opts.EstimateSamples < 0 {
+		return errors.Fatal("--estimate-samples must not be negative")
+	}
+
+	if opts.EstimateSamples > 0 && !opts.DryRun {
+		return errors.Fatal("--estimate-samples requires --dry-run")
+	}
+
+	if opts.Delete && filepath.Clean(opts.Target) == "/" && !hasExcludes && !hasIncludes && !opts.PathsFromStdin {
 		return errors.Fatal("'--target / --delete' must be combined with an include or exclude filter")
 	}
 
+	if opts.DeleteAll && !opts.Delete {
+		return errors.Fatal("--delete-all requires --delete")
+	}
+
+	if len(opts.TargetFDs) > 0 && opts.Journal != "" {
+		return errors.Fatal("--target-fd cannot be combined with --journal")
+	}
+	targetFiles, err := parseTargetFDs(opts.TargetFDs)
+	if err != nil {
+		return err
+	}
+
+	idMap, err := parseIDMap(opts.UIDMap, opts.GIDMap)
+	if err != nil {
+		return err
+	}
+	ownerFilter, err := parseOwnerFilter(opts.OwnerUIDs, opts.OwnerGIDs, opts.OwnerMatchAny)
+	if err != nil {
+		return err
+	}
+
+	var umask uint64
+	if opts.Umask != "" {
+		umask, err = strconv.ParseUint(opts.Umask, 8, 32)
+		if err != nil || umask > 0o777 {
+			return errors.Fatalf("invalid --umask %q, must be an octal number between 0 and 777", opts.Umask)
+		}
+	}
+
+	if opts.ProbeTargets && !opts.DryRun {
+		return errors.Fatal("--probe-targets requires --dry-run")
+	}
+	if opts.PreviewPatch != "" && !opts.DryRun {
+		return errors.Fatal("--preview-patch requires --dry-run")
+	}
+	if opts.PreviewPatch != "" && opts.EstimateSamples > 0 {
+		return errors.Fatal("--preview-patch cannot be combined with --estimate-samples")
+	}
+	if opts.Quarantine != "" && opts.ScanCommand == "" {
+		return errors.Fatal("--quarantine requires --scan-command")
+	}
+	if opts.Provenance == restorer.ProvenanceStorageManifest && opts.ProvenanceManifest == "" {
+		return errors.Fatal("'--provenance manifest' requires --provenance-manifest")
+	}
+	if opts.ProvenanceManifest != "" && opts.Provenance != restorer.ProvenanceStorageManifest {
+		return errors.Fatal("--provenance-manifest requires '--provenance manifest'")
+	}
+	scanFile, err := newScanCommand(opts.ScanCommand)
+	if err != nil {
+		return err
+	}
+
+	if (opts.WatchdogOutput != "" || opts.WatchdogAbort) && opts.Watchdog == 0 {
+		return errors.Fatal("--watchdog-output and --watchdog-abort require --watchdog")
+	}
+	var watchdogOutput io.Writer
+	if opts.WatchdogOutput != "" {
+		f, err := os.OpenFile(opts.WatchdogOutput, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return errors.Fatalf("unable to open --watchdog-output: %v", err)
+		}
+		defer func() { _ = f.Close() }()
+		watchdogOutput = f
+	}
+
+	var previewPatch io.Writer
+	if opts.PreviewPatch != "" {
+		f, err := os.OpenFile(opts.PreviewPatch, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return errors.Fatalf("unable to create --preview-patch: %v", err)
+		}
+		defer func() { _ = f.Close() }()
+		previewPatch = f
+	}
+
+	var pathMap *restorer.PathMap
+	if opts.PathMap != "" {
+		pathMap, err = readPathMap(opts.PathMap)
+		if err != nil {
+			return errors.Fatalf("--path-map: %s", err)
+		}
+	}
+
+	if opts.DownloadSchedule != "" {
+		gopts.DownloadSchedule, err = limiter.ParseSchedule(opts.DownloadSchedule)
+		if err != nil {
+			return errors.Fatalf("invalid --limit-download-schedule: %v", err)
+		}
+	}
+
+	if opts.QuickCheckChecksum && opts.Overwrite != restorer.OverwriteQuickCheck {
+		return errors.Fatal("--quick-check-checksum requires '--overwrite quick-check'")
+	}
+
+	var rechunkSizeLimit uint64
+	if opts.RechunkSizeLimit != "" {
+		size, err := ui.ParseBytes(opts.RechunkSizeLimit)
+		if err != nil {
+			return errors.Fatalf("invalid number of bytes %q for --rechunk-size-limit: %v", opts.RechunkSizeLimit, err)
+		}
+		rechunkSizeLimit = uint64(size)
+	}
+	var chunkerPolynomial chunker.Pol
+	if opts.ChunkerPolynomial != "" {
+		pol, err := strconv.ParseUint(strings.TrimPrefix(opts.ChunkerPolynomial, "0x"), 16, 64)
+		if err != nil {
+			return errors.Fatalf("invalid polynomial %q for --chunker-polynomial: %v", opts.ChunkerPolynomial, err)
+		}
+		chunkerPolynomial = chunker.Pol(pol)
+	}
+	var sizeQuota uint64
+	if opts.SizeQuota != "" {
+		size, err := ui.ParseBytes(opts.SizeQuota)
+		if err != nil {
+			return errors.Fatalf("invalid number of bytes %q for --size-quota: %v", opts.SizeQuota, err)
+		}
+		sizeQuota = uint64(size)
+	}
+	var minFreeSpace uint64
+	if opts.MinFreeSpace != "" {
+		size, err := ui.ParseBytes(opts.MinFreeSpace)
+		if err != nil {
+			return errors.Fatalf("invalid number of bytes %q for --min-free-space: %v", opts.MinFreeSpace, err)
+		}
+		minFreeSpace = uint64(size)
+	}
+	if opts.FreeSpaceInterval != 0 && minFreeSpace == 0 {
+		return errors.Fatal("--free-space-interval requires --min-free-space")
+	}
+	if opts.FreeSpaceInterval < 0 {
+		return errors.Fatal("--free-space-interval must be positive")
+	}
+	var writeAlignment int64
+	if opts.WriteAlignment != "" {
+		size, err := ui.ParseBytes(opts.WriteAlignment)
+		if err != nil {
+			return errors.Fatalf("invalid number of bytes %q for --write-alignment: %v", opts.WriteAlignment, err)
+		}
+		if size <= 0 {
+			return errors.Fatal("--write-alignment must be positive")
+		}
+		if opts.Journal != "" {
+			return errors.Fatal("--write-alignment and --journal are mutually exclusive")
+		}
+		writeAlignment = size
+	}
+	var blobCacheSize int
+	if opts.BlobCacheSize != "" {
+		size, err := ui.ParseBytes(opts.BlobCacheSize)
+		if err != nil {
+			return errors.Fatalf("invalid number of bytes %q for --blob-cache-size: %v", opts.BlobCacheSize, err)
+		}
+		if size <= 0 {
+			return errors.Fatal("--blob-cache-size must be positive")
+		}
+		blobCacheSize = int(size)
+	}
+	var sparseHoleThreshold int
+	if opts.SparseHoleThreshold != "" {
+		size, err := ui.ParseBytes(opts.SparseHoleThreshold)
+		if err != nil {
+			return errors.Fatalf("invalid number of bytes %q for --sparse-hole-threshold: %v", opts.SparseHoleThreshold, err)
+		}
+		if size <= 0 || size > math.MaxInt32 {
+			return errors.Fatal("--sparse-hole-threshold must be positive and smaller than 2 GiB")
+		}
+		if !opts.Sparse {
+			return errors.Fatal("--sparse-hole-threshold requires --sparse")
+		}
+		sparseHoleThreshold = int(size)
+	}
+	if opts.SparseUnsupported != restorer.SparseFallback && !opts.Sparse {
+		return errors.Fatal("--sparse-unsupported requires --sparse")
+	}
+
 	snapshotIDString := args[0]
 
 	debug.Log("restore %v to %v", snapshotIDString, opts.Target)
@@ -157,24 +647,145 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts global.Options,
 		return errors.Fatalf("failed to find snapshot: %v", err)
 	}
 
-	err = repo.LoadIndex(ctx, printer)
-	if err != nil {
-		return err
+	if opts.ReuseBuffers {
+		// pack files are downloaded in sections of at most about this size
+		repo.UseBufferPool(repository.NewBufferPool(2 * repository.DefaultPackSize))
+	}
+
+	// blobRepo is used for all accesses requiring the index
+	var blobRepo restic.Repository = repo
+	var lazyIndex *repository.LazyIndexRepository
+	if opts.LazyIndex {
+		lazyIndex = repo.StartLoadIndex(ctx, restic.NoopTerminalCounterFactory)
+		blobRepo = lazyIndex
+	} else {
+		err = repo.LoadIndex(ctx, printer)
+		if err != nil {
+			return err
+		}
 	}
 
-	sn.Tree, err = data.FindTreeDirectory(ctx, repo, sn.Tree, subfolder)
+	// the metadata of the subfolder is restored to the target directory
+	rootNode, err := data.FindTreeDirectoryNode(ctx, blobRepo, sn.Tree, subfolder)
 	if err != nil {
 		return err
 	}
+	if rootNode != nil {
+		sn.Tree = rootNode.Subtree
+	}
+
+	if targetSubdir != nil {
+		dir, err := targetSubdir.Expand(sn)
+		if err != nil {
+			return errors.Fatalf("invalid --target-subdir: %v", err)
+		}
+		opts.Target = filepath.Join(opts.Target, dir)
+	}
+
+	var patchBase *data.Snapshot
+	if opts.PatchFrom != "" {
+		var baseSubfolder string
+		patchBase, baseSubfolder, err = data.FindSnapshot(ctx, repo, repo, opts.PatchFrom)
+		if err != nil {
+			return errors.Fatalf("failed to find snapshot for --patch-from: %v", err)
+		}
+		patchBase.Tree, err = data.FindTreeDirectory(ctx, blobRepo, patchBase.Tree, baseSubfolder)
+		if err != nil {
+			return err
+		}
+	}
+
+	var deltaBase *data.Snapshot
+	if opts.DeltaFrom != "" {
+		var baseSubfolder string
+		deltaBase, baseSubfolder, err = data.FindSnapshot(ctx, repo, repo, opts.DeltaFrom)
+		if err != nil {
+			return errors.Fatalf("failed to find snapshot for --delta-from: %v", err)
+		}
+		deltaBase.Tree, err = data.FindTreeDirectory(ctx, blobRepo, deltaBase.Tree, baseSubfolder)
+		if err != nil {
+			return err
+		}
+	}
 
-	progress := restoreui.NewProgress(printer, gopts.Quiet, gopts.JSON, term.CanUpdateStatus())
-	res := restorer.NewRestorer(repo, sn, restorer.Options{
-		DryRun:          opts.DryRun,
-		Sparse:          opts.Sparse,
-		Progress:        progress,
-		Overwrite:       opts.Overwrite,
-		Delete:          opts.Delete,
-		OwnershipByName: opts.OwnershipByName,
+	progress := restoreui.NewProgress(printer, gopts.Quiet, gopts.JSON || logfmt, term.CanUpdateStatus())
+	res := restorer.NewRestorer(blobRepo, sn, restorer.Options{
+		DryRun:              opts.DryRun,
+		EstimateSamples:     opts.EstimateSamples,
+		Sparse:              opts.Sparse,
+		SparseHoleThreshold: sparseHoleThreshold,
+		SparseUnsupported:   opts.SparseUnsupported,
+		Progress:            progress,
+		Overwrite:           opts.Overwrite,
+		Immutable:           opts.Immutable,
+		Delete:              opts.Delete,
+		DeleteAll:           opts.DeleteAll,
+		OwnershipByName:     opts.OwnershipByName,
+		IDMap:               idMap,
+		SkipInodeCheck:      opts.SkipInodeCheck,
+		Unprivileged:        opts.Unprivileged,
+		Umask:               os.FileMode(umask),
+		RechunkSizeLimit:    rechunkSizeLimit,
+		ChunkerPolynomial:   chunkerPolynomial,
+		QuickCheckChecksum:  opts.QuickCheckChecksum,
+		PatchBase:           patchBase,
+		DeltaBase:           deltaBase,
+		DeltaDelete:         opts.DeltaDelete,
+		SizeQuota:           sizeQuota,
+		OwnerFilter:         ownerFilter,
+		SequentialFiles:     opts.SequentialFiles,
+		RootNode:            rootNode,
+		BlobCacheSize:       blobCacheSize,
+		StructureOnly:       opts.StructureOnly,
+		WriteAlignment:      writeAlignment,
+		SortWrites:          opts.SortWrites,
+		Subvolumes:          opts.Subvolumes,
+		ReportChanges:       opts.ReportChanges,
+		Report:              opts.Report,
+		DirCreateLimit:      opts.DirCreateLimit,
+		DirListingLimit:     opts.ListTargetDirs,
+		DirOwnerPolicy:      opts.DirOwnerPolicy,
+		ProgressBatch:       opts.ProgressBatch,
+		ProgressInterval:    opts.ProgressInterval,
+		SortedEntries:       opts.SortedEntries,
+		Flatten:             opts.Flatten,
+		FlattenCollision:    opts.FlattenCollision,
+		PathMap:             pathMap,
+		Seed:                opts.Seed,
+		SeedIndex:           opts.SeedIndex,
+		Salvage:             opts.Salvage,
+		AlternatePacks:      opts.AlternatePacks,
+		CoalescePacks:       opts.CoalescePacks,
+		CacheAdvice:         opts.CacheAdvice,
+		VerifyPacks:         opts.VerifyPacks,
+		TargetFiles:         targetFiles,
+		ReadOnly:            opts.ReadOnly,
+		UndoReadOnly:        opts.UndoReadOnly,
+		Quarantine:          opts.Quarantine,
+		Provenance:          opts.Provenance,
+		ProbeTargets:        opts.ProbeTargets,
+		PreviewPatch:        previewPatch,
+		LongPaths:           opts.LongPaths,
+		VerifyWrites:        opts.VerifyWrites,
+		ProvenanceManifest:  opts.ProvenanceManifest,
+		Scheduler:           opts.PackOrder.NewScheduler(),
+		SchedulerMetrics:    gopts.Verbosity >= 2,
+		IndexLookupStats:    gopts.Verbosity >= 2,
+		PlanMemory:          true,
+		CheckMissingBlobs:   opts.CheckMissingBlobs,
+		Journal:             opts.Journal,
+		Deadline:            opts.Deadline,
+		DeadlineGracePeriod: opts.DeadlineGracePeriod,
+		MaxDuration:         opts.MaxDuration,
+		OutageRetries:       opts.OutageRetries,
+		OutageBackoff:       opts.OutageBackoff,
+		DecodeWorkers:       opts.DecodeWorkers,
+		WatchdogThreshold:   opts.Watchdog,
+		WatchdogOutput:      watchdogOutput,
+		WatchdogAbort:       opts.WatchdogAbort,
+		MinFreeSpace:        minFreeSpace,
+		FreeSpaceInterval:   opts.FreeSpaceInterval,
+		SlowFileThreshold:   opts.LogSlowFiles,
 	})
 
 	totalErrors := 0
@@ -185,8 +796,9 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts global.Options,
 	res.Warn = func(message string) {
 		printer.E("Warning: %s\n", message)
 	}
+	res.ScanFile = scanFile
 	res.Info = func(message string) {
-		if gopts.JSON {
+		if gopts.JSON || logfmt {
 			return
 		}
 		printer.P("Info: %s\n", message)
@@ -235,6 +847,15 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts global.Options,
 		res.SelectFilter = selectExcludeFilter
 	} else if hasIncludes {
 		res.SelectFilter = selectIncludeFilter
+	} else if opts.PathsFromStdin {
+		paths, err := restorer.ReadPathList(term.InputRaw())
+		if err != nil {
+			return err
+		}
+		res.SelectFilter, err = restorer.NewPathListFilter(paths)
+		if err != nil {
+			return errors.Fatalf("--paths-from-stdin: %s", err)
+		}
 	}
 
 	res.XattrSelectFilter, err = getXattrSelectFilter(opts, printer)
@@ -242,16 +863,236 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts global.Options,
 		return err
 	}
 
+	if len(opts.VerifyWritesPattern) > 0 {
+		includeFn := filter.IncludeByPattern(opts.VerifyWritesPattern, printer.E)
+		res.VerifyWritesFilter = func(location string) bool {
+			matched, _ := includeFn(location)
+			return matched
+		}
+	}
+
+	if opts.List {
+		return printRestoreList(ctx, res, gopts.JSON, term.OutputWriter())
+	}
+
 	if !gopts.JSON {
 		printer.P("restoring %s to %s\n", res.Snapshot(), opts.Target)
 	}
 
+	if opts.WebhookURL != "" {
+		webhook := restoreui.NewWebhook(webhookOpts, printer.E)
+		webhook.Start(ctx, sn.ID().String(), opts.Target, progress.State)
+		// the command may still fail after restoring the files, for example
+		// if errors were reported or the verification failed
+		defer func() { webhook.Finish(ctx, err) }()
+	}
+
 	countRestoredFiles, err := res.RestoreTo(ctx, opts.Target)
+	if lazyIndex != nil {
+		// blobs are reported as missing if loading the index failed
+		if indexErr := lazyIndex.Wait(ctx); indexErr != nil {
+			progress.Finish()
+			return indexErr
+		}
+	}
+	reportSalvaged := func() {
+		for _, file := range res.SalvagedFiles() {
+			printer.E("partially recovered %v, the %d damaged ranges filled with zeros are listed in %v", file.Location, len(file.Ranges), file.Report)
+		}
+	}
+	reportPackCheck := func() {
+		if stats := res.PackCheck(); opts.VerifyPacks && !gopts.JSON {
+			printer.P("checked %d blobs in %d packs, %d damaged\n", stats.Blobs, stats.Packs, stats.DamagedBlobs)
+		}
+	}
+	if errors.As(err, new(*restorer.DeleteAllError)) {
+		progress.Finish()
+		return errors.Fatalf("%v, use --delete-all to delete them anyway", err)
+	}
+	var probeErr *restorer.InaccessibleDirsError
+	if errors.As(err, &probeErr) {
+		progress.Finish()
+		for _, dir := range probeErr.Dirs {
+			printer.E("cannot create files in %v: %v", dir.Path, dir.Err)
+		}
+		return errors.Fatalf("%v", err)
+	}
+	var deadlineErr *restorer.DeadlineExceededError
+	if errors.As(err, &deadlineErr) {
+		progress.Finish()
+		for _, file := range deadlineErr.Files {
+			printer.V("incomplete %v\n", file)
+		}
+		return errors.Fatalf("%v, run restore again to complete it", err)
+	}
+	if errors.As(err, new(*restorer.MaxDurationExceededError)) {
+		// returned as is to exit with a distinct status code
+		progress.Finish()
+		return err
+	}
+	var corruptErr *restorer.CorruptBlobsError
+	if errors.As(err, &corruptErr) {
+		progress.Finish()
+		packs := make([]string, 0, len(corruptErr.Packs()))
+		for _, id := range corruptErr.Packs() {
+			packs = append(packs, id.String())
+		}
+		for _, blob := range corruptErr.Blobs {
+			if blob.Unauthenticated {
+				printer.E("damaged blob %v in pack %v: authentication failed", blob.Blob, blob.Pack.Str())
+			} else {
+				printer.E("damaged blob %v in pack %v", blob.Blob, blob.Pack.Str())
+			}
+		}
+		reportSalvaged()
+		reportPackCheck()
+		return errors.Fatalf("%v, the repository is damaged. Run 'restic check --read-data' and 'restic repair packs %s' to salvage the intact blobs",
+			err, strings.Join(packs, " "))
+	}
 	if err != nil {
 		return err
 	}
 
 	progress.Finish()
+	if salvaged := res.SalvagedFiles(); len(salvaged) > 0 {
+		reportSalvaged()
+		return errors.Fatalf("%d files were only partially recovered", len(salvaged))
+	}
+	if vetoed := res.VetoedFiles(); len(vetoed) > 0 {
+		for _, file := range vetoed {
+			if file.Quarantine != "" {
+				printer.E("rejected %v: %v, moved to %v", file.Location, file.Reason, file.Quarantine)
+			} else {
+				printer.E("rejected %v: %v, removed", file.Location, file.Reason)
+			}
+		}
+		return errors.Fatalf("%d files were rejected by --scan-command", len(vetoed))
+	}
+
+	if opts.ReportChanges {
+		printer.ReportChanges(res.Changes())
+	}
+
+	if count, size := res.Placeholders(); count > 0 && !gopts.JSON {
+		printer.P("file content was not restored, created %d empty placeholder files instead of %s of content\n", count, ui.FormatBytes(size))
+	}
+
+	if subvolumes := res.Subvolumes(); len(subvolumes) > 0 && !gopts.JSON {
+		printer.P("created %d btrfs subvolumes\n", len(subvolumes))
+		for _, location := range subvolumes {
+			printer.V("  %v\n", location)
+		}
+	}
+
+	if stats := res.Compression(); stats.CompressedBlobs > 0 && !gopts.JSON {
+		printer.P("fetched %s of file content, %s after decompression (%.1fx)\n",
+			ui.FormatBytes(stats.FetchedBytes), ui.FormatBytes(stats.DecompressedBytes), stats.Ratio())
+	}
+	reportPackCheck()
+
+	if delta := res.Delta(); delta != nil && !gopts.JSON {
+		printer.P("changes since the base snapshot: %d created, %d updated, %d deleted\n",
+			len(delta.Created), len(delta.Updated), len(delta.Deleted))
+		for _, location := range delta.Created {
+			printer.VV("  created %v\n", location)
+		}
+		for _, location := range delta.Updated {
+			printer.VV("  updated %v\n", location)
+		}
+		for _, location := range delta.Deleted {
+			printer.VV("  deleted %v\n", location)
+		}
+		if len(delta.Deleted) > 0 && !opts.DeltaDelete {
+			printer.P("deleted items were not removed from the target, use --delta-delete to remove them\n")
+		}
+	}
+
+	if stats := res.BlobCache(); stats.Hits+stats.Misses > 0 && !gopts.JSON {
+		printer.V("blob cache: %d of %d blobs (%s) were not downloaded again\n",
+			stats.Hits, stats.Hits+stats.Misses, ui.FormatBytes(stats.HitBytes))
+	}
+
+	if stats := res.Coalesce(); stats.DuplicateBlobs > 0 && !gopts.JSON {
+		printer.V("coalesced packs: %d of %d blobs stored in multiple packs were reassigned, downloaded %d instead of %d packs\n",
+			stats.ReassignedBlobs, stats.DuplicateBlobs, stats.Packs, stats.DefaultPacks)
+	}
+
+	if opts.Seed != "" && !gopts.JSON {
+		stats := res.Seed()
+		printer.P("seed: %d blobs (%s) copied from the seed directory, %s fetched from the repository\n",
+			stats.Blobs, ui.FormatBytes(stats.Bytes), ui.FormatBytes(stats.FetchedBytes))
+		if stats.Stale > 0 {
+			printer.V("seed: %d blobs were no longer contained in the seed files\n", stats.Stale)
+		}
+	}
+
+	if count, size := res.SkippedBlobs(); count > 0 && !gopts.JSON {
+		printer.P("skipped %d blobs (%s) which were already present in the target\n", count, ui.FormatBytes(size))
+	}
+
+	if m := res.SchedulerMetrics(); m != nil && m.Duration > 0 {
+		printer.V("download workers: %d, on average %.1f idle, workers waited %v for packs, scheduler waited %v for workers\n",
+			m.Workers, m.AvgIdleWorkers, m.WorkerIdle.Round(time.Millisecond), m.SchedulerWait.Round(time.Millisecond))
+		if minimum, median, maximum, ok := m.WorkerThroughput(); ok {
+			printer.V("worker throughput: min %s/s, median %s/s, max %s/s\n",
+				ui.FormatBytes(uint64(minimum)), ui.FormatBytes(uint64(median)), ui.FormatBytes(uint64(maximum)))
+		}
+	}
+
+	if stats := res.IndexLookups(); stats.Lookups > 0 && !gopts.JSON {
+		printer.V("index lookups: %d blobs (%d not found) took %v\n",
+			stats.Lookups, stats.Misses, stats.Duration.Round(time.Millisecond))
+	}
+
+	if m := res.PlanMemory(); m != nil && m.Files > 0 && !gopts.JSON {
+		printer.V("restore plan: %d files with %d blobs (%s), at most %d packs with %d file references (%s)\n",
+			m.Files, m.Blobs, ui.FormatBytes(m.FileBytes), m.Packs, m.PackFiles, ui.FormatBytes(m.PackBytes))
+		if advice := planMemoryAdvice(*m); advice != "" {
+			printer.P("%s\n", advice)
+		}
+	}
+
+	if est := res.Estimate(); est != nil && !gopts.JSON {
+		if est.SampledPacks == 0 {
+			printer.P("no file content needs to be downloaded\n")
+		} else {
+			printer.P("estimated time to download %s from %d packs: %v (likely between %v and %v, based on %d sampled packs)\n",
+				ui.FormatBytes(est.Bytes), est.Packs, roundEstimate(est.Duration),
+				roundEstimate(est.Min), roundEstimate(est.Max), est.SampledPacks)
+		}
+	}
+
+	if longPaths := res.LongPaths(); len(longPaths) > 0 && !gopts.JSON {
+		printer.P("%d items exceeded the path length limits\n", len(longPaths))
+		for _, p := range longPaths {
+			if p.Name == "" {
+				printer.V("  %v: skipped\n", p.Location)
+			} else {
+				printer.V("  %v: restored as %v\n", p.Location, p.Name)
+			}
+		}
+	}
+
+	if skipped := res.QuotaSkippedFiles(); len(skipped) > 0 && !gopts.JSON {
+		printer.P("%d files were not restored as they exceed the size quota\n", len(skipped))
+		for _, file := range skipped {
+			printer.V("  %v\n", file)
+		}
+	}
+
+	if skipped := res.OwnerSkippedFiles(); len(skipped) > 0 && !gopts.JSON {
+		printer.P("%d files were not restored as their owner was not selected\n", len(skipped))
+		for _, file := range skipped {
+			printer.V("  %v\n", file)
+		}
+	}
+
+	if downgrades := res.Downgrades(); len(downgrades) > 0 && !gopts.JSON {
+		printer.P("%d items were not restored completely, as this requires root privileges\n", len(downgrades))
+		for _, d := range downgrades {
+			printer.V("  %v: %v\n", d.Location, d.Reason)
+		}
+	}
 
 	if totalErrors > 0 {
 		return errors.Fatalf("There were %d errors", totalErrors)
@@ -278,9 +1119,217 @@ func runRestore(ctx context.Context, opts RestoreOptions, gopts global.Options,
 		}
 	}
 
+	if opts.TreeHash {
+		snapshotHash, restoredHash, err := res.TreeHash(ctx, opts.Target)
+		if err != nil {
+			return err
+		}
+		if totalErrors > 0 {
+			return errors.Fatalf("There were %d errors", totalErrors)
+		}
+		if !gopts.JSON {
+			printer.P("tree hash of %s: %v\n", opts.Target, restoredHash)
+		}
+		if !restoredHash.Equal(snapshotHash) {
+			return errors.Fatalf("tree hash %v of the restored files does not match the tree hash %v of the snapshot", restoredHash, snapshotHash)
+		}
+		if opts.ExpectTreeHash != "" && !restoredHash.Equal(expectedTreeHash) {
+			return errors.Fatalf("tree hash %v of the restored files does not match the expected tree hash %v", restoredHash, expectedTreeHash)
+		}
+	}
+
 	return nil
 }
 
+// printRestoreList prints the items which would be restored for --list, in
+// the format of 'ls --long' or 'ls --json'.
+func printRestoreList(ctx context.Context, res *restorer.Restorer, jsonOutput bool, out io.Writer) error {
+	enc := json.NewEncoder(out)
+	return res.List(ctx, func(location string, node *data.Node) error {
+		if jsonOutput {
+			return enc.Encode(lsNodeOutputFrom(location, node))
+		}
+		_, err := fmt.Fprintln(out, formatNode(location, node, true, false))
+		return err
+	})
+}
+
+// parseTargetFDs parses the path=fd arguments of --target-fd.
+func parseTargetFDs(specs []string) (map[string]*os.File, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	files := make(map[string]*os.File, len(specs))
+	for _, spec := range specs {
+		idx := strings.LastIndex(spec, "=")
+		if idx <= 0 {
+			return nil, errors.Fatalf("invalid --target-fd %q, must be path=fd", spec)
+		}
+		fd, err := strconv.ParseUint(spec[idx+1:], 10, 31)
+		if err != nil {
+			return nil, errors.Fatalf("invalid file descriptor in --target-fd %q: %v", spec, err)
+		}
+		location := filepath.Join(string(filepath.Separator), spec[:idx])
+		if _, ok := files[location]; ok {
+			return nil, errors.Fatalf("--target-fd specified multiple times for %v", location)
+		}
+		files[location] = os.NewFile(uintptr(fd), location)
+	}
+	return files, nil
+}
+
+// parseWebhookOptions parses the --webhook-* options.
+func parseWebhookOptions(opts RestoreOptions) (restoreui.WebhookOptions, error) {
+	events, err := restoreui.ParseWebhookEvents(opts.WebhookEvents)
+	if err != nil {
+		return restoreui.WebhookOptions{}, errors.Fatalf("invalid --webhook-events: %v", err)
+	}
+	if opts.WebhookInterval < 0 {
+		return restoreui.WebhookOptions{}, errors.Fatal("--webhook-interval must not be negative")
+	}
+	header := make(http.Header)
+	for _, spec := range opts.WebhookHeaders {
+		name, value, ok := strings.Cut(spec, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return restoreui.WebhookOptions{}, errors.Fatalf("invalid --webhook-header %q, must be 'Name: value'", spec)
+		}
+		header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return restoreui.WebhookOptions{
+		URL:      opts.WebhookURL,
+		Header:   header,
+		Events:   events,
+		Interval: opts.WebhookInterval,
+	}, nil
+}
+
+// readPathMap reads the mappings of --path-map from filename.
+func readPathMap(filename string) (*restorer.PathMap, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	mappings, err := restorer.ReadPathMap(f)
+	if err != nil {
+		return nil, err
+	}
+	return restorer.NewPathMap(mappings)
+}
+
+// parseIDMap parses the ranges of --uid-map and --gid-map. It returns nil if
+// neither is set, such that the ownership is restored unchanged.
+func parseIDMap(uidSpecs, gidSpecs []string) (*fs.IDMap, error) {
+	if len(uidSpecs) == 0 && len(gidSpecs) == 0 {
+		return nil, nil
+	}
+	parse := func(flag string, specs []string) ([]fs.IDMapRange, error) {
+		var ranges []fs.IDMapRange
+		for _, spec := range specs {
+			r, err := fs.ParseIDMapRange(spec)
+			if err != nil {
+				return nil, errors.Fatalf("invalid %v %q: %v", flag, spec, err)
+			}
+			ranges = append(ranges, r)
+		}
+		return ranges, nil
+	}
+	uids, err := parse("--uid-map", uidSpecs)
+	if err != nil {
+		return nil, err
+	}
+	gids, err := parse("--gid-map", gidSpecs)
+	if err != nil {
+		return nil, err
+	}
+	return &fs.IDMap{UIDs: uids, GIDs: gids}, nil
+}
+
+// parseOwnerFilter parses the ids of --owner-uid and --owner-gid. It returns
+// nil if neither is set, such that all files are restored.
+func parseOwnerFilter(uidSpecs, gidSpecs []string, matchAny bool) (*restorer.OwnerFilter, error) {
+	if len(uidSpecs) == 0 && len(gidSpecs) == 0 {
+		if matchAny {
+			return nil, errors.Fatal("--owner-match-any requires --owner-uid or --owner-gid")
+		}
+		return nil, nil
+	}
+	parse := func(flag string, specs []string) ([]uint32, error) {
+		var ids []uint32
+		for _, spec := range specs {
+			id, err := strconv.ParseUint(spec, 10, 32)
+			if err != nil {
+				return nil, errors.Fatalf("invalid %v %q: must be a numeric id", flag, spec)
+			}
+			ids = append(ids, uint32(id))
+		}
+		return ids, nil
+	}
+	uids, err := parse("--owner-uid", uidSpecs)
+	if err != nil {
+		return nil, err
+	}
+	gids, err := parse("--owner-gid", gidSpecs)
+	if err != nil {
+		return nil, err
+	}
+	return &restorer.OwnerFilter{UIDs: uids, GIDs: gids, MatchAny: matchAny}, nil
+}
+
+// newScanCommand returns a restorer.ScanFile function which runs the shell
+// command with the path of the file as additional argument. The file is
+// rejected if the command fails, its output is used as reason.
+func newScanCommand(command string) (func(location, path string) error, error) {
+	if command == "" {
+		return nil, nil
+	}
+	args, err := backend.SplitShellStrings(command)
+	if err != nil {
+		return nil, errors.Fatalf("invalid --scan-command: %v", err)
+	}
+	if len(args) == 0 {
+		return nil, errors.Fatal("--scan-command must not be empty")
+	}
+	return func(_, path string) error {
+		cmd := exec.Command(args[0], append(args[1:], path)...)
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}, nil
+}
+
+// planMemoryAdviceThreshold is the estimated memory usage for planning the
+// restore above which restic suggests how to reduce it.
+const planMemoryAdviceThreshold = 1 << 30
+
+// planMemoryAdvice returns a suggestion on how to reduce the memory used for
+// planning the restore, or an empty string if the usage is not excessive.
+func planMemoryAdvice(m restorer.PlanMemory) string {
+	if m.Bytes() <= planMemoryAdviceThreshold {
+		return ""
+	}
+	if m.PackBytes > m.FileBytes {
+		return fmt.Sprintf("planning the restore required about %s of memory, mostly for %d packs, "+
+			"use --sequential-files to reduce the number of packs planned at once", ui.FormatBytes(m.Bytes()), m.Packs)
+	}
+	return fmt.Sprintf("planning the restore required about %s of memory, mostly for %d files, "+
+		"use --include to restore the snapshot in several parts", ui.FormatBytes(m.Bytes()), m.Files)
+}
+
+// roundEstimate rounds d to a precision suitable for its magnitude.
+func roundEstimate(d time.Duration) time.Duration {
+	if d < time.Minute {
+		return d.Round(10 * time.Millisecond)
+	}
+	return d.Round(time.Second)
+}
+
 func getXattrSelectFilter(opts RestoreOptions, printer restic.Printer) (func(xattrName string) bool, error) {
 	hasXattrExcludes := len(opts.ExcludeXattrPattern) > 0
 	hasXattrIncludes := len(opts.IncludeXattrPattern) > 0
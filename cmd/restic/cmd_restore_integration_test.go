@@ -2,8 +2,11 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -418,3 +421,73 @@ func TestRestoreDefaultLayout(t *testing.T) {
 	rtest.RemoveAll(t, filepath.Join(env.base, "repo"))
 	rtest.RemoveAll(t, target)
 }
+
+func TestRestoreWebhookFailure(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	rtest.OK(t, os.WriteFile(filepath.Join(env.testdata, "file"), []byte("content"), 0644))
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+
+	var events []string
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		var payload struct {
+			Event string `json:"event"`
+		}
+		rtest.OK(t, json.NewDecoder(r.Body).Decode(&payload))
+		events = append(events, payload.Event)
+	}))
+	defer srv.Close()
+
+	// the restore succeeds, but the command fails afterwards
+	opts := RestoreOptions{
+		Target:         filepath.Join(env.base, "restore"),
+		ExpectTreeHash: restic.NewRandomID().String(),
+		WebhookURL:     srv.URL,
+		WebhookEvents:  "completed,failed",
+	}
+	err := testRunRestoreAssumeFailure(t, "latest", opts, env.gopts)
+	rtest.Assert(t, err != nil, "expected the tree hash mismatch to fail the restore")
+	rtest.Equals(t, []string{"failed"}, events)
+}
+
+func TestRestoreList(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+	for _, name := range []string{"foo/file1", "foo/file2", "bar/file3"} {
+		p := filepath.Join(env.testdata, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(p), 0755))
+		rtest.OK(t, os.WriteFile(p, []byte("content of "+name), 0644))
+	}
+	testRunBackup(t, filepath.Dir(env.testdata), []string{filepath.Base(env.testdata)}, BackupOptions{}, env.gopts)
+
+	list := func(wantJSON bool) string {
+		buf, err := withCaptureStdout(t, env.gopts, func(ctx context.Context, gopts global.Options) error {
+			gopts.JSON = wantJSON
+			opts := RestoreOptions{List: true}
+			opts.Excludes = []string{"file2"}
+			return runRestore(ctx, opts, gopts, gopts.Term, []string{"latest"})
+		})
+		rtest.OK(t, err)
+		return buf.String()
+	}
+
+	output := list(false)
+	file1 := filepath.Join(string(filepath.Separator), filepath.Base(env.testdata), "foo", "file1")
+	rtest.Assert(t, strings.Contains(output, file1), "missing %v in output %q", file1, output)
+	rtest.Assert(t, !strings.Contains(output, "file2"), "excluded file in output %q", output)
+
+	var files []string
+	for _, line := range strings.Split(strings.TrimSpace(list(true)), "\n") {
+		var node lsNodeOutput
+		rtest.OK(t, json.Unmarshal([]byte(line), &node))
+		if node.Type == data.NodeTypeFile {
+			files = append(files, node.Name)
+			rtest.Equals(t, uint64(len("content of foo/file1")), *node.Size)
+		}
+	}
+	rtest.Equals(t, []string{"file3", "file1"}, files)
+}
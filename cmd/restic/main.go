@@ -20,6 +20,7 @@ import (
 	"github.com/restic/restic/internal/feature"
 	"github.com/restic/restic/internal/global"
 	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restorer"
 	"github.com/restic/restic/internal/ui/termstatus"
 )
 
@@ -205,6 +206,8 @@ func main() {
 		exitMessage = err.Error()
 	case errors.Is(err, repository.ErrNoKeyFound):
 		exitMessage = fmt.Sprintf("Fatal: %v", err)
+	case errors.As(err, new(*restorer.MaxDurationExceededError)):
+		exitMessage = fmt.Sprintf("Fatal: %v", err)
 	case err != nil:
 		exitMessage = fmt.Sprintf("%+v", err)
 
@@ -231,6 +234,8 @@ func main() {
 		exitCode = 11
 	case errors.Is(err, repository.ErrNoKeyFound):
 		exitCode = 12
+	case errors.As(err, new(*restorer.MaxDurationExceededError)):
+		exitCode = 13
 	case errors.Is(err, context.Canceled):
 		exitCode = 130
 	default:
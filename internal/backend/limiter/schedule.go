@@ -0,0 +1,165 @@
+package limiter
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule assigns rates to periods of the week. The first entry which
+// contains a point in time determines the rate at that time.
+type Schedule []ScheduleEntry
+
+// ScheduleEntry is a daily period with a rate in KiB/s, zero means unlimited.
+// Start and End are the offsets from midnight in local time. If End is not
+// after Start, the period continues until End on the following day.
+type ScheduleEntry struct {
+	// Days lists the days on which the period starts, empty means every day.
+	Days   []time.Weekday
+	Start  time.Duration
+	End    time.Duration
+	RateKb int
+}
+
+var weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseSchedule parses a comma separated list of entries of the form
+// "[days ]HH:MM-HH:MM=rate". The optional days are a weekday like "sat" or a
+// range of weekdays like "mon-fri". The rate is given in KiB/s, zero means
+// unlimited. For example, "mon-fri 08:00-18:00=1024, 18:00-08:00=0" limits
+// the rate to 1 MiB/s during business hours.
+func ParseSchedule(s string) (Schedule, error) {
+	var schedule Schedule
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		e, err := parseScheduleEntry(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule entry %q: %w", item, err)
+		}
+		schedule = append(schedule, e)
+	}
+	if len(schedule) == 0 {
+		return nil, fmt.Errorf("empty schedule")
+	}
+	return schedule, nil
+}
+
+func parseScheduleEntry(s string) (ScheduleEntry, error) {
+	var e ScheduleEntry
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+	case 2:
+		days, err := parseWeekdays(fields[0])
+		if err != nil {
+			return e, err
+		}
+		e.Days = days
+	default:
+		return e, fmt.Errorf("expected [days ]HH:MM-HH:MM=rate")
+	}
+
+	period, rate, ok := strings.Cut(fields[len(fields)-1], "=")
+	if !ok {
+		return e, fmt.Errorf("missing rate")
+	}
+	start, end, ok := strings.Cut(period, "-")
+	if !ok {
+		return e, fmt.Errorf("expected HH:MM-HH:MM, got %q", period)
+	}
+
+	var err error
+	if e.Start, err = parseTimeOfDay(start); err != nil {
+		return e, err
+	}
+	if e.End, err = parseTimeOfDay(end); err != nil {
+		return e, err
+	}
+	if e.Start == e.End {
+		return e, fmt.Errorf("period %v is empty", period)
+	}
+	if e.Start == 24*time.Hour {
+		return e, fmt.Errorf("period %v must not start at 24:00", period)
+	}
+
+	e.RateKb, err = strconv.Atoi(rate)
+	if err != nil || e.RateKb < 0 {
+		return e, fmt.Errorf("invalid rate %q, expected a number of KiB/s", rate)
+	}
+	return e, nil
+}
+
+func parseWeekdays(s string) ([]time.Weekday, error) {
+	first, last, isRange := strings.Cut(s, "-")
+	from, err := parseWeekday(first)
+	if err != nil {
+		return nil, err
+	}
+	to := from
+	if isRange {
+		if to, err = parseWeekday(last); err != nil {
+			return nil, err
+		}
+	}
+
+	// ranges like fri-mon wrap around the end of the week
+	days := []time.Weekday{from}
+	for d := from; d != to; {
+		d = (d + 1) % 7
+		days = append(days, d)
+	}
+	return days, nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for i, name := range weekdayNames {
+		if strings.EqualFold(s, name) {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid weekday %q, expected one of %v", s, strings.Join(weekdayNames, ", "))
+}
+
+// parseTimeOfDay parses HH:MM and returns the offset from midnight. 24:00 is
+// accepted to denote the end of the day.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	hours, minutes, ok := strings.Cut(s, ":")
+	h, errH := strconv.Atoi(hours)
+	m, errM := strconv.Atoi(minutes)
+	if !ok || errH != nil || errM != nil || len(minutes) != 2 || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Rate returns the rate in KiB/s of the first entry which contains t. It
+// returns false if no entry contains t.
+func (s Schedule) Rate(t time.Time) (rateKb int, ok bool) {
+	// use the wall clock, such that the periods are not shifted on days with
+	// a daylight saving time transition
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	for _, e := range s {
+		var contained bool
+		if e.Start < e.End {
+			contained = e.startsOn(today) && offset >= e.Start && offset < e.End
+		} else {
+			contained = (e.startsOn(today) && offset >= e.Start) || (e.startsOn(yesterday) && offset < e.End)
+		}
+		if contained {
+			return e.RateKb, true
+		}
+	}
+	return 0, false
+}
+
+func (e ScheduleEntry) startsOn(day time.Weekday) bool {
+	return len(e.Days) == 0 || slices.Contains(e.Days, day)
+}
@@ -0,0 +1,133 @@
+package limiter
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// unlimitedBurst is the burst of the download bucket while the schedule does
+// not limit the rate. consumeTokens waits for at most the burst at once.
+const unlimitedBurst = 1 << 20
+
+// scheduledLimiter limits the downloads with a rate which follows a schedule.
+// Uploads are limited like for the static limiter.
+type scheduledLimiter struct {
+	static    staticLimiter
+	schedule  Schedule
+	defaultKb int
+	now       func() time.Time
+
+	downstream *rate.Limiter
+
+	mu sync.Mutex
+	// currentKb is the rate of the downstream bucket, zero means unlimited
+	currentKb int
+	// recheck is the time after which the schedule must be evaluated again
+	recheck time.Time
+}
+
+// NewScheduledLimiter constructs a Limiter which limits downloads to the rate
+// of the schedule entry for the current time, or to l.DownloadKb if no entry
+// applies. Uploads are limited to l.UploadKb. The rate is updated while data
+// is transferred, such that a change of the rate also applies to the
+// transfers which are already running.
+func NewScheduledLimiter(l Limits, schedule Schedule) Limiter {
+	return newScheduledLimiter(l, schedule, time.Now)
+}
+
+func newScheduledLimiter(l Limits, schedule Schedule, now func() time.Time) *scheduledLimiter {
+	lim := &scheduledLimiter{
+		static:     NewStaticLimiter(Limits{UploadKb: l.UploadKb}).(staticLimiter),
+		schedule:   schedule,
+		defaultKb:  l.DownloadKb,
+		now:        now,
+		downstream: rate.NewLimiter(rate.Inf, unlimitedBurst),
+	}
+	lim.update()
+	return lim
+}
+
+// update sets the rate of the downstream bucket from the schedule. The
+// schedule has a resolution of one minute, so it is only evaluated again once
+// the current minute has passed.
+func (l *scheduledLimiter) update() {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Before(l.recheck) {
+		return
+	}
+	l.recheck = now.Truncate(time.Minute).Add(time.Minute)
+
+	rateKb, ok := l.schedule.Rate(now)
+	if !ok {
+		rateKb = l.defaultKb
+	}
+	if rateKb == l.currentKb {
+		return
+	}
+	l.currentKb = rateKb
+
+	if rateKb == 0 {
+		l.downstream.SetLimit(rate.Inf)
+		l.downstream.SetBurst(unlimitedBurst)
+		return
+	}
+	l.downstream.SetLimit(rate.Limit(toByteRate(rateKb)))
+	l.downstream.SetBurst(int(toByteRate(rateKb)))
+}
+
+func (l *scheduledLimiter) Upstream(r io.Reader) io.Reader {
+	return l.static.Upstream(r)
+}
+
+func (l *scheduledLimiter) UpstreamWriter(w io.Writer) io.Writer {
+	return l.static.UpstreamWriter(w)
+}
+
+func (l *scheduledLimiter) Downstream(r io.Reader) io.Reader {
+	return &scheduledReader{r, l}
+}
+
+func (l *scheduledLimiter) DownstreamWriter(w io.Writer) io.Writer {
+	return &scheduledWriter{w, l}
+}
+
+// Transport returns an HTTP transport limited with the limiter l.
+func (l *scheduledLimiter) Transport(rt http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		return limitRoundTrip(l, rt, req)
+	})
+}
+
+type scheduledReader struct {
+	reader  io.Reader
+	limiter *scheduledLimiter
+}
+
+func (r *scheduledReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.limiter.update()
+	if err := consumeTokens(n, r.limiter.downstream); err != nil {
+		return n, err
+	}
+	return n, err
+}
+
+type scheduledWriter struct {
+	writer  io.Writer
+	limiter *scheduledLimiter
+}
+
+func (w *scheduledWriter) Write(buf []byte) (int, error) {
+	w.limiter.update()
+	if err := consumeTokens(len(buf), w.limiter.downstream); err != nil {
+		return 0, err
+	}
+	return w.writer.Write(buf)
+}
@@ -0,0 +1,124 @@
+package limiter
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/test"
+	"golang.org/x/time/rate"
+)
+
+func TestParseSchedule(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		schedule Schedule
+	}{
+		{"08:00-18:00=512", Schedule{{Start: 8 * time.Hour, End: 18 * time.Hour, RateKb: 512}}},
+		{"mon-fri 08:30-18:00=1024, 18:00-08:30=0", Schedule{
+			{Days: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+				Start: 8*time.Hour + 30*time.Minute, End: 18 * time.Hour, RateKb: 1024},
+			{Start: 18 * time.Hour, End: 8*time.Hour + 30*time.Minute, RateKb: 0},
+		}},
+		{"Sat 00:00-24:00=100", Schedule{{Days: []time.Weekday{time.Saturday}, End: 24 * time.Hour, RateKb: 100}}},
+		{"fri-mon 22:00-06:00=10", Schedule{
+			{Days: []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday},
+				Start: 22 * time.Hour, End: 6 * time.Hour, RateKb: 10},
+		}},
+	} {
+		schedule, err := ParseSchedule(tc.input)
+		test.OK(t, err)
+		test.Equals(t, tc.schedule, schedule)
+	}
+
+	for _, input := range []string{
+		"",
+		",",
+		"08:00-18:00",
+		"08:00=100",
+		"8-18=100",
+		"08:00-08:00=100",
+		"24:00-08:00=100",
+		"08:00-25:00=100",
+		"08:60-18:00=100",
+		"08:00-18:00=-1",
+		"08:00-18:00=1k",
+		"weekdays 08:00-18:00=100",
+		"mon - fri 08:00-18:00=100",
+	} {
+		_, err := ParseSchedule(input)
+		test.Assert(t, err != nil, "expected an error for %q", input)
+	}
+}
+
+func TestScheduleRate(t *testing.T) {
+	schedule, err := ParseSchedule("mon-fri 08:00-18:00=1024, sat 22:00-02:00=10, 12:00-13:00=100")
+	test.OK(t, err)
+
+	for _, tc := range []struct {
+		time   string
+		rateKb int
+		ok     bool
+	}{
+		// 2024-01-01 is a Monday
+		{"2024-01-01 07:59", 0, false},
+		{"2024-01-01 08:00", 1024, true},
+		{"2024-01-01 12:30", 1024, true},
+		{"2024-01-01 18:00", 0, false},
+		{"2024-01-06 12:30", 100, true},
+		{"2024-01-06 21:59", 0, false},
+		{"2024-01-06 22:00", 10, true},
+		{"2024-01-07 01:59", 10, true},
+		{"2024-01-07 02:00", 0, false},
+		{"2024-01-07 22:00", 0, false},
+	} {
+		now, err := time.ParseInLocation("2006-01-02 15:04", tc.time, time.Local)
+		test.OK(t, err)
+		rateKb, ok := schedule.Rate(now)
+		test.Equals(t, tc.ok, ok, fmt.Sprintf("wrong result for %v", tc.time))
+		test.Equals(t, tc.rateKb, rateKb, fmt.Sprintf("wrong rate for %v", tc.time))
+	}
+}
+
+func TestScheduledLimiterUpdate(t *testing.T) {
+	schedule, err := ParseSchedule("08:00-18:00=1024, 18:00-20:00=0")
+	test.OK(t, err)
+
+	now := time.Date(2024, 1, 1, 7, 59, 30, 0, time.Local)
+	lim := newScheduledLimiter(Limits{DownloadKb: 42}, schedule, func() time.Time { return now })
+	test.Equals(t, rate.Limit(42*1024), lim.downstream.Limit())
+
+	// reads which are already running pick up the new rate
+	rd := lim.Downstream(bytes.NewReader(make([]byte, 100)))
+	now = now.Add(time.Minute)
+	_, err = rd.Read(make([]byte, 10))
+	test.OK(t, err)
+	test.Equals(t, rate.Limit(1024*1024), lim.downstream.Limit())
+	test.Equals(t, 1024*1024, lim.downstream.Burst())
+
+	now = time.Date(2024, 1, 1, 18, 0, 0, 0, time.Local)
+	_, err = rd.Read(make([]byte, 10))
+	test.OK(t, err)
+	test.Equals(t, rate.Inf, lim.downstream.Limit())
+
+	now = time.Date(2024, 1, 1, 20, 0, 0, 0, time.Local)
+	_, err = lim.DownstreamWriter(new(bytes.Buffer)).Write(make([]byte, 10))
+	test.OK(t, err)
+	test.Equals(t, rate.Limit(42*1024), lim.downstream.Limit())
+}
+
+func TestScheduledLimiterUpload(t *testing.T) {
+	schedule, err := ParseSchedule("00:00-24:00=0")
+	test.OK(t, err)
+
+	reader := bytes.NewReader([]byte{})
+	writer := new(bytes.Buffer)
+	lim := NewScheduledLimiter(Limits{}, schedule)
+	test.Assert(t, lim.Upstream(reader) == reader, "upstream reader limited without a limit")
+	test.Assert(t, lim.UpstreamWriter(writer) == writer, "upstream writer limited without a limit")
+
+	lim = NewScheduledLimiter(Limits{UploadKb: 42}, schedule)
+	test.Assert(t, lim.Upstream(reader) != reader, "upstream reader not limited")
+	test.Assert(t, lim.UpstreamWriter(writer) != writer, "upstream writer not limited")
+}
@@ -87,6 +87,18 @@ func (c *Cache) get(id restic.ID) ([]byte, bool) {
 	return blob, ok
 }
 
+// Get returns the cached content of blob id. The content must not be
+// modified.
+func (c *Cache) Get(id restic.ID) ([]byte, bool) {
+	return c.get(id)
+}
+
+// Add adds blob with the given id to c. The content must not be modified
+// afterwards. Blobs which are larger than the cache are ignored.
+func (c *Cache) Add(id restic.ID, blob []byte) {
+	c.add(id, blob)
+}
+
 func (c *Cache) GetOrCompute(id restic.ID, compute func() ([]byte, error)) ([]byte, error) {
 	// check if already cached
 	blob, ok := c.get(id)
@@ -46,13 +46,27 @@ const (
 	TypeFileAttributes GenericAttributeType = "windows.file_attributes"
 	// TypeSecurityDescriptor is the GenericAttributeType used for storing security descriptors including owner, group, discretionary access control list (DACL), system access control list (SACL)) for windows files within the generic attributes map.
 	TypeSecurityDescriptor GenericAttributeType = "windows.security_descriptor"
+	// TypeShortName is the GenericAttributeType used for storing the 8.3 short name of windows files within the generic attributes map.
+	TypeShortName GenericAttributeType = "windows.short_name"
+
+	// Below are the attributes for macOS and FreeBSD.
+
+	// TypeDarwinFileFlags is the GenericAttributeType used for storing the file flags of macOS files within the generic attributes map.
+	TypeDarwinFileFlags GenericAttributeType = "darwin.flags"
+	// TypeFreeBSDFileFlags is the GenericAttributeType used for storing the file flags of FreeBSD files within the generic attributes map.
+	TypeFreeBSDFileFlags GenericAttributeType = "freebsd.flags"
+	// TypeDarwinCreationTime is the GenericAttributeType used for storing the creation time of macOS files within the generic attributes map.
+	TypeDarwinCreationTime GenericAttributeType = "darwin.creation_time"
+	// TypeFreeBSDCreationTime is the GenericAttributeType used for storing the creation time of FreeBSD files within the generic attributes map.
+	TypeFreeBSDCreationTime GenericAttributeType = "freebsd.creation_time"
 
 	// Generic Attributes for other OS types should be defined here.
 )
 
 // init is called when the package is initialized. Any new GenericAttributeTypes being created must be added here as well.
 func init() {
-	storeGenericAttributeType(TypeCreationTime, TypeFileAttributes, TypeSecurityDescriptor)
+	storeGenericAttributeType(TypeCreationTime, TypeFileAttributes, TypeSecurityDescriptor, TypeShortName,
+		TypeDarwinFileFlags, TypeFreeBSDFileFlags, TypeDarwinCreationTime, TypeFreeBSDCreationTime)
 }
 
 // genericAttributesForOS maintains a map of known genericAttributesForOS to the OSType
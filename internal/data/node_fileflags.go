@@ -0,0 +1,26 @@
+//go:build darwin || freebsd
+
+package data
+
+import (
+	"encoding/json"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+// FileFlagsAttributes are the genericAttributes for macOS and FreeBSD
+type FileFlagsAttributes struct {
+	// Flags is used for storing the file flags as set by chflags(2), for
+	// example the user immutable or hidden flag.
+	Flags *uint32 `generic:"flags"`
+	// CreationTime is used for storing the creation time (birth time) of
+	// the file.
+	CreationTime *time.Time `generic:"creation_time"`
+}
+
+// FileFlagsAttrsToGenericAttributes converts the FileFlagsAttributes to a generic attributes map using reflection
+func FileFlagsAttrsToGenericAttributes(fileFlagsAttributes FileFlagsAttributes) (attrs map[GenericAttributeType]json.RawMessage, err error) {
+	fileFlagsAttributesValue := reflect.ValueOf(fileFlagsAttributes)
+	return OSAttrsToGenericAttributes(reflect.TypeOf(fileFlagsAttributes), &fileFlagsAttributesValue, runtime.GOOS)
+}
@@ -16,6 +16,9 @@ type WindowsAttributes struct {
 	// SecurityDescriptor is used for storing security descriptors which includes
 	// owner, group, discretionary access control list (DACL), system access control list (SACL)
 	SecurityDescriptor *[]byte `generic:"security_descriptor"`
+	// ShortName is used for storing the 8.3 short name of windows files. It is
+	// only set if the file has a short name which differs from its name.
+	ShortName *string `generic:"short_name"`
 }
 
 // WindowsAttrsToGenericAttributes converts the WindowsAttributes to a generic attributes map using reflection
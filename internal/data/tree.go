@@ -289,12 +289,23 @@ func (builder *TreeJSONBuilder) Count() int {
 }
 
 func FindTreeDirectory(ctx context.Context, repo restic.BlobLoader, id *restic.ID, dir string) (*restic.ID, error) {
+	node, err := FindTreeDirectoryNode(ctx, repo, id, dir)
+	if err != nil || node == nil {
+		return id, err
+	}
+	return node.Subtree, nil
+}
+
+// FindTreeDirectoryNode returns the node of the directory dir within the tree
+// id. It returns nil for the root directory, which has no node.
+func FindTreeDirectoryNode(ctx context.Context, repo restic.BlobLoader, id *restic.ID, dir string) (*Node, error) {
 	if id == nil {
 		return nil, errors.New("tree id is null")
 	}
 
 	dirs := strings.Split(path.Clean(dir), "/")
 	subfolder := ""
+	var dirNode *Node
 
 	for _, name := range dirs {
 		if name == "" || name == "." {
@@ -321,8 +332,9 @@ func FindTreeDirectory(ctx context.Context, repo restic.BlobLoader, id *restic.I
 			return nil, fmt.Errorf("path %s: not a directory", subfolder)
 		}
 		id = node.Subtree
+		dirNode = node
 	}
-	return id, nil
+	return dirNode, nil
 }
 
 type peekableNodeIterator struct {
@@ -402,6 +402,21 @@ func TestFindTreeDirectory(t *testing.T) {
 	rtest.Assert(t, err != nil, "missing error on null tree id")
 }
 
+func TestFindTreeDirectoryNode(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn := data.TestCreateSnapshot(t, repo, parseTimeUTC("2017-07-07 07:07:08"), 3)
+
+	node, err := data.FindTreeDirectoryNode(context.TODO(), repo, sn.Tree, "/")
+	rtest.OK(t, err)
+	rtest.Assert(t, node == nil, "unexpected node %v for the root directory", node)
+
+	node, err = data.FindTreeDirectoryNode(context.TODO(), repo, sn.Tree, "dir-7/dir-5")
+	rtest.OK(t, err)
+	rtest.Equals(t, "dir-5", node.Name)
+	rtest.Equals(t, data.NodeTypeDir, node.Type)
+	rtest.Equals(t, restic.TestParseID("f05534d2673964de698860e5069da1ee3c198acf21c187975c6feb49feb8e9c9"), *node.Subtree)
+}
+
 func TestFindTreeDirectoryWindowsBackslashHint(t *testing.T) {
 	repo := repository.TestRepository(t)
 	sn := data.TestCreateSnapshot(t, repo, parseTimeUTC("2017-07-07 07:07:08"), 1)
@@ -19,6 +19,8 @@ type Dumper struct {
 	format string
 	repo   restic.Loader
 	w      io.Writer
+	// archive names of the files by their content, see DeduplicateContent
+	contents map[string]string
 }
 
 func New(format string, repo restic.Loader, w io.Writer) *Dumper {
@@ -30,6 +32,15 @@ func New(format string, repo restic.Loader, w io.Writer) *Dumper {
 	}
 }
 
+// DeduplicateContent stores the content of files with identical content only
+// once in tar archives. Later files are stored as hard links to the first one,
+// which therefore determines the metadata of all of them when extracting the
+// hard links. Empty files are not deduplicated. It must be called before
+// DumpTree and is ignored for zip archives.
+func (d *Dumper) DeduplicateContent() {
+	d.contents = make(map[string]string)
+}
+
 func (d *Dumper) DumpTree(ctx context.Context, tree data.TreeNodeIterator, rootPath string) error {
 	wg, ctx := errgroup.WithContext(ctx)
 
@@ -10,6 +10,7 @@ import (
 	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
 )
 
 func (d *Dumper) dumpTar(ctx context.Context, ch <-chan *data.Node) (err error) {
@@ -81,6 +82,16 @@ func (d *Dumper) dumpNodeTar(ctx context.Context, node *data.Node, w *tar.Writer
 
 	if node.Type == data.NodeTypeFile {
 		header.Typeflag = tar.TypeReg
+		if name, ok := d.dedupContent(node, header.Name); ok {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = name
+			header.Size = 0
+			err = w.WriteHeader(header)
+			if err != nil {
+				return fmt.Errorf("writing header for %q: %w", node.Path, err)
+			}
+			return nil
+		}
 	}
 
 	if node.Type == data.NodeTypeSymlink {
@@ -100,6 +111,24 @@ func (d *Dumper) dumpNodeTar(ctx context.Context, node *data.Node, w *tar.Writer
 	return d.writeNode(ctx, w, node)
 }
 
+// dedupContent returns the archive name of the first file with the same
+// content as node, see DeduplicateContent. Otherwise, node is recorded as the
+// first file with its content under the given name.
+func (d *Dumper) dedupContent(node *data.Node, name string) (string, bool) {
+	if d.contents == nil || node.Size == 0 {
+		return "", false
+	}
+	key := make([]byte, 0, len(node.Content)*len(restic.ID{}))
+	for _, id := range node.Content {
+		key = append(key, id[:]...)
+	}
+	if first, ok := d.contents[string(key)]; ok {
+		return first, true
+	}
+	d.contents[string(key)] = name
+	return "", false
+}
+
 func parseXattrs(xattrs []data.ExtendedAttribute) map[string]string {
 	tmpMap := make(map[string]string)
 
@@ -13,7 +13,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/archiver"
 	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/fs"
 	rtest "github.com/restic/restic/internal/test"
 )
 
@@ -141,3 +143,49 @@ func TestFieldTooLong(t *testing.T) {
 	rtest.Assert(t, strings.Contains(err.Error(), node.Path),
 		"no filename in %q", err)
 }
+
+func TestWriteTarDeduplicateContent(t *testing.T) {
+	ctx := context.Background()
+	tmpdir, repo, _ := prepareTempdirRepoSrc(t, archiver.TestDir{
+		"file1": archiver.TestFile{Content: "string"},
+		"file2": archiver.TestFile{Content: "other"},
+		"sub": archiver.TestDir{
+			"file3": archiver.TestFile{Content: "string"},
+		},
+		"empty1": archiver.TestFile{Content: ""},
+		"empty2": archiver.TestFile{Content: ""},
+	})
+	arch := archiver.New(repo, fs.Track{FS: fs.NewLocal()}, archiver.Options{})
+	back := rtest.Chdir(t, tmpdir)
+	defer back()
+	sn, _, _, err := arch.Snapshot(ctx, []string{"."}, archiver.SnapshotOptions{})
+	rtest.OK(t, err)
+	tree, err := data.LoadTree(ctx, repo, *sn.Tree)
+	rtest.OK(t, err)
+
+	dst := &bytes.Buffer{}
+	d := New("tar", repo, dst)
+	d.DeduplicateContent()
+	rtest.OK(t, d.DumpTree(ctx, tree, "/"))
+
+	links := make(map[string]string)
+	contents := make(map[string]string)
+	tr := tar.NewReader(dst)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		rtest.OK(t, err)
+		switch hdr.Typeflag {
+		case tar.TypeLink:
+			links[hdr.Name] = hdr.Linkname
+		case tar.TypeReg:
+			buf, err := io.ReadAll(tr)
+			rtest.OK(t, err)
+			contents[hdr.Name] = string(buf)
+		}
+	}
+	rtest.Equals(t, map[string]string{"sub/file3": "file1"}, links)
+	rtest.Equals(t, map[string]string{"empty1": "", "empty2": "", "file1": "string", "file2": "other"}, contents)
+}
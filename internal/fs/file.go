@@ -33,6 +33,13 @@ func Link(oldname, newname string) error {
 	return os.Link(fixpath(oldname), fixpath(newname))
 }
 
+// Rename renames (moves) oldpath to newpath. If newpath already exists and
+// is not a directory, Rename replaces it.
+// If there is an error, it will be of type *LinkError.
+func Rename(oldpath, newpath string) error {
+	return os.Rename(fixpath(oldpath), fixpath(newpath))
+}
+
 // Lstat returns the FileInfo structure describing the named file.
 // If the file is a symbolic link, the returned FileInfo
 // describes the symbolic link.  Lstat makes no attempt to follow the link.
@@ -50,6 +57,11 @@ func OpenFile(name string, flag int, perm os.FileMode) (*os.File, error) {
 	return os.OpenFile(fixpath(name), sanitizeFlags(flag), perm)
 }
 
+// OpenFileInRoot is like OpenFile, but opens the file name relative to root.
+func OpenFileInRoot(root *os.Root, name string, flag int, perm os.FileMode) (*os.File, error) {
+	return root.OpenFile(name, sanitizeFlags(flag), perm)
+}
+
 // IsAccessDenied checks if the error is due to permission error.
 func IsAccessDenied(err error) bool {
 	return os.IsPermission(err)
@@ -64,6 +76,28 @@ func ResetPermissions(path string) error {
 	return nil
 }
 
+// SetWritePermission removes all write permissions of the file or directory
+// at path if writable is false, or adds the write permission for the owner
+// otherwise. Symlinks are left as is, as their permissions cannot be changed
+// on most systems.
+func SetWritePermission(path string, writable bool) error {
+	fi, err := os.Lstat(fixpath(path))
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+	mode := fi.Mode() &^ 0222
+	if writable {
+		mode = fi.Mode() | 0200
+	}
+	if mode == fi.Mode() {
+		return nil
+	}
+	return os.Chmod(fixpath(path), mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+}
+
 // Readdirnames returns a list of file in a directory. Flags are passed to fs.OpenFile.
 // O_RDONLY and O_DIRECTORY are implied.
 func Readdirnames(filesystem FS, dir string, flags int) ([]string, error) {
@@ -0,0 +1,74 @@
+package fs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IDMapRange maps Count consecutive IDs starting at From to the IDs starting
+// at To.
+type IDMapRange struct {
+	From  uint32
+	To    uint32
+	Count uint32
+}
+
+// ParseIDMapRange parses a range in the format "from:to:count".
+func ParseIDMapRange(s string) (IDMapRange, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return IDMapRange{}, fmt.Errorf("invalid id map range %q, must be from:to:count", s)
+	}
+	var values [3]uint32
+	for i, part := range parts {
+		v, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return IDMapRange{}, fmt.Errorf("invalid id map range %q: %w", s, err)
+		}
+		values[i] = uint32(v)
+	}
+	r := IDMapRange{From: values[0], To: values[1], Count: values[2]}
+	if r.Count == 0 || uint64(r.From)+uint64(r.Count) > 1<<32 || uint64(r.To)+uint64(r.Count) > 1<<32 {
+		return IDMapRange{}, fmt.Errorf("invalid id map range %q, count is zero or too large", s)
+	}
+	return r, nil
+}
+
+// IDMap translates the user and group IDs stored in a snapshot before they are
+// applied to restored items, like the idmap of an idmapped mount or of a user
+// namespace. IDs which are not contained in any range cannot be represented,
+// the corresponding owner is then left unchanged. An empty list of ranges
+// applies the IDs unchanged, as does a nil IDMap.
+type IDMap struct {
+	UIDs []IDMapRange
+	GIDs []IDMapRange
+}
+
+func mapID(ranges []IDMapRange, id uint32) (uint32, bool) {
+	if len(ranges) == 0 {
+		return id, true
+	}
+	for _, r := range ranges {
+		if id >= r.From && uint64(id) < uint64(r.From)+uint64(r.Count) {
+			return r.To + (id - r.From), true
+		}
+	}
+	return 0, false
+}
+
+// MapUID returns the translated user ID, or false if uid is not mapped.
+func (m *IDMap) MapUID(uid uint32) (uint32, bool) {
+	if m == nil {
+		return uid, true
+	}
+	return mapID(m.UIDs, uid)
+}
+
+// MapGID returns the translated group ID, or false if gid is not mapped.
+func (m *IDMap) MapGID(gid uint32) (uint32, bool) {
+	if m == nil {
+		return gid, true
+	}
+	return mapID(m.GIDs, gid)
+}
@@ -0,0 +1,47 @@
+package fs
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseIDMapRange(t *testing.T) {
+	r, err := ParseIDMapRange("100000:0:65536")
+	rtest.OK(t, err)
+	rtest.Equals(t, IDMapRange{From: 100000, To: 0, Count: 65536}, r)
+
+	for _, s := range []string{"", "1:2", "1:2:3:4", "a:0:1", "0:0:0", "-1:0:1", "4294967295:0:2", "0:4294967295:2"} {
+		_, err := ParseIDMapRange(s)
+		rtest.Assert(t, err != nil, "expected error for %q", s)
+	}
+}
+
+func TestIDMap(t *testing.T) {
+	// like the uid_map of a container whose ids start at 100000 on the host
+	idMap := &IDMap{
+		UIDs: []IDMapRange{{From: 100000, To: 0, Count: 65536}, {From: 1000, To: 70000, Count: 1}},
+	}
+	for _, test := range []struct {
+		id, mapped uint32
+		ok         bool
+	}{
+		{100000, 0, true},
+		{101000, 1000, true},
+		{165535, 65535, true},
+		{165536, 0, false},
+		{1000, 70000, true},
+		{0, 0, false},
+	} {
+		mapped, ok := idMap.MapUID(test.id)
+		rtest.Equals(t, test.ok, ok)
+		rtest.Equals(t, test.mapped, mapped)
+	}
+
+	// without ranges, the ids are applied unchanged
+	gid, ok := idMap.MapGID(1234)
+	rtest.Assert(t, ok && gid == 1234, "unexpected gid %v %v", gid, ok)
+	var nilMap *IDMap
+	uid, ok := nilMap.MapUID(1234)
+	rtest.Assert(t, ok && uid == 1234, "unexpected uid %v %v", uid, ok)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/user"
+	"runtime"
 	"strconv"
 	"sync"
 	"syscall"
@@ -36,14 +37,15 @@ func buildBasicNode(path string, fi *ExtendedFileInfo) *data.Node {
 		ModTime: fi.ModTime,
 	}
 
-	node.Type = nodeTypeFromFileInfo(fi.Mode)
+	node.Type = NodeTypeFromFileMode(fi.Mode)
 	if node.Type == data.NodeTypeFile {
 		node.Size = uint64(fi.Size)
 	}
 	return node
 }
 
-func nodeTypeFromFileInfo(mode os.FileMode) data.NodeType {
+// NodeTypeFromFileMode returns the node type for the type bits of mode.
+func NodeTypeFromFileMode(mode os.FileMode) data.NodeType {
 	switch mode & os.ModeType {
 	case 0:
 		return data.NodeTypeFile
@@ -239,7 +241,7 @@ func NodeCreateAt(node *data.Node, path string) (err error) {
 	case data.NodeTypeFifo:
 		err = nodeCreateFifoAt(path)
 	case data.NodeTypeSocket:
-		err = nil
+		err = nodeCreateSocketAt(path)
 	default:
 		err = errors.Errorf("filetype %q not implemented", node.Type)
 	}
@@ -289,13 +291,30 @@ func nodeCreateFifoAt(path string) error {
 	return mkfifo(path, 0600)
 }
 
+// ErrSocketUnsupported is returned by NodeCreateAt if socket files cannot be
+// created on the current platform or filesystem.
+var ErrSocketUnsupported = errors.New("recreating socket files is not supported on this platform")
+
+// nodeCreateSocketAt creates a socket file, which is not bound to any process.
+func nodeCreateSocketAt(path string) error {
+	if runtime.GOOS == "windows" {
+		return ErrSocketUnsupported
+	}
+	err := mknod(path, syscall.S_IFSOCK|0600, 0)
+	if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EOPNOTSUPP) {
+		return fmt.Errorf("%w: %w", ErrSocketUnsupported, err)
+	}
+	return err
+}
+
 func mkfifo(path string, mode uint32) (err error) {
 	return mknod(path, mode|syscall.S_IFIFO, 0)
 }
 
-// NodeRestoreMetadata restores node metadata
-func NodeRestoreMetadata(node *data.Node, path string, warn func(msg string), xattrSelectFilter func(xattrName string) bool, ownershipByName bool) error {
-	err := nodeRestoreMetadata(node, path, warn, xattrSelectFilter, ownershipByName)
+// NodeRestoreMetadata restores node metadata. The ownership is translated
+// using idMap, which may be nil.
+func NodeRestoreMetadata(node *data.Node, path string, warn func(msg string), xattrSelectFilter func(xattrName string) bool, ownershipByName bool, idMap *IDMap) error {
+	err := nodeRestoreMetadata(node, path, warn, xattrSelectFilter, ownershipByName, idMap)
 	if err != nil {
 		// It is common to have permission errors for folders like /home
 		// unless you're running as root, so ignore those.
@@ -310,10 +329,10 @@ func NodeRestoreMetadata(node *data.Node, path string, warn func(msg string), xa
 	return err
 }
 
-func nodeRestoreMetadata(node *data.Node, path string, warn func(msg string), xattrSelectFilter func(xattrName string) bool, ownershipByName bool) error {
+func nodeRestoreMetadata(node *data.Node, path string, warn func(msg string), xattrSelectFilter func(xattrName string) bool, ownershipByName bool, idMap *IDMap) error {
 	var firsterr error
 
-	if err := lchown(path, node, ownershipByName); err != nil {
+	if err := lchown(path, node, ownershipByName, idMap); err != nil {
 		firsterr = errors.WithStack(err)
 	}
 
@@ -331,6 +350,15 @@ func nodeRestoreMetadata(node *data.Node, path string, warn func(msg string), xa
 		}
 	}
 
+	// must precede restoring the timestamps, which resets the modification
+	// time on FreeBSD
+	if err := nodeRestoreCreationTime(node, path); err != nil {
+		debug.Log("error restoring creation time for %v: %v", path, err)
+		if firsterr == nil {
+			firsterr = err
+		}
+	}
+
 	if err := nodeRestoreTimestamps(node, path); err != nil {
 		debug.Log("error restoring timestamps for %v: %v", path, err)
 		if firsterr == nil {
@@ -349,9 +377,32 @@ func nodeRestoreMetadata(node *data.Node, path string, warn func(msg string), xa
 		}
 	}
 
+	// Flags like the immutable flag prevent all further modifications, thus
+	// they must be restored last.
+	if err := nodeRestoreFileFlags(node, path); err != nil {
+		debug.Log("error restoring file flags for %v: %v", path, err)
+		var downgraded *FileFlagsDowngradedError
+		// NodeRestoreMetadata ignores permission errors of non-root users,
+		// thus report the downgrade instead
+		if firsterr == nil || (errors.As(err, &downgraded) && errors.Is(firsterr, os.ErrPermission)) {
+			firsterr = err
+		}
+	}
+
 	return firsterr
 }
 
+// FileFlagsDowngradedError is returned by NodeRestoreMetadata if the system
+// file flags of a node could not be restored, as this requires root
+// privileges. All other metadata, including the user file flags, was restored.
+type FileFlagsDowngradedError struct {
+	Flags uint32
+}
+
+func (e *FileFlagsDowngradedError) Error() string {
+	return fmt.Sprintf("system file flags %#x were not restored", e.Flags)
+}
+
 func nodeRestoreTimestamps(node *data.Node, path string) error {
 	atime := node.AccessTime.UnixNano()
 	mtime := node.ModTime.UnixNano()
@@ -0,0 +1,111 @@
+//go:build darwin || freebsd
+
+package fs
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/unix"
+)
+
+// systemFileFlags are the flags which can only be changed by root.
+const systemFileFlags = 0xffff0000
+
+// nodeRestoreGenericAttributes only checks for unknown generic attributes. The
+// file flags are restored by nodeRestoreFileFlags.
+func nodeRestoreGenericAttributes(node *data.Node, _ string, warn func(msg string)) error {
+	if len(node.GenericAttributes) == 0 {
+		return nil
+	}
+	_, unknownAttribs, err := genericAttributesToFileFlagsAttrs(node.GenericAttributes)
+	if err != nil {
+		return err
+	}
+	data.HandleUnknownGenericAttributesFound(unknownAttribs, warn)
+	return nil
+}
+
+// genericAttributesToFileFlagsAttrs converts the generic attributes map to a FileFlagsAttributes and also returns a string of unknown attributes that it could not convert.
+func genericAttributesToFileFlagsAttrs(attrs map[data.GenericAttributeType]json.RawMessage) (fileFlagsAttributes data.FileFlagsAttributes, unknownAttribs []data.GenericAttributeType, err error) {
+	fileFlagsAttributesValue := reflect.ValueOf(&fileFlagsAttributes).Elem()
+	unknownAttribs, err = data.GenericAttributesToOSAttrs(attrs, reflect.TypeOf(fileFlagsAttributes), &fileFlagsAttributesValue, runtime.GOOS)
+	return fileFlagsAttributes, unknownAttribs, err
+}
+
+// nodeFillGenericAttributes fills in the file flags and the creation time.
+// Flags which are managed by the kernel are not stored.
+func nodeFillGenericAttributes(node *data.Node, _ string, stat *ExtendedFileInfo) error {
+	s, ok := stat.sys.(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	var attrs data.FileFlagsAttributes
+	if flags := s.Flags &^ ignoredFileFlags; flags != 0 {
+		attrs.Flags = &flags
+	}
+	// filesystems without creation times report zero or -1
+	if s.Birthtimespec.Sec > 0 {
+		btime := time.Unix(s.Birthtimespec.Unix())
+		attrs.CreationTime = &btime
+	}
+	if attrs.Flags == nil && attrs.CreationTime == nil {
+		return nil
+	}
+
+	var err error
+	node.GenericAttributes, err = data.FileFlagsAttrsToGenericAttributes(attrs)
+	return err
+}
+
+// nodeRestoreCreationTime sets the creation time of node. Filesystems which do
+// not support setting it are skipped.
+func nodeRestoreCreationTime(node *data.Node, path string) error {
+	if len(node.GenericAttributes) == 0 {
+		return nil
+	}
+	attrs, _, err := genericAttributesToFileFlagsAttrs(node.GenericAttributes)
+	if err != nil || attrs.CreationTime == nil {
+		return err
+	}
+
+	err = setCreationTime(path, node, *attrs.CreationTime)
+	if errors.Is(err, unix.ENOTSUP) || errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EINVAL) {
+		debug.Log("filesystem does not support setting the creation time of %v: %v", path, err)
+		return nil
+	}
+	return err
+}
+
+// nodeRestoreFileFlags sets the file flags of node using chflags(2). Without
+// root privileges, only the user flags are restored and a
+// FileFlagsDowngradedError is returned if the node also has system flags.
+// Symlinks are skipped.
+func nodeRestoreFileFlags(node *data.Node, path string) error {
+	if len(node.GenericAttributes) == 0 || node.Type == data.NodeTypeSymlink {
+		return nil
+	}
+	attrs, _, err := genericAttributesToFileFlagsAttrs(node.GenericAttributes)
+	if err != nil || attrs.Flags == nil {
+		return err
+	}
+
+	flags := *attrs.Flags
+	err = unix.Chflags(path, int(flags))
+	if errors.Is(err, unix.EPERM) && flags&systemFileFlags != 0 {
+		if err = unix.Chflags(path, int(flags&^systemFileFlags)); err == nil {
+			return &FileFlagsDowngradedError{Flags: flags & systemFileFlags}
+		}
+	}
+	if err != nil {
+		return &os.PathError{Op: "chflags", Path: path, Err: err}
+	}
+	return nil
+}
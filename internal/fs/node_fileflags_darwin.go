@@ -0,0 +1,25 @@
+package fs
+
+import (
+	"os"
+	"time"
+	"unsafe"
+
+	"github.com/restic/restic/internal/data"
+	"golang.org/x/sys/unix"
+)
+
+// ignoredFileFlags are managed by the kernel and cannot be restored.
+const ignoredFileFlags = unix.UF_COMPRESSED | unix.UF_TRACKED | unix.UF_DATAVAULT |
+	unix.SF_RESTRICTED | unix.SF_FIRMLINK | unix.SF_DATALESS | unix.SF_SYNTHETIC
+
+// setCreationTime sets the creation time of path using setattrlist(2).
+func setCreationTime(path string, _ *data.Node, btime time.Time) error {
+	attrs := unix.Attrlist{Bitmapcount: unix.ATTR_BIT_MAP_COUNT, Commonattr: unix.ATTR_CMN_CRTIME}
+	ts := unix.NsecToTimespec(btime.UnixNano())
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&ts)), unsafe.Sizeof(ts))
+	if err := unix.Setattrlist(path, &attrs, buf, unix.FSOPT_NOFOLLOW); err != nil {
+		return &os.PathError{Op: "setattrlist", Path: path, Err: err}
+	}
+	return nil
+}
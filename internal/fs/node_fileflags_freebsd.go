@@ -0,0 +1,22 @@
+package fs
+
+import (
+	"os"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+)
+
+// ignoredFileFlags are managed by the kernel and cannot be restored. This is
+// SF_SNAPSHOT, which marks UFS snapshot files.
+const ignoredFileFlags = 0x00200000
+
+// setCreationTime sets the creation time of path. FreeBSD has no call to set
+// it directly, but moves it back when setting an earlier modification time.
+// The modification time is restored afterwards by nodeRestoreTimestamps.
+func setCreationTime(path string, node *data.Node, btime time.Time) error {
+	if err := utimesNano(path, node.AccessTime.UnixNano(), btime.UnixNano(), node.Type); err != nil {
+		return &os.PathError{Op: "utimes", Path: path, Err: err}
+	}
+	return nil
+}
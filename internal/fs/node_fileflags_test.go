@@ -0,0 +1,135 @@
+//go:build darwin || freebsd
+
+package fs
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sys/unix"
+)
+
+// flag values which are shared by macOS and FreeBSD
+const (
+	flagUserNoDump    = 0x1
+	flagUserImmutable = 0x2
+	flagUserHidden    = 0x8000
+	flagSysArchived   = 0x10000
+)
+
+func fileFlags(t *testing.T, path string) uint32 {
+	t.Helper()
+	fi, err := os.Lstat(path)
+	rtest.OK(t, err)
+	return fi.Sys().(*syscall.Stat_t).Flags
+}
+
+func TestNodeFileFlagsRoundTrip(t *testing.T) {
+	tempdir := t.TempDir()
+	path := filepath.Join(tempdir, "file")
+	rtest.OK(t, os.WriteFile(path, []byte("content"), 0o600))
+	const flags = flagUserNoDump | flagUserHidden
+	rtest.OK(t, unix.Chflags(path, flags))
+
+	fi, err := os.Lstat(path)
+	rtest.OK(t, err)
+	node, err := nodeFromFileInfo(path, ExtendedStat(fi), false, t.Logf)
+	rtest.OK(t, err)
+	attrs, unknown, err := genericAttributesToFileFlagsAttrs(node.GenericAttributes)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(unknown))
+	rtest.Assert(t, attrs.Flags != nil && *attrs.Flags == flags, "expected file flags attribute, got %v", node.GenericAttributes)
+
+	target := filepath.Join(tempdir, "restored")
+	rtest.OK(t, os.WriteFile(target, []byte("content"), 0o600))
+	rtest.OK(t, NodeRestoreMetadata(node, target, func(msg string) { t.Error(msg) }, func(string) bool { return true }, false, nil))
+	rtest.Equals(t, uint32(flags), fileFlags(t, target))
+}
+
+func TestNodeFileFlagsImmutable(t *testing.T) {
+	tempdir := t.TempDir()
+	path := filepath.Join(tempdir, "file")
+	rtest.OK(t, os.WriteFile(path, []byte("content"), 0o600))
+	defer func() {
+		_ = unix.Chflags(path, 0)
+	}()
+
+	// the timestamps and mode are restored before setting the immutable flag
+	node := &data.Node{Type: data.NodeTypeFile, Mode: 0o400, ModTime: parseTime("2005-05-14 21:07:03.111")}
+	flags := uint32(flagUserImmutable)
+	var err error
+	node.GenericAttributes, err = data.FileFlagsAttrsToGenericAttributes(data.FileFlagsAttributes{Flags: &flags})
+	rtest.OK(t, err)
+	rtest.OK(t, NodeRestoreMetadata(node, path, func(msg string) { t.Error(msg) }, func(string) bool { return true }, false, nil))
+
+	rtest.Equals(t, flags, fileFlags(t, path))
+	fi, err := os.Lstat(path)
+	rtest.OK(t, err)
+	rtest.Equals(t, os.FileMode(0o400), fi.Mode().Perm())
+	rtest.Equals(t, node.ModTime.UnixMilli(), fi.ModTime().UnixMilli())
+}
+
+func TestNodeFileFlagsSystemUnprivileged(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("test requires a non-root user")
+	}
+	path := filepath.Join(t.TempDir(), "file")
+	rtest.OK(t, os.WriteFile(path, []byte("content"), 0o600))
+
+	node := &data.Node{Type: data.NodeTypeFile, Mode: 0o600}
+	flags := uint32(flagUserNoDump | flagSysArchived)
+	var err error
+	node.GenericAttributes, err = data.FileFlagsAttrsToGenericAttributes(data.FileFlagsAttributes{Flags: &flags})
+	rtest.OK(t, err)
+
+	err = NodeRestoreMetadata(node, path, func(msg string) { t.Error(msg) }, func(string) bool { return true }, false, nil)
+	var downgraded *FileFlagsDowngradedError
+	rtest.Assert(t, errors.As(err, &downgraded), "expected FileFlagsDowngradedError, got %v", err)
+	rtest.Equals(t, uint32(flagSysArchived), downgraded.Flags)
+	rtest.Equals(t, uint32(flagUserNoDump), fileFlags(t, path))
+}
+
+func creationTime(t *testing.T, path string) time.Time {
+	t.Helper()
+	fi, err := os.Lstat(path)
+	rtest.OK(t, err)
+	return time.Unix(fi.Sys().(*syscall.Stat_t).Birthtimespec.Unix())
+}
+
+func TestNodeCreationTimeRoundTrip(t *testing.T) {
+	tempdir := t.TempDir()
+	path := filepath.Join(tempdir, "file")
+	rtest.OK(t, os.WriteFile(path, []byte("content"), 0o600))
+
+	fi, err := os.Lstat(path)
+	rtest.OK(t, err)
+	node, err := nodeFromFileInfo(path, ExtendedStat(fi), false, t.Logf)
+	rtest.OK(t, err)
+	attrs, _, err := genericAttributesToFileFlagsAttrs(node.GenericAttributes)
+	rtest.OK(t, err)
+	if attrs.CreationTime == nil {
+		t.Skip("filesystem does not report creation times")
+	}
+	rtest.Equals(t, creationTime(t, path).UnixNano(), attrs.CreationTime.UnixNano())
+
+	// restore a creation time which is older than the file
+	btime := parseTime("2005-05-14 21:07:03.111")
+	attrs.CreationTime = &btime
+	node.ModTime = parseTime("2010-01-02 03:04:05.678")
+	node.GenericAttributes, err = data.FileFlagsAttrsToGenericAttributes(attrs)
+	rtest.OK(t, err)
+
+	target := filepath.Join(tempdir, "restored")
+	rtest.OK(t, os.WriteFile(target, []byte("content"), 0o600))
+	rtest.OK(t, NodeRestoreMetadata(node, target, func(msg string) { t.Error(msg) }, func(string) bool { return true }, false, nil))
+	rtest.Equals(t, btime.UnixMilli(), creationTime(t, target).UnixMilli())
+	fi, err = os.Lstat(target)
+	rtest.OK(t, err)
+	rtest.Equals(t, node.ModTime.UnixMilli(), fi.ModTime().UnixMilli())
+}
@@ -0,0 +1,25 @@
+//go:build !windows && !darwin && !freebsd
+
+package fs
+
+import "github.com/restic/restic/internal/data"
+
+// nodeRestoreGenericAttributes is no-op.
+func nodeRestoreGenericAttributes(node *data.Node, _ string, warn func(msg string)) error {
+	return data.HandleAllUnknownGenericAttributesFound(node.GenericAttributes, warn)
+}
+
+// nodeFillGenericAttributes is a no-op.
+func nodeFillGenericAttributes(_ *data.Node, _ string, _ *ExtendedFileInfo) error {
+	return nil
+}
+
+// nodeRestoreFileFlags is a no-op.
+func nodeRestoreFileFlags(_ *data.Node, _ string) error {
+	return nil
+}
+
+// nodeRestoreCreationTime is a no-op.
+func nodeRestoreCreationTime(_ *data.Node, _ string) error {
+	return nil
+}
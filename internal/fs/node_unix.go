@@ -6,9 +6,10 @@ import (
 	"os"
 
 	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
 )
 
-func lchown(name string, node *data.Node, lookupByName bool) error {
+func lchown(name string, node *data.Node, lookupByName bool, idMap *IDMap) error {
 	var uid, gid uint32
 	if lookupByName {
 		uid = lookupUid(node.User)
@@ -18,15 +19,20 @@ func lchown(name string, node *data.Node, lookupByName bool) error {
 		gid = node.GID
 	}
 
-	return os.Lchown(name, int(uid), int(gid))
-}
-
-// nodeRestoreGenericAttributes is no-op.
-func nodeRestoreGenericAttributes(node *data.Node, _ string, warn func(msg string)) error {
-	return data.HandleAllUnknownGenericAttributesFound(node.GenericAttributes, warn)
-}
-
-// nodeFillGenericAttributes is a no-op.
-func nodeFillGenericAttributes(_ *data.Node, _ string, _ *ExtendedFileInfo) error {
-	return nil
+	// -1 leaves the owner unchanged
+	newUID, newGID := -1, -1
+	if mapped, ok := idMap.MapUID(uid); ok {
+		newUID = int(mapped)
+	} else {
+		debug.Log("uid %d of %v is not contained in the id map", uid, name)
+	}
+	if mapped, ok := idMap.MapGID(gid); ok {
+		newGID = int(mapped)
+	} else {
+		debug.Log("gid %d of %v is not contained in the id map", gid, name)
+	}
+	if newUID == -1 && newGID == -1 {
+		return nil
+	}
+	return os.Lchown(name, newUID, newGID)
 }
@@ -167,7 +167,7 @@ func TestLchown(t *testing.T) {
 			GID: uint32(gid),
 		}
 
-		err = lchown(f, n, false)
+		err = lchown(f, n, false, nil)
 		rtest.OK(t, err)
 	})
 
@@ -180,7 +180,28 @@ func TestLchown(t *testing.T) {
 			Group: group.Name,
 		}
 
-		err = lchown(f, n, true)
+		err = lchown(f, n, true, nil)
 		rtest.OK(t, err)
 	})
+
+	t.Run("through id map", func(t *testing.T) {
+		idMap := &IDMap{
+			UIDs: []IDMapRange{{From: uint32(uid) + 100000, To: uint32(uid), Count: 1}},
+			GIDs: []IDMapRange{{From: uint32(gid) + 100000, To: uint32(gid), Count: 1}},
+		}
+		n := &data.Node{
+			UID: uint32(uid) + 100000,
+			GID: uint32(gid) + 100000,
+		}
+		rtest.OK(t, lchown(f, n, false, idMap))
+
+		// unmapped ids leave the ownership unchanged
+		n = &data.Node{UID: 4242, GID: 4242}
+		rtest.OK(t, lchown(f, n, false, idMap))
+		fi, err := os.Lstat(f)
+		rtest.OK(t, err)
+		stat := ExtendedStat(fi)
+		rtest.Equals(t, uint32(uid), stat.UID)
+		rtest.Equals(t, uint32(gid), stat.GID)
+	})
 }
@@ -21,6 +21,9 @@ var (
 	procEncryptFile = modAdvapi32.NewProc("EncryptFileW")
 	procDecryptFile = modAdvapi32.NewProc("DecryptFileW")
 
+	modKernel32           = syscall.NewLazyDLL("kernel32.dll")
+	procSetFileShortNameW = modKernel32.NewProc("SetFileShortNameW")
+
 	// eaSupportedVolumesMap is a map of volumes to boolean values indicating if they support extended attributes.
 	eaSupportedVolumesMap = sync.Map{}
 )
@@ -38,7 +41,7 @@ func mknod(_ string, _ uint32, _ uint64) (err error) {
 }
 
 // Windows doesn't need lchown
-func lchown(_ string, _ *data.Node, _ bool) (err error) {
+func lchown(_ string, _ *data.Node, _ bool, _ *IDMap) (err error) {
 	return nil
 }
 
@@ -187,6 +190,18 @@ func restoreExtendedAttributes(nodeType data.NodeType, path string, eas []extend
 	return nil
 }
 
+// nodeRestoreFileFlags is a no-op, the file attributes are restored as
+// generic attributes.
+func nodeRestoreFileFlags(_ *data.Node, _ string) error {
+	return nil
+}
+
+// nodeRestoreCreationTime is a no-op, the creation time is restored as a
+// generic attribute.
+func nodeRestoreCreationTime(_ *data.Node, _ string) error {
+	return nil
+}
+
 // restoreGenericAttributes restores generic attributes for Windows
 func nodeRestoreGenericAttributes(node *data.Node, path string, warn func(msg string)) (err error) {
 	if len(node.GenericAttributes) == 0 {
@@ -197,6 +212,12 @@ func nodeRestoreGenericAttributes(node *data.Node, path string, warn func(msg st
 	if err != nil {
 		return fmt.Errorf("error parsing generic attribute for: %s : %v", path, err)
 	}
+	if windowsAttributes.ShortName != nil {
+		// must happen before restoring the file attributes, which may make the file readonly
+		if err := restoreShortName(path, *windowsAttributes.ShortName); err != nil {
+			errs = append(errs, fmt.Errorf("error restoring short name for: %s : %v", path, err))
+		}
+	}
 	if windowsAttributes.CreationTime != nil {
 		if err := restoreCreationTime(path, windowsAttributes.CreationTime); err != nil {
 			errs = append(errs, fmt.Errorf("error restoring creation time for: %s : %v", path, err))
@@ -245,6 +266,82 @@ func restoreCreationTime(path string, creationTime *syscall.Filetime) (err error
 	return syscall.SetFileTime(handle, creationTime, nil, nil)
 }
 
+// getShortName returns the 8.3 short name of the file/folder at the specified path. It returns
+// nil if the file has no short name or if it matches the file name.
+func getShortName(path string) (*string, error) {
+	pathPointer, err := syscall.UTF16PtrFromString(fixpath(path))
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]uint16, windows.MAX_PATH)
+	for {
+		n, err := windows.GetShortPathName(pathPointer, &buf[0], uint32(len(buf)))
+		if err != nil {
+			// not all filesystems support short names
+			debug.Log("Could not get short name for path: %s: %v", path, err)
+			return nil, nil
+		}
+		if n < uint32(len(buf)) {
+			buf = buf[:n]
+			break
+		}
+		// n is the required buffer size
+		buf = make([]uint16, n)
+	}
+
+	shortName := filepath.Base(windows.UTF16ToString(buf))
+	if shortName == "" || shortName == filepath.Base(path) {
+		return nil, nil
+	}
+	return &shortName, nil
+}
+
+// restoreShortName sets the 8.3 short name of the file/folder at the specified path. Setting
+// the short name requires the SeRestorePrivilege and a volume with short names enabled,
+// otherwise the short name is silently skipped.
+func restoreShortName(path string, shortName string) error {
+	if err := procSetFileShortNameW.Find(); err != nil {
+		debug.Log("SetFileShortNameW is not available: %v", err)
+		return nil
+	}
+
+	current, err := getShortName(path)
+	if err != nil {
+		return err
+	}
+	if current != nil && *current == shortName {
+		return nil
+	}
+
+	pathPointer, err := syscall.UTF16PtrFromString(fixpath(path))
+	if err != nil {
+		return err
+	}
+	namePointer, err := syscall.UTF16PtrFromString(shortName)
+	if err != nil {
+		return err
+	}
+	handle, err := windows.CreateFile(pathPointer,
+		windows.GENERIC_WRITE|windows.DELETE,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE, nil,
+		windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS|windows.FILE_FLAG_OPEN_REPARSE_POINT, 0)
+	if err != nil {
+		return err
+	}
+	defer closeFileHandle(handle, path)
+
+	ret, _, err := procSetFileShortNameW.Call(uintptr(handle), uintptr(unsafe.Pointer(namePointer)))
+	if ret == 0 {
+		if errors.Is(err, windows.ERROR_PRIVILEGE_NOT_HELD) || errors.Is(err, windows.ERROR_INVALID_PARAMETER) {
+			// missing privilege or short names are disabled for the volume
+			debug.Log("Could not set short name %s for path: %s: %v", shortName, path, err)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
 // restoreFileAttributes gets the File Attributes from the data and sets them to the file/folder
 // at the specified path.
 func restoreFileAttributes(path string, fileAttributes *uint32) (err error) {
@@ -366,6 +463,11 @@ func nodeFillGenericAttributes(node *data.Node, path string, stat *ExtendedFileI
 		}
 	}
 
+	shortName, err := getShortName(path)
+	if err != nil {
+		return err
+	}
+
 	winFI := stat.sys.(*syscall.Win32FileAttributeData)
 
 	// Add Windows attributes
@@ -373,6 +475,7 @@ func nodeFillGenericAttributes(node *data.Node, path string, stat *ExtendedFileI
 		CreationTime:       &winFI.CreationTime,
 		FileAttributes:     &winFI.FileAttributes,
 		SecurityDescriptor: sd,
+		ShortName:          shortName,
 	})
 	return err
 }
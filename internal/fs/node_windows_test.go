@@ -327,6 +327,48 @@ func TestRestoreFileAttributes(t *testing.T) {
 	}
 }
 
+func TestRestoreShortName(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+
+	// probe whether the volume generates short names
+	probe := filepath.Join(tempDir, "probe with long name.txt")
+	test.OK(t, os.WriteFile(probe, nil, 0600))
+	shortName, err := getShortName(probe)
+	test.OK(t, err)
+	if shortName == nil {
+		t.Skip("volume does not support short names")
+	}
+	isAdmin, err := isAdmin()
+	test.OK(t, err)
+	if !isAdmin {
+		t.Skip("setting short names requires admin privileges")
+	}
+
+	for i, nodeType := range []data.NodeType{data.NodeTypeFile, data.NodeTypeDir} {
+		expected := fmt.Sprintf("SHORT~%d", i+5)
+		genericAttrs, err := data.WindowsAttrsToGenericAttributes(data.WindowsAttributes{ShortName: &expected})
+		test.OK(t, err)
+		node := getNode(fmt.Sprintf("node with a long name %d", i), nodeType, genericAttrs)
+
+		testPath, _ := restoreAndGetNode(t, tempDir, &node, false)
+		shortName, err := getShortName(testPath)
+		test.OK(t, err)
+		test.Assert(t, shortName != nil && *shortName == expected, "unexpected short name %v for %v", shortName, testPath)
+	}
+}
+
+func TestGetShortNameWithoutShortName(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "short.txt")
+	test.OK(t, os.WriteFile(path, nil, 0600))
+
+	// a valid 8.3 name does not have a separate short name
+	shortName, err := getShortName(path)
+	test.OK(t, err)
+	test.Assert(t, shortName == nil, "unexpected short name %v", shortName)
+}
+
 func runGenericAttributesTest(t *testing.T, tempDir string, genericAttributeName data.GenericAttributeType, genericAttributeExpected data.WindowsAttributes, warningExpected bool) {
 	genericAttributes, err := data.WindowsAttrsToGenericAttributes(genericAttributeExpected)
 	test.OK(t, err)
@@ -387,7 +429,7 @@ func restoreAndGetNode(t *testing.T, tempDir string, testNode *data.Node, warnin
 			// If warning is not expected, this code should not get triggered.
 			test.OK(t, fmt.Errorf("Warning triggered for path: %s: %s", testPath, msg))
 		}
-	}, func(_ string) bool { return true }, false)
+	}, func(_ string) bool { return true }, false, nil)
 	test.OK(t, errors.Wrapf(err, "Failed to restore metadata for: %s", testPath))
 
 	fs := NewLocal()
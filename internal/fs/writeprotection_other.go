@@ -0,0 +1,20 @@
+//go:build !linux
+
+package fs
+
+import "github.com/restic/restic/internal/errors"
+
+// GetWriteProtection returns the immutable and append-only attributes of the
+// file at path. These are only supported on Linux.
+func GetWriteProtection(_ string) (uint32, error) {
+	return 0, nil
+}
+
+// SetWriteProtection replaces the immutable and append-only attributes of the
+// file at path. These are only supported on Linux.
+func SetWriteProtection(_ string, flags uint32) error {
+	if flags != 0 {
+		return errors.New("immutable and append-only attributes are not supported")
+	}
+	return nil
+}
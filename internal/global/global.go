@@ -63,6 +63,9 @@ type Options struct {
 
 	backend.TransportOptions
 	limiter.Limits
+	// DownloadSchedule varies the download limit over time, it is set by
+	// commands which support it.
+	DownloadSchedule limiter.Schedule
 
 	Password string
 	Term     ui.Terminal
@@ -552,6 +555,9 @@ func setupTransport(gopts Options) (http.RoundTripper, limiter.Limiter, error) {
 
 	// wrap the transport so that the throughput via HTTP is limited
 	lim := limiter.NewStaticLimiter(gopts.Limits)
+	if len(gopts.DownloadSchedule) > 0 {
+		lim = limiter.NewScheduledLimiter(gopts.Limits, gopts.DownloadSchedule)
+	}
 	rt = lim.Transport(rt)
 
 	return rt, lim, nil
@@ -0,0 +1,40 @@
+package repository
+
+import "sync"
+
+// BufferPool recycles the buffers used to download sections of pack files,
+// see Repository.UseBufferPool. This reduces the allocation rate and thus the
+// garbage collection overhead when loading many packs, for example during a
+// restore. It is safe for concurrent use. A nil BufferPool allocates a new
+// buffer each time.
+type BufferPool struct {
+	pool    sync.Pool
+	maxSize int
+}
+
+// NewBufferPool returns a new BufferPool. Buffers larger than maxSize are not
+// recycled, such that the rare downloads of very large sections do not
+// permanently increase the memory usage.
+func NewBufferPool(maxSize int) *BufferPool {
+	return &BufferPool{maxSize: maxSize}
+}
+
+// get returns a buffer of length size. Its content is undefined.
+func (p *BufferPool) get(size int) []byte {
+	if p == nil {
+		return make([]byte, size)
+	}
+	if buf, ok := p.pool.Get().(*[]byte); ok && cap(*buf) >= size {
+		return (*buf)[:size]
+	}
+	// a too small buffer is dropped, the next one is usually large enough
+	return make([]byte, size)
+}
+
+// put returns buf to the pool. The caller must not use buf afterwards.
+func (p *BufferPool) put(buf []byte) {
+	if p == nil || cap(buf) > p.maxSize {
+		return
+	}
+	p.pool.Put(&buf)
+}
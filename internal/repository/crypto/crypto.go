@@ -3,7 +3,10 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hkdf"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 
@@ -322,6 +325,86 @@ func (k *Key) Open(dst, nonce, ciphertext, _ []byte) ([]byte, error) {
 	return ret, nil
 }
 
+// XORKeyStreamAt encrypts or decrypts src into dst as if src was located at
+// offset within a message sealed using nonce. This allows encrypting the parts
+// of a message in arbitrary order. The authentication tag for the complete
+// ciphertext can be computed using NewMAC. dst must be at least as long as src.
+func (k *Key) XORKeyStreamAt(dst, src, nonce []byte, offset int64) {
+	if !k.Valid() {
+		panic("key is invalid")
+	}
+
+	if len(nonce) != ivSize {
+		panic("incorrect nonce length")
+	}
+
+	if offset < 0 {
+		panic("negative offset")
+	}
+
+	// CTR mode treats the iv as a big endian counter which is incremented
+	// for every block
+	var iv [ivSize]byte
+	hi := binary.BigEndian.Uint64(nonce[:8])
+	lo := binary.BigEndian.Uint64(nonce[8:])
+	blocks := uint64(offset / aes.BlockSize)
+	if lo+blocks < lo {
+		hi++
+	}
+	binary.BigEndian.PutUint64(iv[:8], hi)
+	binary.BigEndian.PutUint64(iv[8:], lo+blocks)
+
+	c, err := aes.NewCipher(k.EncryptionKey[:])
+	if err != nil {
+		panic(fmt.Sprintf("unable to create cipher: %v", err))
+	}
+	e := cipher.NewCTR(c, iv[:])
+
+	// skip the part of the keystream block before offset
+	var skip [aes.BlockSize]byte
+	n := offset % aes.BlockSize
+	e.XORKeyStream(skip[:n], skip[:n])
+
+	e.XORKeyStream(dst[:len(src)], src)
+}
+
+// NewMAC returns a MAC for a message sealed using nonce. After writing the
+// complete ciphertext to it, it returns the same authentication tag as Seal.
+func (k *Key) NewMAC(nonce []byte) *poly1305.MAC {
+	if len(nonce) != ivSize {
+		panic("incorrect nonce length")
+	}
+
+	key := poly1305PrepareKey(nonce, &k.MACKey)
+	return poly1305.New(&key)
+}
+
+// Derive returns a new key which is derived from k and info using
+// HKDF-SHA256. The input keying material is the concatenation of the
+// encryption key and the MAC keys K and R of k, no salt is used. The 64 bytes
+// of output keying material form the encryption key and the MAC keys K and R
+// of the derived key, in that order. Different values of info result in
+// independent keys.
+func (k *Key) Derive(info string) *Key {
+	if !k.Valid() {
+		panic("key is invalid")
+	}
+
+	secret := make([]byte, 0, aesKeySize+macKeySize)
+	secret = append(secret, k.EncryptionKey[:]...)
+	secret = append(secret, k.MACKey.K[:]...)
+	secret = append(secret, k.MACKey.R[:]...)
+	buf, err := hkdf.Key(sha256.New, secret, nil, info, aesKeySize+macKeySize)
+	if err != nil {
+		panic(fmt.Sprintf("unable to derive key: %v", err))
+	}
+
+	derived := &Key{}
+	copy(derived.EncryptionKey[:], buf[:aesKeySize])
+	macKeyFromSlice(&derived.MACKey, buf[aesKeySize:])
+	return derived
+}
+
 // Valid tests if the key is valid.
 func (k *Key) Valid() bool {
 	return k.EncryptionKey.Valid() && k.MACKey.Valid()
@@ -164,6 +164,30 @@ func TestCrypto(t *testing.T) {
 	}
 }
 
+func TestDeriveKnownAnswer(t *testing.T) {
+	// the derived keys must never change, as files encrypted with them
+	// could no longer be decrypted
+	k := &Key{}
+	for i := range k.EncryptionKey {
+		k.EncryptionKey[i] = byte(i + 1)
+	}
+	for i := range k.MACKey.K {
+		k.MACKey.K[i] = byte(i + 33)
+		k.MACKey.R[i] = byte(i + 49)
+	}
+
+	derived := k.Derive("restic test")
+	if derived.EncryptionKey != decodeArray32("91f178c47af150cf5321548e7be486f40b6f47543951d045afe43aa0d73bfec0") {
+		t.Fatalf("wrong encryption key %x", derived.EncryptionKey)
+	}
+	if derived.MACKey.K != decodeArray16("eea00e070e2975acaa6eef011b577780") {
+		t.Fatalf("wrong MAC key K %x", derived.MACKey.K)
+	}
+	if derived.MACKey.R != decodeArray16("d1a594799a6d61358368b9b69fda228b") {
+		t.Fatalf("wrong MAC key R %x", derived.MACKey.R)
+	}
+}
+
 func TestNonceValid(t *testing.T) {
 	nonce := make([]byte, ivSize)
 
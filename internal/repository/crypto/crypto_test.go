@@ -300,3 +300,52 @@ func BenchmarkDecrypt(b *testing.B) {
 		rtest.OK(b, err)
 	}
 }
+
+func TestXORKeyStreamAt(t *testing.T) {
+	k := crypto.NewRandomKey()
+	data := rtest.Random(23, 1<<16+5)
+	nonce := crypto.NewRandomNonce()
+	// the counter must carry over into the upper half of the iv
+	for i := 8; i < len(nonce); i++ {
+		nonce[i] = 0xff
+	}
+
+	sealed := k.Seal(nil, nonce, data, nil)
+
+	// encrypt the data in reverse order using unaligned parts
+	ciphertext := make([]byte, len(data))
+	for end := len(data); end > 0; {
+		start := max(end-4097, 0)
+		k.XORKeyStreamAt(ciphertext[start:end], data[start:end], nonce, int64(start))
+		end = start
+	}
+	rtest.Equals(t, sealed[:len(data)], ciphertext)
+
+	mac := k.NewMAC(nonce)
+	_, err := mac.Write(ciphertext)
+	rtest.OK(t, err)
+	rtest.Equals(t, sealed[len(data):], mac.Sum(nil))
+
+	plaintext, err := k.Open(nil, nonce, sealed, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, data, plaintext)
+}
+
+func TestDerive(t *testing.T) {
+	k := crypto.NewRandomKey()
+	derived := k.Derive("file1")
+	rtest.Assert(t, derived.Valid(), "derived key is invalid")
+	rtest.Equals(t, derived, k.Derive("file1"))
+	rtest.Assert(t, *derived != *k, "derived key equals the original key")
+	rtest.Assert(t, *derived != *k.Derive("file2"), "keys for different info are equal")
+	rtest.Assert(t, *derived != *crypto.NewRandomKey().Derive("file1"), "keys derived from different keys are equal")
+
+	data := rtest.Random(42, 1000)
+	nonce := crypto.NewRandomNonce()
+	ciphertext := derived.Seal(nil, nonce, data, nil)
+	_, err := k.Open(nil, nonce, ciphertext, nil)
+	rtest.Assert(t, err == crypto.ErrUnauthenticated, "unexpected error %v", err)
+	plaintext, err := k.Derive("file1").Open(nil, nonce, ciphertext, nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, data, plaintext)
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/restic/restic/internal/repository/index"
+	"github.com/restic/restic/internal/restic"
+)
+
+// LazyIndexRepository is a repository whose index is still being loaded in
+// the background. Lookups of blobs which are not yet contained in the index
+// block until further index files were loaded, such that callers can start
+// working before the whole index is in memory. Blobs which do not exist in
+// the repository are only reported as missing once the index is loaded
+// completely.
+type LazyIndexRepository struct {
+	*Repository
+
+	loaded atomic.Bool
+	m      sync.Mutex
+	// closed and replaced each time an index file was loaded
+	changed chan struct{}
+	err     error
+}
+
+// StartLoadIndex loads the index in the background.
+func (r *Repository) StartLoadIndex(ctx context.Context, p restic.TerminalCounterFactory) *LazyIndexRepository {
+	l := &LazyIndexRepository{
+		Repository: r,
+		changed:    make(chan struct{}),
+	}
+	go func() {
+		err := r.loadIndexWithCallback(ctx, p, func(_ restic.ID, _ *index.Index, err error) error {
+			if err == nil {
+				// the index file is inserted into the index after the
+				// callback, thus waiters may have to wait for the next one
+				l.notify(false, nil)
+			}
+			return err
+		})
+		l.notify(true, err)
+	}()
+	return l
+}
+
+func (l *LazyIndexRepository) notify(loaded bool, err error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if loaded {
+		l.err = err
+		l.loaded.Store(true)
+	}
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// waitFor blocks until found returns true or the index is loaded completely.
+// It returns the error which stopped loading the index, if any.
+func (l *LazyIndexRepository) waitFor(ctx context.Context, found func() bool) error {
+	for {
+		if found() {
+			return nil
+		}
+		l.m.Lock()
+		changed := l.changed
+		loaded := l.loaded.Load()
+		err := l.err
+		l.m.Unlock()
+		if loaded {
+			if err == nil || found() {
+				// missing blobs are reported by the caller
+				return nil
+			}
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Wait blocks until the index is loaded completely and returns the error
+// which stopped loading it, if any.
+func (l *LazyIndexRepository) Wait(ctx context.Context) error {
+	return l.waitFor(ctx, func() bool { return false })
+}
+
+// LookupBlob returns the packs containing the blob. It blocks until the blob
+// was loaded into the index.
+func (l *LazyIndexRepository) LookupBlob(bh restic.BlobHandle) []restic.PackBlob {
+	pbs := l.Repository.LookupBlob(bh)
+	if len(pbs) > 0 || l.loaded.Load() {
+		return pbs
+	}
+	_ = l.waitFor(context.Background(), func() bool {
+		pbs = l.Repository.LookupBlob(bh)
+		return len(pbs) > 0
+	})
+	return pbs
+}
+
+// LookupBlobSize returns the size of the blob. It blocks until the blob was
+// loaded into the index.
+func (l *LazyIndexRepository) LookupBlobSize(bh restic.BlobHandle) (uint, bool) {
+	size, exists := l.Repository.LookupBlobSize(bh)
+	if exists || l.loaded.Load() {
+		return size, exists
+	}
+	_ = l.waitFor(context.Background(), func() bool {
+		size, exists = l.Repository.LookupBlobSize(bh)
+		return exists
+	})
+	return size, exists
+}
+
+// LoadBlob loads the blob once it was loaded into the index.
+func (l *LazyIndexRepository) LoadBlob(ctx context.Context, bh restic.BlobHandle, buf []byte) ([]byte, error) {
+	if !l.loaded.Load() {
+		err := l.waitFor(ctx, func() bool {
+			_, exists := l.Repository.LookupBlobSize(bh)
+			return exists
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return l.Repository.LoadBlob(ctx, bh, buf)
+}
@@ -0,0 +1,85 @@
+package repository_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// blockingIndexBackend blocks loading index files until release is closed.
+type blockingIndexBackend struct {
+	backend.Backend
+	release chan struct{}
+}
+
+func (be *blockingIndexBackend) Load(ctx context.Context, h backend.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if h.Type == backend.IndexFile {
+		select {
+		case <-be.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+func TestLazyIndexRepository(t *testing.T) {
+	repo, _, be := repository.TestRepositoryWithVersion(t, 0)
+	data := rtest.Random(42, 1000)
+	var id restic.ID
+	rtest.OK(t, repo.WithBlobUploader(context.TODO(), func(ctx context.Context, uploader restic.BlobSaverWithAsync) error {
+		var err error
+		id, _, _, err = uploader.SaveBlob(ctx, restic.DataBlob, data, restic.ID{}, false)
+		return err
+	}))
+	h := restic.BlobHandle{Type: restic.DataBlob, ID: id}
+
+	release := make(chan struct{})
+	lazy := repository.TestOpenBackend(t, &blockingIndexBackend{Backend: be, release: release}).
+		StartLoadIndex(context.TODO(), restic.NoopTerminalCounterFactory)
+
+	var buf []byte
+	var err error
+	loaded := make(chan struct{})
+	go func() {
+		buf, err = lazy.LoadBlob(context.TODO(), h, nil)
+		close(loaded)
+	}()
+	select {
+	case <-loaded:
+		t.Fatal("blob was loaded before the index")
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	<-loaded
+	rtest.OK(t, err)
+	rtest.Equals(t, data, buf)
+
+	rtest.OK(t, lazy.Wait(context.TODO()))
+	rtest.Equals(t, 1, len(lazy.LookupBlob(h)))
+	size, exists := lazy.LookupBlobSize(h)
+	rtest.Assert(t, exists, "blob %v is missing", h)
+	rtest.Equals(t, uint(len(data)), size)
+	// missing blobs are reported once the index is loaded
+	rtest.Equals(t, 0, len(lazy.LookupBlob(restic.BlobHandle{Type: restic.DataBlob, ID: restic.NewRandomID()})))
+}
+
+func TestLazyIndexRepositoryCanceled(t *testing.T) {
+	repo, _, be := repository.TestRepositoryWithVersion(t, 0)
+	saveRandomDataBlobs(t, repo, 1, 1000)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lazy := repository.TestOpenBackend(t, &blockingIndexBackend{Backend: be, release: make(chan struct{})}).
+		StartLoadIndex(ctx, restic.NoopTerminalCounterFactory)
+	cancel()
+	err := lazy.Wait(context.TODO())
+	rtest.Assert(t, err != nil, "expected error for canceled index load")
+	_, err = lazy.LoadBlob(context.TODO(), restic.BlobHandle{Type: restic.DataBlob, ID: restic.NewRandomID()}, nil)
+	rtest.Assert(t, err != nil, "expected error for missing blob")
+}
@@ -54,6 +54,9 @@ type Repository struct {
 
 	zeroChunkOnce sync.Once
 	zeroChunkID   restic.ID
+
+	// recycles the buffers for downloading pack sections, may be nil
+	bufferPool *BufferPool
 }
 
 // internalRepository allows using SaveUnpacked and RemoveUnpacked with all FileTypes
@@ -1100,10 +1103,41 @@ func (r *Repository) blobsInPack(packID restic.ID, handles []restic.BlobHandle)
 }
 
 func (r *Repository) loadBlobsFromPack(ctx context.Context, packID restic.ID, blobs pack.Blobs, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
-	return streamPack(ctx, r.be.Load, r.LoadBlob, r.getZstdDecoder(), r.key, packID, blobs, handleBlobFn)
+	return streamPack(ctx, r.be.Load, r.LoadBlob, r.getZstdDecoder(), r.key, r.bufferPool, packID, blobs, handleBlobFn)
+}
+
+// UseBufferPool recycles the buffers used by LoadBlobsFromPack and
+// LoadPackSections to download the pack files using pool. A buffer is put
+// back once all blobs of a section were passed to the callback, thus the
+// callback must never keep a reference to the blob. Passing nil disables
+// recycling. Must be called before loading any pack files.
+func (r *Repository) UseBufferPool(pool *BufferPool) {
+	r.bufferPool = pool
 }
 
-func streamPack(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn, dec *zstd.Decoder, key *crypto.Key, packID restic.ID, blobs pack.Blobs, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+// LoadPackSections is like LoadBlobsFromPack, but only downloads the listed
+// blobs. Each downloaded section of the pack file is passed to
+// handleSectionFn, the blobs are decrypted and decompressed by calling
+// Decode on the section. This allows decoding a section in a different
+// goroutine while further sections are downloaded. Decode must be called at
+// most once for each section.
+func (r *Repository) LoadPackSections(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleSectionFn func(section restic.PackSection) error) error {
+	blobs, err := r.blobsInPack(packID, handles)
+	if err != nil {
+		return err
+	}
+	return streamPackSections(ctx, r.be.Load, r.LoadBlob, r.getZstdDecoder(), r.key, r.bufferPool, packID, blobs, func(section *packSection) error {
+		return handleSectionFn(section)
+	})
+}
+
+func streamPack(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn, dec *zstd.Decoder, key *crypto.Key, pool *BufferPool, packID restic.ID, blobs pack.Blobs, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+	return streamPackSections(ctx, beLoad, loadBlobFn, dec, key, pool, packID, blobs, func(section *packSection) error {
+		return section.Decode(ctx, handleBlobFn)
+	})
+}
+
+func streamPackSections(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn, dec *zstd.Decoder, key *crypto.Key, pool *BufferPool, packID restic.ID, blobs pack.Blobs, handleSectionFn func(section *packSection) error) error {
 	if len(blobs) == 0 {
 		// nothing to do
 		return nil
@@ -1134,7 +1168,7 @@ func streamPack(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn
 
 		if split {
 			// load everything up to the skipped file section
-			err := streamPackPart(ctx, beLoad, loadBlobFn, dec, key, packID, blobs[lowerIdx:i], handleBlobFn)
+			err := streamPackPart(ctx, beLoad, loadBlobFn, dec, key, pool, packID, blobs[lowerIdx:i], handleSectionFn)
 			if err != nil {
 				return err
 			}
@@ -1143,10 +1177,10 @@ func streamPack(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn
 		lastPos = blobs[i].Offset + blobs[i].Length
 	}
 	// load remainder
-	return streamPackPart(ctx, beLoad, loadBlobFn, dec, key, packID, blobs[lowerIdx:], handleBlobFn)
+	return streamPackPart(ctx, beLoad, loadBlobFn, dec, key, pool, packID, blobs[lowerIdx:], handleSectionFn)
 }
 
-func streamPackPart(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn, dec *zstd.Decoder, key *crypto.Key, packID restic.ID, blobs pack.Blobs, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+func streamPackPart(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBlobFn, dec *zstd.Decoder, key *crypto.Key, pool *BufferPool, packID restic.ID, blobs pack.Blobs, handleSectionFn func(section *packSection) error) error {
 	h := backend.Handle{Type: backend.PackFile, Name: packID.String(), IsMetadata: blobs[0].Type.IsMetadata()}
 
 	dataStart := blobs[0].Offset
@@ -1154,21 +1188,68 @@ func streamPackPart(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBl
 
 	debug.Log("streaming pack %v (%d to %d bytes), blobs: %v", packID, dataStart, dataEnd, len(blobs))
 
-	data := make([]byte, int(dataEnd-dataStart))
+	data := pool.get(int(dataEnd - dataStart))
 	err := beLoad(ctx, h, int(dataEnd-dataStart), int64(dataStart), func(rd io.Reader) error {
 		_, cerr := io.ReadFull(rd, data)
 		return cerr
 	})
 	// prevent callbacks after cancellation
 	if ctx.Err() != nil {
+		pool.put(data)
 		return ctx.Err()
 	}
-	if err != nil {
+
+	return handleSectionFn(&packSection{
+		packID:     packID,
+		data:       data,
+		pool:       pool,
+		dataStart:  dataStart,
+		blobs:      blobs,
+		loadErr:    err,
+		loadBlobFn: loadBlobFn,
+		key:        key,
+		dec:        dec,
+	})
+}
+
+// packSection is a downloaded section of a pack file.
+type packSection struct {
+	packID    restic.ID
+	data      []byte
+	dataStart uint
+	blobs     pack.Blobs
+	// error returned while downloading data
+	loadErr    error
+	loadBlobFn loadBlobFn
+	key        *crypto.Key
+	dec        *zstd.Decoder
+	// receives data once the section was decoded, may be nil
+	pool *BufferPool
+}
+
+// LoadErr returns the error of downloading the section.
+func (s *packSection) LoadErr() error {
+	return s.loadErr
+}
+
+// Decode passes all blobs of the section to handleBlobFn, see LoadBlobsFromPack.
+func (s *packSection) Decode(ctx context.Context, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+	// the blobs passed to handleBlobFn are located within data
+	defer func() {
+		s.pool.put(s.data)
+		s.data = nil
+	}()
+	blobs := s.blobs
+	if s.loadErr != nil {
+		err := s.loadErr
 		// the context is only still valid if handleBlobFn never returned an error
-		if loadBlobFn != nil {
+		if s.loadBlobFn != nil {
 			// check whether we can get the remaining blobs somewhere else
 			for _, entry := range blobs {
-				buf, ierr := loadBlobFn(ctx, entry.BlobHandle, nil)
+				buf, ierr := s.loadBlobFn(ctx, entry.BlobHandle, nil)
+				if ierr != nil {
+					ierr = &restic.PackLoadError{PackID: s.packID, Err: ierr}
+				}
 				err = handleBlobFn(entry.BlobHandle, buf, ierr)
 				if err != nil {
 					break
@@ -1178,7 +1259,7 @@ func streamPackPart(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBl
 		return errors.Wrap(err, "StreamPack")
 	}
 
-	it := newPackBlobIterator(packID, newByteReader(data), dataStart, blobs, key, dec)
+	it := newPackBlobIterator(s.packID, newByteReader(s.data), s.dataStart, blobs, s.key, s.dec)
 
 	for {
 		if ctx.Err() != nil {
@@ -1192,10 +1273,10 @@ func streamPackPart(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBl
 			return err
 		}
 
-		if val.Err != nil && loadBlobFn != nil {
+		if val.Err != nil && s.loadBlobFn != nil {
 			var ierr error
 			// check whether we can get a valid copy somewhere else
-			buf, ierr := loadBlobFn(ctx, val.Handle, nil)
+			buf, ierr := s.loadBlobFn(ctx, val.Handle, nil)
 			if ierr == nil {
 				// success
 				val.Plaintext = buf
@@ -1211,7 +1292,7 @@ func streamPackPart(ctx context.Context, beLoad backendLoadFn, loadBlobFn loadBl
 		blobs = blobs[1:]
 	}
 
-	return errors.Wrap(err, "StreamPack")
+	return nil
 }
 
 // discardReader allows the PackBlobIterator to perform zero copy
@@ -1344,9 +1425,27 @@ func (b *packBlobIterator) Next() (packBlobValue, error) {
 		}
 	}
 
+	if err != nil {
+		err = invalidBlobError{err}
+	}
+
 	return packBlobValue{entry.BlobHandle, plaintext, err}, nil
 }
 
+// invalidBlobError marks an error for a blob whose data is damaged as
+// restic.ErrInvalidData without changing the error message.
+type invalidBlobError struct {
+	err error
+}
+
+func (e invalidBlobError) Error() string {
+	return e.err.Error()
+}
+
+func (e invalidBlobError) Unwrap() []error {
+	return []error{e.err, restic.ErrInvalidData}
+}
+
 func (r *Repository) zeroChunk() restic.ID {
 	r.zeroChunkOnce.Do(func() {
 		r.zeroChunkID = restic.Hash(make([]byte, chunker.MinSize))
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"math/rand"
 	"sort"
@@ -277,6 +278,9 @@ func testStreamPack(t *testing.T, version uint) {
 		return fn(bytes.NewReader(loadBytes(length, offset)))
 	}
 
+	// the buffers are reused across all subtests, which must not affect the content
+	pool := NewBufferPool(4 * 1024 * 1024)
+
 	// first, test regular usage
 	t.Run("regular", func(t *testing.T) {
 		tests := []struct {
@@ -324,7 +328,7 @@ func testStreamPack(t *testing.T, version uint) {
 
 				loadCalls = 0
 				shortFirstLoad = test.shortFirstLoad
-				err := streamPack(ctx, load, nil, dec, &key, restic.ID{}, test.blobs, handleBlob)
+				err := streamPack(ctx, load, nil, dec, &key, pool, restic.ID{}, test.blobs, handleBlob)
 				if err != nil {
 					t.Fatal(err)
 				}
@@ -338,11 +342,37 @@ func testStreamPack(t *testing.T, version uint) {
 	})
 	shortFirstLoad = false
 
+	// decode sections only after all of them were downloaded
+	t.Run("sections", func(t *testing.T) {
+		blobs := pack.Blobs{packfileBlobs[0], packfileBlobs[len(packfileBlobs)-1]}
+		var sections []*packSection
+		loadCalls = 0
+		err := streamPackSections(context.TODO(), load, nil, dec, &key, pool, restic.ID{}, blobs, func(section *packSection) error {
+			sections = append(sections, section)
+			return nil
+		})
+		rtest.OK(t, err)
+		rtest.Equals(t, 2, loadCalls)
+		rtest.Equals(t, 2, len(sections))
+
+		gotBlobs := restic.NewIDSet()
+		for _, section := range sections {
+			rtest.OK(t, section.Decode(context.TODO(), func(blob restic.BlobHandle, buf []byte, err error) error {
+				rtest.OK(t, err)
+				rtest.Equals(t, blob.ID, restic.Hash(buf))
+				gotBlobs.Insert(blob.ID)
+				return nil
+			}))
+		}
+		rtest.Equals(t, restic.NewIDSet(blobs[0].ID, blobs[1].ID), gotBlobs)
+	})
+
 	// next, test invalid uses, which should return an error
 	t.Run("invalid", func(t *testing.T) {
 		tests := []struct {
-			blobs pack.Blobs
-			err   string
+			blobs       pack.Blobs
+			err         string
+			invalidData bool
 		}{
 			{
 				// pass one blob several times
@@ -363,7 +393,8 @@ func testStreamPack(t *testing.T, version uint) {
 						Length: 20000,
 					},
 				},
-				err: "ciphertext verification failed",
+				err:         "ciphertext verification failed",
+				invalidData: true,
 			},
 
 			{
@@ -387,7 +418,7 @@ func testStreamPack(t *testing.T, version uint) {
 					return err
 				}
 
-				err := streamPack(ctx, load, nil, dec, &key, restic.ID{}, test.blobs, handleBlob)
+				err := streamPack(ctx, load, nil, dec, &key, nil, restic.ID{}, test.blobs, handleBlob)
 				if err == nil {
 					t.Fatalf("wanted error %v, got nil", test.err)
 				}
@@ -395,11 +426,43 @@ func testStreamPack(t *testing.T, version uint) {
 				if !strings.Contains(err.Error(), test.err) {
 					t.Fatalf("wrong error returned, it should contain %q but was %q", test.err, err)
 				}
+				rtest.Equals(t, test.invalidData, errors.Is(err, restic.ErrInvalidData))
 			})
 		}
 	})
 }
 
+// BenchmarkStreamPack compares the allocations for loading pack files with
+// and without a BufferPool.
+func BenchmarkStreamPack(b *testing.B) {
+	dec, err := zstd.NewReader(nil)
+	rtest.OK(b, err)
+	defer dec.Close()
+	key := testKey(b)
+
+	blobSizes := make([]int, 64)
+	for i := range blobSizes {
+		blobSizes[i] = 256 * 1024
+	}
+	blobs, packfile := buildPackfileWithoutHeader(blobSizes, &key, true)
+	load := func(_ context.Context, _ backend.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+		return fn(bytes.NewReader(packfile[offset : offset+int64(length)]))
+	}
+	handleBlob := func(_ restic.BlobHandle, _ []byte, err error) error {
+		return err
+	}
+
+	for _, pool := range []*BufferPool{nil, NewBufferPool(4 * len(packfile))} {
+		b.Run(fmt.Sprintf("pool=%v", pool != nil), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(packfile)))
+			for i := 0; i < b.N; i++ {
+				rtest.OK(b, streamPack(context.TODO(), load, nil, dec, &key, pool, restic.ID{}, blobs, handleBlob))
+			}
+		})
+	}
+}
+
 func TestBlobVerification(t *testing.T) {
 	repo := TestRepository(t)
 
@@ -498,7 +561,7 @@ func TestUnpackedVerification(t *testing.T) {
 	}
 }
 
-func testKey(t *testing.T) crypto.Key {
+func testKey(t testing.TB) crypto.Key {
 	const jsonKey = `{"mac":{"k":"eQenuI8adktfzZMuC8rwdA==","r":"k8cfAly2qQSky48CQK7SBA=="},"encrypt":"MKO9gZnRiQFl8mDUurSDa9NMjiu9MUifUrODTHS05wo="}`
 
 	var key crypto.Key
@@ -563,7 +626,7 @@ func TestStreamPackFallback(t *testing.T) {
 			return err
 		}
 
-		err := streamPack(ctx, loadPack, loadBlob, dec, &key, restic.ID{}, blobs, handleBlob)
+		err := streamPack(ctx, loadPack, loadBlob, dec, &key, nil, restic.ID{}, blobs, handleBlob)
 		rtest.OK(t, err)
 		rtest.Assert(t, blobOK, "blob failed to load")
 	}
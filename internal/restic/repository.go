@@ -143,6 +143,41 @@ type Loader interface {
 	Connections() uint
 }
 
+// PackSectionsLoader is implemented by repositories which can download the
+// sections of a pack file without decoding them.
+type PackSectionsLoader interface {
+	// LoadPackSections is like Repository.LoadBlobsFromPack, but leaves
+	// decoding the downloaded sections of the pack file to the caller.
+	LoadPackSections(ctx context.Context, packID ID, blobs []BlobHandle, handleSectionFn func(section PackSection) error) error
+}
+
+// PackSection is a downloaded section of a pack file, see
+// PackSectionsLoader.
+type PackSection interface {
+	// Decode decrypts and decompresses the blobs of the section and passes
+	// them to handleBlobFn, see Repository.LoadBlobsFromPack.
+	Decode(ctx context.Context, handleBlobFn func(blob BlobHandle, buf []byte, err error) error) error
+	// LoadErr returns the error of downloading the section, if any. Decode
+	// then tries to load the blobs individually, which may still succeed.
+	LoadErr() error
+}
+
+// PackLoadError is passed to the blob handler of
+// Repository.LoadBlobsFromPack for a blob whose pack file could not be
+// downloaded and which could not be loaded individually either.
+type PackLoadError struct {
+	PackID ID
+	Err    error
+}
+
+func (e *PackLoadError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PackLoadError) Unwrap() error {
+	return e.Err
+}
+
 type WarmupJob interface {
 	// HandleCount returns the number of handles that are currently warming up.
 	HandleCount() int
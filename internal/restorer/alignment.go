@@ -0,0 +1,56 @@
+package restorer
+
+import "sync"
+
+// alignedBlocks assembles the content of a file into blocks of blockSize
+// bytes, which start at multiples of blockSize. Blobs may arrive in any order,
+// thus each block is buffered until all of its content is available. The last
+// block of the file only extends to the end of the file. It is safe for
+// concurrent use.
+type alignedBlocks struct {
+	m         sync.Mutex
+	size      int64
+	blockSize int64
+	pending   map[int64]*alignedBlock // by block index
+}
+
+type alignedBlock struct {
+	offset int64
+	data   []byte
+	filled int
+}
+
+func newAlignedBlocks(size, blockSize int64) *alignedBlocks {
+	return &alignedBlocks{
+		size:      size,
+		blockSize: blockSize,
+		pending:   make(map[int64]*alignedBlock),
+	}
+}
+
+// add copies data, which is located at offset in the file, into the blocks
+// it overlaps and returns the blocks which are complete afterwards.
+func (b *alignedBlocks) add(offset int64, data []byte) []*alignedBlock {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	var complete []*alignedBlock
+	for len(data) > 0 {
+		idx := offset / b.blockSize
+		block, ok := b.pending[idx]
+		if !ok {
+			start := idx * b.blockSize
+			block = &alignedBlock{offset: start, data: make([]byte, min(b.blockSize, b.size-start))}
+			b.pending[idx] = block
+		}
+		n := copy(block.data[offset-block.offset:], data)
+		block.filled += n
+		if block.filled == len(block.data) {
+			delete(b.pending, idx)
+			complete = append(complete, block)
+		}
+		data = data[n:]
+		offset += int64(n)
+	}
+	return complete
+}
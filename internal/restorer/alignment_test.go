@@ -0,0 +1,82 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestAlignedBlocks(t *testing.T) {
+	b := newAlignedBlocks(10, 4)
+
+	// the second block is only complete once both blobs were added
+	rtest.Equals(t, 0, len(b.add(6, []byte("gh"))))
+	complete := b.add(2, []byte("cdef"))
+	rtest.Equals(t, 1, len(complete))
+	rtest.Equals(t, int64(4), complete[0].offset)
+	rtest.Equals(t, "efgh", string(complete[0].data))
+
+	// a blob can complete several blocks, the tail is shorter
+	complete = b.add(0, []byte("ab"))
+	rtest.Equals(t, 1, len(complete))
+	rtest.Equals(t, "abcd", string(complete[0].data))
+	complete = b.add(8, []byte("ij"))
+	rtest.Equals(t, 1, len(complete))
+	rtest.Equals(t, int64(8), complete[0].offset)
+	rtest.Equals(t, "ij", string(complete[0].data))
+	rtest.Equals(t, 0, len(b.pending))
+}
+
+func TestFileRestorerWriteAlignment(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack2"},
+				{"data1-2", "pack1"},
+				{"data1-3", "pack2"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2", "pack1"},
+			},
+		},
+	}
+	repo := newTestRepo(content)
+
+	r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.writeAlignment = 4
+
+	var m sync.Mutex
+	writes := make(map[string][]int64)
+	r.setFaultInjector(&faultInjector{writeFile: func(path string, offset int64) error {
+		m.Lock()
+		defer m.Unlock()
+		writes[path] = append(writes[path], offset)
+		return nil
+	}})
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+
+	// 21 bytes result in five blocks of 4 bytes and the tail
+	offsets := writes[r.targetPath("file1")]
+	rtest.Equals(t, 6, len(offsets))
+	for _, offset := range offsets {
+		rtest.Assert(t, offset%4 == 0, "unaligned write at offset %d", offset)
+	}
+	rtest.Equals(t, 2, len(writes[r.targetPath("file2")]))
+
+	for _, file := range content {
+		data, err := os.ReadFile(r.targetPath(file.name))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.filesPathToContent[file.name], string(data))
+	}
+}
@@ -0,0 +1,43 @@
+package restorer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// loadAlternate loads the blob h from one of the other packs which contain it
+// according to the index, after its data in packID turned out to be damaged.
+// It returns nil if none of the other packs contains an intact copy.
+func (r *fileRestorer) loadAlternate(ctx context.Context, packID restic.ID, h restic.BlobHandle, length uint) []byte {
+	loader := r.faults.wrapLoader(r.blobsLoader)
+	for _, pb := range r.idx(h) {
+		alternate := pb.PackID()
+		if alternate.Equal(packID) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		var data []byte
+		err := loader(ctx, alternate, []restic.BlobHandle{h}, func(_ restic.BlobHandle, buf []byte, err error) error {
+			if err == nil && uint(len(buf)) == length {
+				// the loader may reuse buf after returning
+				data = bytes.Clone(buf)
+			}
+			return nil
+		})
+		if err != nil || data == nil {
+			debug.Log("%sblob %v is also unusable in pack %v: %v", r.logPrefix, h, alternate.Str(), err)
+			continue
+		}
+
+		r.Info(fmt.Sprintf("blob %v in pack %v is damaged, restored it from pack %v", h.ID.Str(), packID.Str(), alternate.Str()))
+		return data
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/repository/crypto"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRestorerAlternatePacks(t *testing.T) {
+	content := []TestFile{
+		{name: "file1", blobs: []TestBlob{{"data1-1", "pack1"}, {"data1-2", "pack1"}}},
+		// stores a second copy of the blob, like a repack without prune
+		{name: "duplicate", blobs: []TestBlob{{"data1-2", "pack2"}}},
+	}
+	damagedBlob := restic.Hash([]byte("data1-2"))
+
+	for _, test := range []struct {
+		name       string
+		alternates bool
+		allDamaged bool
+		failed     bool
+	}{
+		{"disabled", false, false, true},
+		{"intact copy", true, false, false},
+		{"all copies damaged", true, true, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			repo := newTestRepo(content)
+			primary := repo.blobs[damagedBlob][0].PackID()
+
+			r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+				repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+			r.files = repo.files[:1]
+			r.alternatePacks = test.alternates
+			r.setFaultInjector(&faultInjector{loadBlob: func(packID restic.ID, blob restic.BlobHandle) error {
+				if blob.ID.Equal(damagedBlob) && (test.allDamaged || packID.Equal(primary)) {
+					return fmt.Errorf("decrypting blob failed: %w: %w", crypto.ErrUnauthenticated, restic.ErrInvalidData)
+				}
+				return nil
+			}})
+			var failed []string
+			r.Error = func(location string, _ error) error {
+				failed = append(failed, location)
+				return nil
+			}
+			var infos []string
+			r.Info = func(message string) {
+				infos = append(infos, message)
+			}
+
+			rtest.OK(t, r.restoreFiles(context.TODO()))
+			if test.failed {
+				rtest.Equals(t, []string{"file1"}, failed)
+				rtest.Assert(t, r.corrupt.err() != nil, "expected the damaged blob to be recorded")
+				return
+			}
+			rtest.Equals(t, []string(nil), failed)
+			rtest.OK(t, r.corrupt.err())
+			rtest.Equals(t, 1, len(infos))
+			data, err := os.ReadFile(r.targetPath("file1"))
+			rtest.OK(t, err)
+			rtest.Equals(t, repo.fileContent(repo.files[0]), string(data))
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package restorer
+
+import (
+	"sync/atomic"
+
+	"github.com/restic/restic/internal/bloblru"
+	"github.com/restic/restic/internal/restic"
+)
+
+// BlobCacheStats summarizes how often the blob cache avoided downloading a
+// blob again, see Options.BlobCacheSize.
+type BlobCacheStats struct {
+	// Hits is the number of blobs which were taken from the cache.
+	Hits uint64
+	// HitBytes is the size of these blobs after decompression.
+	HitBytes uint64
+	// Misses is the number of blobs which were downloaded.
+	Misses uint64
+}
+
+// blobCache keeps recently downloaded blobs in memory, such that blobs which
+// are required again are not downloaded once more. This happens for example
+// for the batches of Options.SequentialFiles or if the same blob is stored in
+// multiple packs after a repack. It is safe for concurrent use, all methods
+// are no-ops for a nil receiver.
+type blobCache struct {
+	lru      *bloblru.Cache
+	hits     atomic.Uint64
+	hitBytes atomic.Uint64
+	misses   atomic.Uint64
+}
+
+func newBlobCache(size int) *blobCache {
+	return &blobCache{lru: bloblru.New(size)}
+}
+
+// get returns the cached content of blob id, which must not be modified.
+func (c *blobCache) get(id restic.ID) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	buf, ok := c.lru.Get(id)
+	if ok {
+		c.hits.Add(1)
+		c.hitBytes.Add(uint64(len(buf)))
+	}
+	return buf, ok
+}
+
+// contains reports whether all blobs are cached.
+func (c *blobCache) contains(blobs blobToFileOffsetsMapping) bool {
+	if c == nil {
+		return false
+	}
+	for id := range blobs {
+		if _, ok := c.lru.Get(id); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// wrapHandler returns a callback which adds a copy of each successfully
+// loaded blob to the cache before passing it on to handleBlobFn.
+func (c *blobCache) wrapHandler(handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) func(blob restic.BlobHandle, buf []byte, err error) error {
+	if c == nil {
+		return handleBlobFn
+	}
+	return func(blob restic.BlobHandle, buf []byte, err error) error {
+		c.misses.Add(1)
+		if err == nil {
+			// the loader reuses buf
+			c.lru.Add(blob.ID, append([]byte(nil), buf...))
+		}
+		return handleBlobFn(blob, buf, err)
+	}
+}
+
+func (c *blobCache) stats() BlobCacheStats {
+	if c == nil {
+		return BlobCacheStats{}
+	}
+	return BlobCacheStats{
+		Hits:     c.hits.Load(),
+		HitBytes: c.hitBytes.Load(),
+		Misses:   c.misses.Load(),
+	}
+}
+
+// BlobCache returns how often the blob cache avoided downloading a blob again.
+// It is only available once RestoreTo has completed and is empty if
+// Options.BlobCacheSize is not set.
+func (res *Restorer) BlobCache() BlobCacheStats {
+	return res.blobCache
+}
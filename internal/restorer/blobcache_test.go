@@ -0,0 +1,76 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRestorerBlobCache(t *testing.T) {
+	content := []TestFile{
+		{name: "file1", blobs: []TestBlob{{"data1-1", "pack1"}, {"shared", "pack1"}}},
+		{name: "file2", blobs: []TestBlob{{"shared", "pack1"}}},
+		{name: "file3", blobs: []TestBlob{{"shared", "pack1"}, {"data3-1", "pack2"}}},
+	}
+	for _, test := range []struct {
+		cacheSize int
+		sections  bool
+		loaded    int
+		fetched   uint64
+	}{
+		{cacheSize: 0, loaded: 5, fetched: 32},
+		{cacheSize: 1 << 20, loaded: 3, fetched: 20},
+		{cacheSize: 1 << 20, sections: true, loaded: 3, fetched: 20},
+	} {
+		t.Run(fmt.Sprintf("size=%v/sections=%v", test.cacheSize, test.sections), func(t *testing.T) {
+			repo := newTestRepo(content)
+			var m sync.Mutex
+			loaded := 0
+			loader := func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+				m.Lock()
+				loaded += len(blobs)
+				m.Unlock()
+				return repo.loader(ctx, packID, blobs, handleBlobFn)
+			}
+
+			r := newFileRestorer(rtest.TempDir(t), loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+				repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+			r.files = repo.files
+			// each file is restored separately, thus the shared blob is required three times
+			r.sequentialFiles = 1
+			if test.cacheSize > 0 {
+				r.blobCache = newBlobCache(test.cacheSize)
+			}
+			if test.sections {
+				r.decodeWorkers = 2
+				r.sectionsLoader = func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleSectionFn func(section restic.PackSection) error) error {
+					m.Lock()
+					loaded += len(blobs)
+					m.Unlock()
+					return handleSectionFn(&testPackSection{repo.loader, packID, blobs})
+				}
+			}
+			rtest.OK(t, r.restoreFiles(context.TODO()))
+
+			rtest.Equals(t, test.loaded, loaded)
+			stats := r.blobCache.stats()
+			if test.cacheSize > 0 {
+				rtest.Equals(t, uint64(2), stats.Hits)
+				rtest.Equals(t, uint64(2*len("shared")), stats.HitBytes)
+			}
+			// cached blobs were not fetched again
+			rtest.Equals(t, test.fetched, r.compression.stats().DecompressedBytes)
+			for _, file := range repo.files {
+				data, err := os.ReadFile(r.targetPath(file.location))
+				rtest.OK(t, err)
+				rtest.Equals(t, repo.fileContent(file), string(data))
+			}
+		})
+	}
+}
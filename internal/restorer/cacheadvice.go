@@ -0,0 +1,58 @@
+package restorer
+
+import "fmt"
+
+// CacheAdvice tells the operating system how the restored files are used,
+// which allows restoring large amounts of data without evicting the page
+// cache of other applications. The advice is only applied on Linux.
+type CacheAdvice int
+
+// Constants for the different values of CacheAdvice.
+const (
+	// CacheAdviceNone does not give any advice.
+	CacheAdviceNone CacheAdvice = iota
+	// CacheAdviceSequential advises that files are accessed sequentially,
+	// which increases the readahead when reading them, for example for
+	// Options.VerifyWrites.
+	CacheAdviceSequential
+	// CacheAdviceDontNeed drops the content of each file from the page cache
+	// once it has been written completely. As only data which is already on
+	// disk can be dropped, the file is synced first, which slows down the
+	// restore of many small files.
+	CacheAdviceDontNeed
+	CacheAdviceInvalid
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (a *CacheAdvice) Set(s string) error {
+	switch s {
+	case "none":
+		*a = CacheAdviceNone
+	case "sequential":
+		*a = CacheAdviceSequential
+	case "dont-need":
+		*a = CacheAdviceDontNeed
+	default:
+		*a = CacheAdviceInvalid
+		return fmt.Errorf("invalid cache advice %q, must be one of (none|sequential|dont-need)", s)
+	}
+
+	return nil
+}
+
+func (a *CacheAdvice) String() string {
+	switch *a {
+	case CacheAdviceNone:
+		return "none"
+	case CacheAdviceSequential:
+		return "sequential"
+	case CacheAdviceDontNeed:
+		return "dont-need"
+	default:
+		return "invalid"
+	}
+}
+
+func (a *CacheAdvice) Type() string {
+	return "advice"
+}
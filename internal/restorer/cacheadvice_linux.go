@@ -0,0 +1,34 @@
+package restorer
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/debug"
+	"golang.org/x/sys/unix"
+)
+
+// adviseOpen applies advice to f, which was just opened for writing.
+func adviseOpen(f *os.File, advice CacheAdvice) {
+	if advice != CacheAdviceSequential {
+		return
+	}
+	if err := unix.Fadvise(int(f.Fd()), 0, 0, unix.FADV_SEQUENTIAL); err != nil {
+		debug.Log("fadvise(%v, SEQUENTIAL) failed: %v", f.Name(), err)
+	}
+}
+
+// adviseClose applies advice to f before it is closed.
+func adviseClose(f *os.File, advice CacheAdvice) {
+	if advice != CacheAdviceDontNeed {
+		return
+	}
+	fd := int(f.Fd())
+	// dirty pages are not dropped
+	if err := unix.Fdatasync(fd); err != nil {
+		debug.Log("fdatasync(%v) failed: %v", f.Name(), err)
+		return
+	}
+	if err := unix.Fadvise(fd, 0, 0, unix.FADV_DONTNEED); err != nil {
+		debug.Log("fadvise(%v, DONTNEED) failed: %v", f.Name(), err)
+	}
+}
@@ -0,0 +1,78 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"unsafe"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+	"golang.org/x/sys/unix"
+)
+
+// residentPages returns the number of pages of the file at path which are in
+// the page cache.
+func residentPages(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	rtest.OK(t, err)
+	defer func() {
+		_ = f.Close()
+	}()
+	fi, err := f.Stat()
+	rtest.OK(t, err)
+	data, err := unix.Mmap(int(f.Fd()), 0, int(fi.Size()), unix.PROT_READ, unix.MAP_SHARED)
+	rtest.OK(t, err)
+	defer func() {
+		_ = unix.Munmap(data)
+	}()
+
+	pageSize := os.Getpagesize()
+	vec := make([]byte, (len(data)+pageSize-1)/pageSize)
+	_, _, errno := unix.Syscall(unix.SYS_MINCORE, uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&vec[0])))
+	if errno != 0 {
+		t.Fatalf("mincore failed: %v", errno)
+	}
+	resident := 0
+	for _, v := range vec {
+		if v&1 != 0 {
+			resident++
+		}
+	}
+	return resident
+}
+
+func TestFileRestorerCacheAdvice(t *testing.T) {
+	content := []TestFile{
+		{name: "file1", blobs: []TestBlob{{strings.Repeat("a", 10000), "pack1"}, {strings.Repeat("b", 10000), "pack2"}}},
+		{name: "file2", blobs: []TestBlob{{strings.Repeat("c", 10000), "pack2"}}},
+	}
+
+	for _, advice := range []CacheAdvice{CacheAdviceNone, CacheAdviceSequential, CacheAdviceDontNeed} {
+		t.Run(advice.String(), func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			repo := newTestRepo(content)
+			r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+				repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+			r.files = repo.files
+			r.filesWriter.cacheAdvice = advice
+
+			rtest.OK(t, r.restoreFiles(context.TODO()))
+
+			var st unix.Statfs_t
+			rtest.OK(t, unix.Statfs(tempdir, &st))
+			// the page cache is the storage of a tmpfs
+			checkCache := advice == CacheAdviceDontNeed && st.Type != unix.TMPFS_MAGIC
+			for _, file := range repo.files {
+				path := r.targetPath(file.location)
+				if checkCache {
+					rtest.Equals(t, 0, residentPages(t, path))
+				}
+				data, err := os.ReadFile(path)
+				rtest.OK(t, err)
+				rtest.Equals(t, repo.fileContent(file), string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package restorer
+
+import "os"
+
+// adviseOpen is not implemented on this platform.
+func adviseOpen(_ *os.File, _ CacheAdvice) {}
+
+// adviseClose is not implemented on this platform.
+func adviseClose(_ *os.File, _ CacheAdvice) {}
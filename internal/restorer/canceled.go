@@ -0,0 +1,97 @@
+package restorer
+
+import (
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// canceledFiles tracks the files whose restore was canceled using
+// Restorer.CancelFile. It is safe for concurrent use, all methods are no-ops
+// for a nil receiver.
+type canceledFiles struct {
+	m         sync.Mutex
+	locations map[string]struct{}
+	// canceled files which were encountered while restoring
+	skipped map[string]*fileInfo
+}
+
+func (c *canceledFiles) cancel(location string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.locations == nil {
+		c.locations = make(map[string]struct{})
+	}
+	c.locations[location] = struct{}{}
+}
+
+// skip reports whether the restore of file was canceled. If yes, the file is
+// recorded as skipped.
+func (c *canceledFiles) skip(file *fileInfo) bool {
+	if c == nil {
+		return false
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if _, ok := c.locations[file.location]; !ok {
+		return false
+	}
+	if c.skipped == nil {
+		c.skipped = make(map[string]*fileInfo)
+	}
+	c.skipped[file.location] = file
+	return true
+}
+
+// CancelFile stops restoring the content of the file at location, while the
+// restore of all other files continues. location uses the same format as
+// passed to Error. It can be called at any time, also while RestoreTo is
+// running. Once RestoreTo has completed, partially written files are removed,
+// the canceled files are listed by CanceledFiles. Files which were already
+// complete are not affected.
+func (res *Restorer) CancelFile(location string) {
+	res.canceled.cancel(location)
+}
+
+// CanceledFiles returns the sorted list of files which were not restored
+// completely as their restore was canceled via CancelFile. Neither their
+// content nor their metadata was restored.
+func (res *Restorer) CanceledFiles() []string {
+	return res.canceledFiles
+}
+
+// removeCanceledFiles removes the canceled files of which some content was
+// already written and returns the locations of all skipped files. Must only
+// be called once restoreFiles has completed.
+func (r *fileRestorer) removeCanceledFiles() ([]string, error) {
+	if r.canceled == nil {
+		return nil, nil
+	}
+	r.canceled.m.Lock()
+	defer r.canceled.m.Unlock()
+
+	var locations []string
+	for location, file := range r.canceled.skipped {
+		locations = append(locations, location)
+		if !file.inProgress {
+			continue
+		}
+		if _, ok := r.filesWriter.targets[r.targetPath(location)]; ok {
+			// target files were not created at their path
+			continue
+		}
+		debug.Log("%sremoving partially restored file %v", r.logPrefix, location)
+		err := fs.Remove(r.targetPath(location))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			if errFile := r.sanitizeError(file, err); errFile != nil {
+				return nil, errFile
+			}
+		}
+	}
+	slices.Sort(locations)
+	return locations, nil
+}
@@ -0,0 +1,95 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRestorerCancelFile(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	content := []TestFile{
+		{
+			name: "canceled",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "unaffected",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+			},
+		},
+		{
+			name: "never-started",
+			blobs: []TestBlob{
+				{"data3-1", "pack3"},
+			},
+		},
+	}
+	repo := newTestRepo(content)
+
+	canceled := &canceledFiles{}
+	canceled.cancel("never-started")
+	pack2 := repo.blobs[restic.Hash([]byte("data1-2"))][0].PackID()
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		if packID.Equal(pack2) {
+			// the first pack was already written
+			canceled.cancel("canceled")
+		}
+		return repo.loader(ctx, packID, handles, handleBlobFn)
+	}
+
+	r := newFileRestorer(tempdir, loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.canceled = canceled
+
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	locations, err := r.removeCanceledFiles()
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"canceled", "never-started"}, locations)
+
+	for _, name := range locations {
+		_, err := os.Stat(r.targetPath(name))
+		rtest.Assert(t, os.IsNotExist(err), "expected %v to be removed, got %v", name, err)
+	}
+	data, err := os.ReadFile(r.targetPath("unaffected"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "data2-1", string(data))
+}
+
+func TestRestorerCancelFile(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"canceled": File{Data: "content: canceled\n"},
+					"restored": File{Data: "content: restored\n"},
+				},
+			},
+		},
+	}, noopGetGenericAttributes)
+	tempdir := rtest.TempDir(t)
+
+	res := NewRestorer(repo, sn, Options{})
+	res.CancelFile("/dir/canceled")
+	count, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"/dir/canceled"}, res.CanceledFiles())
+	rtest.Equals(t, uint64(1), count)
+
+	_, err = os.Stat(filepath.Join(tempdir, "dir", "canceled"))
+	rtest.Assert(t, os.IsNotExist(err), "expected canceled file to be missing, got %v", err)
+	data, err := os.ReadFile(filepath.Join(tempdir, "dir", "restored"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content: restored\n", string(data))
+}
@@ -0,0 +1,72 @@
+package restorer
+
+import (
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ChangeAction describes how restoring a file changes the target.
+type ChangeAction string
+
+// Constants for the different FileChange actions.
+const (
+	ChangeCreated   ChangeAction = "created"
+	ChangeModified  ChangeAction = "modified"
+	ChangeUnchanged ChangeAction = "unchanged"
+)
+
+// FileChange describes the impact of restoring a regular file on the
+// existing target, see Options.ReportChanges.
+type FileChange struct {
+	Location string
+	Action   ChangeAction
+	// Size is the size of the file in the snapshot.
+	Size uint64
+	// OldSize is the size of the existing file, zero for created files.
+	OldSize uint64
+	// ChangedBytes is the amount of file content which is written.
+	ChangedBytes uint64
+}
+
+// SizeDelta returns the difference between the new and the old file size.
+func (c FileChange) SizeDelta() int64 {
+	return int64(c.Size) - int64(c.OldSize)
+}
+
+// recordChange adds the change caused by restoring node to target to the
+// report. matches is the state of the existing file, if it is restored.
+func (res *Restorer) recordChange(node *data.Node, target, location string, restore bool, matches *fileState) {
+	if !res.opts.ReportChanges {
+		return
+	}
+	change := FileChange{Location: location, Action: ChangeUnchanged, Size: node.Size}
+	fi, err := fs.Lstat(target)
+	if err == nil {
+		change.OldSize = uint64(fi.Size())
+	}
+
+	switch {
+	case err != nil && restore:
+		change.Action = ChangeCreated
+		change.ChangedBytes = node.Size
+	case restore && matches.NeedsRestore():
+		change.Action = ChangeModified
+		for i, blobID := range node.Content {
+			if matches.HasMatchingBlob(i) {
+				continue
+			}
+			size, _ := res.repo.LookupBlobSize(restic.BlobHandle{Type: restic.DataBlob, ID: blobID})
+			change.ChangedBytes += uint64(size)
+		}
+	}
+	res.changes = append(res.changes, change)
+}
+
+// Changes returns the changes to the regular files in the target, in the
+// order of the snapshot. It is only available if Options.ReportChanges is set
+// and also works for a dry run. Files which are not overwritten, as specified
+// by Options.Overwrite, are reported as unchanged.
+func (res *Restorer) Changes() []FileChange {
+	return res.changes
+}
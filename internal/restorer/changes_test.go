@@ -0,0 +1,46 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerReportChanges(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"created":   File{Data: "content: created\n"},
+			"modified":  File{Data: "content: modified\n"},
+			"unchanged": File{Data: "content: unchanged\n"},
+		},
+	}, noopGetGenericAttributes)
+	tempdir := rtest.TempDir(t)
+	rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "modified"), []byte("old"), 0600))
+	rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "unchanged"), []byte("content: unchanged\n"), 0600))
+
+	for _, dryRun := range []bool{true, false} {
+		res := NewRestorer(repo, sn, Options{DryRun: dryRun, ReportChanges: true})
+		_, err := res.RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+
+		rtest.Equals(t, []FileChange{
+			{Location: "/created", Action: ChangeCreated, Size: 17, ChangedBytes: 17},
+			{Location: "/modified", Action: ChangeModified, Size: 18, OldSize: 3, ChangedBytes: 18},
+			{Location: "/unchanged", Action: ChangeUnchanged, Size: 19, OldSize: 19},
+		}, res.Changes())
+		rtest.Equals(t, int64(15), res.Changes()[1].SizeDelta())
+	}
+
+	// the restore has updated all files
+	res := NewRestorer(repo, sn, Options{DryRun: true, ReportChanges: true})
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	for _, change := range res.Changes() {
+		rtest.Equals(t, ChangeUnchanged, change.Action)
+	}
+}
@@ -0,0 +1,135 @@
+package restorer
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// CoalesceStats describes how the blobs stored in multiple packs were assigned
+// to packs by Options.CoalescePacks, see Restorer.Coalesce.
+type CoalesceStats struct {
+	// DuplicateBlobs is the number of required blobs which are stored in
+	// more than one pack.
+	DuplicateBlobs uint64
+	// ReassignedBlobs is the number of those blobs which are not loaded from
+	// the first pack listed in the index.
+	ReassignedBlobs uint64
+	// DefaultPacks is the number of packs which would have been downloaded
+	// without coalescing, Packs the number of packs actually downloaded.
+	DefaultPacks uint64
+	Packs        uint64
+}
+
+// packCoalescer assigns each blob stored in multiple packs to one of them,
+// preferring packs which have to be downloaded anyway for other blobs. This
+// reduces the number of downloaded packs if the index contains duplicate
+// blobs, for example after a repack without a subsequent prune or after
+// several clients uploaded the same data concurrently. The assignment is computed once per
+// batch of files before the packs are scheduled, afterwards it is safe for
+// concurrent use. All methods use the first pack for a nil receiver.
+type packCoalescer struct {
+	// pack chosen for each blob stored in multiple packs
+	choice map[restic.ID]restic.PackBlob
+	totals CoalesceStats
+}
+
+// pack returns the pack from which the blob with the given id is loaded.
+// packs must not be empty.
+func (c *packCoalescer) pack(id restic.ID, packs []restic.PackBlob) restic.PackBlob {
+	if c != nil && len(packs) > 1 {
+		if pb, ok := c.choice[id]; ok {
+			return pb
+		}
+	}
+	return packs[0]
+}
+
+// plan assigns the blobs of files which are stored in multiple packs. Blobs
+// which must only be stored in a single pack decide which packs are
+// downloaded in any case. Each remaining blob is assigned to such a pack if
+// possible, otherwise to the pack which contains the most of the remaining
+// blobs, which is then downloaded in any case as well.
+func (c *packCoalescer) plan(ctx context.Context, files []*fileInfo, idx func(restic.BlobHandle) []restic.PackBlob) error {
+	c.choice = make(map[restic.ID]restic.PackBlob)
+	required := restic.NewIDSet()
+	defaults := restic.NewIDSet()
+	votes := make(map[restic.ID]int)
+	duplicates := make(map[restic.ID][]restic.PackBlob)
+	var order restic.IDs
+
+	for _, file := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		blobIDs, ok := file.blobs.(restic.IDs)
+		if !ok {
+			continue
+		}
+		for i, id := range blobIDs {
+			if file.state.HasMatchingBlob(i) {
+				continue
+			}
+			packs := idx(restic.BlobHandle{Type: restic.DataBlob, ID: id})
+			if len(packs) == 0 {
+				// reported by forEachBlob
+				continue
+			}
+			defaults.Insert(packs[0].PackID())
+			if len(packs) == 1 {
+				required.Insert(packs[0].PackID())
+				continue
+			}
+			if _, ok := duplicates[id]; ok {
+				continue
+			}
+			duplicates[id] = packs
+			order = append(order, id)
+			for _, pb := range packs {
+				votes[pb.PackID()]++
+			}
+		}
+	}
+
+	for _, id := range order {
+		packs := duplicates[id]
+		chosen := -1
+		for i, pb := range packs {
+			if required.Has(pb.PackID()) {
+				chosen = i
+				break
+			}
+		}
+		if chosen < 0 {
+			chosen = 0
+			for i, pb := range packs {
+				if votes[pb.PackID()] > votes[packs[chosen].PackID()] {
+					chosen = i
+				}
+			}
+		}
+		required.Insert(packs[chosen].PackID())
+		c.choice[id] = packs[chosen]
+		if chosen != 0 {
+			c.totals.ReassignedBlobs++
+		}
+	}
+
+	c.totals.DuplicateBlobs += uint64(len(order))
+	c.totals.DefaultPacks += uint64(len(defaults))
+	c.totals.Packs += uint64(len(required))
+	return nil
+}
+
+func (c *packCoalescer) stats() CoalesceStats {
+	if c == nil {
+		return CoalesceStats{}
+	}
+	return c.totals
+}
+
+// Coalesce returns how the blobs stored in multiple packs were assigned for
+// Options.CoalescePacks. It is only available once RestoreTo has completed.
+func (res *Restorer) Coalesce() CoalesceStats {
+	return res.coalesce
+}
@@ -0,0 +1,92 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRestorerCoalescePacks(t *testing.T) {
+	content := []TestFile{
+		{name: "file1", blobs: []TestBlob{{"data-a", "old1"}, {"data-b", "old1"}}},
+		{name: "file2", blobs: []TestBlob{{"data-c", "old2"}, {"data-d", "old2"}}},
+		// a repack stored b and c in a new pack, the old packs are still indexed
+		{name: "repacked", blobs: []TestBlob{{"data-b", "new"}, {"data-c", "new"}}},
+	}
+	blobB := restic.Hash([]byte("data-b"))
+	blobC := restic.Hash([]byte("data-c"))
+
+	for _, test := range []struct {
+		name string
+		// files to restore
+		files []int
+		// list the new pack first in the index
+		newFirst     bool
+		coalesce     bool
+		packs        int
+		reassigned   uint64
+		defaultPacks uint64
+	}{
+		{"disabled", []int{0, 1}, true, false, 3, 0, 0},
+		{"packs of other blobs", []int{0, 1}, true, true, 2, 2, 3},
+		{"most blobs", []int{2}, false, true, 1, 2, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			repo := newTestRepo(content)
+			var newPack restic.ID
+			for _, pb := range repo.blobs[blobB] {
+				if slices.ContainsFunc(repo.blobs[blobC], func(other restic.PackBlob) bool { return other.PackID() == pb.PackID() }) {
+					newPack = pb.PackID()
+				}
+			}
+			for _, id := range []restic.ID{blobB, blobC} {
+				slices.SortFunc(repo.blobs[id], func(a, b restic.PackBlob) int {
+					if (a.PackID() == newPack) == test.newFirst {
+						return -1
+					}
+					return 1
+				})
+			}
+
+			var m sync.Mutex
+			loaded := restic.NewIDSet()
+			loader := func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+				m.Lock()
+				loaded.Insert(packID)
+				m.Unlock()
+				return repo.loader(ctx, packID, blobs, handleBlobFn)
+			}
+
+			r := newFileRestorer(rtest.TempDir(t), loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+				repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+			for _, i := range test.files {
+				r.files = append(r.files, repo.files[i])
+			}
+			if test.coalesce {
+				r.coalesce = &packCoalescer{}
+			}
+
+			rtest.OK(t, r.restoreFiles(context.TODO()))
+			for _, file := range r.files {
+				data, err := os.ReadFile(r.targetPath(file.location))
+				rtest.OK(t, err)
+				rtest.Equals(t, repo.fileContent(file), string(data))
+			}
+			rtest.Equals(t, test.packs, len(loaded))
+
+			stats := r.coalesce.stats()
+			if test.coalesce {
+				rtest.Equals(t, uint64(2), stats.DuplicateBlobs)
+				rtest.Equals(t, uint64(test.packs), stats.Packs)
+			}
+			rtest.Equals(t, test.reassigned, stats.ReassignedBlobs)
+			rtest.Equals(t, test.defaultPacks, stats.DefaultPacks)
+		})
+	}
+}
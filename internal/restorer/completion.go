@@ -0,0 +1,94 @@
+package restorer
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// SnapshotOrder compares two locations according to the order in which they
+// are contained in the snapshot. It can be used as Options.CompletionOrder.
+func SnapshotOrder(a, b string) int {
+	sep := string(filepath.Separator)
+	return slices.Compare(strings.Split(a, sep), strings.Split(b, sep))
+}
+
+// fileCompletion passes the files whose content was restored completely to
+// Restorer.FileCompleted. If cmp is set, the files of a batch are released in
+// that order, files which complete early are buffered until all previous
+// files are complete. It is safe for concurrent use.
+type fileCompletion struct {
+	m    sync.Mutex
+	fn   func(location string)
+	cmp  func(a, b string) int
+	done map[*fileInfo]struct{}
+	// files of the current batch in the order of cmp, which were not yet
+	// released
+	pending []*fileInfo
+}
+
+func newFileCompletion(fn func(location string), cmp func(a, b string) int) *fileCompletion {
+	return &fileCompletion{fn: fn, cmp: cmp, done: make(map[*fileInfo]struct{})}
+}
+
+// sort orders files according to c.cmp.
+func (c *fileCompletion) sort(files []*fileInfo) {
+	if c == nil || c.cmp == nil {
+		return
+	}
+	slices.SortStableFunc(files, func(a, b *fileInfo) int {
+		return c.cmp(a.location, b.location)
+	})
+}
+
+// start must be called with the files of a batch, ordered by sort, before
+// restoring any of them.
+func (c *fileCompletion) start(files []*fileInfo) {
+	if c == nil || c.cmp == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.pending = slices.Clone(files)
+}
+
+// complete records that the content of file was restored completely.
+func (c *fileCompletion) complete(file *fileInfo) {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if c.cmp == nil {
+		c.fn(file.location)
+		return
+	}
+	c.done[file] = struct{}{}
+	c.release(false)
+}
+
+// finish releases the remaining completed files of a batch. Files which were
+// not completed, for example due to an error, are skipped.
+func (c *fileCompletion) finish() {
+	if c == nil || c.cmp == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.release(true)
+	c.pending = nil
+}
+
+func (c *fileCompletion) release(skipIncomplete bool) {
+	for len(c.pending) > 0 {
+		file := c.pending[0]
+		if _, ok := c.done[file]; ok {
+			delete(c.done, file)
+			c.fn(file.location)
+		} else if !skipIncomplete {
+			return
+		}
+		c.pending = c.pending[1:]
+	}
+}
@@ -0,0 +1,114 @@
+package restorer
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestSnapshotOrder(t *testing.T) {
+	locations := []string{"/a.b", "/a/c", "/a/b/c", "/a"}
+	for i := range locations {
+		locations[i] = filepath.FromSlash(locations[i])
+	}
+	files := make([]*fileInfo, 0, len(locations))
+	for _, location := range locations {
+		files = append(files, &fileInfo{location: location})
+	}
+	newFileCompletion(nil, SnapshotOrder).sort(files)
+
+	var sorted []string
+	for _, file := range files {
+		sorted = append(sorted, filepath.ToSlash(file.location))
+	}
+	rtest.Equals(t, []string{"/a", "/a/b/c", "/a/c", "/a.b"}, sorted)
+}
+
+func TestFileCompletion(t *testing.T) {
+	var released []string
+	c := newFileCompletion(func(location string) {
+		released = append(released, location)
+	}, strings.Compare)
+
+	files := []*fileInfo{{location: "a"}, {location: "b"}, {location: "c"}, {location: "d"}}
+	c.start(files)
+	c.complete(files[1])
+	c.complete(files[3])
+	rtest.Equals(t, 0, len(released))
+	c.complete(files[0])
+	rtest.Equals(t, []string{"a", "b"}, released)
+	// c failed, thus d is only released once the batch is finished
+	c.finish()
+	rtest.Equals(t, []string{"a", "b", "d"}, released)
+}
+
+func TestFileRestorerCompletion(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack1"},
+			},
+		},
+		{
+			name:  "file3",
+			blobs: []TestBlob{},
+		},
+	}
+	repo := newTestRepo(content)
+
+	r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	// the files are passed in the order of pack downloads, unless an order is specified
+	for _, test := range []struct {
+		cmp      func(a, b string) int
+		expected []string
+	}{
+		{nil, []string{"file3", "file2", "file1"}},
+		{strings.Compare, []string{"file1", "file2", "file3"}},
+	} {
+		var completed []string
+		r.files = newTestRepo(content).files
+		r.completion = newFileCompletion(func(location string) {
+			completed = append(completed, location)
+		}, test.cmp)
+		rtest.OK(t, r.restoreFiles(context.TODO()))
+		rtest.Equals(t, test.expected, completed)
+	}
+}
+
+func TestRestorerCompletionBuffer(t *testing.T) {
+	repo := repository.TestRepository(t)
+	nodes := make(map[string]Node)
+	var expected []string
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		nodes[name] = Dir{
+			Nodes: map[string]Node{
+				"file": File{Data: "content: " + name + "\n"},
+			},
+		}
+		expected = append(expected, filepath.FromSlash("/"+name+"/file"))
+	}
+	sn, _ := saveSnapshot(t, repo, Snapshot{Nodes: nodes}, noopGetGenericAttributes)
+
+	res := NewRestorer(repo, sn, Options{CompletionOrder: SnapshotOrder, CompletionBuffer: 2})
+	var completed []string
+	res.FileCompleted = func(location string) {
+		completed = append(completed, location)
+	}
+	_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.OK(t, err)
+	rtest.Equals(t, expected, completed)
+}
@@ -0,0 +1,72 @@
+package restorer
+
+import "sync/atomic"
+
+// CompressionStats summarizes the file content fetched from the repository,
+// see Restorer.Compression. Both compressed and uncompressed blobs are
+// included, such that the ratio is also accurate for repositories which
+// contain both.
+type CompressionStats struct {
+	// FetchedBytes is the size of the fetched blobs as stored in the packs.
+	FetchedBytes uint64
+	// DecompressedBytes is the size of the fetched blobs after decryption
+	// and decompression.
+	DecompressedBytes uint64
+	// CompressedBlobs is the number of fetched blobs which were compressed.
+	CompressedBlobs uint64
+}
+
+// Ratio returns how many bytes of file content were restored from each
+// fetched byte. It returns zero if nothing was fetched.
+func (s CompressionStats) Ratio() float64 {
+	if s.FetchedBytes == 0 {
+		return 0
+	}
+	return float64(s.DecompressedBytes) / float64(s.FetchedBytes)
+}
+
+// compressionStats collects CompressionStats, it is safe for concurrent use.
+type compressionStats struct {
+	fetched      atomic.Uint64
+	decompressed atomic.Uint64
+	compressed   atomic.Uint64
+	// size of the file content written from the fetched blobs
+	written atomic.Uint64
+}
+
+// add records a blob which was stored using stored bytes in the pack and
+// whose content has a size of plaintext bytes.
+func (c *compressionStats) add(stored, plaintext uint, compressed bool) {
+	c.fetched.Add(uint64(stored))
+	c.decompressed.Add(uint64(plaintext))
+	if compressed {
+		c.compressed.Add(1)
+	}
+}
+
+// write records that a fetched blob of the given size was written to a file.
+func (c *compressionStats) write(size int) {
+	c.written.Add(uint64(size))
+}
+
+func (c *compressionStats) dedup() DedupStats {
+	return DedupStats{
+		LogicalBytes: c.written.Load(),
+		UniqueBytes:  c.decompressed.Load(),
+	}
+}
+
+func (c *compressionStats) stats() CompressionStats {
+	return CompressionStats{
+		FetchedBytes:      c.fetched.Load(),
+		DecompressedBytes: c.decompressed.Load(),
+		CompressedBlobs:   c.compressed.Load(),
+	}
+}
+
+// Compression returns how much the compression of the file content reduced
+// the amount of data fetched from the repository. It is only available once
+// RestoreTo has completed and is empty for a dry run.
+func (res *Restorer) Compression() CompressionStats {
+	return res.compression
+}
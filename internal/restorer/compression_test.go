@@ -0,0 +1,93 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerCompression(t *testing.T) {
+	compressible := strings.Repeat("content: compressible\n", 1000)
+	random := string(rtest.Random(42, 1000))
+
+	for _, test := range []struct {
+		version    uint
+		compressed uint64
+	}{
+		{1, 0},
+		{2, 2},
+	} {
+		t.Run(fmt.Sprintf("v%d", test.version), func(t *testing.T) {
+			repo, _, _ := repository.TestRepositoryWithVersion(t, test.version)
+			sn, _ := saveSnapshot(t, repo, Snapshot{
+				Nodes: map[string]Node{
+					"compressible": File{Data: compressible},
+					"duplicate":    File{Data: compressible},
+					"random":       File{Data: random},
+				},
+			}, noopGetGenericAttributes)
+
+			res := NewRestorer(repo, sn, Options{})
+			_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+			rtest.OK(t, err)
+
+			stats := res.Compression()
+			// blobs used by two files are only fetched once
+			rtest.Equals(t, uint64(len(compressible)+len(random)), stats.DecompressedBytes)
+			rtest.Equals(t, test.compressed, stats.CompressedBlobs)
+			if test.version == 1 {
+				rtest.Assert(t, stats.FetchedBytes > stats.DecompressedBytes, "expected encryption overhead, got %+v", stats)
+			} else {
+				rtest.Assert(t, stats.Ratio() > 5, "expected high compression ratio, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestCompressionStatsMixed(t *testing.T) {
+	var c compressionStats
+	c.add(100, 1000, true)
+	c.add(132, 100, false)
+	stats := c.stats()
+	rtest.Equals(t, CompressionStats{FetchedBytes: 232, DecompressedBytes: 1100, CompressedBlobs: 1}, stats)
+	rtest.Equals(t, 1100.0/232.0, stats.Ratio())
+	rtest.Equals(t, 0.0, CompressionStats{}.Ratio())
+}
+
+type dedupProgress struct {
+	*testProgress
+	stats DedupStats
+}
+
+func (p *dedupProgress) ReportDedup(stats DedupStats) {
+	p.stats = stats
+}
+
+func TestRestorerDedup(t *testing.T) {
+	repo := repository.TestRepository(t)
+	content := strings.Repeat("content: duplicate\n", 100)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"a": File{Data: content},
+			"b": File{Data: content},
+			"c": File{DataParts: []string{content, "unique\n"}},
+		},
+	}, noopGetGenericAttributes)
+
+	progress := &dedupProgress{testProgress: newTestProgress()}
+	res := NewRestorer(repo, sn, Options{Progress: progress})
+	_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.OK(t, err)
+
+	expected := DedupStats{
+		LogicalBytes: uint64(3*len(content) + len("unique\n")),
+		UniqueBytes:  uint64(len(content) + len("unique\n")),
+	}
+	rtest.Equals(t, expected, res.Dedup())
+	rtest.Equals(t, expected, progress.stats)
+	rtest.Assert(t, expected.Ratio() > 2.9, "unexpected ratio %v", expected.Ratio())
+}
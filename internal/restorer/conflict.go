@@ -0,0 +1,171 @@
+package restorer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// ConflictReason is the reason why an item cannot be restored under its
+// desired name, see ConflictResolver.
+type ConflictReason int
+
+// Constants for the different conflict reasons.
+const (
+	// ConflictNameInUse is used if another item of the restore already uses
+	// the name, which happens for Options.Flatten.
+	ConflictNameInUse ConflictReason = iota
+	// ConflictNameTooLong is used if the name or path of the item exceeds the
+	// limits of the target platform, see Options.LongPaths.
+	ConflictNameTooLong
+)
+
+func (r ConflictReason) String() string {
+	switch r {
+	case ConflictNameInUse:
+		return "name in use"
+	case ConflictNameTooLong:
+		return "name too long"
+	default:
+		return "invalid"
+	}
+}
+
+// Conflict describes an item which cannot be restored under its desired name.
+type Conflict struct {
+	Reason ConflictReason
+	// Location is the location of the item in the snapshot.
+	Location string
+	// Name is the desired name of the item.
+	Name string
+	// Existing is the location of the item which already uses Name, only set
+	// for ConflictNameInUse.
+	Existing string
+	// InUse reports whether a name is already used. For ConflictNameTooLong,
+	// it only knows the names assigned to other too long items in the same
+	// directory.
+	InUse func(name string) bool
+	// MaxLength is the maximum length of the name as counted by the target
+	// platform, that is in bytes or in UTF-16 code units on Windows. It is
+	// only set for ConflictNameTooLong.
+	MaxLength int
+}
+
+// ConflictResolver decides how to restore items which cannot be restored
+// under their desired name, see Options.ConflictResolver.
+type ConflictResolver interface {
+	// Resolve returns the name to restore the item as, which must not
+	// contain path separators. An empty name skips the item. An error is
+	// reported for the item, which is skipped as well. Resolve is called at
+	// most once for each item, while holding a lock which blocks restoring
+	// other items with conflicts.
+	Resolve(c Conflict) (name string, err error)
+}
+
+// ConflictResolverFunc adapts a function to a ConflictResolver.
+type ConflictResolverFunc func(c Conflict) (string, error)
+
+// Resolve calls f(c).
+func (f ConflictResolverFunc) Resolve(c Conflict) (string, error) {
+	return f(c)
+}
+
+// DefaultConflictResolver returns the resolver implementing the given
+// behaviors for flattened names and for too long names.
+func DefaultConflictResolver(collision FlattenCollisionBehavior, longPaths LongPathBehavior) ConflictResolver {
+	return ConflictResolverFunc(func(c Conflict) (string, error) {
+		switch c.Reason {
+		case ConflictNameInUse:
+			if collision == FlattenCollisionFail {
+				return "", errors.Errorf("flattened name %v is already used by %v", c.Name, c.Existing)
+			}
+			return suffixName(c), nil
+		case ConflictNameTooLong:
+			switch longPaths {
+			case LongPathTruncate:
+				return truncateName(c), nil
+			case LongPathHash:
+				return hashName(c), nil
+			case LongPathSkip:
+				return "", nil
+			}
+			// creating the item fails later on
+			return c.Name, nil
+		}
+		return "", errors.Errorf("invalid conflict reason %v", c.Reason)
+	})
+}
+
+// conflictResolver returns Options.ConflictResolver or the default resolver
+// for the options.
+func (res *Restorer) conflictResolver() ConflictResolver {
+	if res.opts.ConflictResolver != nil {
+		return res.opts.ConflictResolver
+	}
+	return DefaultConflictResolver(res.opts.FlattenCollision, res.opts.LongPaths)
+}
+
+// resolveConflict calls resolver and checks that the returned name is valid.
+func resolveConflict(resolver ConflictResolver, c Conflict) (string, error) {
+	name, err := resolver.Resolve(c)
+	if err != nil || name == "" {
+		return "", err
+	}
+	if name == "." || name == ".." || strings.ContainsRune(name, filepath.Separator) || strings.ContainsRune(name, '/') {
+		return "", errors.Errorf("invalid name %q for %v", name, c.Location)
+	}
+	if c.InUse != nil && c.InUse(name) {
+		return "", errors.Errorf("name %v for %v is already used", name, c.Location)
+	}
+	return name, nil
+}
+
+// suffixName appends the first counter to the name which results in an unused
+// name, keeping the file extension intact.
+func suffixName(c Conflict) string {
+	ext := filepath.Ext(filepath.Base(c.Location))
+	base := strings.TrimSuffix(c.Name, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if c.InUse == nil || !c.InUse(candidate) {
+			return candidate
+		}
+	}
+}
+
+// truncateName shortens the name until it fits, keeping the file extension
+// intact. If the truncated name is already used, it falls back to hashName.
+func truncateName(c Conflict) string {
+	ext := filepath.Ext(c.Name)
+	if pathLength(ext) >= c.MaxLength {
+		ext = ""
+	}
+	short := truncatePathName(strings.TrimSuffix(c.Name, ext), c.MaxLength-pathLength(ext))
+	if short == "" {
+		return ""
+	}
+	if c.InUse != nil && c.InUse(short+ext) {
+		return hashName(c)
+	}
+	return short + ext
+}
+
+// hashName shortens the name until it fits and appends a hash of the original
+// name, such that the shortened names stay unique.
+func hashName(c Conflict) string {
+	ext := filepath.Ext(c.Name)
+	sum := sha256.Sum256([]byte(c.Name))
+	suffix := "~" + hex.EncodeToString(sum[:])[:longPathHashLength]
+	if pathLength(suffix+ext) > c.MaxLength {
+		ext = ""
+	}
+	if pathLength(suffix) > c.MaxLength {
+		return ""
+	}
+	suffix += ext
+	return truncatePathName(strings.TrimSuffix(c.Name, ext), c.MaxLength-pathLength(suffix)) + suffix
+}
@@ -0,0 +1,94 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerConflictResolver(t *testing.T) {
+	repo := repository.TestRepository(t)
+	longFile := strings.Repeat("f", 300) + ".txt"
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"a": Dir{Nodes: map[string]Node{
+				"b": File{Data: "content: nested\n"},
+			}},
+			"a_b":    File{Data: "content: collision\n"},
+			longFile: File{Data: "content: long\n"},
+			"skip":   Dir{Nodes: map[string]Node{strings.Repeat("s", 300): File{Data: "content: skipped\n"}}},
+		},
+	}, noopGetGenericAttributes)
+
+	var m sync.Mutex
+	var conflicts []string
+	resolver := ConflictResolverFunc(func(c Conflict) (string, error) {
+		m.Lock()
+		conflicts = append(conflicts, c.Reason.String()+" "+filepath.ToSlash(c.Location))
+		m.Unlock()
+		switch {
+		case c.Reason == ConflictNameInUse:
+			rtest.Assert(t, c.InUse(c.Name), "name %v is not in use", c.Name)
+			return "renamed_" + c.Name, nil
+		case strings.HasPrefix(c.Location, filepath.FromSlash("/skip/")):
+			return "", nil
+		}
+		rtest.Equals(t, maxNameLength, c.MaxLength)
+		return "long.txt", nil
+	})
+
+	for _, flatten := range []bool{false, true} {
+		tempdir := rtest.TempDir(t)
+		conflicts = nil
+		res := NewRestorer(repo, sn, Options{Flatten: flatten, ConflictResolver: resolver})
+		var failed []string
+		res.Error = func(location string, _ error) error {
+			m.Lock()
+			defer m.Unlock()
+			failed = append(failed, filepath.ToSlash(location))
+			return nil
+		}
+		_, err := res.RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+
+		files := map[string]string{"long.txt": "content: long\n"}
+		expected := []string{"name too long /" + longFile, "name too long /skip/" + strings.Repeat("s", 300)}
+		var expectedFailed []string
+		if flatten {
+			// long flattened names are not checked
+			files = map[string]string{"a_b": "content: nested\n", "renamed_a_b": "content: collision\n"}
+			expected = []string{"name in use /a_b"}
+			expectedFailed = []string{"/" + longFile, "/skip/" + strings.Repeat("s", 300)}
+		} else {
+			files["a_b"] = "content: collision\n"
+			files[filepath.Join("a", "b")] = "content: nested\n"
+		}
+		sort.Strings(conflicts)
+		rtest.Equals(t, expected, conflicts)
+		sort.Strings(failed)
+		rtest.Equals(t, expectedFailed, slices.Compact(failed))
+		for name, content := range files {
+			data, err := os.ReadFile(filepath.Join(tempdir, name))
+			rtest.OK(t, err)
+			rtest.Equals(t, content, string(data))
+		}
+	}
+}
+
+func TestResolveConflictInvalidName(t *testing.T) {
+	used := func(name string) bool { return name == "used" }
+	for _, name := range []string{"..", "a/b", "used"} {
+		_, err := resolveConflict(ConflictResolverFunc(func(_ Conflict) (string, error) {
+			return name, nil
+		}), Conflict{Reason: ConflictNameInUse, Location: "/x", Name: "x", InUse: used})
+		rtest.Assert(t, err != nil, "expected an error for name %q", name)
+	}
+}
@@ -0,0 +1,92 @@
+package restorer
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository/crypto"
+	"github.com/restic/restic/internal/restic"
+)
+
+// CorruptBlob is a blob which could not be restored as its data stored in
+// the pack is damaged.
+type CorruptBlob struct {
+	Blob restic.BlobHandle
+	Pack restic.ID
+	// Unauthenticated is set if the blob failed the authentication check,
+	// otherwise it could not be decompressed or has the wrong hash.
+	Unauthenticated bool
+}
+
+// CorruptBlobsError is returned by RestoreTo once the restore has completed,
+// if damaged blobs were encountered. The affected files are reported to
+// Restorer.Error.
+type CorruptBlobsError struct {
+	Blobs []CorruptBlob
+}
+
+func (e *CorruptBlobsError) Error() string {
+	return fmt.Sprintf("found %d damaged blobs in %d packs", len(e.Blobs), len(e.Packs()))
+}
+
+// Packs returns the sorted list of packs which contain damaged blobs.
+func (e *CorruptBlobsError) Packs() restic.IDs {
+	packs := restic.NewIDSet()
+	for _, blob := range e.Blobs {
+		packs.Insert(blob.Pack)
+	}
+	return packs.List()
+}
+
+// corruptBlobs collects the damaged blobs found while restoring. It is safe
+// for concurrent use.
+type corruptBlobs struct {
+	m     sync.Mutex
+	blobs map[restic.BlobHandle]CorruptBlob
+}
+
+// record adds the blob if err reports that its data is damaged and returns
+// err annotated with the kind of damage. Other errors, for example while
+// downloading the pack, are returned unchanged.
+func (c *corruptBlobs) record(packID restic.ID, h restic.BlobHandle, err error) error {
+	if !errors.Is(err, restic.ErrInvalidData) {
+		return err
+	}
+	unauthenticated := errors.Is(err, crypto.ErrUnauthenticated)
+
+	c.m.Lock()
+	if c.blobs == nil {
+		c.blobs = make(map[restic.BlobHandle]CorruptBlob)
+	}
+	c.blobs[h] = CorruptBlob{Blob: h, Pack: packID, Unauthenticated: unauthenticated}
+	c.m.Unlock()
+
+	if unauthenticated {
+		return fmt.Errorf("damaged blob, authentication failed: %w", err)
+	}
+	return fmt.Errorf("damaged blob: %w", err)
+}
+
+// err returns a CorruptBlobsError listing all recorded blobs or nil.
+func (c *corruptBlobs) err() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if len(c.blobs) == 0 {
+		return nil
+	}
+
+	blobs := make([]CorruptBlob, 0, len(c.blobs))
+	for _, blob := range c.blobs {
+		blobs = append(blobs, blob)
+	}
+	slices.SortFunc(blobs, func(a, b CorruptBlob) int {
+		if c := bytes.Compare(a.Pack[:], b.Pack[:]); c != 0 {
+			return c
+		}
+		return bytes.Compare(a.Blob.ID[:], b.Blob.ID[:])
+	})
+	return &CorruptBlobsError{Blobs: blobs}
+}
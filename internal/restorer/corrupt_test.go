@@ -0,0 +1,101 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/repository/crypto"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRestorerCorruptBlobs(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	repo := newTestRepo([]TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+			},
+		},
+		{
+			name: "file3",
+			blobs: []TestBlob{
+				{"data3-1", "pack3"},
+			},
+		},
+		{
+			name: "file4",
+			blobs: []TestBlob{
+				{"data4-1", "pack4"},
+			},
+		},
+	})
+
+	unauthenticated := restic.Hash([]byte("data1-1"))
+	hashMismatch := restic.Hash([]byte("data2-1"))
+	readFailed := restic.Hash([]byte("data3-1"))
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		return repo.loader(ctx, packID, handles, func(blob restic.BlobHandle, buf []byte, err error) error {
+			switch blob.ID {
+			case unauthenticated:
+				err = fmt.Errorf("decrypting blob failed: %w: %w", crypto.ErrUnauthenticated, restic.ErrInvalidData)
+			case hashMismatch:
+				err = fmt.Errorf("wrong data returned: %w", restic.ErrInvalidData)
+			case readFailed:
+				// not caused by damaged data
+				err = errors.New("read failed")
+			}
+			if err != nil {
+				buf = nil
+			}
+			return handleBlobFn(blob, buf, err)
+		})
+	}
+
+	r := newFileRestorer(tempdir, loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	var m sync.Mutex
+	var failed []string
+	r.Error = func(location string, err error) error {
+		m.Lock()
+		defer m.Unlock()
+		failed = append(failed, location)
+		return nil
+	}
+
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	sort.Strings(failed)
+	rtest.Equals(t, []string{"file1", "file2", "file3"}, failed)
+
+	err := r.corrupt.err()
+	var corruptErr *CorruptBlobsError
+	rtest.Assert(t, errors.As(err, &corruptErr), "unexpected error %v", err)
+	pack1 := repo.blobs[unauthenticated][0].PackID()
+	pack2 := repo.blobs[hashMismatch][0].PackID()
+	want := []CorruptBlob{
+		{Blob: restic.BlobHandle{ID: unauthenticated, Type: restic.DataBlob}, Pack: pack1, Unauthenticated: true},
+		{Blob: restic.BlobHandle{ID: hashMismatch, Type: restic.DataBlob}, Pack: pack2},
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i].Pack.String() < want[j].Pack.String() })
+	rtest.Equals(t, want, corruptErr.Blobs)
+	rtest.Equals(t, 2, len(corruptErr.Packs()))
+
+	data, err := os.ReadFile(r.targetPath("file4"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "data4-1", string(data))
+}
@@ -0,0 +1,37 @@
+package restorer
+
+// DedupStats summarizes how much the deduplication of the file content
+// reduced the amount of content fetched from the repository, see
+// Restorer.Dedup.
+type DedupStats struct {
+	// LogicalBytes is the size of the file content written from fetched
+	// blobs. Blobs which are used multiple times are counted for each use.
+	LogicalBytes uint64
+	// UniqueBytes is the size of the distinct fetched blobs after
+	// decompression. Blobs which are fetched multiple times, for example for
+	// several batches of Options.SequentialFiles, are counted for each fetch.
+	UniqueBytes uint64
+}
+
+// Ratio returns how many bytes of file content were written for each unique
+// byte. It returns zero if nothing was fetched.
+func (s DedupStats) Ratio() float64 {
+	if s.UniqueBytes == 0 {
+		return 0
+	}
+	return float64(s.LogicalBytes) / float64(s.UniqueBytes)
+}
+
+// DedupReporter is implemented by a ProgressReporter which includes the
+// DedupStats in its summary.
+type DedupReporter interface {
+	// ReportDedup is called once the content of all files was restored.
+	ReportDedup(stats DedupStats)
+}
+
+// Dedup returns how much the deduplication of the file content reduced the
+// amount of data fetched from the repository. It is only available once
+// RestoreTo has completed and is empty for a dry run.
+func (res *Restorer) Dedup() DedupStats {
+	return res.dedup
+}
@@ -0,0 +1,59 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// DeleteAllError is returned if Options.Delete would remove all items of the
+// target directory, as none of them is contained in the snapshot. This
+// usually means that the wrong snapshot or target directory was chosen, see
+// Options.DeleteAll.
+type DeleteAllError struct {
+	Target  string
+	Entries int
+}
+
+func (e *DeleteAllError) Error() string {
+	return fmt.Sprintf("refusing to delete all %d items in %v, none of them is contained in the snapshot", e.Entries, e.Target)
+}
+
+// checkDeleteAll returns a DeleteAllError if Options.Delete would remove all
+// items of the target directory dst. An empty target is always accepted.
+func (res *Restorer) checkDeleteAll(ctx context.Context, dst string) error {
+	entries, err := fs.Readdirnames(fs.NewLocal(), dst, fs.O_NOFOLLOW)
+	if errors.Is(err, os.ErrNotExist) || len(entries) == 0 {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	tree, err := data.LoadTree(ctx, res.repo, *res.sn.Tree)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]struct{})
+	for item := range tree {
+		if item.Error != nil {
+			return item.Error
+		}
+		keep[toComparableFilename(item.Node.Name)] = struct{}{}
+	}
+
+	for _, entry := range entries {
+		if _, ok := keep[toComparableFilename(entry)]; ok {
+			return nil
+		}
+		// entries which are not selected for restore are never deleted
+		if selected, _ := res.SelectFilter(filepath.Join(string(filepath.Separator), entry), false); !selected {
+			return nil
+		}
+	}
+	return &DeleteAllError{Target: dst, Entries: len(entries)}
+}
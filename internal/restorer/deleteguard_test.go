@@ -0,0 +1,71 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestoreDeleteAll(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, test := range []struct {
+		name      string
+		opts      Options
+		existing  []string
+		deleted   bool
+		refused   bool
+		warnings  int
+		selectAll bool
+	}{
+		{"unrelated target", Options{Delete: true}, []string{"other"}, false, true, 0, true},
+		{"overlapping target", Options{Delete: true}, []string{"foo", "other"}, true, false, 0, true},
+		{"empty target", Options{Delete: true}, nil, false, false, 0, true},
+		{"delete all", Options{Delete: true, DeleteAll: true}, []string{"other"}, true, false, 0, true},
+		{"dry run", Options{Delete: true, DryRun: true}, []string{"other"}, false, false, 1, true},
+		{"not selected", Options{Delete: true}, []string{"other"}, false, false, 0, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			for _, name := range test.existing {
+				rtest.OK(t, os.WriteFile(filepath.Join(tempdir, name), []byte("existing\n"), 0o600))
+			}
+
+			res := NewRestorer(repo, sn, test.opts)
+			if !test.selectAll {
+				res.SelectFilter = func(item string, isDir bool) (bool, bool) {
+					return item != filepath.FromSlash("/other"), isDir
+				}
+			}
+			warnings := 0
+			res.Warn = func(_ string) {
+				warnings++
+			}
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			if test.refused {
+				rtest.Assert(t, errors.As(err, new(*DeleteAllError)), "expected DeleteAllError, got %v", err)
+			} else {
+				rtest.OK(t, err)
+			}
+			rtest.Equals(t, test.warnings, warnings)
+
+			for _, name := range test.existing {
+				if name == "foo" {
+					continue
+				}
+				_, err := os.Stat(filepath.Join(tempdir, name))
+				rtest.Assert(t, test.deleted == errors.Is(err, os.ErrNotExist), "unexpected state of %v: %v", name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// DeltaSummary lists the items which differ between Options.DeltaBase and the
+// restored snapshot, in the order of the snapshot.
+type DeltaSummary struct {
+	// Created are the items which do not exist in the base snapshot.
+	Created []string
+	// Updated are the items whose content or metadata changed.
+	Updated []string
+	// Deleted are the items which only exist in the base snapshot. The
+	// content of a deleted directory is not listed separately.
+	Deleted []string
+}
+
+// snapshotDelta is the difference between the trees of two snapshots.
+type snapshotDelta struct {
+	// created or updated items
+	changed map[string]struct{}
+	// directories which contain changed items
+	dirs    map[string]struct{}
+	summary DeltaSummary
+}
+
+// diffSnapshots compares the tree of the snapshot to restore against the base
+// tree. Subtrees with the same ID are skipped without loading them.
+func diffSnapshots(ctx context.Context, repo restic.BlobLoader, base, tree restic.ID) (*snapshotDelta, error) {
+	d := &snapshotDelta{
+		changed: make(map[string]struct{}),
+		dirs:    make(map[string]struct{}),
+	}
+	if _, err := d.diffTrees(ctx, repo, string(filepath.Separator), &base, tree); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func loadTreeNodes(ctx context.Context, repo restic.BlobLoader, id *restic.ID) (map[string]*data.Node, []string, error) {
+	nodes := make(map[string]*data.Node)
+	if id == nil {
+		return nodes, nil, nil
+	}
+	tree, err := data.LoadTree(ctx, repo, *id)
+	if err != nil {
+		return nil, nil, err
+	}
+	var names []string
+	for item := range tree {
+		if item.Error != nil {
+			return nil, nil, item.Error
+		}
+		nodes[item.Node.Name] = item.Node
+		names = append(names, item.Node.Name)
+	}
+	return nodes, names, nil
+}
+
+// diffTrees records the changes between the directory at location in the base
+// snapshot, which may be nil if it does not exist, and the restored snapshot.
+// It returns whether the directory contains changes.
+func (d *snapshotDelta) diffTrees(ctx context.Context, repo restic.BlobLoader, location string, base *restic.ID, tree restic.ID) (bool, error) {
+	if base != nil && base.Equal(tree) {
+		return false, nil
+	}
+
+	baseNodes, baseNames, err := loadTreeNodes(ctx, repo, base)
+	if err != nil {
+		return false, err
+	}
+	nodes, names, err := loadTreeNodes(ctx, repo, &tree)
+	if err != nil {
+		return false, err
+	}
+
+	hasChanges := false
+	for _, name := range names {
+		node := nodes[name]
+		nodeLocation := filepath.Join(location, name)
+		baseNode, ok := baseNodes[name]
+		if ok && baseNode.Type != node.Type {
+			// the base item must be replaced as a whole, thus it is listed as
+			// deleted and the new item as created
+			ok = false
+			d.summary.Deleted = append(d.summary.Deleted, nodeLocation)
+		}
+
+		switch {
+		case !ok:
+			d.changed[nodeLocation] = struct{}{}
+			d.summary.Created = append(d.summary.Created, nodeLocation)
+			hasChanges = true
+		case !sameMetadata(node, baseNode):
+			d.changed[nodeLocation] = struct{}{}
+			d.summary.Updated = append(d.summary.Updated, nodeLocation)
+			hasChanges = true
+		}
+
+		if node.Type == data.NodeTypeDir && node.Subtree != nil {
+			var baseSubtree *restic.ID
+			if ok {
+				baseSubtree = baseNode.Subtree
+			}
+			dirChanged, err := d.diffTrees(ctx, repo, nodeLocation, baseSubtree, *node.Subtree)
+			if err != nil {
+				return false, err
+			}
+			if dirChanged {
+				d.dirs[nodeLocation] = struct{}{}
+				hasChanges = true
+			}
+		}
+	}
+
+	for _, name := range baseNames {
+		if _, ok := nodes[name]; !ok {
+			d.summary.Deleted = append(d.summary.Deleted, filepath.Join(location, name))
+			hasChanges = true
+		}
+	}
+	return hasChanges, nil
+}
+
+// sameMetadata compares two nodes of the same type, ignoring the subtree of
+// directories.
+func sameMetadata(a, b *data.Node) bool {
+	aCopy, bCopy := *a, *b
+	aCopy.Subtree, bCopy.Subtree = nil, nil
+	return aCopy.Equals(bCopy)
+}
+
+// filter restricts the result of the SelectFilter to the changed items.
+func (d *snapshotDelta) filter(location string, selectedForRestore, childMayBeSelected bool) (bool, bool) {
+	if d == nil {
+		return selectedForRestore, childMayBeSelected
+	}
+	_, changed := d.changed[location]
+	_, hasChanges := d.dirs[location]
+	return selectedForRestore && changed, childMayBeSelected && hasChanges
+}
+
+// removeDeleted removes the items which only exist in the base snapshot from
+// the target directory, unless they are excluded by the SelectFilter.
+func (res *Restorer) removeDeleted(dst string) error {
+	for _, location := range res.delta.summary.Deleted {
+		if selected, _ := res.SelectFilter(location, false); !selected {
+			continue
+		}
+		target := filepath.Join(dst, location)
+		debug.Log("%sremoving %v, which was deleted since the base snapshot", res.logPrefix, target)
+		if !res.opts.DryRun {
+			if err := fs.RemoveAll(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+				if errLoc := res.sanitizeError(location, err); errLoc != nil {
+					return errLoc
+				}
+				continue
+			}
+		}
+		res.opts.Progress.ReportDeletion(target)
+	}
+	return nil
+}
+
+// Delta returns the differences between Options.DeltaBase and the restored
+// snapshot. It returns nil unless Options.DeltaBase is set.
+func (res *Restorer) Delta() *DeltaSummary {
+	if res.delta == nil {
+		return nil
+	}
+	return &res.delta.summary
+}
@@ -0,0 +1,83 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerDelta(t *testing.T) {
+	repo := repository.TestRepository(t)
+	// the inodes must be stable to detect unchanged files
+	base, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"same":    File{Data: "same\n", Inode: 1},
+				"changed": File{DataParts: []string{"part-1\n", "part-2\n"}, Inode: 2},
+				"gone":    File{Data: "gone\n", Inode: 3},
+			}},
+			"unchanged": Dir{Nodes: map[string]Node{
+				"file": File{Data: "unchanged\n", Inode: 4},
+			}},
+			"replaced": File{Data: "file\n", Inode: 5},
+		},
+	}, noopGetGenericAttributes)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"same":    File{Data: "same\n", Inode: 1},
+				"changed": File{DataParts: []string{"part-1\n", "part-X\n"}, Inode: 2},
+				"new":     File{Data: "new\n", Inode: 6},
+			}},
+			"unchanged": Dir{Nodes: map[string]Node{
+				"file": File{Data: "unchanged\n", Inode: 4},
+			}},
+			"replaced": Dir{Nodes: map[string]Node{
+				"file": File{Data: "in dir\n", Inode: 7},
+			}},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, deleteItems := range []bool{false, true} {
+		tempdir := rtest.TempDir(t)
+		_, err := NewRestorer(repo, base, Options{}).RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+		// unchanged files are not checked, thus local modifications are kept
+		for _, name := range []string{"dir/same", "unchanged/file"} {
+			rtest.OK(t, os.WriteFile(filepath.Join(tempdir, filepath.FromSlash(name)), []byte("local\n"), 0o600))
+		}
+		if !deleteItems {
+			// the type of the replaced item can only change once it is removed
+			rtest.OK(t, os.Remove(filepath.Join(tempdir, "replaced")))
+		}
+
+		res := NewRestorer(repo, sn, Options{DeltaBase: base, DeltaDelete: deleteItems})
+		_, err = res.RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+
+		loc := filepath.FromSlash
+		rtest.Equals(t, &DeltaSummary{
+			Created: []string{loc("/dir/new"), loc("/replaced"), loc("/replaced/file")},
+			Updated: []string{loc("/dir/changed")},
+			Deleted: []string{loc("/dir/gone"), loc("/replaced")},
+		}, res.Delta())
+
+		for name, content := range map[string]string{
+			"dir/same":       "local\n",
+			"dir/changed":    "part-1\npart-X\n",
+			"dir/new":        "new\n",
+			"unchanged/file": "local\n",
+			"replaced/file":  "in dir\n",
+		} {
+			data, err := os.ReadFile(filepath.Join(tempdir, filepath.FromSlash(name)))
+			rtest.OK(t, err)
+			rtest.Equals(t, content, string(data), name)
+		}
+		_, err = os.Lstat(filepath.Join(tempdir, "dir", "gone"))
+		rtest.Equals(t, deleteItems, os.IsNotExist(err))
+	}
+}
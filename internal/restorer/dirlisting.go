@@ -0,0 +1,112 @@
+package restorer
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+)
+
+// dirListingCacheSize is the number of directory listings kept in memory.
+// The tree is traversed depth-first, thus only few directories are consulted
+// at the same time.
+const dirListingCacheSize = 16
+
+// dirListing answers whether items exist in the target directory by listing
+// each directory once, instead of checking each item individually, see
+// Options.DirListingLimit. Directories with more than limit entries or which
+// cannot be listed are checked per item. It is safe for concurrent use, all
+// methods fall back to checking the item for a nil receiver.
+type dirListing struct {
+	limit int
+
+	m sync.Mutex
+	// entries by name for each listed directory, nil if the directory is
+	// checked per item
+	dirs  map[string]map[string]os.DirEntry
+	order []string
+}
+
+func newDirListing(limit int) *dirListing {
+	return &dirListing{limit: limit, dirs: make(map[string]map[string]os.DirEntry)}
+}
+
+// lookup returns the entry for path. known is false if the directory of path
+// is not listed.
+func (l *dirListing) lookup(path string) (entry os.DirEntry, exists bool, known bool) {
+	if l == nil {
+		return nil, false, false
+	}
+	dir, name := filepath.Split(path)
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	entries, ok := l.dirs[dir]
+	if !ok {
+		entries = l.list(dir)
+		if len(l.order) >= dirListingCacheSize {
+			delete(l.dirs, l.order[0])
+			l.order = l.order[1:]
+		}
+		l.dirs[dir] = entries
+		l.order = append(l.order, dir)
+	}
+	if entries == nil {
+		return nil, false, false
+	}
+	entry, exists = entries[name]
+	return entry, exists, true
+}
+
+// list returns the entries of dir or nil if it has too many entries.
+func (l *dirListing) list(dir string) map[string]os.DirEntry {
+	f, err := fs.OpenFile(dir, fs.O_RDONLY, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		// the directory will be created, thus it is still empty
+		return make(map[string]os.DirEntry)
+	}
+	if err != nil {
+		debug.Log("cannot list %v, checking each item: %v", dir, err)
+		return nil
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	list, err := f.ReadDir(l.limit + 1)
+	if err != nil && err != io.EOF {
+		debug.Log("cannot list %v, checking each item: %v", dir, err)
+		return nil
+	}
+	if len(list) > l.limit {
+		debug.Log("%v contains more than %d entries, checking each item", dir, l.limit)
+		return nil
+	}
+	entries := make(map[string]os.DirEntry, len(list))
+	for _, entry := range list {
+		entries[entry.Name()] = entry
+	}
+	return entries
+}
+
+// missing reports whether the listing shows that path does not exist.
+func (l *dirListing) missing(path string) bool {
+	_, exists, known := l.lookup(path)
+	return known && !exists
+}
+
+// lstat is like fs.Lstat, but answers from the listing if possible.
+func (l *dirListing) lstat(path string) (os.FileInfo, error) {
+	entry, exists, known := l.lookup(path)
+	if !known {
+		return fs.Lstat(path)
+	}
+	if !exists {
+		return nil, &os.PathError{Op: "lstat", Path: path, Err: os.ErrNotExist}
+	}
+	return entry.Info()
+}
@@ -0,0 +1,97 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestDirListing(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	small := filepath.Join(tempdir, "small")
+	large := filepath.Join(tempdir, "large")
+	for _, name := range []string{"small/a", "large/a", "large/b", "large/c"} {
+		path := filepath.Join(tempdir, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(path), 0700))
+		rtest.OK(t, os.WriteFile(path, []byte("content"), 0600))
+	}
+
+	l := newDirListing(2)
+	fi, err := l.lstat(filepath.Join(small, "a"))
+	rtest.OK(t, err)
+	rtest.Equals(t, int64(7), fi.Size())
+	rtest.Assert(t, l.missing(filepath.Join(small, "b")), "expected small/b to be missing")
+	_, err = l.lstat(filepath.Join(small, "b"))
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "unexpected error %v", err)
+
+	// large directories are checked per item
+	_, _, known := l.lookup(filepath.Join(large, "d"))
+	rtest.Assert(t, !known, "expected large directory not to be listed")
+	rtest.Assert(t, !l.missing(filepath.Join(large, "d")), "missing must only be reported for listed directories")
+	_, err = l.lstat(filepath.Join(large, "a"))
+	rtest.OK(t, err)
+
+	// directories which do not exist yet are empty
+	rtest.Assert(t, l.missing(filepath.Join(tempdir, "new", "a")), "expected new/a to be missing")
+
+	var nilListing *dirListing
+	rtest.Assert(t, !nilListing.missing(filepath.Join(small, "b")), "nil listing must not report missing items")
+	_, err = nilListing.lstat(filepath.Join(small, "a"))
+	rtest.OK(t, err)
+}
+
+func TestRestorerDirListing(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"existing": File{Data: "content: existing\n"},
+				"modified": File{Data: "content: modified\n"},
+				"new":      File{Data: "content: new\n"},
+			}},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, test := range []struct {
+		overwrite OverwriteBehavior
+		expected  map[string]string
+	}{
+		{
+			overwrite: OverwriteAlways,
+			expected: map[string]string{
+				"existing": "content: existing\n",
+				"modified": "content: modified\n",
+				"new":      "content: new\n",
+			},
+		},
+		{
+			overwrite: OverwriteNever,
+			expected: map[string]string{
+				"existing": "content: existing\n",
+				"modified": "local change\n",
+				"new":      "content: new\n",
+			},
+		},
+	} {
+		t.Run(test.overwrite.String(), func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			rtest.OK(t, os.MkdirAll(filepath.Join(tempdir, "dir"), 0700))
+			rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "dir", "existing"), []byte("content: existing\n"), 0600))
+			rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "dir", "modified"), []byte("local change\n"), 0600))
+
+			res := NewRestorer(repo, sn, Options{Overwrite: test.overwrite, DirListingLimit: 10})
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.OK(t, err)
+			for name, content := range test.expected {
+				data, err := os.ReadFile(filepath.Join(tempdir, "dir", name))
+				rtest.OK(t, err)
+				rtest.Equals(t, content, string(data), "unexpected content of %v", name)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package restorer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// DirOwnerPolicy specifies how to handle files whose parent directory in the
+// target is owned by an unexpected user, see Options.DirOwnerPolicy.
+type DirOwnerPolicy int
+
+// Constants for different directory owner policies
+const (
+	// DirOwnerIgnore does not check the owner of the parent directories.
+	DirOwnerIgnore DirOwnerPolicy = iota
+	// DirOwnerWarn reports each parent directory owned by an unexpected user
+	// as a warning, but restores the files.
+	DirOwnerWarn
+	// DirOwnerEnforce reports an error for each file whose parent directory is
+	// owned by an unexpected user and does not restore it.
+	DirOwnerEnforce
+	DirOwnerInvalid
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (p *DirOwnerPolicy) Set(s string) error {
+	switch s {
+	case "ignore":
+		*p = DirOwnerIgnore
+	case "warn":
+		*p = DirOwnerWarn
+	case "enforce":
+		*p = DirOwnerEnforce
+	default:
+		*p = DirOwnerInvalid
+		return fmt.Errorf("invalid directory owner policy %q, must be one of (ignore|warn|enforce)", s)
+	}
+
+	return nil
+}
+
+func (p *DirOwnerPolicy) String() string {
+	switch *p {
+	case DirOwnerIgnore:
+		return "ignore"
+	case DirOwnerWarn:
+		return "warn"
+	case DirOwnerEnforce:
+		return "enforce"
+	default:
+		return "invalid"
+	}
+}
+
+func (p *DirOwnerPolicy) Type() string {
+	return "policy"
+}
+
+// DirOwnerError is reported for a file whose parent directory is owned by an
+// unexpected user.
+type DirOwnerError struct {
+	Dir string
+	UID uint32
+	// Expected is the owner stored in the snapshot, if known.
+	Expected *uint32
+}
+
+func (e *DirOwnerError) Error() string {
+	if e.Expected == nil {
+		return fmt.Sprintf("parent directory %v is owned by unexpected user %d", e.Dir, e.UID)
+	}
+	return fmt.Sprintf("parent directory %v is owned by user %d instead of %d", e.Dir, e.UID, *e.Expected)
+}
+
+// dirOwnerCheck verifies the owner of the directories into which files are
+// written, see Options.DirOwnerPolicy. A directory is accepted if it is owned
+// by root, by the user running the restore or by the owner stored in the
+// snapshot. Each directory is only checked once. It must not be used
+// concurrently, all methods are no-ops for a nil receiver.
+type dirOwnerCheck struct {
+	euid  int
+	idMap *fs.IDMap
+	// owner of the directories stored in the snapshot by target path
+	expected map[string]uint32
+	// result of the check by target path
+	checked map[string]error
+}
+
+// newDirOwnerCheck returns nil if the policy does not require checks. The
+// ownership is irrelevant on Windows, where euid is -1.
+func newDirOwnerCheck(policy DirOwnerPolicy, euid int, idMap *fs.IDMap) *dirOwnerCheck {
+	if policy == DirOwnerIgnore || euid < 0 {
+		return nil
+	}
+	return &dirOwnerCheck{
+		euid:     euid,
+		idMap:    idMap,
+		expected: make(map[string]uint32),
+		checked:  make(map[string]error),
+	}
+}
+
+// enterDir records the owner of the directory at target stored in node.
+func (c *dirOwnerCheck) enterDir(node *data.Node, target string) {
+	if c == nil || node == nil {
+		return
+	}
+	if uid, ok := c.idMap.MapUID(node.UID); ok {
+		c.expected[target] = uid
+	}
+}
+
+// check returns a DirOwnerError if dir is owned by an unexpected user. first
+// is true if dir was not checked before.
+func (c *dirOwnerCheck) check(dir string) (first bool, err error) {
+	if c == nil {
+		return false, nil
+	}
+	if err, ok := c.checked[dir]; ok {
+		return false, err
+	}
+	err = c.verify(dir)
+	c.checked[dir] = err
+	return true, err
+}
+
+func (c *dirOwnerCheck) verify(dir string) error {
+	fi, err := fs.Lstat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		// only the case for a dry run, the directory would be created by the restore
+		return nil
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	uid := fs.ExtendedStat(fi).UID
+	if uid == 0 || uid == uint32(c.euid) {
+		return nil
+	}
+	if expected, ok := c.expected[dir]; ok {
+		if uid == expected {
+			return nil
+		}
+		return &DirOwnerError{Dir: dir, UID: uid, Expected: &expected}
+	}
+	return &DirOwnerError{Dir: dir, UID: uid}
+}
+
+// checkDirOwner verifies the owner of the parent directory of target before
+// the file at location is written into it. skip is true if the file must not
+// be restored.
+func (res *Restorer) checkDirOwner(node *data.Node, target, location string) (skip bool, err error) {
+	first, ownerErr := res.dirOwner.check(filepath.Dir(target))
+	if ownerErr == nil {
+		return false, nil
+	}
+	if res.opts.DirOwnerPolicy == DirOwnerWarn {
+		if first {
+			res.Warn(ownerErr.Error())
+		}
+		return false, nil
+	}
+	debug.Log("%snot restoring %v: %v", res.logPrefix, location, ownerErr)
+	res.report.add(location, ReportFailed, node.Size, "")
+	return true, res.Error(location, ownerErr)
+}
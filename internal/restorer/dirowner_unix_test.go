@@ -0,0 +1,114 @@
+//go:build !windows
+
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// foreignDir creates dir owned by neither root nor the returned user id.
+func foreignDir(t *testing.T, dir string) (euid int) {
+	rtest.OK(t, os.MkdirAll(dir, 0o755))
+	if os.Geteuid() != 0 {
+		// pretend to run as a different user than the owner of dir
+		return os.Geteuid() + 1
+	}
+	rtest.OK(t, os.Chown(dir, 4242, 4242))
+	return 0
+}
+
+func TestDirOwnerCheck(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	dir := filepath.Join(tempdir, "dir")
+	euid := foreignDir(t, dir)
+	fi, err := os.Lstat(dir)
+	rtest.OK(t, err)
+	owner := fs.ExtendedStat(fi).UID
+
+	c := newDirOwnerCheck(DirOwnerEnforce, euid, nil)
+	first, err := c.check(dir)
+	rtest.Assert(t, first, "expected first check")
+	var ownerErr *DirOwnerError
+	rtest.Assert(t, errors.As(err, &ownerErr), "unexpected error %v", err)
+	rtest.Equals(t, owner, ownerErr.UID)
+	first, err = c.check(dir)
+	rtest.Assert(t, !first && err != nil, "expected cached error, got %v", err)
+
+	// the owner stored in the snapshot is accepted
+	c = newDirOwnerCheck(DirOwnerEnforce, euid, nil)
+	c.enterDir(&data.Node{UID: owner}, dir)
+	_, err = c.check(dir)
+	rtest.OK(t, err)
+
+	// directories which do not exist yet are created by the restore
+	_, err = c.check(filepath.Join(tempdir, "missing"))
+	rtest.OK(t, err)
+
+	rtest.Assert(t, newDirOwnerCheck(DirOwnerIgnore, euid, nil) == nil, "expected no check for ignore policy")
+	rtest.Assert(t, newDirOwnerCheck(DirOwnerEnforce, -1, nil) == nil, "expected no check without user ids")
+}
+
+func TestRestorerDirOwnerPolicy(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing the owner of the target directory requires root privileges")
+	}
+
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file": File{Data: "content: file\n"},
+			}},
+			"top": File{Data: "content: top\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, test := range []struct {
+		policy   DirOwnerPolicy
+		restored bool
+		errors   int
+		warnings int
+	}{
+		{DirOwnerIgnore, true, 0, 0},
+		{DirOwnerWarn, true, 0, 1},
+		{DirOwnerEnforce, false, 1, 0},
+	} {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			// the snapshot expects the directory to be owned by root
+			_ = foreignDir(t, filepath.Join(tempdir, "dir"))
+
+			res := NewRestorer(repo, sn, Options{DirOwnerPolicy: test.policy})
+			var errs []error
+			res.Error = func(_ string, err error) error {
+				errs = append(errs, err)
+				return nil
+			}
+			warnings := 0
+			res.Warn = func(_ string) {
+				warnings++
+			}
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.errors, len(errs))
+			rtest.Equals(t, test.warnings, warnings)
+			for _, err := range errs {
+				rtest.Assert(t, errors.As(err, new(*DirOwnerError)), "unexpected error %v", err)
+			}
+
+			_, err = os.Stat(filepath.Join(tempdir, "dir", "file"))
+			rtest.Assert(t, test.restored == (err == nil), "unexpected state of dir/file: %v", err)
+			_, err = os.Stat(filepath.Join(tempdir, "top"))
+			rtest.OK(t, err)
+		})
+	}
+}
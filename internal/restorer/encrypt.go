@@ -0,0 +1,112 @@
+package restorer
+
+import (
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository/crypto"
+)
+
+// ContentEncryption configures the restorer to write the content of regular
+// files in encrypted form. Each file is stored as nonce, ciphertext and
+// authentication tag, that is the same format as used for repository blobs.
+// Thus, the plaintext can be retrieved by passing the file content without the
+// leading nonce to Key.Open.
+//
+// The content is encrypted using AES-256 in counter mode, which allows
+// encrypting the blobs in the order in which they are downloaded without
+// buffering the file. The Poly1305-AES authentication tag is computed by
+// reading the ciphertext back once all blobs are written.
+//
+// With PerFileKeys, each file is encrypted using its own key, see FileKey.
+// This allows handing out the key of a single file for decryption without
+// revealing the content of the other files.
+//
+// The encryption only protects the file content. The names, sizes and
+// metadata of the files remain visible. The authentication tag of a file
+// does not cover its location, thus files encrypted with the same key can be
+// swapped unnoticed. Per-file keys prevent this, but then a renamed file can
+// only be decrypted using the key for its original location.
+//
+// Existing files are always restored from scratch. Encrypted files cannot be
+// checked by Restorer.VerifyFiles.
+type ContentEncryption struct {
+	Key *crypto.Key
+	// PerFileKeys encrypts each file using the key returned by FileKey
+	// instead of Key.
+	PerFileKeys bool
+	// Nonce returns the nonce for the file at location. It must not return the
+	// same nonce twice for the same key and may be called concurrently. If
+	// nil, random nonces are used.
+	Nonce func(location string) []byte
+}
+
+// fileKeyInfo is the prefix of the HKDF info used to derive per-file keys.
+const fileKeyInfo = "restic restore file key\x00"
+
+// FileKey returns the key for the file at location, which is its path within
+// the snapshot, for example "/home/user/file". With PerFileKeys, it is derived
+// from Key using HKDF-SHA256 as described for crypto.Key.Derive, with the info
+// "restic restore file key", a zero byte and the location. Otherwise, it
+// returns Key.
+func (e *ContentEncryption) FileKey(location string) *crypto.Key {
+	if !e.PerFileKeys {
+		return e.Key
+	}
+	return e.Key.Derive(fileKeyInfo + location)
+}
+
+func (e *ContentEncryption) nonce(location string) []byte {
+	if e.Nonce == nil {
+		return crypto.NewRandomNonce()
+	}
+	return e.Nonce(location)
+}
+
+// writeEncrypted encrypts blob and writes it to file. The key and the nonce
+// for the file are selected by the write which creates the file.
+func (r *fileRestorer) writeEncrypted(file *fileInfo, blob []byte, offset int64, createSize int64) error {
+	if createSize >= 0 {
+		// the file lock is held by the caller
+		file.key = r.encryption.FileKey(file.location)
+		file.nonce = r.encryption.nonce(file.location)
+		createSize += crypto.Extension
+	}
+
+	buf := make([]byte, len(blob))
+	file.key.XORKeyStreamAt(buf, blob, file.nonce, offset)
+	// the sparse flag is ignored, ciphertext is never sparse
+	return r.filesWriter.writeToFile(r.targetPath(file.location), buf, int64(len(file.nonce))+offset, createSize, false, false)
+}
+
+// sealEncrypted writes the nonce and the authentication tag of an encrypted
+// file. Must be called once the whole file content was written.
+func (r *fileRestorer) sealEncrypted(file *fileInfo) error {
+	debug.Log("%ssealing encrypted file %v", r.logPrefix, file.location)
+	f, err := fs.OpenFile(r.targetPath(file.location), fs.O_RDWR|fs.O_NOFOLLOW, 0600)
+	if err != nil {
+		return err
+	}
+
+	nonceSize := int64(len(file.nonce))
+	mac := file.key.NewMAC(file.nonce)
+	buf := make([]byte, 1<<20)
+	for pos := int64(0); pos < file.size; {
+		n := min(int64(len(buf)), file.size-pos)
+		if _, err := f.ReadAt(buf[:n], nonceSize+pos); err != nil {
+			_ = f.Close()
+			return err
+		}
+		_, _ = mac.Write(buf[:n])
+		pos += n
+	}
+
+	if _, err := f.WriteAt(file.nonce, 0); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if _, err := f.WriteAt(mac.Sum(nil), nonceSize+file.size); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
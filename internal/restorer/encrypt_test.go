@@ -0,0 +1,117 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/repository/crypto"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerContentEncryption(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"file":     File{Data: "content: file\n"},
+					"parts":    File{DataParts: []string{"part1\n", "part2\n", "part1\n"}},
+					"empty":    File{Data: ""},
+					"existing": File{Data: "content: existing\n"},
+				},
+			},
+		},
+	}
+
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+	tempdir := rtest.TempDir(t)
+	rtest.OK(t, os.MkdirAll(filepath.Join(tempdir, "dir"), 0700))
+	rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "dir", "existing"), []byte("content: existing\n"), 0600))
+
+	key := crypto.NewRandomKey()
+	var mu sync.Mutex
+	nonces := make(map[string][]byte)
+	enc := &ContentEncryption{
+		Key: key,
+		Nonce: func(location string) []byte {
+			mu.Lock()
+			defer mu.Unlock()
+			nonce := crypto.NewRandomNonce()
+			nonces[location] = nonce
+			return nonce
+		},
+	}
+
+	res := NewRestorer(repo, sn, Options{Encryption: enc})
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	for location, plaintext := range map[string]string{
+		"/dir/file":     "content: file\n",
+		"/dir/parts":    "part1\npart2\npart1\n",
+		"/dir/empty":    "",
+		"/dir/existing": "content: existing\n",
+	} {
+		buf, err := os.ReadFile(filepath.Join(tempdir, filepath.FromSlash(location)))
+		rtest.OK(t, err)
+		rtest.Equals(t, len(plaintext)+crypto.Extension, len(buf))
+		nonce, ciphertext := buf[:len(nonces[location])], buf[len(nonces[location]):]
+		rtest.Equals(t, nonces[location], nonce)
+
+		decrypted, err := key.Open(nil, nonce, ciphertext, nil)
+		rtest.OK(t, err)
+		rtest.Equals(t, plaintext, string(decrypted))
+	}
+
+	res = NewRestorer(repo, sn, Options{Encryption: enc, Journal: filepath.Join(rtest.TempDir(t), "journal")})
+	_, err = res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "cannot be combined"), "unexpected error %v", err)
+}
+
+func TestRestorerContentEncryptionPerFileKeys(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"file1": File{DataParts: []string{"part1\n", "part2\n", "part1\n"}},
+					"file2": File{DataParts: []string{"part1\n", "part2\n", "part1\n"}},
+				},
+			},
+		},
+	}
+
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+	tempdir := rtest.TempDir(t)
+
+	// the nonce may be reused as each file uses a different key
+	nonce := crypto.NewRandomNonce()
+	enc := &ContentEncryption{
+		Key:         crypto.NewRandomKey(),
+		PerFileKeys: true,
+		Nonce:       func(string) []byte { return nonce },
+	}
+	res := NewRestorer(repo, sn, Options{Encryption: enc})
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	var ciphertexts []string
+	for _, location := range []string{"/dir/file1", "/dir/file2"} {
+		buf, err := os.ReadFile(filepath.Join(tempdir, filepath.FromSlash(location)))
+		rtest.OK(t, err)
+		ciphertext := buf[len(nonce):]
+		ciphertexts = append(ciphertexts, string(ciphertext))
+
+		_, err = enc.Key.Open(nil, nonce, ciphertext, nil)
+		rtest.Assert(t, err == crypto.ErrUnauthenticated, "file %v was encrypted using the master key", location)
+		decrypted, err := enc.FileKey(location).Open(nil, nonce, ciphertext, nil)
+		rtest.OK(t, err)
+		rtest.Equals(t, "part1\npart2\npart1\n", string(decrypted))
+	}
+	rtest.Assert(t, ciphertexts[0] != ciphertexts[1], "files with the same content have the same ciphertext")
+}
@@ -0,0 +1,194 @@
+package restorer
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// RestoreEstimate is the expected duration of downloading the file content
+// for a restore. It is extrapolated from the time required to download a
+// sample of the packs. The time to write the files is not included.
+type RestoreEstimate struct {
+	Packs        int    // number of packs required to restore the file content
+	Bytes        uint64 // number of bytes which must be downloaded from these packs
+	SampledPacks int
+	SampledBytes uint64
+
+	Duration time.Duration
+	// Duration is likely within the range from Min to Max. With a single
+	// sampled pack, the range is empty.
+	Min, Max time.Duration
+}
+
+// SampleCache keeps the blobs which were downloaded while estimating the
+// restore duration. Passing the same cache to a subsequent restore avoids
+// downloading the sampled packs again. The cache holds the complete sampled
+// file content in memory, sampled packs are dropped once they were restored.
+type SampleCache struct {
+	m     sync.Mutex
+	packs map[restic.ID]map[restic.BlobHandle][]byte
+}
+
+// NewSampleCache returns an empty SampleCache.
+func NewSampleCache() *SampleCache {
+	return &SampleCache{packs: make(map[restic.ID]map[restic.BlobHandle][]byte)}
+}
+
+func (c *SampleCache) add(packID restic.ID, h restic.BlobHandle, buf []byte) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	blobs, ok := c.packs[packID]
+	if !ok {
+		blobs = make(map[restic.BlobHandle][]byte)
+		c.packs[packID] = blobs
+	}
+	// the loader reuses buf
+	blobs[h] = append([]byte(nil), buf...)
+}
+
+func (c *SampleCache) has(packID restic.ID) bool {
+	if c == nil {
+		return false
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	_, ok := c.packs[packID]
+	return ok
+}
+
+func (c *SampleCache) take(packID restic.ID) map[restic.BlobHandle][]byte {
+	c.m.Lock()
+	defer c.m.Unlock()
+	blobs := c.packs[packID]
+	delete(c.packs, packID)
+	return blobs
+}
+
+// wrapLoader returns a loader which passes cached blobs to handleBlobFn and
+// only loads the remaining blobs using loader.
+func (c *SampleCache) wrapLoader(loader blobsLoaderFn) blobsLoaderFn {
+	if c == nil {
+		return loader
+	}
+	return func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		cached := c.take(packID)
+		if cached == nil {
+			return loader(ctx, packID, blobs, handleBlobFn)
+		}
+
+		var missing []restic.BlobHandle
+		for _, h := range blobs {
+			buf, ok := cached[h]
+			if !ok {
+				missing = append(missing, h)
+				continue
+			}
+			if err := handleBlobFn(h, buf, nil); err != nil {
+				return err
+			}
+		}
+		debug.Log("restored %d blobs of pack %v from sample cache, loading %d blobs", len(blobs)-len(missing), packID.Str(), len(missing))
+		if len(missing) == 0 {
+			return nil
+		}
+		return loader(ctx, packID, missing, handleBlobFn)
+	}
+}
+
+// estimate downloads up to samples of the packs required to restore the
+// files and extrapolates the restore duration from the download times. The
+// sampled packs are spread evenly across the restore order. If cache is set,
+// the downloaded blobs are added to it.
+func (r *fileRestorer) estimate(ctx context.Context, samples int, cache *SampleCache) (*RestoreEstimate, error) {
+	r.logPrefix = logPrefix(ctx)
+
+	type packBlobs struct {
+		blobs restic.BlobSet
+		bytes uint64
+	}
+	packs := make(map[restic.ID]*packBlobs)
+	var packOrder restic.IDs
+	est := &RestoreEstimate{}
+	for _, file := range r.files {
+		err := r.forEachBlob(file.blobs.(restic.IDs), func(blob restic.PackBlob, idx int, _ int64) {
+			if file.state.HasMatchingBlob(idx) {
+				return
+			}
+			pack, ok := packs[blob.PackID()]
+			if !ok {
+				pack = &packBlobs{blobs: restic.NewBlobSet()}
+				packs[blob.PackID()] = pack
+				packOrder = append(packOrder, blob.PackID())
+			}
+			if !pack.blobs.Has(blob.Handle()) {
+				pack.blobs.Insert(blob.Handle())
+				pack.bytes += uint64(blob.CiphertextLength())
+				est.Bytes += uint64(blob.CiphertextLength())
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	est.Packs = len(packOrder)
+	if est.Packs == 0 || samples <= 0 {
+		return est, nil
+	}
+
+	samples = min(samples, est.Packs)
+	rates := make([]float64, 0, samples) // download duration per byte
+	var sampledDuration time.Duration
+	for i := 0; i < samples; i++ {
+		packID := packOrder[i*est.Packs/samples]
+		pack := packs[packID]
+
+		start := time.Now()
+		err := r.blobsLoader(ctx, packID, pack.blobs.List(), func(h restic.BlobHandle, buf []byte, err error) error {
+			if err != nil {
+				return err
+			}
+			if cache != nil {
+				cache.add(packID, h, buf)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		elapsed := time.Since(start)
+		debug.Log("%ssampled pack %v: %d bytes took %v", r.logPrefix, packID.Str(), pack.bytes, elapsed)
+
+		est.SampledPacks++
+		est.SampledBytes += pack.bytes
+		sampledDuration += elapsed
+		rates = append(rates, float64(elapsed)/float64(max(pack.bytes, 1)))
+	}
+
+	// the samples are downloaded one after another, whereas the restore
+	// downloads packs in parallel
+	scale := float64(est.Bytes) / float64(max(r.workerCount, 1))
+	estimate := float64(sampledDuration) / float64(max(est.SampledBytes, 1)) * scale
+
+	// use twice the standard error of the per-byte download duration as range
+	var variance float64
+	mean := 0.0
+	for _, rate := range rates {
+		mean += rate / float64(len(rates))
+	}
+	if len(rates) > 1 {
+		for _, rate := range rates {
+			variance += (rate - mean) * (rate - mean) / float64(len(rates)-1)
+		}
+	}
+	delta := 2 * math.Sqrt(variance/float64(len(rates))) * scale
+
+	est.Duration = time.Duration(estimate)
+	est.Min = time.Duration(max(estimate-delta, 0))
+	est.Max = time.Duration(estimate + delta)
+	return est, nil
+}
@@ -0,0 +1,82 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRestorerEstimate(t *testing.T) {
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack3"},
+				{"data2-2", "pack4"},
+				{"data1-1", "pack1"},
+			},
+		},
+	}
+	repo := newTestRepo(content)
+
+	var m sync.Mutex
+	loaded := restic.NewIDSet()
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		m.Lock()
+		loaded.Insert(packID)
+		m.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		return repo.loader(ctx, packID, handles, handleBlobFn)
+	}
+	zeroChunk := repository.TestRepository(t).ChunkerFactory().ZeroChunk()
+
+	cache := NewSampleCache()
+	r := newFileRestorer(rtest.TempDir(t), loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil, zeroChunk)
+	r.files = repo.files
+	est, err := r.estimate(context.TODO(), 2, cache)
+	rtest.OK(t, err)
+
+	rtest.Equals(t, 4, est.Packs)
+	rtest.Equals(t, uint64(4*len("data1-1")), est.Bytes)
+	rtest.Equals(t, 2, est.SampledPacks)
+	rtest.Equals(t, uint64(2*len("data1-1")), est.SampledBytes)
+	rtest.Equals(t, 2, len(loaded))
+	// the samples are spread across the restore order
+	rtest.Assert(t, loaded.Has(restic.Hash([]byte("data1-1"))) && loaded.Has(restic.Hash([]byte("data2-1"))),
+		"unexpected sampled packs %v", loaded)
+	rtest.Assert(t, est.Duration >= 40*time.Millisecond, "estimate too short: %v", est.Duration)
+	rtest.Assert(t, est.Min <= est.Duration && est.Duration <= est.Max, "estimate %v not within range %v - %v", est.Duration, est.Min, est.Max)
+
+	// the restore only downloads the packs which were not sampled
+	sampled := loaded
+	loaded = restic.NewIDSet()
+	tempdir := rtest.TempDir(t)
+	repo = newTestRepo(content)
+	r = newFileRestorer(tempdir, loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil, zeroChunk)
+	r.files = repo.files
+	r.sampleCache = cache
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Equals(t, 2, len(loaded))
+	for id := range sampled {
+		rtest.Assert(t, !loaded.Has(id), "sampled pack %v was downloaded again", id.Str())
+	}
+
+	for _, file := range content {
+		data, err := os.ReadFile(r.targetPath(file.name))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.filesPathToContent[file.name], string(data))
+	}
+}
@@ -0,0 +1,39 @@
+package restorer
+
+// EventType is the type of an Event.
+type EventType string
+
+// Constants for the different Event types.
+const (
+	// EventCreated is sent before restoring the content of a regular file
+	// from scratch, either as it did not exist or could not be updated.
+	EventCreated EventType = "created"
+	// EventUpdated is sent before updating the content of an existing
+	// regular file in place.
+	EventUpdated EventType = "updated"
+	// EventCompleted is sent once an item, including its metadata, has been
+	// restored completely.
+	EventCompleted EventType = "completed"
+)
+
+// Event reports the progress of restoring an item, see Restorer.Event.
+//
+// Events are sent in the following order: all created and updated events are
+// sent while collecting the files to restore, before any file content is
+// written. The completed events follow once all file content has been
+// written, in the order of the snapshot. A directory is completed after all
+// of its children. Regular files whose content was already up to date only
+// receive a completed event. Items which could not be restored, for example
+// due to an error, never receive a completed event. Restored files are not
+// synced to disk before sending the completed event.
+type Event struct {
+	Type     EventType
+	Location string
+}
+
+func (res *Restorer) sendEvent(eventType EventType, location string) {
+	if res.Event == nil || res.opts.DryRun {
+		return
+	}
+	res.Event(Event{Type: eventType, Location: location})
+}
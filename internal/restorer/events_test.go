@@ -0,0 +1,63 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerEvents(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"changed":   File{Data: "content: changed\n"},
+					"new":       File{Data: "content: new\n"},
+					"unchanged": File{Data: "content: unchanged\n"},
+				},
+			},
+		},
+	}, noopGetGenericAttributes)
+	tempdir := rtest.TempDir(t)
+	rtest.OK(t, os.Mkdir(filepath.Join(tempdir, "dir"), 0o700))
+	rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "dir", "changed"), []byte("content: CHANGED\n"), 0o600))
+	rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "dir", "unchanged"), []byte("content: unchanged\n"), 0o600))
+
+	res := NewRestorer(repo, sn, Options{})
+	var events []Event
+	res.Event = func(event Event) {
+		events = append(events, event)
+	}
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	rtest.Equals(t, []Event{
+		{EventUpdated, "/dir/changed"},
+		{EventCreated, "/dir/new"},
+		{EventCompleted, "/dir/changed"},
+		{EventCompleted, "/dir/new"},
+		{EventCompleted, "/dir/unchanged"},
+		{EventCompleted, "/dir"},
+	}, events)
+}
+
+func TestRestorerEventsDryRun(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{Data: "content: file\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	res := NewRestorer(repo, sn, Options{DryRun: true})
+	res.Event = func(event Event) {
+		t.Errorf("unexpected event %v", event)
+	}
+	_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.OK(t, err)
+}
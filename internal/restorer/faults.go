@@ -0,0 +1,60 @@
+package restorer
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// faultInjector allows tests to deterministically inject errors into the
+// restore process, for example to simulate network failures, corrupted blobs
+// or a full disk. Each hook may be nil. It is never set outside of tests.
+type faultInjector struct {
+	// loadPack is called before loading blobs from a pack. An error aborts
+	// loading the pack.
+	loadPack func(packID restic.ID) error
+	// loadBlob is called for each loaded blob. An error is passed on as if
+	// the blob could not be decrypted.
+	loadBlob func(packID restic.ID, blob restic.BlobHandle) error
+	// writeFile is called before writing a blob to path at offset. An error
+	// is returned instead of writing the blob.
+	writeFile func(path string, offset int64) error
+	// writeData is called before writing a blob to path at offset. It returns
+	// the data which is written instead, to simulate silent corruption.
+	writeData func(path string, offset int64, blob []byte) []byte
+}
+
+func (f *faultInjector) wrapLoader(loader blobsLoaderFn) blobsLoaderFn {
+	if f == nil {
+		return loader
+	}
+	return func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		if f.loadPack != nil {
+			if err := f.loadPack(packID); err != nil {
+				return err
+			}
+		}
+		return loader(ctx, packID, blobs, func(blob restic.BlobHandle, buf []byte, err error) error {
+			if err == nil && f.loadBlob != nil {
+				if err = f.loadBlob(packID, blob); err != nil {
+					buf = nil
+				}
+			}
+			return handleBlobFn(blob, buf, err)
+		})
+	}
+}
+
+func (f *faultInjector) checkWrite(path string, offset int64) error {
+	if f == nil || f.writeFile == nil {
+		return nil
+	}
+	return f.writeFile(path, offset)
+}
+
+func (f *faultInjector) data(path string, offset int64, blob []byte) []byte {
+	if f == nil || f.writeData == nil {
+		return blob
+	}
+	return f.writeData(path, offset, blob)
+}
@@ -0,0 +1,103 @@
+package restorer
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// setFaultInjector enables the hooks of f for both loading and writing blobs.
+func (r *fileRestorer) setFaultInjector(f *faultInjector) {
+	r.faults = f
+	r.filesWriter.faults = f
+}
+
+func TestFileRestorerFaults(t *testing.T) {
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack1"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+			},
+		}}
+	pack2 := restic.Hash([]byte("data2-1"))
+	injected := errors.New("injected fault")
+
+	for _, test := range []struct {
+		name   string
+		faults func(dst string) *faultInjector
+		failed []string
+	}{
+		{
+			name: "network",
+			faults: func(_ string) *faultInjector {
+				return &faultInjector{loadPack: func(packID restic.ID) error {
+					if packID.Equal(pack2) {
+						return injected
+					}
+					return nil
+				}}
+			},
+			failed: []string{"file2"},
+		},
+		{
+			name: "corrupted blob",
+			faults: func(_ string) *faultInjector {
+				return &faultInjector{loadBlob: func(_ restic.ID, blob restic.BlobHandle) error {
+					if blob.ID.Equal(restic.Hash([]byte("data1-2"))) {
+						return injected
+					}
+					return nil
+				}}
+			},
+			failed: []string{"file1"},
+		},
+		{
+			name: "disk full",
+			faults: func(dst string) *faultInjector {
+				return &faultInjector{writeFile: func(path string, offset int64) error {
+					if path == filepath.Join(dst, "file1") && offset > 0 {
+						return syscall.ENOSPC
+					}
+					return nil
+				}}
+			},
+			failed: []string{"file1"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			repo := newTestRepo(content)
+
+			r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+				repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+			r.files = repo.files
+			r.setFaultInjector(test.faults(tempdir))
+
+			var failed []string
+			r.Error = func(location string, err error) error {
+				failed = append(failed, location)
+				return nil
+			}
+
+			rtest.OK(t, r.restoreFiles(context.TODO()))
+			slices.Sort(failed)
+			failed = slices.Compact(failed)
+			rtest.Equals(t, test.failed, failed)
+		})
+	}
+}
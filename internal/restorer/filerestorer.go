@@ -4,14 +4,19 @@ import (
 	"context"
 	"fmt"
 	"path/filepath"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/sync/errgroup"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/feature"
+	"github.com/restic/restic/internal/repository/crypto"
 	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/ui"
 )
 
 const (
@@ -24,9 +29,34 @@ type fileInfo struct {
 	inProgress bool
 	sparse     bool
 	size       int64
+	modTime    time.Time   // used to prioritize files if a size quota is set
+	uid, gid   uint32      // owner stored in the snapshot, see ownerFilter
+	priority   int         // see Restorer.SetFilePriority
 	location   string      // file on local filesystem relative to restorer basedir
 	blobs      interface{} // blobs of the file
 	state      *fileState
+
+	// only tracked if a slow file threshold, content encryption, a
+	// completion callback or a tracer is set
+	started      time.Time    // set by the write which creates the file
+	pendingBlobs atomic.Int64 // blobs which still have to be written
+	span         Span         // set by the write which creates the file
+	packCount    int
+	nonce        []byte      // set by the write which creates the file
+	key          *crypto.Key // set by the write which creates the file
+
+	// assembles the content into aligned blocks, only set if writeAlignment
+	// is set
+	blocks *alignedBlocks
+
+	// an existing file which is restored as sparse file. Its zero regions
+	// are punched as holes once all changed blobs are written, see
+	// recordZeroRegion.
+	keepHoles bool
+	holes     []zeroRegion // protected by lock
+
+	// id of the file in the preview patch, see previewPatch
+	patchID uint64
 }
 
 type fileBlobInfo struct {
@@ -36,11 +66,19 @@ type fileBlobInfo struct {
 
 // information about a data pack required to restore one or more files
 type packInfo struct {
-	id    restic.ID              // the pack id
-	files map[*fileInfo]struct{} // set of files that use blobs from this pack
+	id       restic.ID              // the pack id
+	files    map[*fileInfo]struct{} // set of files that use blobs from this pack
+	size     uint64                 // stored size of the required blobs
+	blobs    int                    // number of required blobs
+	order    int                    // position in the order of first access
+	priority int                    // highest priority of the files
+	// all blobs of the pack according to the index, only set for
+	// Options.VerifyPacks
+	allBlobs []restic.BlobHandle
 }
 
 type blobsLoaderFn func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error
+type sectionsLoaderFn func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleSectionFn func(section restic.PackSection) error) error
 type startWarmupFn func(context.Context, restic.IDSet) (restic.WarmupJob, error)
 
 // fileRestorer restores set of files
@@ -49,19 +87,128 @@ type fileRestorer struct {
 	blobsLoader blobsLoaderFn
 
 	startWarmup startWarmupFn
+	// sectionsLoader downloads packs without decoding them. If set, the blobs
+	// are decoded by decodeWorkers separate workers, such that downloads do
+	// not wait for CPU-bound decompression.
+	sectionsLoader sectionsLoaderFn
+	decodeWorkers  int
 
 	workerCount int
 	filesWriter *filesWriter
 	zeroChunk   restic.ID
 	sparse      bool
 	progress    ProgressReporter
+	// coalesces the progress updates, see Options.ProgressBatch
+	progressBatch *progressBatch
 
 	allowRecursiveDelete bool
+	// checkMissingBlobs enables a preflight check which collects all blobs
+	// missing from the index before restoring any file content
+	checkMissingBlobs bool
+	journal           *restoreJournal
+	// stop scheduling packs once the deadline has passed, but wait up to
+	// deadlineGracePeriod for in-progress packs. Zero means no deadline.
+	deadline            time.Time
+	deadlineGracePeriod time.Duration
+	// counts the restored file content, may be nil
+	content *contentProgress
+	// dumps the goroutine stacks if the restore stalls, may be nil
+	watchdog *watchdog
+	// pauses scheduling packs while the free space is low, may be nil
+	spaceWatch *spaceWatchdog
+	// scans the completely restored files, may be nil
+	scan *fileScanner
+	// silently keep only the first file added for a location instead of
+	// reporting the duplicates
+	dedupeFiles bool
+	// restore at most sizeQuota bytes of file content, prioritizing recently
+	// modified files. Zero means no quota.
+	sizeQuota    uint64
+	quotaSkipped []string
+
+	// only restore the files whose owner is selected, may be nil
+	ownerFilter *OwnerFilter
+	// report files whose restore takes longer than slowFileThreshold
+	slowFileThreshold time.Duration
+	// write file content encrypted, see ContentEncryption
+	encryption *ContentEncryption
+	// write the file content to a patch instead of the target files, may be
+	// nil
+	patch *previewPatch
+	// blobs downloaded while estimating the restore duration
+	sampleCache *SampleCache
+	// restore the files in batches of sequentialFiles files, each batch is
+	// completed before starting the next one. Zero restores all files at once.
+	sequentialFiles int
+	// decides in which order the packs are downloaded
+	scheduler Scheduler
+	// consulted before downloading each pack, may be nil
+	packGate PackGate
+	// collects scheduler metrics if set
+	metrics *schedulerMetrics
+	// traces the download of the packs and the writes of the files, may be nil
+	tracer Tracer
+	// write the blobs of each pack ordered by file and offset once the
+	// whole pack was loaded, see Options.SortWrites
+	sortWrites bool
+	// records the written bytes of each file, may be nil
+	report *restoreReport
+	// estimates the memory used for planning if set
+	planMemory *PlanMemory
+	// recently downloaded blobs, may be nil
+	blobCache *blobCache
+	// coalesce the blobs of newly created files into writes of
+	// writeAlignment bytes at offsets which are a multiple of it. Zero writes
+	// each blob separately.
+	writeAlignment int64
+	// blobs whose data in the repository is damaged
+	corrupt corruptBlobs
+	// files which must no longer be restored, may be nil
+	canceled *canceledFiles
+	// priorities of the files, may be nil
+	priorities *filePriorities
+	// names of the files restored directly into dst, see Options.Flatten
+	flatten *flatNames
+	// targets of the files mapped by Options.PathMap, may be nil
+	mapped *mappedPaths
+	// shortens too long names, see Options.LongPaths
+	longPaths *longPaths
+	// selects the files whose writes are read back, see Options.VerifyWrites
+	verifyWrites func(location string) bool
+	// reports the files whose content is complete, may be nil
+	completion *fileCompletion
+	// if set, blobs which cannot be loaded are replaced by zeros and recorded
+	salvage *salvagedFiles
+	// load damaged blobs from other packs, see Options.AlternatePacks
+	alternatePacks bool
+	// if set, all blobs of the downloaded packs are checked, see
+	// Options.VerifyPacks
+	listBlobs func(ctx context.Context, fn func(restic.PackBlob)) error
+	packCheck packCheck
+	// size of the fetched blobs before and after decompression
+	compression compressionStats
+	// blobs which were already present in the target files
+	skippedBlobs uint64
+	skippedBytes uint64
+	// copies blobs from local files instead of downloading them, see
+	// Options.Seed
+	seed *seedIndex
+	// detects a backend outage, see Options.OutageRetries
+	outage *outageDetector
+	// assigns blobs stored in multiple packs, see Options.CoalescePacks
+	coalesce *packCoalescer
 
-	dst   string
-	files []*fileInfo
-	Error func(string, error) error
-	Info  func(string)
+	// only used by tests, see setFaultInjector
+	faults *faultInjector
+
+	dst       string
+	files     []*fileInfo
+	logPrefix string
+	Error     func(string, error) error
+	Info      func(string)
+	// BlobSkipped is called for each blob which is already present in the
+	// target file at the given offset. May be nil.
+	BlobSkipped func(location string, offset int64, size uint)
 }
 
 func newFileRestorer(dst string,
@@ -88,16 +235,36 @@ func newFileRestorer(dst string,
 		allowRecursiveDelete: allowRecursiveDelete,
 		workerCount:          workerCount,
 		dst:                  dst,
+		scheduler:            NewFirstAccessScheduler(),
 		Error:                restorerAbortOnAllErrors,
 		Info:                 func(_ string) {},
 	}
 }
 
-func (r *fileRestorer) addFile(location string, content restic.IDs, size int64, state *fileState) {
-	r.files = append(r.files, &fileInfo{location: location, blobs: content, size: size, state: state})
+func (r *fileRestorer) addFile(location string, content restic.IDs, size int64, modTime time.Time, uid, gid uint32, state *fileState) {
+	file := &fileInfo{location: location, blobs: content, size: size, modTime: modTime, uid: uid, gid: gid, state: state}
+	if !r.ownerFilter.Match(file.uid, file.gid) {
+		// skipped while planning the restore, the packs of skipped files
+		// must never be scheduled
+		return
+	}
+	r.files = append(r.files, file)
 }
 
 func (r *fileRestorer) targetPath(location string) string {
+	if r.flatten != nil {
+		// the name was already assigned while collecting the files
+		target, _ := r.flatten.target(location)
+		return target
+	}
+	if r.mapped != nil {
+		if target, ok := r.mapped.assigned(location); ok {
+			return target
+		}
+	}
+	if r.longPaths != nil {
+		return r.longPaths.target(location)
+	}
 	return filepath.Join(r.dst, location)
 }
 
@@ -112,7 +279,7 @@ func (r *fileRestorer) forEachBlob(blobIDs []restic.ID, fn func(blob restic.Pack
 		if len(packs) == 0 {
 			return errors.Errorf("Unknown blob %s", blobID.String())
 		}
-		pb := packs[0]
+		pb := r.coalesce.pack(blobID, packs)
 		fn(pb, i, fileOffset)
 		fileOffset += int64(pb.PlaintextLength())
 	}
@@ -120,13 +287,147 @@ func (r *fileRestorer) forEachBlob(blobIDs []restic.ID, fn func(blob restic.Pack
 	return nil
 }
 
+// MissingBlobsError reports all blobs which are required to restore the files
+// but are not contained in the repository index.
+type MissingBlobsError struct {
+	Blobs restic.IDs
+}
+
+func (e *MissingBlobsError) Error() string {
+	return fmt.Sprintf("%d blobs are missing from the index: %v", len(e.Blobs), e.Blobs)
+}
+
+// findMissingBlobs returns an error listing all blobs of r.files which are not
+// contained in the index.
+func (r *fileRestorer) findMissingBlobs(ctx context.Context) error {
+	missing := restic.NewIDSet()
+	for _, file := range r.files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for _, blobID := range file.blobs.(restic.IDs) {
+			if missing.Has(blobID) {
+				continue
+			}
+			if len(r.idx(restic.BlobHandle{Type: restic.DataBlob, ID: blobID})) == 0 {
+				missing.Insert(blobID)
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &MissingBlobsError{Blobs: missing.List()}
+}
+
+// applySizeQuota orders r.files by modification time, newest first, and only
+// keeps the files which fit into r.sizeQuota. Once a file does not fit, it and
+// all older files are skipped and recorded in r.quotaSkipped.
+func (r *fileRestorer) applySizeQuota() {
+	slices.SortStableFunc(r.files, func(a, b *fileInfo) int {
+		return b.modTime.Compare(a.modTime)
+	})
+
+	var used uint64
+	for i, file := range r.files {
+		if used+uint64(file.size) > r.sizeQuota {
+			for _, skipped := range r.files[i:] {
+				r.quotaSkipped = append(r.quotaSkipped, skipped.location)
+			}
+			r.files = r.files[:i]
+			break
+		}
+		used += uint64(file.size)
+	}
+	slices.Sort(r.quotaSkipped)
+	debug.Log("%ssize quota %d: restoring %d files with %d bytes, skipping %d files", r.logPrefix, r.sizeQuota, len(r.files), used, len(r.quotaSkipped))
+}
+
+// removeDuplicates removes all files whose location was already added before.
+// Writing them concurrently would corrupt the target file, thus the first
+// file is kept. Unless dedupeFiles is set, each duplicate is reported.
+func (r *fileRestorer) removeDuplicates() error {
+	seen := make(map[string]struct{}, len(r.files))
+	files := r.files[:0]
+	for _, file := range r.files {
+		if _, ok := seen[file.location]; !ok {
+			seen[file.location] = struct{}{}
+			files = append(files, file)
+			continue
+		}
+		debug.Log("%sskipping duplicate file %v", r.logPrefix, file.location)
+		if !r.dedupeFiles {
+			if err := r.Error(file.location, errors.New("file was added multiple times, only restoring the first one")); err != nil {
+				return err
+			}
+		}
+	}
+	clear(r.files[len(files):])
+	r.files = files
+	return nil
+}
+
 func (r *fileRestorer) restoreFiles(ctx context.Context) error {
+	r.logPrefix = logPrefix(ctx)
+	// report the exact progress, also if the restore failed
+	defer r.progressBatch.flush()
+
+	if err := r.removeDuplicates(); err != nil {
+		return err
+	}
+
+	if r.checkMissingBlobs {
+		if err := r.findMissingBlobs(ctx); err != nil {
+			return err
+		}
+	}
+
+	r.completion.sort(r.files)
+	r.content.addTotal(r.files)
+	if r.planMemory != nil {
+		r.planMemory.addFiles(r.files)
+	}
+
+	if r.sequentialFiles == 0 {
+		return r.restoreFileBatch(ctx)
+	}
+
+	files := r.files
+	for len(files) > 0 {
+		n := min(r.sequentialFiles, len(files))
+		r.files, files = files[:n], files[n:]
+		debug.Log("%srestoring batch of %d files, %d remaining", r.logPrefix, n, len(files))
+		err := r.restoreFileBatch(ctx)
+		var deadlineErr *DeadlineExceededError
+		if errors.As(err, &deadlineErr) {
+			// none of the remaining files was restored
+			for _, file := range files {
+				deadlineErr.Files = append(deadlineErr.Files, file.location)
+			}
+			slices.Sort(deadlineErr.Files)
+			return deadlineErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreFileBatch restores the content of r.files, processing packs in the
+// order decided by r.scheduler.
+func (r *fileRestorer) restoreFileBatch(ctx context.Context) error {
+	r.completion.start(r.files)
+	defer r.completion.finish()
+
+	if r.coalesce != nil {
+		if err := r.coalesce.plan(ctx, r.files, r.idx); err != nil {
+			return err
+		}
+	}
 
 	packs := make(map[restic.ID]*packInfo) // all packs
-	// Process packs in order of first access. While this cannot guarantee
-	// that file chunks are restored sequentially, it offers a good enough
-	// approximation to shorten restore times by up to 19% in some test.
-	var packOrder restic.IDs
+	var packOrder restic.IDs               // packs in order of first access
 
 	// create packInfo from fileInfo
 	for _, file := range r.files {
@@ -142,28 +443,52 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 			file.blobs = packsMap
 		}
 		restoredBlobs := false
+		trackPending := r.trackPending()
+		var filePacks restic.IDSet
+		if r.slowFileThreshold > 0 {
+			filePacks = restic.NewIDSet()
+		}
+		file.priority = r.priorities.get(file.location)
+		var contentSize int64
 		err := r.forEachBlob(fileBlobs, func(blob restic.PackBlob, idx int, fileOffset int64) {
 			packID := blob.PackID()
+			contentSize = fileOffset + int64(blob.PlaintextLength())
 			if !file.state.HasMatchingBlob(idx) {
 				if largeFile {
 					packsMap[packID] = append(packsMap[packID], fileBlobInfo{id: blob.Handle().ID, offset: fileOffset})
 				}
+				if filePacks != nil {
+					filePacks.Insert(packID)
+				}
+				if trackPending {
+					file.pendingBlobs.Add(1)
+				}
 				restoredBlobs = true
 			} else {
 				r.reportBlobProgress(file, uint64(blob.PlaintextLength()))
+				r.skippedBlobs++
+				r.skippedBytes += uint64(blob.PlaintextLength())
+				if r.BlobSkipped != nil {
+					r.BlobSkipped(file.location, fileOffset, blob.PlaintextLength())
+				}
 				// completely ignore blob
 				return
 			}
 			pack, ok := packs[packID]
 			if !ok {
 				pack = &packInfo{
-					id:    packID,
-					files: make(map[*fileInfo]struct{}),
+					id:       packID,
+					files:    make(map[*fileInfo]struct{}),
+					order:    len(packOrder),
+					priority: file.priority,
 				}
 				packs[packID] = pack
 				packOrder = append(packOrder, packID)
 			}
 			pack.files[file] = struct{}{}
+			pack.priority = max(pack.priority, file.priority)
+			pack.size += uint64(blob.CiphertextLength())
+			pack.blobs++
 			if blob.Handle().ID.Equal(r.zeroChunk) {
 				file.sparse = r.sparse
 			}
@@ -172,6 +497,7 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 			// repository index is messed up, can't do anything
 			return err
 		}
+		file.packCount = len(filePacks)
 
 		if len(fileBlobs) == 1 {
 			// no need to preallocate files with a single block, thus we can always consider them to be sparse
@@ -179,15 +505,44 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 			file.sparse = r.sparse
 		}
 		if file.state != nil {
-			// The restorer currently cannot punch new holes into an existing files.
-			// Thus sections that contained data but should be sparse after restoring
-			// the snapshot would still contain the old data resulting in a corrupt restore.
+			// Skipping the zeros of an existing file would leave the old data in
+			// place resulting in a corrupt restore. Instead, the zeros are
+			// written and the holes are punched afterwards.
+			file.keepHoles = r.sparse
 			file.sparse = false
 		}
+		// blocks are only complete if all blobs are written. Sparse files
+		// rely on skipping the zero chunks in separate writes.
+		if r.writeAlignment > 0 && restoredBlobs && file.state == nil && !file.sparse {
+			file.blocks = newAlignedBlocks(contentSize, r.writeAlignment)
+		}
+
+		if r.patch != nil {
+			if err := r.patch.addFile(file); err != nil {
+				return err
+			}
+		}
 
 		// empty file or one with already up-to-date content. Make sure that the file size is correct
 		if !restoredBlobs {
-			err := r.truncateFileToSize(file.location, file.size)
+			var err error
+			if r.patch != nil {
+				// the file record already contains the size
+			} else if r.encryption != nil {
+				// existing files are always restored from scratch, thus the file is empty
+				err = r.writeEncrypted(file, nil, 0, 0)
+				if err == nil {
+					err = r.sealEncrypted(file)
+				}
+			} else {
+				err = r.truncateFileToSize(file.location, file.size)
+			}
+			if err == nil {
+				var vetoed bool
+				if vetoed, err = r.scanFile(file); !vetoed {
+					r.completion.complete(file)
+				}
+			}
 			if errFile := r.sanitizeError(file, err); errFile != nil {
 				return errFile
 			}
@@ -198,8 +553,26 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 			}
 		}
 	}
+	// the spans of files which are not restored completely are ended at the
+	// end, which requires the files with pending blobs
+	var tracedFiles []*fileInfo
+	if r.tracer != nil {
+		for _, file := range r.files {
+			if file.pendingBlobs.Load() != 0 {
+				tracedFiles = append(tracedFiles, file)
+			}
+		}
+	}
 	// drop no longer necessary file list
 	r.files = nil
+	if r.planMemory != nil {
+		r.planMemory.addPacks(packs)
+	}
+	if r.listBlobs != nil {
+		if err := r.listPackBlobs(ctx, packs); err != nil {
+			return err
+		}
+	}
 
 	if feature.Flag.Enabled(feature.S3Restore) {
 		warmupJob, err := r.startWarmup(ctx, restic.NewIDSet(packOrder...))
@@ -217,42 +590,261 @@ func (r *fileRestorer) restoreFiles(ctx context.Context) error {
 	wg, ctx := errgroup.WithContext(ctx)
 	downloadCh := make(chan *packInfo)
 
+	// the workers use a separate context, which allows them to complete
+	// in-progress packs once the deadline has passed
+	workerCtx, cancelWorkers := context.WithCancel(ctx)
+	defer cancelWorkers()
+	var deadlineCh <-chan time.Time
+	if !r.deadline.IsZero() {
+		timer := time.NewTimer(time.Until(r.deadline))
+		defer timer.Stop()
+		deadlineCh = timer.C
+	}
+	deadlineExceeded := false
+	var inProgressLock sync.Mutex
+	inProgress := make(map[restic.ID]*packInfo)
+
 	// close all files when finished
 	defer r.filesWriter.flush()
-	worker := func() error {
-		for pack := range downloadCh {
-			if err := r.downloadPack(ctx, pack); err != nil {
+	packDone := func(pack *packInfo) {
+		if deadlineCh != nil {
+			inProgressLock.Lock()
+			delete(inProgress, pack.id)
+			inProgressLock.Unlock()
+		}
+	}
+	var decodeCh chan decodeJob
+	if r.sectionsLoader != nil {
+		decodeCh = make(chan decodeJob)
+	}
+	worker := func(id int) error {
+		for {
+			pack, ok := r.metrics.receive(downloadCh)
+			if !ok {
+				return nil
+			}
+			packCtx, span := startSpan(workerCtx, r.tracer, SpanPackDownload,
+				StringAttribute(AttrPackID, pack.id.String()),
+				IntAttribute(AttrWorkerID, int64(id)),
+				IntAttribute(AttrPackBlobs, int64(pack.blobs)),
+				IntAttribute(AttrPackBytes, int64(pack.size)))
+			start := time.Now()
+			r.watchdog.startPack(id, pack)
+			err := r.downloadPack(packCtx, pack, decodeCh, packDone)
+			r.watchdog.finishPack(pack.id)
+			endSpan(span, err)
+			if err == nil {
+				r.metrics.addDownload(id, pack.size, time.Since(start))
+			}
+			if err != nil {
 				return err
 			}
 		}
-		return nil
 	}
+	stopSampling := r.metrics.startSampling(r.workerCount)
+	defer stopSampling()
+	var downloaders sync.WaitGroup
 	for i := 0; i < r.workerCount; i++ {
-		wg.Go(worker)
+		downloaders.Add(1)
+		wg.Go(func() error {
+			defer downloaders.Done()
+			return worker(i)
+		})
+	}
+	if decodeCh != nil {
+		decoder := func() error {
+			for job := range decodeCh {
+				if err := job.pack.finish(job.section.Decode(workerCtx, job.pack.handleBlob)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for i := 0; i < r.decodeWorkers; i++ {
+			wg.Go(decoder)
+		}
+		wg.Go(func() error {
+			downloaders.Wait()
+			close(decodeCh)
+			return nil
+		})
+	}
+
+	stopScheduling := func() error {
+		debug.Log("%sdeadline exceeded, stop scheduling packs", r.logPrefix)
+		deadlineExceeded = true
+		if r.deadlineGracePeriod > 0 {
+			time.AfterFunc(r.deadlineGracePeriod, cancelWorkers)
+		}
+		return nil
+	}
+
+	for _, id := range packOrder {
+		r.scheduler.Enqueue(scheduledPack(packs[id]))
 	}
 
 	// the main restore loop
 	wg.Go(func() error {
 		defer close(downloadCh)
-		for _, id := range packOrder {
-			pack := packs[id]
-			// allow garbage collection of packInfo
-			delete(packs, id)
+		scheduled := 0
+		var gate packGateState
+		for {
+			if deadlineCh != nil {
+				// prefer stopping over scheduling further packs
+				select {
+				case <-deadlineCh:
+					return stopScheduling()
+				default:
+				}
+			}
+			r.applyPriorities(packs)
+			id, ok, err := r.scheduler.Next(ctx)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				break
+			}
+			// packs are removed once they are handed out
+			pack, ok := packs[id]
+			if !ok {
+				return errors.Errorf("scheduler returned unknown or already scheduled pack %v", id.Str())
+			}
+			scheduled++
+			for file := range pack.files {
+				if r.canceled.skip(file) {
+					delete(pack.files, file)
+				}
+			}
+			if len(pack.files) == 0 {
+				debug.Log("%sskipping pack %s, all files were canceled", r.logPrefix, pack.id.Str())
+				delete(packs, id)
+				continue
+			}
+			if r.packGate != nil {
+				decision, err := r.packGate(ctx, scheduledPack(pack))
+				if err != nil {
+					return err
+				}
+				switch decision {
+				case PackDefer:
+					// the pack is returned again by the scheduler
+					scheduled--
+					r.scheduler.Enqueue(scheduledPack(pack))
+					if wait := gate.deferPack(len(packs)); wait > 0 {
+						debug.Log("%sall %d remaining packs were deferred, waiting %v", r.logPrefix, len(packs), wait)
+						select {
+						case <-ctx.Done():
+							return ctx.Err()
+						case <-deadlineCh:
+							return stopScheduling()
+						case <-time.After(wait):
+						}
+					}
+					continue
+				case PackReject:
+					debug.Log("%sskipping pack %s, the download was rejected", r.logPrefix, pack.id.Str())
+					delete(packs, id)
+					for file := range pack.files {
+						if err := r.sanitizeError(file, &PackRejectedError{ID: id}); err != nil {
+							return err
+						}
+					}
+					continue
+				}
+				gate.downloaded()
+			}
+			if stop, err := r.spaceWatch.wait(ctx, deadlineCh); err != nil {
+				return err
+			} else if stop {
+				return stopScheduling()
+			}
+			if deadlineCh != nil {
+				inProgressLock.Lock()
+				inProgress[id] = pack
+				inProgressLock.Unlock()
+			}
+			waitStart := time.Now()
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
+			case <-deadlineCh:
+				inProgressLock.Lock()
+				delete(inProgress, id)
+				inProgressLock.Unlock()
+				return stopScheduling()
 			case downloadCh <- pack:
-				debug.Log("Scheduled download pack %s", pack.id.Str())
+				r.metrics.addSchedulerWait(time.Since(waitStart))
+				// allow garbage collection of packInfo
+				delete(packs, id)
+				debug.Log("%sScheduled download pack %s", r.logPrefix, pack.id.Str())
 			}
 		}
+		if scheduled != len(packOrder) {
+			return errors.Errorf("scheduler returned only %d of %d packs", scheduled, len(packOrder))
+		}
 		return nil
 	})
 
-	return wg.Wait()
+	err := wg.Wait()
+	// end the spans of the files which were not restored completely
+	for _, file := range tracedFiles {
+		if file.span != nil && file.pendingBlobs.Load() != 0 {
+			file.span.End()
+		}
+	}
+	if !deadlineExceeded || (err != nil && !errors.Is(err, context.Canceled)) {
+		return err
+	}
+
+	// collect all files which still miss some content
+	partial := make(map[string]struct{})
+	for _, pack := range packs {
+		for file := range pack.files {
+			partial[file.location] = struct{}{}
+		}
+	}
+	for _, pack := range inProgress {
+		for file := range pack.files {
+			partial[file.location] = struct{}{}
+		}
+	}
+	if len(partial) == 0 {
+		return nil
+	}
+	files := make([]string, 0, len(partial))
+	for location := range partial {
+		files = append(files, location)
+	}
+	slices.Sort(files)
+	return &DeadlineExceededError{Files: files}
+}
+
+// scheduledPack describes the pack for the Scheduler.
+func scheduledPack(pack *packInfo) ScheduledPack {
+	files := make([]string, 0, len(pack.files))
+	for file := range pack.files {
+		files = append(files, file.location)
+	}
+	slices.Sort(files)
+	return ScheduledPack{ID: pack.id, Order: pack.order, Size: pack.size, Blobs: pack.blobs, Files: files, Priority: pack.priority}
+}
+
+// DeadlineExceededError is returned if the restore stopped as the deadline has
+// passed. Files lists all files which have not been restored completely.
+type DeadlineExceededError struct {
+	Files []string
+}
+
+func (e *DeadlineExceededError) Error() string {
+	return fmt.Sprintf("restore deadline exceeded, %d files were not restored completely", len(e.Files))
 }
 
 func (r *fileRestorer) truncateFileToSize(location string, size int64) error {
-	f, err := createFile(r.targetPath(location), size, false, r.allowRecursiveDelete)
+	if ok, err := r.filesWriter.writeToTarget(r.targetPath(location), nil, 0, size, false); ok {
+		return err
+	}
+	f, err := r.filesWriter.createFile(r.targetPath(location), size, false)
 	if err != nil {
 		return err
 	}
@@ -260,27 +852,39 @@ func (r *fileRestorer) truncateFileToSize(location string, size int64) error {
 }
 
 type blobToFileOffsetsMapping map[restic.ID]struct {
-	files map[*fileInfo][]int64 // file -> offsets (plural!) of the blob in the file
-	blob  restic.BlobHandle
+	files  map[*fileInfo][]int64 // file -> offsets (plural!) of the blob in the file
+	blob   restic.BlobHandle
+	length uint // plaintext length according to the index
+	// size in the pack according to the index
+	stored     uint
+	compressed bool
+	// taken from the blob cache instead of downloading it
+	cached bool
 }
 
-func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
+// downloadPack restores all blobs from pack and calls done afterwards. If
+// decodeCh is set, the downloaded sections of the pack are sent to it and
+// done is called by the decode worker which finishes the last section.
+func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo, decodeCh chan<- decodeJob, done func(*packInfo)) error {
 	// calculate blob->[]files->[]offsets mappings
 	blobs := make(blobToFileOffsetsMapping)
 	for file := range pack.files {
-		addBlob := func(blob restic.BlobHandle, fileOffset int64) {
-			blobInfo, ok := blobs[blob.ID]
+		addBlob := func(blob restic.PackBlob, fileOffset int64) {
+			blobInfo, ok := blobs[blob.Handle().ID]
 			if !ok {
 				blobInfo.files = make(map[*fileInfo][]int64)
-				blobInfo.blob = blob
-				blobs[blob.ID] = blobInfo
+				blobInfo.blob = blob.Handle()
+				blobInfo.length = blob.PlaintextLength()
+				blobInfo.stored = blob.CiphertextLength()
+				blobInfo.compressed = blob.IsCompressed()
+				blobs[blob.Handle().ID] = blobInfo
 			}
 			blobInfo.files[file] = append(blobInfo.files[file], fileOffset)
 		}
 		if fileBlobs, ok := file.blobs.(restic.IDs); ok {
 			err := r.forEachBlob(fileBlobs, func(blob restic.PackBlob, idx int, fileOffset int64) {
 				if blob.PackID().Equal(pack.id) && !file.state.HasMatchingBlob(idx) {
-					addBlob(blob.Handle(), fileOffset)
+					addBlob(blob, fileOffset)
 				}
 			})
 			if err != nil {
@@ -292,7 +896,7 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 				idxPacks := r.idx(restic.BlobHandle{Type: restic.DataBlob, ID: blob.id})
 				for _, idxPack := range idxPacks {
 					if idxPack.PackID().Equal(pack.id) {
-						addBlob(idxPack.Handle(), blob.offset)
+						addBlob(idxPack, blob.offset)
 						break
 					}
 				}
@@ -300,17 +904,130 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) error {
 		}
 	}
 
+	var extra restic.BlobSet
+	if r.listBlobs != nil {
+		extra = r.extraBlobs(pack, blobs)
+		r.packCheck.packs.Add(1)
+	}
+
+	debug.Log("%sdownloading %d blobs from pack %s", r.logPrefix, len(blobs), pack.id.Str())
+	// packs whose blobs are all cached are restored without downloading them,
+	// blobs from the cache or the seed directory are handled by downloadBlobs
+	if decodeCh != nil && !r.sampleCache.has(pack.id) && !r.blobCache.contains(blobs) && !r.seed.contains(blobs) {
+		return r.downloadSections(ctx, pack, blobs, extra, decodeCh, done)
+	}
+
 	// track already processed blobs for precise error reporting
 	processedBlobs := restic.NewBlobSet()
-	err := r.downloadBlobs(ctx, pack.id, blobs, processedBlobs)
-	return r.reportError(blobs, processedBlobs, err)
+	err := r.downloadBlobs(ctx, pack.id, blobs, extra, processedBlobs)
+	if err := r.reportError(blobs, processedBlobs, err); err != nil {
+		return err
+	}
+	done(pack)
+	return nil
+}
+
+// decodeJob is a downloaded section of a pack which must be decoded.
+type decodeJob struct {
+	section restic.PackSection
+	pack    *packJob
+}
+
+// packJob tracks restoring a pack whose sections are decoded concurrently.
+type packJob struct {
+	r     *fileRestorer
+	pack  *packInfo
+	blobs blobToFileOffsetsMapping
+	done  func(*packInfo)
+
+	handleBlob func(h restic.BlobHandle, blobData []byte, err error) error
+	// writes of all sections, only set if r.sortWrites is set
+	ctx    context.Context
+	writes *packWrites
+
+	m         sync.Mutex
+	processed restic.BlobSet
+	// number of sections which are not yet decoded, plus one while downloading
+	pending int
+	err     error
+}
+
+func (r *fileRestorer) downloadSections(ctx context.Context, pack *packInfo, blobs blobToFileOffsetsMapping, extra restic.BlobSet, decodeCh chan<- decodeJob, done func(*packInfo)) error {
+	job := &packJob{
+		r:         r,
+		pack:      pack,
+		blobs:     blobs,
+		done:      done,
+		processed: restic.NewBlobSet(),
+		pending:   1,
+		ctx:       ctx,
+		writes:    r.newPackWrites(),
+	}
+	job.handleBlob = r.blobCache.wrapHandler(r.blobHandler(ctx, pack.id, blobs, job.writes, func(h restic.BlobHandle) {
+		job.m.Lock()
+		job.processed.Insert(h)
+		job.m.Unlock()
+	}))
+	if extra != nil {
+		job.handleBlob = r.checkHandler(pack.id, extra, job.handleBlob)
+	}
+
+	blobList := make([]restic.BlobHandle, 0, len(blobs)+len(extra))
+	for _, entry := range blobs {
+		blobList = append(blobList, entry.blob)
+	}
+	for h := range extra {
+		blobList = append(blobList, h)
+	}
+	err := r.outage.wrapSectionsLoader(r.sectionsLoader)(ctx, pack.id, blobList, func(section restic.PackSection) error {
+		job.m.Lock()
+		job.pending++
+		job.m.Unlock()
+		select {
+		case decodeCh <- decodeJob{section: section, pack: job}:
+			return nil
+		case <-ctx.Done():
+			// the section will never be decoded
+			_ = job.finish(nil)
+			return ctx.Err()
+		}
+	})
+	return job.finish(err)
+}
+
+// finish records the result of downloading or decoding a section. Once all
+// sections are finished, errors are reported for all files which could not be
+// restored completely.
+func (j *packJob) finish(err error) error {
+	j.m.Lock()
+	if err != nil && j.err == nil {
+		j.err = err
+	}
+	j.pending--
+	last := j.pending == 0
+	j.m.Unlock()
+	if !last {
+		return nil
+	}
+
+	if err := j.writes.flush(j.ctx, j.r); err != nil {
+		return err
+	}
+	if err := j.r.reportError(j.blobs, j.processed, j.err); err != nil {
+		return err
+	}
+	j.done(j.pack)
+	return nil
 }
 
 func (r *fileRestorer) sanitizeError(file *fileInfo, err error) error {
-	switch err {
-	case nil, context.Canceled, context.DeadlineExceeded:
+	switch {
+	case err == nil, err == context.Canceled, err == context.DeadlineExceeded:
 		// Context errors are permanent.
 		return err
+	case isOutage(err):
+		// Restarting the restore is up to restoreWithOutageRetries.
+		return err
 	default:
 		return r.Error(file.location, err)
 	}
@@ -320,6 +1037,11 @@ func (r *fileRestorer) reportError(blobs blobToFileOffsetsMapping, processedBlob
 	if err == nil {
 		return nil
 	}
+	if isOutage(err) {
+		// the failed blobs may already be processed, if the loader passed
+		// the download error to the blob handler
+		return err
+	}
 
 	// only report error for not yet processed blobs
 	affectedFiles := make(map[*fileInfo]struct{})
@@ -341,17 +1063,64 @@ func (r *fileRestorer) reportError(blobs blobToFileOffsetsMapping, processedBlob
 }
 
 func (r *fileRestorer) downloadBlobs(ctx context.Context, packID restic.ID,
-	blobs blobToFileOffsetsMapping, processedBlobs restic.BlobSet) error {
+	blobs blobToFileOffsetsMapping, extra restic.BlobSet, processedBlobs restic.BlobSet) error {
 
-	blobList := make([]restic.BlobHandle, 0, len(blobs))
-	for _, entry := range blobs {
-		blobList = append(blobList, entry.blob)
+	writes := r.newPackWrites()
+	handleBlob := r.blobHandler(ctx, packID, blobs, writes, processedBlobs.Insert)
+	blobList := make([]restic.BlobHandle, 0, len(blobs)+len(extra))
+	var err error
+	for id, entry := range blobs {
+		buf, ok := r.blobCache.get(id)
+		if !ok {
+			buf, ok = r.seed.get(id, entry.length)
+		}
+		if !ok {
+			blobList = append(blobList, entry.blob)
+			continue
+		}
+		entry.cached = true
+		blobs[id] = entry
+		if err = handleBlob(entry.blob, buf, nil); err != nil {
+			break
+		}
 	}
-	return r.blobsLoader(ctx, packID, blobList,
-		func(h restic.BlobHandle, blobData []byte, err error) error {
-			processedBlobs.Insert(h)
-			blob := blobs[h.ID]
-			if err != nil {
+	loadHandler := r.blobCache.wrapHandler(handleBlob)
+	if extra != nil {
+		for h := range extra {
+			blobList = append(blobList, h)
+		}
+		loadHandler = r.checkHandler(packID, extra, loadHandler)
+	}
+	if err == nil && len(blobList) > 0 {
+		err = r.outage.wrapLoader(r.sampleCache.wrapLoader(r.faults.wrapLoader(r.blobsLoader)))(ctx, packID, blobList, loadHandler)
+	}
+	if flushErr := writes.flush(ctx, r); flushErr != nil {
+		return flushErr
+	}
+	return err
+}
+
+// blobHandler returns a callback which writes the loaded blobs to all files
+// at the offsets listed in blobs. Each handled blob is passed to markProcessed.
+// Blobs whose data is damaged are recorded in r.corrupt. If writes is not nil,
+// the blobs are queued there instead of being written immediately.
+func (r *fileRestorer) blobHandler(ctx context.Context, packID restic.ID, blobs blobToFileOffsetsMapping, writes *packWrites, markProcessed func(restic.BlobHandle)) func(h restic.BlobHandle, blobData []byte, err error) error {
+	return func(h restic.BlobHandle, blobData []byte, err error) error {
+		markProcessed(h)
+		blob := blobs[h.ID]
+		if err == nil && uint(len(blobData)) != blob.length {
+			// writing the buffer would silently result in wrong file content
+			err = errors.Errorf("loader returned %d bytes for blob %v, expected %d", len(blobData), h, blob.length)
+		}
+		if errors.Is(err, restic.ErrInvalidData) && r.alternatePacks {
+			if data := r.loadAlternate(ctx, packID, h, blob.length); data != nil {
+				blobData, err = data, nil
+			}
+		}
+		damaged := err != nil
+		if damaged {
+			err = r.corrupt.record(packID, h, err)
+			if r.salvage == nil {
 				for file := range blob.files {
 					if errFile := r.sanitizeError(file, err); errFile != nil {
 						return errFile
@@ -359,41 +1128,172 @@ func (r *fileRestorer) downloadBlobs(ctx context.Context, packID restic.ID,
 				}
 				return nil
 			}
+			// continue with the remaining content of the files
 			for file, offsets := range blob.files {
 				for _, offset := range offsets {
-					// avoid long cancellation delays for frequently used blobs
-					if ctx.Err() != nil {
-						return ctx.Err()
-					}
-
-					writeToFile := func() error {
-						// this looks overly complicated and needs explanation
-						// two competing requirements:
-						// - must create the file once and only once
-						// - should allow concurrent writes to the file
-						// so write the first blob while holding file lock
-						// write other blobs after releasing the lock
-						createSize := int64(-1)
-						file.lock.Lock()
-						if file.inProgress {
-							file.lock.Unlock()
-						} else {
-							defer file.lock.Unlock()
-							file.inProgress = true
-							createSize = file.size
-						}
-						writeErr := r.filesWriter.writeToFile(r.targetPath(file.location), blobData, offset, createSize, file.sparse)
-						r.reportBlobProgress(file, uint64(len(blobData)))
-						return writeErr
-					}
-					err := r.sanitizeError(file, writeToFile())
-					if err != nil {
-						return err
-					}
+					r.salvage.add(file, offset, blob.length, h.ID, err)
 				}
 			}
+			blobData = make([]byte, blob.length)
+		} else if !blob.cached {
+			r.compression.add(blob.stored, blob.length, blob.compressed)
+		}
+		if writes != nil {
+			writes.add(blob.files, h, blobData, damaged)
 			return nil
-		})
+		}
+		for file, offsets := range blob.files {
+			if r.canceled.skip(file) {
+				continue
+			}
+			for _, offset := range offsets {
+				// avoid long cancellation delays for frequently used blobs
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if err := r.writeBlob(ctx, file, offset, h, blobData, damaged); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// writeBlob writes blobData to file at offset. Errors are passed to
+// sanitizeError.
+func (r *fileRestorer) writeBlob(ctx context.Context, file *fileInfo, offset int64, h restic.BlobHandle, blobData []byte, damaged bool) error {
+	write := func(data []byte, offset int64) error {
+		// this looks overly complicated and needs explanation
+		// two competing requirements:
+		// - must create the file once and only once
+		// - should allow concurrent writes to the file
+		// so write the first blob while holding file lock
+		// write other blobs after releasing the lock
+		createSize := int64(-1)
+		file.lock.Lock()
+		if file.inProgress {
+			file.lock.Unlock()
+		} else {
+			defer file.lock.Unlock()
+			file.inProgress = true
+			createSize = file.size
+			if r.slowFileThreshold > 0 {
+				file.started = time.Now()
+			}
+			if r.tracer != nil {
+				_, file.span = r.tracer.Start(ctx, SpanFileWrite,
+					StringAttribute(AttrFilePath, file.location),
+					IntAttribute(AttrFileBytes, file.size))
+			}
+		}
+		if r.patch != nil {
+			return r.patch.write(file, data, offset)
+		}
+		if r.encryption != nil {
+			return r.writeEncrypted(file, data, offset, createSize)
+		}
+		path := r.targetPath(file.location)
+		if err := r.filesWriter.writeToFile(path, data, offset, createSize, file.sparse, file.keepHoles); err != nil {
+			return err
+		}
+		if r.verifyWrites != nil && r.verifyWrites(file.location) {
+			return r.filesWriter.verifyWrite(path, data, offset)
+		}
+		return nil
+	}
+
+	writeToFile := func() error {
+		var writeStarted time.Time
+		if r.report != nil {
+			writeStarted = time.Now()
+		}
+		var writeErr error
+		if file.blocks != nil {
+			for _, block := range file.blocks.add(offset, blobData) {
+				if writeErr = write(block.data, block.offset); writeErr != nil {
+					break
+				}
+			}
+		} else {
+			writeErr = write(blobData, offset)
+		}
+		if writeErr == nil && !damaged {
+			r.compression.write(len(blobData))
+		}
+		if writeErr == nil && r.journal != nil && !damaged {
+			writeErr = r.journal.recordBlob(file.location, offset, h.ID)
+		}
+		if writeErr == nil && file.keepHoles {
+			r.recordZeroRegion(file, offset, blobData)
+		}
+		r.reportBlobProgress(file, uint64(len(blobData)))
+		if writeErr == nil {
+			r.report.written(file.location, uint64(len(blobData)), writeStarted)
+		}
+		if writeErr != nil && file.span != nil {
+			file.span.RecordError(writeErr)
+		}
+		if writeErr == nil && r.trackPending() && file.pendingBlobs.Add(-1) == 0 {
+			if r.encryption != nil {
+				writeErr = r.sealEncrypted(file)
+			}
+			if writeErr == nil && len(file.holes) > 0 {
+				writeErr = r.filesWriter.punchHoles(r.targetPath(file.location), file.holes)
+			}
+			if writeErr == nil && r.slowFileThreshold > 0 {
+				r.reportSlowFile(file)
+			}
+			if writeErr == nil {
+				// partially recovered files are scanned as well
+				var vetoed bool
+				vetoed, writeErr = r.scanFile(file)
+				if !vetoed && !r.salvage.has(file) {
+					r.completion.complete(file)
+				}
+			}
+			if writeErr == nil && r.filesWriter.cacheAdvice == CacheAdviceDontNeed {
+				r.filesWriter.closeFile(r.targetPath(file.location))
+			}
+			if file.span != nil {
+				endSpan(file.span, writeErr)
+			}
+		}
+		return writeErr
+	}
+	return r.sanitizeError(file, writeToFile())
+}
+
+// trackPending reports whether the number of pending blobs is tracked for each
+// file, which is necessary to detect when a file has been written completely.
+func (r *fileRestorer) trackPending() bool {
+	return r.slowFileThreshold > 0 || r.sparse || r.encryption != nil || r.completion != nil || r.scan != nil || r.tracer != nil ||
+		r.filesWriter.cacheAdvice == CacheAdviceDontNeed
+}
+
+// recordZeroRegion records the blob written to file at offset if it only
+// contains zeros, see fileInfo.keepHoles.
+func (r *fileRestorer) recordZeroRegion(file *fileInfo, offset int64, blobData []byte) {
+	if len(blobData) == 0 || restic.ZeroPrefixLen(blobData) != len(blobData) {
+		return
+	}
+	file.lock.Lock()
+	defer file.lock.Unlock()
+	file.holes = append(file.holes, zeroRegion{offset: offset, length: int64(len(blobData))})
+}
+
+// reportSlowFile reports file if restoring it took longer than
+// r.slowFileThreshold. Must be called once the last blob was written. All
+// writes happen after the first one has set file.started, thus reading it
+// does not require the file lock, which the first write still holds.
+func (r *fileRestorer) reportSlowFile(file *fileInfo) {
+	elapsed := time.Since(file.started)
+	if elapsed <= r.slowFileThreshold {
+		return
+	}
+	debug.Log("%sslow file %v: %d bytes from %d packs took %v", r.logPrefix, file.location, file.size, file.packCount, elapsed)
+	r.Info(fmt.Sprintf("slow file %v: restoring %s from %d packs took %v",
+		file.location, ui.FormatBytes(uint64(file.size)), file.packCount, elapsed.Round(time.Millisecond)))
 }
 
 func (r *fileRestorer) reportBlobProgress(file *fileInfo, blobSize uint64) {
@@ -401,5 +1301,11 @@ func (r *fileRestorer) reportBlobProgress(file *fileInfo, blobSize uint64) {
 	if file.state == nil {
 		action = ActionFileRestored
 	}
-	r.progress.AddProgress(file.location, action, blobSize, uint64(file.size))
+	if r.progressBatch != nil {
+		r.progressBatch.add(file.location, action, blobSize, uint64(file.size))
+	} else {
+		r.progress.AddProgress(file.location, action, blobSize, uint64(file.size))
+	}
+	r.content.addCompleted(blobSize)
+	r.watchdog.progressed()
 }
@@ -8,7 +8,9 @@ import (
 	"os"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/feature"
@@ -419,3 +421,476 @@ func TestFatalDownloadError(t *testing.T) {
 	rtest.Assert(t, len(errors) == 1, "unexpected number of restore errors, expected: 1, got: %v", len(errors))
 	rtest.Assert(t, errors[0] == "file2", "expected error for file2, got: %v", errors[0])
 }
+
+func TestFileRestorerMissingBlobs(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack1"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+			},
+		}}
+
+	repo := newTestRepo(content)
+	// drop two blobs from the index
+	missing := restic.IDs{restic.Hash([]byte("data1-2")), restic.Hash([]byte("data2-1"))}
+	for _, id := range missing {
+		delete(repo.blobs, id)
+	}
+
+	r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.checkMissingBlobs = true
+	r.files = repo.files
+
+	err := r.restoreFiles(context.TODO())
+	var missingErr *MissingBlobsError
+	rtest.Assert(t, errors.As(err, &missingErr), "unexpected error %v", err)
+	slices.SortFunc(missing, func(a, b restic.ID) int { return bytes.Compare(a[:], b[:]) })
+	rtest.Equals(t, missing, missingErr.Blobs)
+
+	_, err = os.Stat(r.targetPath("file1"))
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "expected no file to be created, got %v", err)
+}
+
+func TestFileRestorerDeadline(t *testing.T) {
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+			},
+		}}
+
+	for _, test := range []struct {
+		name        string
+		gracePeriod time.Duration
+		blockLoader bool
+		partial     []string
+	}{
+		{
+			name:    "in-progress pack completes",
+			partial: []string{"file2"},
+		},
+		{
+			name:        "grace period exceeded",
+			gracePeriod: 10 * time.Millisecond,
+			blockLoader: true,
+			partial:     []string{"file1", "file2"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			repo := newTestRepo(content)
+			loader := repo.loader
+			repo.loader = func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+				// wait until the deadline has passed
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(50 * time.Millisecond):
+				}
+				if test.blockLoader {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+				return loader(ctx, packID, handles, handleBlobFn)
+			}
+
+			r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+				repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+			r.files = repo.files
+			r.deadline = time.Now().Add(10 * time.Millisecond)
+			r.deadlineGracePeriod = test.gracePeriod
+
+			err := r.restoreFiles(context.TODO())
+			var deadlineErr *DeadlineExceededError
+			rtest.Assert(t, errors.As(err, &deadlineErr), "unexpected error %v", err)
+			rtest.Equals(t, test.partial, deadlineErr.Files)
+		})
+	}
+}
+
+func TestFileRestorerSizeQuota(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	content := []TestFile{
+		{name: "old", blobs: []TestBlob{{"data-old", "pack1"}}},
+		{name: "new", blobs: []TestBlob{{"data-new", "pack1"}}},
+		{name: "newest-large", blobs: []TestBlob{{"data-newest-large", "pack2"}}},
+	}
+
+	repo := newTestRepo(content)
+	now := time.Now()
+	for i, file := range repo.files {
+		file.size = int64(len(repo.fileContent(file)))
+		file.modTime = now.Add(time.Duration(i) * time.Hour)
+	}
+
+	r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	// the newest file fits, the next one does not
+	r.sizeQuota = uint64(len("data-newest-large") + len("data-new") - 1)
+
+	r.applySizeQuota()
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Equals(t, []string{"new", "old"}, r.quotaSkipped)
+
+	data, err := os.ReadFile(r.targetPath("newest-large"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "data-newest-large", string(data))
+	for _, name := range r.quotaSkipped {
+		_, err = os.Stat(r.targetPath(name))
+		rtest.Assert(t, errors.Is(err, os.ErrNotExist), "expected %v to be skipped, got %v", name, err)
+	}
+}
+
+// testPackSection decodes a pack using the blobsLoader of a TestRepo
+type testPackSection struct {
+	loader blobsLoaderFn
+	packID restic.ID
+	blobs  []restic.BlobHandle
+}
+
+func (s *testPackSection) Decode(ctx context.Context, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+	return s.loader(ctx, s.packID, s.blobs, handleBlobFn)
+}
+
+func (s *testPackSection) LoadErr() error {
+	return nil
+}
+
+func TestFileRestorerDecodeWorkers(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	sectionErr := errors.New("section error")
+	repo := newTestRepo([]TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack1"},
+				{"data2-2", "pack3"},
+			},
+		},
+		{
+			name: "file3",
+			blobs: []TestBlob{
+				{"data3-1", "pack4"},
+			},
+		},
+	})
+	pack4 := restic.Hash([]byte("data3-1"))
+
+	r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.decodeWorkers = 2
+	r.sectionsLoader = func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleSectionFn func(section restic.PackSection) error) error {
+		if packID.Equal(pack4) {
+			return sectionErr
+		}
+		// pass each blob as a separate section
+		for _, blob := range blobs {
+			err := handleSectionFn(&testPackSection{repo.loader, packID, []restic.BlobHandle{blob}})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var failed []string
+	r.Error = func(location string, err error) error {
+		rtest.Assert(t, errors.Is(err, sectionErr), "unexpected error %v", err)
+		failed = append(failed, location)
+		return nil
+	}
+
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Equals(t, []string{"file3"}, failed)
+
+	for _, file := range repo.files[:2] {
+		data, err := os.ReadFile(r.targetPath(file.location))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.fileContent(file), string(data))
+	}
+}
+
+func TestFileRestorerSlowFiles(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	repo := newTestRepo([]TestFile{
+		{
+			name: "slow",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "fast",
+			blobs: []TestBlob{
+				{"data2-1", "pack3"},
+				{"data2-2", "pack3"},
+			},
+		},
+		{
+			name:  "single",
+			blobs: []TestBlob{{"data3-1", "pack4"}},
+		},
+	})
+	pack2 := restic.Hash([]byte("data1-2"))
+	loader := repo.loader
+	repo.loader = func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		if packID.Equal(pack2) {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return loader(ctx, packID, handles, handleBlobFn)
+	}
+
+	// a single worker restores the packs in order of first use
+	r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	for _, file := range repo.files {
+		file.size = int64(len(repo.fileContent(file)))
+	}
+	r.files = repo.files
+	r.slowFileThreshold = 20 * time.Millisecond
+	var infos []string
+	r.Info = func(msg string) {
+		infos = append(infos, msg)
+	}
+
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Assert(t, len(infos) == 1, "unexpected messages %v", infos)
+	rtest.Assert(t, strings.HasPrefix(infos[0], "slow file slow: restoring 14 B from 2 packs took"), "unexpected message %q", infos[0])
+}
+
+func TestFileRestorerSequentialFiles(t *testing.T) {
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+				{"data2-2", "pack1"},
+			},
+		},
+		{
+			name: "file3",
+			blobs: []TestBlob{
+				{"data3-1", "pack1"},
+			},
+		},
+	}
+	repo := newTestRepo(content)
+
+	var m sync.Mutex
+	var loaded []string
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		return repo.loader(ctx, packID, handles, func(blob restic.BlobHandle, buf []byte, err error) error {
+			m.Lock()
+			loaded = append(loaded, string(buf))
+			m.Unlock()
+			return handleBlobFn(blob, buf, err)
+		})
+	}
+
+	tempdir := rtest.TempDir(t)
+	r := newFileRestorer(tempdir, loader, repo.Lookup, 4, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.sequentialFiles = 1
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+
+	// blobs of a file are only loaded once the previous file is complete
+	rtest.Equals(t, 5, len(loaded))
+	for i := 1; i < len(loaded); i++ {
+		rtest.Assert(t, loaded[i-1][:5] <= loaded[i][:5], "blobs loaded out of order: %v", loaded)
+	}
+	for _, file := range content {
+		data, err := os.ReadFile(r.targetPath(file.name))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.filesPathToContent[file.name], string(data))
+	}
+}
+
+func TestFileRestorerSchedulerMetrics(t *testing.T) {
+	repo := newTestRepo([]TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+				{"data1-3", "pack3"},
+				{"data1-4", "pack4"},
+			},
+		},
+	})
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		time.Sleep(30 * time.Millisecond)
+		return repo.loader(ctx, packID, handles, handleBlobFn)
+	}
+
+	r := newFileRestorer(rtest.TempDir(t), loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.metrics = &schedulerMetrics{}
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+
+	// a single slow worker is the bottleneck
+	m := r.metrics.result()
+	rtest.Equals(t, 1, m.Workers)
+	rtest.Assert(t, m.Duration >= 120*time.Millisecond, "unexpected duration %v", m.Duration)
+	rtest.Assert(t, m.SchedulerWait >= 60*time.Millisecond, "unexpected scheduler wait %v", m.SchedulerWait)
+	rtest.Assert(t, m.WorkerIdle < m.SchedulerWait, "unexpected worker idle time %v", m.WorkerIdle)
+	rtest.Assert(t, m.AvgIdleWorkers >= 0 && m.AvgIdleWorkers < 1, "unexpected idle workers %v", m.AvgIdleWorkers)
+	rtest.Equals(t, 1, len(m.PerWorker))
+	rtest.Equals(t, 0, m.PerWorker[0].ID)
+	rtest.Equals(t, uint64(4*len("data1-1")), m.PerWorker[0].Bytes)
+	rtest.Assert(t, m.PerWorker[0].Busy >= 120*time.Millisecond, "unexpected busy time %v", m.PerWorker[0].Busy)
+}
+
+func TestSchedulerMetricsWorkerThroughput(t *testing.T) {
+	m := &SchedulerMetrics{PerWorker: []WorkerMetrics{
+		{ID: 0, Bytes: 3000, Busy: time.Second},
+		{ID: 1, Bytes: 100, Busy: time.Second},
+		// never received a pack
+		{ID: 2},
+		{ID: 3, Bytes: 4000, Busy: 2 * time.Second},
+	}}
+	minimum, median, maximum, ok := m.WorkerThroughput()
+	rtest.Assert(t, ok, "missing throughput")
+	rtest.Equals(t, 100.0, minimum)
+	rtest.Equals(t, 2000.0, median)
+	rtest.Equals(t, 3000.0, maximum)
+
+	m.PerWorker = m.PerWorker[:2]
+	_, median, _, _ = m.WorkerThroughput()
+	rtest.Equals(t, 1550.0, median)
+
+	_, _, _, ok = (&SchedulerMetrics{PerWorker: []WorkerMetrics{{ID: 0}}}).WorkerThroughput()
+	rtest.Assert(t, !ok, "unexpected throughput without downloads")
+}
+
+func TestFileRestorerTruncatedBlobs(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	repo := newTestRepo([]TestFile{
+		{
+			name: "truncated",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack1"},
+			},
+		},
+		{
+			name: "empty",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+			},
+		},
+		{
+			name: "intact",
+			blobs: []TestBlob{
+				{"data3-1", "pack2"},
+			},
+		},
+	})
+
+	truncated := restic.Hash([]byte("data1-2"))
+	empty := restic.Hash([]byte("data2-1"))
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		return repo.loader(ctx, packID, handles, func(blob restic.BlobHandle, buf []byte, err error) error {
+			switch blob.ID {
+			case truncated:
+				buf = buf[:len(buf)-1]
+			case empty:
+				buf = buf[:0]
+			}
+			return handleBlobFn(blob, buf, err)
+		})
+	}
+
+	r := newFileRestorer(tempdir, loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	var failed []string
+	r.Error = func(location string, err error) error {
+		rtest.Assert(t, strings.Contains(err.Error(), "expected 7"), "unexpected error %v", err)
+		failed = append(failed, location)
+		return nil
+	}
+
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	slices.Sort(failed)
+	rtest.Equals(t, []string{"empty", "truncated"}, failed)
+
+	data, err := os.ReadFile(r.targetPath("intact"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "data3-1", string(data))
+}
+
+func TestFileRestorerDuplicateFiles(t *testing.T) {
+	content := []TestFile{
+		{name: "file", blobs: []TestBlob{{"data1-1", "pack1"}}},
+		{name: "other", blobs: []TestBlob{{"data2-1", "pack2"}, {"data2-2", "pack2"}}},
+	}
+
+	for _, dedupe := range []bool{false, true} {
+		repo := newTestRepo(content)
+		r := newFileRestorer(rtest.TempDir(t), repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+			repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+		// add the second file a second time for the location of the first one
+		other := repo.files[1]
+		r.files = append(repo.files, &fileInfo{location: "file", blobs: other.blobs, size: other.size})
+		r.dedupeFiles = dedupe
+		var failed []string
+		r.Error = func(location string, err error) error {
+			failed = append(failed, location)
+			return nil
+		}
+
+		rtest.OK(t, r.restoreFiles(context.TODO()))
+		if dedupe {
+			rtest.Equals(t, 0, len(failed))
+		} else {
+			rtest.Equals(t, []string{"file"}, failed)
+		}
+		for name, expected := range map[string]string{"file": "data1-1", "other": "data2-1data2-2"} {
+			data, err := os.ReadFile(r.targetPath(name))
+			rtest.OK(t, err)
+			rtest.Equals(t, expected, string(data))
+		}
+	}
+
+	// errors abort the restore
+	repo := newTestRepo(content)
+	r := newFileRestorer(rtest.TempDir(t), repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = append(repo.files, repo.files[0])
+	rtest.Assert(t, r.restoreFiles(context.TODO()) != nil, "expected error for duplicate file")
+}
@@ -24,6 +24,47 @@ type filesWriter struct {
 	allowRecursiveDelete bool
 	cacheMu              sync.Mutex
 	cache                *simplelru.LRU[string, *partialFile]
+	// only used by tests
+	faults *faultInjector
+
+	immutable ImmutableBehavior
+	// write protection of files which must be reapplied after the restore
+	protectedMu sync.Mutex
+	protected   map[string]uint32
+
+	// limits the number of files created concurrently in the same directory,
+	// zero means no limit
+	dirCreateLimit int
+	dirsMu         sync.Mutex
+	dirs           map[string]*dirLimiter
+
+	// already open files to restore into instead of the file at the path,
+	// see Options.TargetFiles
+	targets map[string]*os.File
+
+	// files whose hardlinks were already created, they are not replaced
+	// despite having multiple links, see Options.SortedEntries
+	linked map[string]struct{}
+
+	// minimum length of a zero run within a blob which is skipped in sparse
+	// files, zero disables the check, see Options.SparseHoleThreshold
+	holeThreshold int
+
+	// resolves the paths within the target directory, may be nil
+	root *targetRoot
+	// paths outside of root are accessed directly instead of being refused,
+	// see Options.PathMap
+	allowOutside bool
+
+	// see Options.CacheAdvice
+	cacheAdvice CacheAdvice
+}
+
+// dirLimiter is a semaphore limiting concurrent file creations in a
+// directory. It is removed once it has no users.
+type dirLimiter struct {
+	sem   chan struct{}
+	users int
 }
 
 type filesWriterBucket struct {
@@ -35,6 +76,14 @@ type partialFile struct {
 	*os.File
 	users  int // Reference count.
 	sparse bool
+	// see filesWriter.holeThreshold
+	holeThreshold int
+	cacheAdvice   CacheAdvice
+}
+
+func (wr *partialFile) close() error {
+	adviseClose(wr.File, wr.cacheAdvice)
+	return wr.Close()
 }
 
 func newFilesWriter(count int, allowRecursiveDelete bool) *filesWriter {
@@ -48,7 +97,7 @@ func newFilesWriter(count int, allowRecursiveDelete bool) *filesWriter {
 	cache, err := simplelru.NewLRU[string, *partialFile](count+50, func(_ string, wr *partialFile) {
 		// close the file only when it is not in use
 		if wr.users == 0 {
-			_ = wr.Close()
+			_ = wr.close()
 		}
 	})
 	if err != nil {
@@ -59,11 +108,51 @@ func newFilesWriter(count int, allowRecursiveDelete bool) *filesWriter {
 		buckets:              buckets,
 		allowRecursiveDelete: allowRecursiveDelete,
 		cache:                cache,
+		protected:            make(map[string]uint32),
+		dirs:                 make(map[string]*dirLimiter),
+		linked:               make(map[string]struct{}),
+	}
+}
+
+// rootFor returns the root to resolve path with.
+func (w *filesWriter) rootFor(path string) *targetRoot {
+	if w.allowOutside && !w.root.contains(path) {
+		return nil
+	}
+	return w.root
+}
+
+// acquireDir blocks until another file may be created in dir, as limited by
+// dirCreateLimit. The returned function must be called once the file was
+// created.
+func (w *filesWriter) acquireDir(dir string) (release func()) {
+	if w.dirCreateLimit <= 0 {
+		return func() {}
+	}
+
+	w.dirsMu.Lock()
+	l, ok := w.dirs[dir]
+	if !ok {
+		l = &dirLimiter{sem: make(chan struct{}, w.dirCreateLimit)}
+		w.dirs[dir] = l
+	}
+	l.users++
+	w.dirsMu.Unlock()
+
+	l.sem <- struct{}{}
+	return func() {
+		<-l.sem
+		w.dirsMu.Lock()
+		l.users--
+		if l.users == 0 {
+			delete(w.dirs, dir)
+		}
+		w.dirsMu.Unlock()
 	}
 }
 
-func openFile(path string) (*os.File, error) {
-	f, err := fs.OpenFile(path, fs.O_WRONLY|fs.O_NOFOLLOW, 0600)
+func openFile(root *targetRoot, path string) (*os.File, error) {
+	f, err := root.OpenFile(path, fs.O_WRONLY|fs.O_NOFOLLOW, 0600)
 	if err != nil {
 		return nil, err
 	}
@@ -79,20 +168,20 @@ func openFile(path string) (*os.File, error) {
 	return f, nil
 }
 
-func createFile(path string, createSize int64, sparse bool, allowRecursiveDelete bool) (*os.File, error) {
-	f, err := fs.OpenFile(path, fs.O_CREATE|fs.O_WRONLY|fs.O_NOFOLLOW, 0600)
+func createFile(root *targetRoot, path string, createSize int64, sparse bool, allowRecursiveDelete bool) (*os.File, error) {
+	f, err := root.OpenFile(path, fs.O_CREATE|fs.O_WRONLY|fs.O_NOFOLLOW, 0600)
 	if err != nil && fs.IsAccessDenied(err) {
 		// If file is readonly, clear the readonly flag by resetting the
 		// permissions of the file and try again
 		// as the metadata will be set again in the second pass and the
 		// readonly flag will be applied again if needed.
-		if err = fs.ResetPermissions(path); err != nil {
+		if err = root.ResetPermissions(path); err != nil {
 			return nil, err
 		}
-		if f, err = fs.OpenFile(path, fs.O_WRONLY|fs.O_NOFOLLOW, 0600); err != nil {
+		if f, err = root.OpenFile(path, fs.O_WRONLY|fs.O_NOFOLLOW, 0600); err != nil {
 			return nil, err
 		}
-	} else if err != nil && (errors.Is(err, syscall.ELOOP) || errors.Is(err, syscall.EISDIR)) {
+	} else if err != nil && (errors.Is(err, syscall.ELOOP) || errors.Is(err, syscall.EISDIR) || root.isSymlink(path)) {
 		// symlink or directory, try to remove it later on
 		f = nil
 	} else if err != nil {
@@ -129,16 +218,16 @@ func createFile(path string, createSize int64, sparse bool, allowRecursiveDelete
 
 		// not what we expected, try to get rid of it
 		if allowRecursiveDelete {
-			if err := fs.RemoveAll(path); err != nil {
+			if err := root.RemoveAll(path); err != nil {
 				return nil, err
 			}
 		} else {
-			if err := fs.Remove(path); err != nil {
+			if err := root.Remove(path); err != nil {
 				return nil, err
 			}
 		}
 		// create a new file, pass O_EXCL to make sure there are no surprises
-		f, err = fs.OpenFile(path, fs.O_CREATE|fs.O_WRONLY|fs.O_EXCL|fs.O_NOFOLLOW, 0600)
+		f, err = root.OpenFile(path, fs.O_CREATE|fs.O_WRONLY|fs.O_EXCL|fs.O_NOFOLLOW, 0600)
 		if err != nil {
 			return nil, err
 		}
@@ -180,7 +269,16 @@ func ensureSize(f *os.File, fi os.FileInfo, createSize int64, sparse bool) (*os.
 	return f, nil
 }
 
-func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, createSize int64, sparse bool) error {
+// writeToFile writes blob to the file at path. The file is created by the first
+// write, for which createSize is not negative. Zeros within blob are skipped
+// for sparse files. If keepHoles is set, the file is sized like a sparse file,
+// such that the holes of an existing file are not allocated, but blob is
+// written completely.
+func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, createSize int64, sparse bool, keepHoles bool) error {
+	if ok, err := w.writeToTarget(path, blob, offset, createSize, sparse); ok {
+		return err
+	}
+
 	bucket := &w.buckets[uint(xxhash.Sum64String(path))%uint(len(w.buckets))]
 
 	acquireWriter := func() (*partialFile, error) {
@@ -212,15 +310,16 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 		var f *os.File
 		var err error
 		if createSize >= 0 {
-			f, err = createFile(path, createSize, sparse, w.allowRecursiveDelete)
+			f, err = w.createFile(path, createSize, sparse || keepHoles)
 			if err != nil {
 				return nil, err
 			}
-		} else if f, err = openFile(path); err != nil {
+		} else if f, err = openFile(w.rootFor(path), path); err != nil {
 			return nil, err
 		}
 
-		wr := &partialFile{File: f, users: 1, sparse: sparse}
+		adviseOpen(f, w.cacheAdvice)
+		wr := &partialFile{File: f, users: 1, sparse: sparse, holeThreshold: w.holeThreshold, cacheAdvice: w.cacheAdvice}
 		bucket.files[path] = wr
 
 		return wr, nil
@@ -246,7 +345,10 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 		return err
 	}
 
-	_, err = wr.WriteAt(blob, offset)
+	err = w.faults.checkWrite(path, offset)
+	if err == nil {
+		_, err = wr.WriteAt(w.faults.data(path, offset, blob), offset)
+	}
 
 	if err != nil {
 		// ignore subsequent errors
@@ -257,6 +359,15 @@ func (w *filesWriter) writeToFile(path string, blob []byte, offset int64, create
 	return releaseWriter(wr)
 }
 
+// closeFile closes the cached file handle for path, if any. It must only be
+// called once all writes to the file have completed.
+func (w *filesWriter) closeFile(path string) {
+	w.cacheMu.Lock()
+	defer w.cacheMu.Unlock()
+
+	w.cache.Remove(path)
+}
+
 func (w *filesWriter) flush() {
 	w.cacheMu.Lock()
 	defer w.cacheMu.Unlock()
@@ -5,7 +5,10 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/restic/restic/internal/errors"
 	rtest "github.com/restic/restic/internal/test"
@@ -18,16 +21,16 @@ func TestFilesWriterBasic(t *testing.T) {
 	f1 := dir + "/f1"
 	f2 := dir + "/f2"
 
-	rtest.OK(t, w.writeToFile(f1, []byte{1}, 0, 2, false))
+	rtest.OK(t, w.writeToFile(f1, []byte{1}, 0, 2, false, false))
 	rtest.Equals(t, 0, len(w.buckets[0].files))
 
-	rtest.OK(t, w.writeToFile(f2, []byte{2}, 0, 2, false))
+	rtest.OK(t, w.writeToFile(f2, []byte{2}, 0, 2, false, false))
 	rtest.Equals(t, 0, len(w.buckets[0].files))
 
-	rtest.OK(t, w.writeToFile(f1, []byte{1}, 1, -1, false))
+	rtest.OK(t, w.writeToFile(f1, []byte{1}, 1, -1, false, false))
 	rtest.Equals(t, 0, len(w.buckets[0].files))
 
-	rtest.OK(t, w.writeToFile(f2, []byte{2}, 1, -1, false))
+	rtest.OK(t, w.writeToFile(f2, []byte{2}, 1, -1, false, false))
 	rtest.Equals(t, 0, len(w.buckets[0].files))
 
 	w.flush()
@@ -50,14 +53,14 @@ func TestFilesWriterRecursiveOverwrite(t *testing.T) {
 
 	// must error if recursive delete is not allowed
 	w := newFilesWriter(1, false)
-	err := w.writeToFile(path, []byte{1}, 0, 2, false)
+	err := w.writeToFile(path, []byte{1}, 0, 2, false, false)
 	rtest.Assert(t, errors.Is(err, notEmptyDirError()), "unexpected error got %v", err)
 	rtest.Equals(t, 0, len(w.buckets[0].files))
 	w.flush()
 
 	// must replace directory
 	w = newFilesWriter(1, true)
-	rtest.OK(t, w.writeToFile(path, []byte{1, 1}, 0, 2, false))
+	rtest.OK(t, w.writeToFile(path, []byte{1, 1}, 0, 2, false, false))
 	rtest.Equals(t, 0, len(w.buckets[0].files))
 	w.flush()
 
@@ -137,7 +140,7 @@ func TestCreateFile(t *testing.T) {
 			for j, test := range tests {
 				path := basepath + fmt.Sprintf("%v%v", i, j)
 				sc.create(t, path)
-				f, err := createFile(path, test.size, test.isSparse, false)
+				f, err := createFile(nil, path, test.size, test.isSparse, false)
 				if sc.err == nil {
 					rtest.OK(t, err)
 					fi, err := f.Stat()
@@ -165,10 +168,126 @@ func TestCreateFileRecursiveDelete(t *testing.T) {
 	rtest.OK(t, os.WriteFile(filepath.Join(path, "file"), []byte("data"), 0o400))
 
 	// replace it
-	f, err := createFile(path, 42, false, true)
+	f, err := createFile(nil, path, 42, false, true)
 	rtest.OK(t, err)
 	fi, err := f.Stat()
 	rtest.OK(t, err)
 	rtest.Assert(t, fi.Mode().IsRegular(), "wrong filetype %v", fi.Mode())
 	rtest.OK(t, f.Close())
 }
+
+func TestFilesWriterKeepHoles(t *testing.T) {
+	const size = 1 << 20
+	dir := rtest.TempDir(t)
+	if sparse, err := probeSparse(dir); err != nil || !sparse {
+		t.Skipf("sparse files are not supported: %v", err)
+	}
+
+	createSparse := func(path string) {
+		f, err := os.Create(path)
+		rtest.OK(t, err)
+		rtest.OK(t, truncateSparse(f, size))
+		_, err = f.WriteAt([]byte{1}, 0)
+		rtest.OK(t, err)
+		rtest.OK(t, f.Close())
+	}
+	checkSparse := func(path string) bool {
+		f, err := os.Open(path)
+		rtest.OK(t, err)
+		defer func() { rtest.OK(t, f.Close()) }()
+		fi, err := f.Stat()
+		rtest.OK(t, err)
+		rtest.Equals(t, int64(size), fi.Size())
+		sparse, err := isSparse(f, size)
+		rtest.OK(t, err)
+		return sparse
+	}
+
+	// the holes of the existing file must not be allocated
+	path := filepath.Join(dir, "keep")
+	createSparse(path)
+	w := newFilesWriter(1, false)
+	rtest.OK(t, w.writeToFile(path, []byte{0}, 0, size, false, true))
+	w.flush()
+	rtest.Assert(t, checkSparse(path), "holes of %v were allocated", path)
+	data, err := os.ReadFile(path)
+	rtest.OK(t, err)
+	rtest.Equals(t, byte(0), data[0])
+
+	// otherwise, existing files are preallocated like new ones
+	path = filepath.Join(dir, "preallocate")
+	createSparse(path)
+	w = newFilesWriter(1, false)
+	rtest.OK(t, w.writeToFile(path, []byte{0}, 0, size, false, false))
+	w.flush()
+	if checkSparse(path) && runtime.GOOS == "linux" {
+		t.Errorf("%v was not preallocated", path)
+	}
+}
+
+func TestFilesWriterDirCreateLimit(t *testing.T) {
+	w := newFilesWriter(1, false)
+	w.dirCreateLimit = 2
+
+	var active, maxActive atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := w.acquireDir("dir")
+			n := active.Add(1)
+			for {
+				m := maxActive.Load()
+				if n <= m || maxActive.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			active.Add(-1)
+			release()
+		}()
+	}
+	// other directories are not affected
+	release := w.acquireDir("other")
+	release()
+	wg.Wait()
+
+	rtest.Assert(t, maxActive.Load() <= 2, "%d concurrent file creations, expected at most 2", maxActive.Load())
+	rtest.Equals(t, 0, len(w.dirs))
+}
+
+func BenchmarkFilesWriterFlatDirectory(b *testing.B) {
+	const files = 5000
+	for _, limit := range []int{0, 4, 16} {
+		b.Run(fmt.Sprintf("limit-%d", limit), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				dir := b.TempDir()
+				w := newFilesWriter(runtime.GOMAXPROCS(0), false)
+				w.dirCreateLimit = limit
+				paths := make(chan string)
+				var wg sync.WaitGroup
+				for j := 0; j < 32; j++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for path := range paths {
+							if err := w.writeToFile(path, []byte{1}, 0, 1, false, false); err != nil {
+								b.Error(err)
+							}
+						}
+					}()
+				}
+				b.StartTimer()
+
+				for j := 0; j < files; j++ {
+					paths <- filepath.Join(dir, fmt.Sprintf("file%d", j))
+				}
+				close(paths)
+				wg.Wait()
+				w.flush()
+			}
+		})
+	}
+}
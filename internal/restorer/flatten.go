@@ -0,0 +1,126 @@
+package restorer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FlattenCollisionBehavior specifies how to handle items whose flattened
+// names collide, see Options.Flatten.
+type FlattenCollisionBehavior int
+
+// Constants for different flatten collision behavior
+const (
+	// FlattenCollisionSuffix appends a counter to the name of each item whose
+	// flattened name is already used by a previous item.
+	FlattenCollisionSuffix FlattenCollisionBehavior = iota
+	// FlattenCollisionFail reports an error for each item whose flattened name
+	// is already used by a previous item and does not restore it.
+	FlattenCollisionFail
+	FlattenCollisionInvalid
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (c *FlattenCollisionBehavior) Set(s string) error {
+	switch s {
+	case "suffix":
+		*c = FlattenCollisionSuffix
+	case "fail":
+		*c = FlattenCollisionFail
+	default:
+		*c = FlattenCollisionInvalid
+		return fmt.Errorf("invalid flatten collision behavior %q, must be one of (suffix|fail)", s)
+	}
+
+	return nil
+}
+
+func (c *FlattenCollisionBehavior) String() string {
+	switch *c {
+	case FlattenCollisionSuffix:
+		return "suffix"
+	case FlattenCollisionFail:
+		return "fail"
+	default:
+		return "invalid"
+	}
+}
+
+func (c *FlattenCollisionBehavior) Type() string {
+	return "behavior"
+}
+
+// flatNames assigns the names of the items restored directly into dst if
+// Options.Flatten is set. Names are assigned in the order of the snapshot and
+// remain stable for all traversals of the tree. It is safe for concurrent use.
+type flatNames struct {
+	m        sync.Mutex
+	dst      string
+	resolver ConflictResolver
+	// flattened name by location, empty if the item is not restored
+	names map[string]string
+	// location by flattened name
+	used map[string]string
+}
+
+func newFlatNames(dst string, resolver ConflictResolver) *flatNames {
+	return &flatNames{
+		dst:      dst,
+		resolver: resolver,
+		names:    make(map[string]string),
+		used:     make(map[string]string),
+	}
+}
+
+// flattenLocation replaces the path separators in location to derive a file
+// name from it. For example, "/dir/sub/file" becomes "dir_sub_file".
+func flattenLocation(location string) string {
+	sep := string(filepath.Separator)
+	return strings.ReplaceAll(strings.TrimPrefix(location, sep), sep, "_")
+}
+
+// target returns the path to restore the item at location to. An empty path
+// means that the item must be skipped, as its name collides with another
+// item. The collision is only reported once as an error.
+func (f *flatNames) target(location string) (string, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	name, ok := f.names[location]
+	if !ok {
+		var err error
+		name, err = f.assign(location)
+		f.names[location] = name
+		if err != nil {
+			return "", err
+		}
+	}
+	if name == "" {
+		return "", nil
+	}
+	return filepath.Join(f.dst, name), nil
+}
+
+func (f *flatNames) assign(location string) (string, error) {
+	name := flattenLocation(location)
+	if other, ok := f.used[name]; ok {
+		var err error
+		name, err = resolveConflict(f.resolver, Conflict{
+			Reason:   ConflictNameInUse,
+			Location: location,
+			Name:     name,
+			Existing: other,
+			InUse: func(name string) bool {
+				_, ok := f.used[name]
+				return ok
+			},
+		})
+		if err != nil || name == "" {
+			return "", err
+		}
+	}
+	f.used[name] = location
+	return name, nil
+}
@@ -0,0 +1,148 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFlatNames(t *testing.T) {
+	f := newFlatNames("/target", DefaultConflictResolver(FlattenCollisionSuffix, LongPathFail))
+	for _, test := range []struct {
+		location, target string
+	}{
+		{"/a/b.txt", "/target/a_b.txt"},
+		{"/a_b.txt", "/target/a_b-1.txt"},
+		{"/a_b-1.txt", "/target/a_b-1-1.txt"},
+		{"/c.d/e", "/target/c.d_e"},
+		{"/c_d/e", "/target/c_d_e"},
+		{"/c.d_e", "/target/c-1.d_e"},
+		// repeated lookups return the same name
+		{"/a_b.txt", "/target/a_b-1.txt"},
+	} {
+		target, err := f.target(filepath.FromSlash(test.location))
+		rtest.OK(t, err)
+		rtest.Equals(t, filepath.FromSlash(test.target), target)
+	}
+
+	f = newFlatNames("/target", DefaultConflictResolver(FlattenCollisionFail, LongPathFail))
+	_, err := f.target(filepath.FromSlash("/a/b"))
+	rtest.OK(t, err)
+	_, err = f.target(filepath.FromSlash("/a_b"))
+	rtest.Assert(t, err != nil, "expected collision error")
+	// the collision is only reported once
+	target, err := f.target(filepath.FromSlash("/a_b"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "", target)
+}
+
+func TestRestorerFlatten(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"a": Dir{
+				Nodes: map[string]Node{
+					"b": Dir{
+						Nodes: map[string]Node{
+							"c": Dir{
+								Nodes: map[string]Node{
+									"d": Dir{
+										Nodes: map[string]Node{
+											"file.txt": File{Data: "content: nested\n"},
+										},
+									},
+								},
+							},
+						},
+					},
+					"b_c_d_file.txt": File{Data: "content: collision\n"},
+					"link":           Symlink{Target: "b"},
+				},
+			},
+			"top": File{Data: "content: top\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, test := range []struct {
+		collision FlattenCollisionBehavior
+		files     map[string]string
+		errors    int
+	}{
+		{
+			FlattenCollisionSuffix,
+			map[string]string{
+				"a_b_c_d_file.txt":   "content: nested\n",
+				"a_b_c_d_file-1.txt": "content: collision\n",
+				"top":                "content: top\n",
+			},
+			0,
+		},
+		{
+			FlattenCollisionFail,
+			map[string]string{
+				"a_b_c_d_file.txt": "content: nested\n",
+				"top":              "content: top\n",
+			},
+			1,
+		},
+	} {
+		t.Run(test.collision.String(), func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			res := NewRestorer(repo, sn, Options{Flatten: true, FlattenCollision: test.collision})
+			var m sync.Mutex
+			var errs []error
+			res.Error = func(location string, err error) error {
+				m.Lock()
+				defer m.Unlock()
+				rtest.Equals(t, filepath.FromSlash("/a/b_c_d_file.txt"), location)
+				errs = append(errs, err)
+				return nil
+			}
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.errors, len(errs))
+
+			entries, err := os.ReadDir(tempdir)
+			rtest.OK(t, err)
+			var names []string
+			for _, entry := range entries {
+				rtest.Assert(t, !entry.IsDir(), "unexpected directory %v", entry.Name())
+				names = append(names, entry.Name())
+			}
+			rtest.Equals(t, len(test.files)+1, len(names), "unexpected entries %v", strings.Join(names, ", "))
+			for name, content := range test.files {
+				data, err := os.ReadFile(filepath.Join(tempdir, name))
+				rtest.OK(t, err)
+				rtest.Equals(t, content, string(data))
+			}
+			target, err := os.Readlink(filepath.Join(tempdir, "a_link"))
+			rtest.OK(t, err)
+			rtest.Equals(t, "b", target)
+
+			// verification uses the same names
+			count, err := res.VerifyFiles(context.TODO(), tempdir, uint64(len(test.files)), restic.NoopCounter)
+			rtest.OK(t, err)
+			rtest.Equals(t, len(test.files), count)
+		})
+	}
+}
+
+func TestRestorerFlattenDelete(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{Data: "content: file\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	res := NewRestorer(repo, sn, Options{Flatten: true, Delete: true})
+	_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.Assert(t, err != nil, "expected error for flatten combined with delete")
+}
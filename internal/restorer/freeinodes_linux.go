@@ -0,0 +1,19 @@
+package restorer
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// freeInodes returns the number of inodes available on the filesystem
+// containing path. ok is false if the filesystem does not report a fixed
+// inode limit, for example btrfs.
+func freeInodes(path string) (free uint64, ok bool, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, false, err
+	}
+	if st.Files == 0 {
+		return 0, false, nil
+	}
+	return st.Ffree, true, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package restorer
+
+// freeInodes is not implemented on this platform and always reports that
+// the number of free inodes is unknown.
+func freeInodes(_ string) (free uint64, ok bool, err error) {
+	return 0, false, nil
+}
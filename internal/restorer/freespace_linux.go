@@ -0,0 +1,15 @@
+package restorer
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// freeSpace returns the number of bytes available to unprivileged users on
+// the filesystem containing path.
+func freeSpace(path string) (free uint64, ok bool, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, false, err
+	}
+	return st.Bavail * uint64(st.Bsize), true, nil
+}
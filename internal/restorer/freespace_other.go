@@ -0,0 +1,9 @@
+//go:build !linux
+
+package restorer
+
+// freeSpace is not implemented on this platform and always reports that the
+// free space is unknown.
+func freeSpace(_ string) (free uint64, ok bool, err error) {
+	return 0, false, nil
+}
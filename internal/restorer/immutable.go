@@ -0,0 +1,122 @@
+package restorer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// ImmutableBehavior specifies how to handle existing files which are
+// write-protected by the immutable or append-only attribute.
+type ImmutableBehavior int
+
+// Constants for different immutable behavior
+const (
+	// ImmutableFail reports an error for write-protected files.
+	ImmutableFail ImmutableBehavior = iota
+	// ImmutableClear removes the write protection before restoring a file.
+	ImmutableClear
+	// ImmutableReapply is like ImmutableClear, but sets the write protection
+	// again once the file has been restored.
+	ImmutableReapply
+	ImmutableInvalid
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (c *ImmutableBehavior) Set(s string) error {
+	switch s {
+	case "fail":
+		*c = ImmutableFail
+	case "clear":
+		*c = ImmutableClear
+	case "reapply":
+		*c = ImmutableReapply
+	default:
+		*c = ImmutableInvalid
+		return fmt.Errorf("invalid immutable behavior %q, must be one of (fail|clear|reapply)", s)
+	}
+
+	return nil
+}
+
+func (c *ImmutableBehavior) String() string {
+	switch *c {
+	case ImmutableFail:
+		return "fail"
+	case ImmutableClear:
+		return "clear"
+	case ImmutableReapply:
+		return "reapply"
+	default:
+		return "invalid"
+	}
+}
+
+func (c *ImmutableBehavior) Type() string {
+	return "behavior"
+}
+
+// createFile is like createFile, but handles files which are write-protected
+// by the immutable or append-only attribute according to w.immutable. The
+// number of concurrent creations per directory is limited by w.dirCreateLimit.
+func (w *filesWriter) createFile(path string, createSize int64, sparse bool) (*os.File, error) {
+	defer w.acquireDir(filepath.Dir(path))()
+
+	if _, ok := w.linked[path]; ok {
+		return openLinkedFile(w.rootFor(path), path, createSize, sparse)
+	}
+	f, err := createFile(w.rootFor(path), path, createSize, sparse, w.allowRecursiveDelete)
+	if err == nil || !fs.IsAccessDenied(err) {
+		return f, err
+	}
+
+	flags, flagErr := fs.GetWriteProtection(path)
+	if flagErr != nil || flags == 0 {
+		debug.Log("unable to determine write protection of %v: %v", path, flagErr)
+		return nil, err
+	}
+	if w.immutable == ImmutableFail {
+		return nil, errors.Errorf("cannot overwrite %v, as it has the immutable or append-only attribute", path)
+	}
+	if err := fs.SetWriteProtection(path, 0); err != nil {
+		return nil, errors.Wrap(err, "removing immutable or append-only attribute requires root privileges")
+	}
+	if w.immutable == ImmutableReapply {
+		w.protectedMu.Lock()
+		w.protected[path] = flags
+		w.protectedMu.Unlock()
+	}
+	return createFile(w.rootFor(path), path, createSize, sparse, w.allowRecursiveDelete)
+}
+
+// reapplyWriteProtection sets the write protection again for all files for
+// which it was removed. It must be called once the metadata of all files has
+// been restored.
+func (r *fileRestorer) reapplyWriteProtection() error {
+	paths := make([]string, 0, len(r.filesWriter.protected))
+	for path := range r.filesWriter.protected {
+		paths = append(paths, path)
+	}
+	slices.Sort(paths)
+
+	for _, path := range paths {
+		err := fs.SetWriteProtection(path, r.filesWriter.protected[path])
+		if err == nil {
+			continue
+		}
+		location, relErr := filepath.Rel(r.dst, path)
+		if relErr != nil {
+			location = path
+		}
+		if err := r.Error(string(filepath.Separator)+location, err); err != nil {
+			return err
+		}
+	}
+	r.filesWriter.protected = make(map[string]uint32)
+	return nil
+}
@@ -0,0 +1,69 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestoreImmutable(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: new\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, test := range []struct {
+		behavior  ImmutableBehavior
+		err       string
+		protected bool
+	}{
+		{behavior: ImmutableFail, err: "immutable or append-only attribute"},
+		{behavior: ImmutableClear},
+		{behavior: ImmutableReapply, protected: true},
+	} {
+		t.Run(test.behavior.String(), func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			path := filepath.Join(tempdir, "foo")
+			rtest.OK(t, os.WriteFile(path, []byte("content: old\n"), 0o644))
+			if err := fs.SetWriteProtection(path, fsImmutableFlag); err != nil {
+				t.Skipf("unable to set immutable attribute: %v", err)
+			}
+			t.Cleanup(func() {
+				_ = fs.SetWriteProtection(path, 0)
+			})
+
+			res := NewRestorer(repo, sn, Options{Immutable: test.behavior})
+			var errs []error
+			res.Error = func(_ string, err error) error {
+				errs = append(errs, err)
+				return nil
+			}
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.OK(t, err)
+			if test.err != "" {
+				rtest.Assert(t, len(errs) > 0 && strings.Contains(errs[0].Error(), test.err), "unexpected errors %v", errs)
+				return
+			}
+			rtest.Equals(t, 0, len(errs))
+
+			data, err := os.ReadFile(path)
+			rtest.OK(t, err)
+			rtest.Equals(t, "content: new\n", string(data))
+
+			flags, err := fs.GetWriteProtection(path)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.protected, flags != 0)
+		})
+	}
+}
+
+// as defined in linux/fs.h
+const fsImmutableFlag = 0x10
@@ -0,0 +1,61 @@
+package restorer
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// IndexLookupStats summarizes the index lookups of the file restorer, see
+// Options.IndexLookupStats. A large Duration compared to the duration of the
+// restore indicates that the index rather than the IO limits the restore, for
+// example as a lazily loaded index is still incomplete.
+type IndexLookupStats struct {
+	// Lookups is the number of blobs looked up in the index.
+	Lookups uint64
+	// Misses is the number of lookups which did not find the blob.
+	Misses uint64
+	// Duration is the total time spent in lookups. Lookups from multiple
+	// workers are summed up, thus it can exceed the duration of the restore.
+	Duration time.Duration
+}
+
+// indexStats counts the lookups of an index. It is safe for concurrent use.
+type indexStats struct {
+	lookups  atomic.Uint64
+	misses   atomic.Uint64
+	duration atomic.Int64
+}
+
+// wrap returns a lookup function which records the lookups of idx.
+func (s *indexStats) wrap(idx func(restic.BlobHandle) []restic.PackBlob) func(restic.BlobHandle) []restic.PackBlob {
+	return func(h restic.BlobHandle) []restic.PackBlob {
+		start := time.Now()
+		packs := idx(h)
+		s.duration.Add(int64(time.Since(start)))
+		s.lookups.Add(1)
+		if len(packs) == 0 {
+			s.misses.Add(1)
+		}
+		return packs
+	}
+}
+
+func (s *indexStats) stats() IndexLookupStats {
+	if s == nil {
+		return IndexLookupStats{}
+	}
+	return IndexLookupStats{
+		Lookups:  s.lookups.Load(),
+		Misses:   s.misses.Load(),
+		Duration: time.Duration(s.duration.Load()),
+	}
+}
+
+// IndexLookups returns the statistics of the index lookups. It is only
+// available once RestoreTo has completed and is empty unless
+// Options.IndexLookupStats is set.
+func (res *Restorer) IndexLookups() IndexLookupStats {
+	return res.indexStats.stats()
+}
@@ -0,0 +1,54 @@
+package restorer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestIndexStatsWrap(t *testing.T) {
+	known := restic.NewRandomID()
+	s := &indexStats{}
+	idx := s.wrap(func(h restic.BlobHandle) []restic.PackBlob {
+		if h.ID.Equal(known) {
+			return []restic.PackBlob{&testPackBlob{}}
+		}
+		return nil
+	})
+
+	rtest.Equals(t, 1, len(idx(restic.BlobHandle{Type: restic.DataBlob, ID: known})))
+	rtest.Equals(t, 0, len(idx(restic.BlobHandle{Type: restic.DataBlob, ID: restic.NewRandomID()})))
+
+	stats := s.stats()
+	rtest.Equals(t, uint64(2), stats.Lookups)
+	rtest.Equals(t, uint64(1), stats.Misses)
+	rtest.Assert(t, stats.Duration >= 0, "negative duration %v", stats.Duration)
+}
+
+func TestRestorerIndexLookupStats(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{DataParts: []string{"part-1\n", "part-2\n"}},
+			"bar": File{Data: "content: bar\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, enabled := range []bool{false, true} {
+		res := NewRestorer(repo, sn, Options{IndexLookupStats: enabled})
+		_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+		rtest.OK(t, err)
+
+		stats := res.IndexLookups()
+		if !enabled {
+			rtest.Equals(t, IndexLookupStats{}, stats)
+			continue
+		}
+		// each blob is looked up while planning the download
+		rtest.Assert(t, stats.Lookups >= 3, "expected at least 3 lookups, got %v", stats.Lookups)
+		rtest.Equals(t, uint64(0), stats.Misses)
+	}
+}
@@ -0,0 +1,195 @@
+package restorer
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// journalEntry records that the blob with the given ID was completely
+// written to the file at location, starting at offset. Alternatively, it
+// contains the progress of an interrupted restore.
+type journalEntry struct {
+	Location string           `json:"location"`
+	Offset   int64            `json:"offset"`
+	ID       restic.ID        `json:"id"`
+	Progress *ResumedProgress `json:"progress,omitempty"`
+}
+
+// restoreJournal keeps track of the blobs which have already been written to
+// the target files. This allows an interrupted restore to skip blobs which
+// were written by the previous run without having to verify their content.
+//
+// The journal is written without calling fsync, thus it only protects against
+// an interrupted restic process, not against a system crash.
+type restoreJournal struct {
+	path string
+
+	m sync.Mutex
+	f *os.File
+	w *bufio.Writer
+	// blobs written by previous runs, keyed by location and offset
+	completed map[string]map[int64]restic.ID
+	// progress of the last interrupted run, if any
+	progress *ResumedProgress
+}
+
+// openJournal loads the journal at path, if it exists, and opens it for
+// appending new entries.
+func openJournal(path string) (*restoreJournal, error) {
+	j := &restoreJournal{
+		path:      path,
+		completed: make(map[string]map[int64]restic.ID),
+	}
+
+	f, err := fs.OpenFile(path, fs.O_RDWR|fs.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "open journal")
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// the last entry may be incomplete if restic was interrupted
+			debug.Log("ignoring invalid journal entry %q: %v", scanner.Text(), err)
+			continue
+		}
+		if entry.Progress != nil {
+			j.progress = entry.Progress
+			continue
+		}
+		offsets, ok := j.completed[entry.Location]
+		if !ok {
+			offsets = make(map[int64]restic.ID)
+			j.completed[entry.Location] = offsets
+		}
+		offsets[entry.Offset] = entry.ID
+	}
+	if err := scanner.Err(); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "read journal")
+	}
+
+	// terminate a possibly incomplete last entry
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "seek journal")
+	}
+	j.f = f
+	j.w = bufio.NewWriter(f)
+	if _, err := j.w.WriteString("\n"); err != nil {
+		_ = f.Close()
+		return nil, errors.Wrap(err, "write journal")
+	}
+	return j, nil
+}
+
+// fileState returns the state of the file at target according to the
+// journal. It returns nil if the journal contains no entries for location or
+// if the file does not match the journal.
+func (j *restoreJournal) fileState(target, location string, node *data.Node, lookupSize func(restic.BlobHandle) (uint, bool)) *fileState {
+	offsets, ok := j.completed[location]
+	if !ok {
+		return nil
+	}
+
+	fi, err := fs.Lstat(target)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != int64(node.Size) {
+		// the file was modified since the journal was written
+		debug.Log("journal entries for %v do not match file %v", location, target)
+		return nil
+	}
+
+	matches := make([]bool, len(node.Content))
+	var offset int64
+	for i, blobID := range node.Content {
+		length, found := lookupSize(restic.BlobHandle{Type: restic.DataBlob, ID: blobID})
+		if !found {
+			return nil
+		}
+		id, ok := offsets[offset]
+		matches[i] = ok && id.Equal(blobID)
+		offset += int64(length)
+	}
+	return &fileState{matches, true}
+}
+
+// recordBlob adds an entry for the blob id written at offset to the file at location.
+func (j *restoreJournal) recordBlob(location string, offset int64, id restic.ID) error {
+	buf, err := json.Marshal(journalEntry{Location: location, Offset: offset, ID: id})
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+
+	j.m.Lock()
+	defer j.m.Unlock()
+	_, err = j.w.Write(buf)
+	return err
+}
+
+// restored returns whether the journal contains entries for location.
+func (j *restoreJournal) restored(location string) bool {
+	if j == nil {
+		return false
+	}
+	_, ok := j.completed[location]
+	return ok
+}
+
+// recordProgress adds the progress of an interrupted restore. It is a no-op
+// once the journal was closed.
+func (j *restoreJournal) recordProgress(state ResumedProgress) error {
+	buf, err := json.Marshal(struct {
+		Progress ResumedProgress `json:"progress"`
+	}{state})
+	if err != nil {
+		return err
+	}
+	buf = append(buf, '\n')
+
+	j.m.Lock()
+	defer j.m.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	_, err = j.w.Write(buf)
+	return err
+}
+
+// Close flushes all entries and closes the journal. Calling Close more than
+// once is a no-op.
+func (j *restoreJournal) Close() error {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	if j.f == nil {
+		return nil
+	}
+	err := j.w.Flush()
+	if cerr := j.f.Close(); err == nil {
+		err = cerr
+	}
+	j.f = nil
+	return err
+}
+
+// remove closes and deletes the journal once the restore has completed.
+func (j *restoreJournal) remove() error {
+	if err := j.Close(); err != nil {
+		return err
+	}
+	return fs.Remove(j.path)
+}
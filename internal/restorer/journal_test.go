@@ -0,0 +1,155 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestJournalReload(t *testing.T) {
+	path := filepath.Join(rtest.TempDir(t), "journal")
+	id1 := restic.NewRandomID()
+	id2 := restic.NewRandomID()
+
+	j, err := openJournal(path)
+	rtest.OK(t, err)
+	rtest.OK(t, j.recordBlob("/foo", 0, id1))
+	rtest.OK(t, j.recordBlob("/foo", 42, id2))
+	rtest.OK(t, j.recordProgress(ResumedProgress{FilesTotal: 1, BytesTotal: 100}))
+	rtest.OK(t, j.recordProgress(ResumedProgress{FilesTotal: 2, BytesWritten: 42, BytesTotal: 100}))
+	rtest.OK(t, j.Close())
+	// a closed journal no longer records the progress
+	rtest.OK(t, j.recordProgress(ResumedProgress{}))
+
+	// simulate an interrupted write
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	rtest.OK(t, err)
+	_, err = f.WriteString(`{"location":"/bar","off`)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+
+	j, err = openJournal(path)
+	rtest.OK(t, err)
+	rtest.Equals(t, map[string]map[int64]restic.ID{
+		"/foo": {0: id1, 42: id2},
+	}, j.completed)
+	rtest.Equals(t, &ResumedProgress{FilesTotal: 2, BytesWritten: 42, BytesTotal: 100}, j.progress)
+	rtest.OK(t, j.recordBlob("/bar", 0, id1))
+	rtest.OK(t, j.Close())
+
+	j, err = openJournal(path)
+	rtest.OK(t, err)
+	rtest.Equals(t, 2, len(j.completed))
+	rtest.OK(t, j.remove())
+	_, err = os.Stat(path)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "expected journal to be removed, got %v", err)
+}
+
+func TestRestoreWithJournal(t *testing.T) {
+	origData := "content: foo\n"
+	modData := "content: bar\n"
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: origData},
+			"bar": File{Data: origData},
+		},
+	}
+
+	repo := repository.TestRepository(t)
+	tempdir := filepath.Join(rtest.TempDir(t), "target")
+	journal := filepath.Join(rtest.TempDir(t), "journal")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+	res := NewRestorer(repo, sn, Options{Journal: journal})
+	_, err := res.RestoreTo(ctx, tempdir)
+	rtest.OK(t, err)
+	_, err = os.Stat(journal)
+	rtest.Assert(t, errors.Is(err, os.ErrNotExist), "expected journal to be removed, got %v", err)
+
+	// pretend that a previous restore was interrupted after restoring foo,
+	// but both files were modified afterwards
+	for _, name := range []string{"foo", "bar"} {
+		rtest.OK(t, os.WriteFile(filepath.Join(tempdir, name), []byte(modData), 0o600))
+	}
+	j, err := openJournal(journal)
+	rtest.OK(t, err)
+	rtest.OK(t, j.recordBlob(string(filepath.Separator)+"foo", 0, restic.Hash([]byte(origData))))
+	rtest.OK(t, j.Close())
+
+	progress := newTestProgress()
+	res = NewRestorer(repo, sn, Options{Journal: journal, Progress: progress})
+	_, err = res.RestoreTo(ctx, tempdir)
+	rtest.OK(t, err)
+
+	// foo is not verified as it is recorded in the journal
+	for name, expected := range map[string]string{"foo": modData, "bar": origData} {
+		data, err := os.ReadFile(filepath.Join(tempdir, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, expected, string(data), "unexpected content of %v", name)
+	}
+	// foo is part of the progress of the resumed restore
+	rtest.Equals(t, uint64(0), progress.state().FilesSkipped)
+	rtest.Equals(t, uint64(2), progress.state().FilesFinished)
+}
+
+type resumingProgress struct {
+	*testProgress
+	resumed *ResumedProgress
+}
+
+func (p *resumingProgress) ResumeProgress(state ResumedProgress) {
+	p.resumed = &state
+}
+
+func (p *resumingProgress) ProgressState() ResumedProgress {
+	return ResumedProgress{
+		FilesFinished: p.s.FilesFinished,
+		FilesTotal:    p.s.FilesTotal,
+		BytesWritten:  p.s.AllBytesWritten,
+		BytesTotal:    p.s.AllBytesTotal,
+	}
+}
+
+func TestRestoreWithJournalProgress(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n"},
+			"bar": File{Data: "content: bar\n"},
+		},
+	}, noopGetGenericAttributes)
+	tempdir := rtest.TempDir(t)
+	journal := filepath.Join(rtest.TempDir(t), "journal")
+
+	// interrupt the restore before restoring the file content, the files are
+	// already added to the progress
+	ctx, cancel := context.WithCancel(context.Background())
+	progress := &resumingProgress{testProgress: newTestProgress()}
+	res := NewRestorer(repo, sn, Options{Journal: journal, Progress: progress})
+	res.SelectFilter = func(item string, isDir bool) (bool, bool) {
+		if item == filepath.FromSlash("/foo") {
+			cancel()
+		}
+		return true, true
+	}
+	_, err := res.RestoreTo(ctx, tempdir)
+	rtest.Assert(t, errors.Is(err, context.Canceled), "expected canceled restore, got %v", err)
+	rtest.Assert(t, progress.resumed == nil, "unexpected resumed progress %v", progress.resumed)
+	interrupted := progress.ProgressState()
+	rtest.Equals(t, ResumedProgress{FilesTotal: 2, BytesTotal: 26}, interrupted)
+
+	progress = &resumingProgress{testProgress: newTestProgress()}
+	res = NewRestorer(repo, sn, Options{Journal: journal, Progress: progress})
+	_, err = res.RestoreTo(context.Background(), tempdir)
+	rtest.OK(t, err)
+	rtest.Equals(t, &interrupted, progress.resumed)
+	rtest.Equals(t, ResumedProgress{FilesFinished: 2, FilesTotal: 2, BytesWritten: 26, BytesTotal: 26}, progress.ProgressState())
+}
@@ -0,0 +1,30 @@
+package restorer
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/data"
+)
+
+// List calls fn for each item which would be restored, in the order of the
+// snapshot with directories before their content. It honors SelectFilter, but
+// neither accesses the target directory nor looks up the file content in the
+// index, which makes it much faster than a dry run. location is the path of
+// the item within the snapshot.
+func (res *Restorer) List(ctx context.Context, fn func(location string, node *data.Node) error) error {
+	// the target is only used to verify that the items stay within it
+	root := string(filepath.Separator)
+	return res.traverseTree(ctx, root, *res.sn.Tree, treeVisitor{
+		enterDir: func(node *data.Node, _, location string) error {
+			if node == nil {
+				// the target directory itself
+				return nil
+			}
+			return fn(location, node)
+		},
+		visitNode: func(node *data.Node, _, location string) error {
+			return fn(location, node)
+		},
+	})
+}
@@ -0,0 +1,43 @@
+package restorer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerList(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file":     File{Data: "content: file\n"},
+				"excluded": File{Data: "content: excluded\n"},
+				"sub": Dir{Nodes: map[string]Node{
+					"link": Symlink{Target: "../file"},
+				}},
+			}},
+			"top": File{Data: "content: top\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	res := NewRestorer(repo, sn, Options{})
+	res.SelectFilter = func(item string, isDir bool) (bool, bool) {
+		selected := filepath.Base(item) != "excluded"
+		return selected, selected && isDir
+	}
+
+	var locations []string
+	sizes := make(map[string]uint64)
+	rtest.OK(t, res.List(context.TODO(), func(location string, node *data.Node) error {
+		locations = append(locations, filepath.ToSlash(location))
+		sizes[filepath.ToSlash(location)] = node.Size
+		return nil
+	}))
+	rtest.Equals(t, []string{"/dir", "/dir/file", "/dir/sub", "/dir/sub/link", "/top"}, locations)
+	rtest.Equals(t, uint64(len("content: file\n")), sizes["/dir/file"])
+}
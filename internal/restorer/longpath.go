@@ -0,0 +1,183 @@
+package restorer
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// LongPathBehavior specifies how to restore items whose name or path exceeds
+// the limits of the target platform, see Options.LongPaths.
+type LongPathBehavior int
+
+// Constants for different long path behavior
+const (
+	// LongPathFail restores the items using their original name, thus
+	// creating them fails with an error.
+	LongPathFail LongPathBehavior = iota
+	// LongPathTruncate shortens the name of each item until it fits, keeping
+	// the file extension intact. If another item in the same directory was
+	// already shortened to the same name, a hash of the original name is
+	// appended like for LongPathHash.
+	LongPathTruncate
+	// LongPathHash shortens the name of each item until it fits and appends a
+	// hash of the original name, such that the shortened names stay unique.
+	LongPathHash
+	// LongPathSkip does not restore the items.
+	LongPathSkip
+	LongPathInvalid
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (b *LongPathBehavior) Set(s string) error {
+	switch s {
+	case "fail":
+		*b = LongPathFail
+	case "truncate":
+		*b = LongPathTruncate
+	case "hash":
+		*b = LongPathHash
+	case "skip":
+		*b = LongPathSkip
+	default:
+		*b = LongPathInvalid
+		return fmt.Errorf("invalid long path behavior %q, must be one of (fail|truncate|hash|skip)", s)
+	}
+
+	return nil
+}
+
+func (b *LongPathBehavior) String() string {
+	switch *b {
+	case LongPathFail:
+		return "fail"
+	case LongPathTruncate:
+		return "truncate"
+	case LongPathHash:
+		return "hash"
+	case LongPathSkip:
+		return "skip"
+	default:
+		return "invalid"
+	}
+}
+
+func (b *LongPathBehavior) Type() string {
+	return "behavior"
+}
+
+// LongPath is an item whose name or path exceeds the limits of the target
+// platform. Name is the shortened name it was restored as, it is empty if the
+// item was skipped.
+type LongPath struct {
+	Location string
+	Name     string
+}
+
+// Length of the hash appended to shortened names by LongPathHash.
+const longPathHashLength = 16
+
+// longPaths assigns the names of items whose name or path is too long if
+// Options.LongPaths is set. The names only depend on the location of an item,
+// thus they are stable for all traversals of the tree. Two items in the same
+// directory are never assigned the same name. It is safe for concurrent use.
+type longPaths struct {
+	m        sync.Mutex
+	dst      string
+	resolver ConflictResolver
+	// length added to the paths of the items by making them absolute
+	absLength int
+	// shortened name by location, empty if the item is skipped
+	items map[string]string
+	// location by target path of the shortened name
+	used map[string]string
+}
+
+func newLongPaths(dst string, resolver ConflictResolver) *longPaths {
+	l := &longPaths{
+		dst:      dst,
+		resolver: resolver,
+		items:    make(map[string]string),
+		used:     make(map[string]string),
+	}
+	if abs, err := filepath.Abs(dst); err == nil {
+		l.absLength = max(pathLength(abs)-pathLength(dst), 0)
+	}
+	return l
+}
+
+// name returns the name to restore the item at location as, which is
+// restored into the directory parent. It returns false if the item must be
+// skipped. An error is only returned once for each item.
+func (l *longPaths) name(parent, location, name string) (string, bool, error) {
+	available := min(maxNameLength, maxPathLength-l.absLength-pathLength(parent)-1)
+	if pathLength(name) <= available {
+		return name, true, nil
+	}
+
+	l.m.Lock()
+	defer l.m.Unlock()
+	if short, ok := l.items[location]; ok {
+		return short, short != "", nil
+	}
+	short, err := resolveConflict(l.resolver, Conflict{
+		Reason:    ConflictNameTooLong,
+		Location:  location,
+		Name:      name,
+		MaxLength: available,
+		InUse: func(name string) bool {
+			_, ok := l.used[filepath.Join(parent, name)]
+			return ok
+		},
+	})
+	l.items[location] = short
+	if short != "" {
+		l.used[filepath.Join(parent, short)] = location
+	}
+	return short, short != "", err
+}
+
+// truncatePathName returns the longest prefix of name which is at most
+// length long, without splitting characters.
+func truncatePathName(name string, length int) string {
+	n := 0
+	for i, r := range name {
+		n += pathLength(string(r))
+		if n > length {
+			return name[:i]
+		}
+	}
+	return name
+}
+
+// target returns the path to restore the item at location to, with all too
+// long names along the way shortened.
+func (l *longPaths) target(location string) string {
+	target := l.dst
+	itemLocation := string(filepath.Separator)
+	for _, name := range strings.Split(strings.Trim(location, string(filepath.Separator)), string(filepath.Separator)) {
+		if name == "" {
+			continue
+		}
+		itemLocation = filepath.Join(itemLocation, name)
+		name, _, _ = l.name(target, itemLocation, name)
+		target = filepath.Join(target, name)
+	}
+	return target
+}
+
+func (l *longPaths) result() []LongPath {
+	if l == nil {
+		return nil
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	result := make([]LongPath, 0, len(l.items))
+	for _, location := range slices.Sorted(maps.Keys(l.items)) {
+		result = append(result, LongPath{Location: location, Name: l.items[location]})
+	}
+	return result
+}
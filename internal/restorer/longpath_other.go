@@ -0,0 +1,16 @@
+//go:build !windows
+
+package restorer
+
+// Limits for the length of a single name and of a whole path, as counted by
+// pathLength.
+const (
+	maxNameLength = 255
+	// PATH_MAX includes the terminating null byte
+	maxPathLength = 4095
+)
+
+// pathLength returns the length of s in bytes.
+func pathLength(s string) int {
+	return len(s)
+}
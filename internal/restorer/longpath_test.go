@@ -0,0 +1,159 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testLongPathName(t *testing.T, l *longPaths, parent, location, name string) (string, bool) {
+	t.Helper()
+	name, ok, err := l.name(parent, location, name)
+	rtest.OK(t, err)
+	return name, ok
+}
+
+func TestLongPathName(t *testing.T) {
+	dst := rtest.TempDir(t)
+	long := strings.Repeat("a", 300) + ".txt"
+
+	for _, behavior := range []LongPathBehavior{LongPathTruncate, LongPathHash, LongPathSkip} {
+		l := newLongPaths(dst, DefaultConflictResolver(FlattenCollisionSuffix, behavior))
+		name, ok := testLongPathName(t, l, dst, "/short", "short.txt")
+		rtest.Assert(t, ok, "short name was skipped")
+		rtest.Equals(t, "short.txt", name)
+
+		name, ok = testLongPathName(t, l, dst, "/long", long)
+		switch behavior {
+		case LongPathTruncate:
+			rtest.Assert(t, ok, "long name was skipped")
+			rtest.Equals(t, strings.Repeat("a", maxNameLength-4)+".txt", name)
+		case LongPathHash:
+			rtest.Assert(t, ok, "long name was skipped")
+			rtest.Equals(t, maxNameLength, len(name))
+			rtest.Assert(t, strings.HasPrefix(name, "aaa") && strings.HasSuffix(name, ".txt"), "unexpected name %v", name)
+			// names which only differ after the cut must remain unique
+			other, _ := testLongPathName(t, l, dst, "/other", strings.Repeat("a", 301)+".txt")
+			rtest.Assert(t, name != other, "hashed names collide: %v", name)
+		case LongPathSkip:
+			rtest.Assert(t, !ok, "long name was not skipped")
+		}
+		rtest.Equals(t, []LongPath{{Location: "/long", Name: name}}, l.result()[:1])
+	}
+
+	// characters are never split
+	l := newLongPaths(dst, DefaultConflictResolver(FlattenCollisionSuffix, LongPathTruncate))
+	name, ok := testLongPathName(t, l, dst, "/umlauts", strings.Repeat("ä", 300))
+	rtest.Assert(t, ok, "long name was skipped")
+	rtest.Assert(t, utf8.ValidString(name), "invalid name %q", name)
+	rtest.Assert(t, pathLength(name) <= maxNameLength, "name is too long: %v", pathLength(name))
+
+	// the whole path must fit as well
+	parent := filepath.Join(dst, strings.Repeat("p", maxPathLength-l.absLength-pathLength(dst)-40))
+	l = newLongPaths(dst, DefaultConflictResolver(FlattenCollisionSuffix, LongPathHash))
+	name, ok = testLongPathName(t, l, parent, "/deep", strings.Repeat("b", 100))
+	rtest.Assert(t, ok, "long path was skipped")
+	rtest.Equals(t, maxPathLength-l.absLength, pathLength(filepath.Join(parent, name)))
+	_, ok = testLongPathName(t, l, filepath.Join(parent, strings.Repeat("c", 30)), "/deeper", strings.Repeat("b", 100))
+	rtest.Assert(t, !ok, "too long path was not skipped")
+}
+
+func TestLongPathNameCollision(t *testing.T) {
+	dst := rtest.TempDir(t)
+	first := strings.Repeat("a", 300) + ".txt"
+	second := strings.Repeat("a", 301) + ".txt"
+
+	l := newLongPaths(dst, DefaultConflictResolver(FlattenCollisionSuffix, LongPathTruncate))
+	name, _ := testLongPathName(t, l, dst, "/first", first)
+	rtest.Equals(t, strings.Repeat("a", maxNameLength-4)+".txt", name)
+	// the second name is disambiguated by a hash
+	other, ok := testLongPathName(t, l, dst, "/second", second)
+	rtest.Assert(t, ok, "long name was skipped")
+	rtest.Assert(t, name != other, "truncated names collide: %v", name)
+	rtest.Equals(t, maxNameLength, pathLength(other))
+	// names are stable and only checked within the same directory
+	name2, _ := testLongPathName(t, l, dst, "/first", first)
+	rtest.Equals(t, name, name2)
+	name2, _ = testLongPathName(t, l, filepath.Join(dst, "dir"), "/dir/first", first)
+	rtest.Equals(t, name, name2)
+
+	// a custom resolver must not return a name which is already used
+	l = newLongPaths(dst, ConflictResolverFunc(func(_ Conflict) (string, error) {
+		return "long.txt", nil
+	}))
+	_, ok = testLongPathName(t, l, dst, "/first", first)
+	rtest.Assert(t, ok, "long name was skipped")
+	_, ok, err := l.name(dst, "/second", second)
+	rtest.Assert(t, err != nil, "expected an error for the colliding name")
+	rtest.Assert(t, !ok, "colliding name was not skipped")
+}
+
+func TestRestorerLongPaths(t *testing.T) {
+	repo := repository.TestRepository(t)
+	longDir := strings.Repeat("d", 300)
+	longFile := strings.Repeat("f", 300) + ".txt"
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			longDir: Dir{Nodes: map[string]Node{
+				"file": File{Data: "content: nested\n"},
+			}},
+			longFile: File{Data: "content: long\n"},
+			"short":  File{Data: "content: short\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, behavior := range []LongPathBehavior{LongPathFail, LongPathTruncate, LongPathHash, LongPathSkip} {
+		t.Run(behavior.String(), func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			res := NewRestorer(repo, sn, Options{LongPaths: behavior})
+			var errs int
+			res.Error = func(_ string, _ error) error {
+				errs++
+				return nil
+			}
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.OK(t, err)
+
+			data, err := os.ReadFile(filepath.Join(tempdir, "short"))
+			rtest.OK(t, err)
+			rtest.Equals(t, "content: short\n", string(data))
+
+			longPaths := res.LongPaths()
+			switch behavior {
+			case LongPathFail:
+				rtest.Assert(t, errs > 0, "expected errors for the long names")
+				rtest.Equals(t, 0, len(longPaths))
+			case LongPathSkip:
+				rtest.Equals(t, 0, errs)
+				rtest.Equals(t, []LongPath{
+					{Location: string(filepath.Separator) + longDir},
+					{Location: string(filepath.Separator) + longFile},
+				}, longPaths)
+				entries, err := os.ReadDir(tempdir)
+				rtest.OK(t, err)
+				rtest.Equals(t, 1, len(entries))
+			default:
+				rtest.Equals(t, 0, errs)
+				rtest.Equals(t, 2, len(longPaths))
+				data, err := os.ReadFile(filepath.Join(tempdir, longPaths[0].Name, "file"))
+				rtest.OK(t, err)
+				rtest.Equals(t, "content: nested\n", string(data))
+				data, err = os.ReadFile(filepath.Join(tempdir, longPaths[1].Name))
+				rtest.OK(t, err)
+				rtest.Equals(t, "content: long\n", string(data))
+
+				// the shortened names are not removed as unexpected files
+				progress := newTestProgress()
+				_, err = NewRestorer(repo, sn, Options{LongPaths: behavior, Delete: true, Progress: progress}).RestoreTo(context.TODO(), tempdir)
+				rtest.OK(t, err)
+				rtest.Equals(t, uint64(0), progress.state().FilesDeleted)
+			}
+		})
+	}
+}
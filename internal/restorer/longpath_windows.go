@@ -0,0 +1,17 @@
+package restorer
+
+import "unicode/utf16"
+
+// Limits for the length of a single name and of a whole path, as counted by
+// pathLength. Absolute paths are passed to Windows with the `\\?\` or
+// `\\?\UNC\` prefix by the fs package, which raises the path limit from 260
+// to 32767 characters including the prefix and the terminating null.
+const (
+	maxNameLength = 255
+	maxPathLength = 32767 - len(`\\?\UNC\`) - 1
+)
+
+// pathLength returns the length of s in UTF-16 code units.
+func pathLength(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
@@ -0,0 +1,42 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerLongPathsWindows(t *testing.T) {
+	repo := repository.TestRepository(t)
+	// each name fits, but the whole path exceeds MAX_PATH
+	var names []string
+	for i := 0; i < 5; i++ {
+		names = append(names, strings.Repeat(string(rune('a'+i)), 100))
+	}
+	var node Node = File{Data: "content: deep\n"}
+	child := "file"
+	for i := len(names) - 1; i >= 0; i-- {
+		node = Dir{Nodes: map[string]Node{child: node}}
+		child = names[i]
+	}
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{child: node},
+	}, noopGetGenericAttributes)
+
+	tempdir := rtest.TempDir(t)
+	res := NewRestorer(repo, sn, Options{})
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	target := filepath.Join(append(append([]string{tempdir}, names...), "file")...)
+	rtest.Assert(t, len(target) > 260, "path %v is too short", target)
+	data, err := os.ReadFile(target)
+	rtest.OK(t, err)
+	rtest.Equals(t, "content: deep\n", string(data))
+	rtest.Equals(t, 0, len(res.LongPaths()))
+}
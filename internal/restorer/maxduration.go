@@ -0,0 +1,76 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/ui"
+)
+
+// MaxDurationExceededError is returned if the restore was canceled as it took
+// longer than Options.MaxDuration. It allows distinguishing a timeout from a
+// restore canceled by the caller, which returns context.Canceled.
+type MaxDurationExceededError struct {
+	MaxDuration time.Duration
+	// CompletedBytes is the file content which was written or already up to
+	// date when the restore was canceled, out of TotalBytes.
+	CompletedBytes uint64
+	TotalBytes     uint64
+}
+
+func (e *MaxDurationExceededError) Error() string {
+	return fmt.Sprintf("restore exceeded the maximum duration of %v, completed %v of %v file content",
+		e.MaxDuration, ui.FormatBytes(e.CompletedBytes), ui.FormatBytes(e.TotalBytes))
+}
+
+// errMaxDuration is the cause of the context cancellation once
+// Options.MaxDuration has passed.
+var errMaxDuration = errors.New("maximum restore duration exceeded")
+
+// contentProgress counts the file content that was handled by the
+// fileRestorer. All methods are safe to call on a nil pointer.
+type contentProgress struct {
+	completed atomic.Uint64
+	total     atomic.Uint64
+}
+
+func (p *contentProgress) addTotal(files []*fileInfo) {
+	if p == nil {
+		return
+	}
+	for _, file := range files {
+		p.total.Add(uint64(file.size))
+	}
+}
+
+func (p *contentProgress) addCompleted(size uint64) {
+	if p != nil {
+		p.completed.Add(size)
+	}
+}
+
+// restoreWithMaxDuration runs restore with a context which is canceled once
+// Options.MaxDuration has passed. The error returned in that case is replaced
+// by a *MaxDurationExceededError.
+func (res *Restorer) restoreWithMaxDuration(ctx context.Context, restore func(ctx context.Context) (uint64, error)) (uint64, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	timer := time.AfterFunc(res.opts.MaxDuration, func() {
+		cancel(errMaxDuration)
+	})
+	defer timer.Stop()
+
+	res.content = &contentProgress{}
+	count, err := restore(ctx)
+	if err != nil && errors.Is(context.Cause(ctx), errMaxDuration) {
+		return count, &MaxDurationExceededError{
+			MaxDuration:    res.opts.MaxDuration,
+			CompletedBytes: res.content.completed.Load(),
+			TotalBytes:     res.content.total.Load(),
+		}
+	}
+	return count, err
+}
@@ -0,0 +1,44 @@
+package restorer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerMaxDuration(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file1": File{Data: "content: file1\n"},
+			"file2": File{Data: "content: file2\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	res := NewRestorer(repo, sn, Options{MaxDuration: 10 * time.Millisecond})
+	res.FileCompleted = func(_ string) {
+		// exceed the maximum duration while the restore is still running
+		time.Sleep(50 * time.Millisecond)
+	}
+	_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	var maxErr *MaxDurationExceededError
+	rtest.Assert(t, errors.As(err, &maxErr), "expected MaxDurationExceededError, got %v", err)
+	rtest.Equals(t, 10*time.Millisecond, maxErr.MaxDuration)
+	rtest.Equals(t, uint64(30), maxErr.TotalBytes)
+	rtest.Assert(t, maxErr.CompletedBytes >= 15, "expected at least one completed file, got %v bytes", maxErr.CompletedBytes)
+
+	// canceling the restore must still be reported as such
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res = NewRestorer(repo, sn, Options{MaxDuration: time.Hour})
+	res.FileCompleted = func(_ string) {
+		cancel()
+	}
+	_, err = res.RestoreTo(ctx, rtest.TempDir(t))
+	rtest.Assert(t, errors.Is(err, context.Canceled), "expected context.Canceled, got %v", err)
+	rtest.Assert(t, !errors.As(err, &maxErr), "unexpected MaxDurationExceededError")
+}
@@ -0,0 +1,194 @@
+package restorer
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// metricsSampleInterval is the interval at which the number of idle workers
+// is sampled.
+const metricsSampleInterval = 100 * time.Millisecond
+
+// SchedulerMetrics describes whether the scheduler or the download workers
+// limited the restore of the file content. If the workers are frequently
+// idle, they wait for the scheduler to hand out packs. If the scheduler
+// spends most of the time waiting for the workers, using more workers may
+// speed up the restore.
+type SchedulerMetrics struct {
+	Workers int
+	// Duration is the time spent downloading packs.
+	Duration time.Duration
+	// AvgIdleWorkers is the average number of workers waiting for a pack.
+	AvgIdleWorkers float64
+	// WorkerIdle is the total time workers spent waiting for a pack.
+	WorkerIdle time.Duration
+	// SchedulerWait is the total time the scheduler spent waiting for a
+	// worker to accept the next pack.
+	SchedulerWait time.Duration
+	// PerWorker contains the downloads of each worker, indexed by the worker
+	// ID.
+	PerWorker []WorkerMetrics
+}
+
+// WorkerMetrics describes the downloads of a single worker. A worker whose
+// throughput is much lower than that of the others, for example as it is
+// stuck on a slow connection, can delay the completion of the restore.
+type WorkerMetrics struct {
+	// ID identifies the worker during the restore. It is the same as the
+	// AttrWorkerID of its SpanPackDownload spans.
+	ID int
+	// Bytes is the stored size of the blobs downloaded by the worker.
+	Bytes uint64
+	// Busy is the time the worker spent downloading packs.
+	Busy time.Duration
+}
+
+// Throughput returns the bytes downloaded per second while the worker was
+// busy.
+func (w WorkerMetrics) Throughput() float64 {
+	if w.Busy <= 0 {
+		return 0
+	}
+	return float64(w.Bytes) / w.Busy.Seconds()
+}
+
+// WorkerThroughput returns the minimum, median and maximum throughput of the
+// workers which downloaded at least one pack. ok is false if there are no
+// such workers.
+func (m *SchedulerMetrics) WorkerThroughput() (minimum, median, maximum float64, ok bool) {
+	var throughputs []float64
+	for _, w := range m.PerWorker {
+		if w.Busy > 0 {
+			throughputs = append(throughputs, w.Throughput())
+		}
+	}
+	if len(throughputs) == 0 {
+		return 0, 0, 0, false
+	}
+	slices.Sort(throughputs)
+	n := len(throughputs)
+	median = throughputs[n/2]
+	if n%2 == 0 {
+		median = (throughputs[n/2-1] + throughputs[n/2]) / 2
+	}
+	return throughputs[0], median, throughputs[n-1], true
+}
+
+// workerCounters are updated by a single worker.
+type workerCounters struct {
+	bytes atomic.Uint64
+	busy  atomic.Int64
+}
+
+// schedulerMetrics collects SchedulerMetrics. The counters updated by the
+// workers and the scheduler are atomic, the sampler is the only goroutine
+// accessing the sample fields. All methods are no-ops for a nil receiver.
+type schedulerMetrics struct {
+	idleWorkers   atomic.Int64
+	workerIdle    atomic.Int64
+	schedulerWait atomic.Int64
+	perWorker     []workerCounters
+
+	workers     int
+	duration    time.Duration
+	samples     int
+	idleSamples int64
+}
+
+// receive waits for the next pack from ch and records the waiting time.
+func (m *schedulerMetrics) receive(ch <-chan *packInfo) (*packInfo, bool) {
+	if m == nil {
+		pack, ok := <-ch
+		return pack, ok
+	}
+
+	m.idleWorkers.Add(1)
+	start := time.Now()
+	pack, ok := <-ch
+	m.idleWorkers.Add(-1)
+	// once the channel is closed, the workers only wait for the remaining downloads
+	if ok {
+		m.workerIdle.Add(int64(time.Since(start)))
+	}
+	return pack, ok
+}
+
+// addDownload records that the worker with the given id downloaded a pack
+// with the given number of bytes, which took busy.
+func (m *schedulerMetrics) addDownload(id int, bytes uint64, busy time.Duration) {
+	if m == nil {
+		return
+	}
+	m.perWorker[id].bytes.Add(bytes)
+	m.perWorker[id].busy.Add(int64(busy))
+}
+
+func (m *schedulerMetrics) addSchedulerWait(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.schedulerWait.Add(int64(d))
+}
+
+// startSampling periodically samples the number of idle workers until the
+// returned function is called.
+func (m *schedulerMetrics) startSampling(workers int) (stop func()) {
+	if m == nil {
+		return func() {}
+	}
+
+	m.workers = workers
+	// the worker ids are the same for all batches
+	if len(m.perWorker) < workers {
+		m.perWorker = append(m.perWorker, make([]workerCounters, workers-len(m.perWorker))...)
+	}
+	start := time.Now()
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(metricsSampleInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				m.samples++
+				m.idleSamples += m.idleWorkers.Load()
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+		m.duration += time.Since(start)
+	}
+}
+
+func (m *schedulerMetrics) result() *SchedulerMetrics {
+	if m == nil {
+		return nil
+	}
+	res := &SchedulerMetrics{
+		Workers:       m.workers,
+		Duration:      m.duration,
+		WorkerIdle:    time.Duration(m.workerIdle.Load()),
+		SchedulerWait: time.Duration(m.schedulerWait.Load()),
+	}
+	for id := range m.perWorker {
+		res.PerWorker = append(res.PerWorker, WorkerMetrics{
+			ID:    id,
+			Bytes: m.perWorker[id].bytes.Load(),
+			Busy:  time.Duration(m.perWorker[id].busy.Load()),
+		})
+	}
+	if m.samples > 0 {
+		res.AvgIdleWorkers = float64(m.idleSamples) / float64(m.samples)
+	}
+	return res
+}
@@ -0,0 +1,60 @@
+// Package oteltrace traces restores using OpenTelemetry. It is kept separate
+// from the restorer package, such that only users of the tracing depend on
+// OpenTelemetry.
+package oteltrace
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/restic/restic/internal/restorer"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// New returns a restorer.Tracer which starts its spans using t.
+func New(t trace.Tracer) restorer.Tracer {
+	return &tracer{t: t}
+}
+
+type tracer struct {
+	t trace.Tracer
+}
+
+func (t *tracer) Start(ctx context.Context, name string, attrs ...restorer.Attribute) (context.Context, restorer.Span) {
+	ctx, s := t.t.Start(ctx, name, trace.WithAttributes(convert(attrs)...))
+	return ctx, &span{s: s}
+}
+
+type span struct {
+	s trace.Span
+}
+
+func (s *span) SetAttributes(attrs ...restorer.Attribute) {
+	s.s.SetAttributes(convert(attrs)...)
+}
+
+func (s *span) RecordError(err error) {
+	s.s.RecordError(err)
+	s.s.SetStatus(codes.Error, err.Error())
+}
+
+func (s *span) End() {
+	s.s.End()
+}
+
+func convert(attrs []restorer.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch v := attr.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(attr.Key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(attr.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(attr.Key, fmt.Sprint(v)))
+		}
+	}
+	return kvs
+}
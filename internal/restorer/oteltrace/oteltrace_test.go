@@ -0,0 +1,38 @@
+package oteltrace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/restic/restic/internal/restorer"
+	rtest "github.com/restic/restic/internal/test"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := New(provider.Tracer("restic"))
+
+	ctx, parent := tracer.Start(context.TODO(), restorer.SpanRestore, restorer.StringAttribute(restorer.AttrTarget, "/target"))
+	_, child := tracer.Start(ctx, restorer.SpanPackDownload)
+	child.SetAttributes(restorer.IntAttribute(restorer.AttrPackBytes, 42))
+	child.RecordError(errors.New("download failed"))
+	child.End()
+	parent.End()
+
+	spans := recorder.Ended()
+	rtest.Equals(t, 2, len(spans))
+	rtest.Equals(t, restorer.SpanPackDownload, spans[0].Name())
+	rtest.Equals(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	rtest.Equals(t, []attribute.KeyValue{attribute.Int64(restorer.AttrPackBytes, 42)}, spans[0].Attributes())
+	rtest.Equals(t, codes.Error, spans[0].Status().Code)
+
+	rtest.Equals(t, restorer.SpanRestore, spans[1].Name())
+	rtest.Equals(t, []attribute.KeyValue{attribute.String(restorer.AttrTarget, "/target")}, spans[1].Attributes())
+	rtest.Equals(t, codes.Unset, spans[1].Status().Code)
+}
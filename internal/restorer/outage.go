@@ -0,0 +1,156 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// defaultOutageBackoff is the wait before the first restart, see
+// Options.OutageBackoff.
+const defaultOutageBackoff = time.Minute
+
+// BackendOutageError is returned if downloading packs failed for all
+// connections to the backend, see Options.OutageRetries. Unlike other errors,
+// it is not passed to Restorer.Error, but aborts the restore immediately.
+type BackendOutageError struct {
+	// Failures is the number of consecutive pack downloads which failed.
+	Failures int
+	// Err is the error of the last failed download.
+	Err error
+}
+
+func (e *BackendOutageError) Error() string {
+	return fmt.Sprintf("backend outage, the last %d pack downloads failed: %v", e.Failures, e.Err)
+}
+
+func (e *BackendOutageError) Unwrap() error {
+	return e.Err
+}
+
+// outageDetector detects a backend outage if threshold consecutive pack
+// downloads failed. Errors of the blob handler, for example as the data of a
+// blob is damaged or writing the file failed, are not caused by the backend
+// and thus reset the count like a successful download. A download also counts
+// as failed if the repository passed the error on to the blob handler instead
+// of returning it. It is safe for concurrent use, all methods are no-ops for a
+// nil receiver.
+type outageDetector struct {
+	m         sync.Mutex
+	threshold int
+	failures  int
+}
+
+func newOutageDetector(threshold int) *outageDetector {
+	return &outageDetector{threshold: max(threshold, 1)}
+}
+
+// record records the result of a pack download and returns the error to pass
+// on, which is a *BackendOutageError once the threshold is reached. loadErr is
+// the error of a failed download which the loader did not return, as it was
+// passed to the blob handler or is reported by the downloaded section.
+func (d *outageDetector) record(ctx context.Context, err error, handlerErr error, loadErr error) error {
+	if d == nil || ctx.Err() != nil {
+		return err
+	}
+
+	d.m.Lock()
+	defer d.m.Unlock()
+	if loadErr == nil {
+		if err == nil || err == handlerErr {
+			d.failures = 0
+			return err
+		}
+		loadErr = err
+	}
+	d.failures++
+	if d.failures < d.threshold {
+		return err
+	}
+	debug.Log("detected backend outage after %d failed pack downloads: %v", d.failures, loadErr)
+	return &BackendOutageError{Failures: d.failures, Err: loadErr}
+}
+
+func (d *outageDetector) wrapLoader(loader blobsLoaderFn) blobsLoaderFn {
+	if d == nil {
+		return loader
+	}
+	return func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		var handlerErr, loadErr error
+		err := loader(ctx, packID, blobs, func(blob restic.BlobHandle, buf []byte, err error) error {
+			if loadErr == nil && errors.As(err, new(*restic.PackLoadError)) {
+				loadErr = err
+			}
+			handlerErr = handleBlobFn(blob, buf, err)
+			return handlerErr
+		})
+		return d.record(ctx, err, handlerErr, loadErr)
+	}
+}
+
+func (d *outageDetector) wrapSectionsLoader(loader sectionsLoaderFn) sectionsLoaderFn {
+	if d == nil {
+		return loader
+	}
+	return func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleSectionFn func(section restic.PackSection) error) error {
+		var handlerErr, loadErr error
+		err := loader(ctx, packID, blobs, func(section restic.PackSection) error {
+			if loadErr == nil {
+				loadErr = section.LoadErr()
+			}
+			handlerErr = handleSectionFn(section)
+			return handlerErr
+		})
+		return d.record(ctx, err, handlerErr, loadErr)
+	}
+}
+
+// isOutage reports whether err is a *BackendOutageError.
+func isOutage(err error) bool {
+	var outageErr *BackendOutageError
+	return errors.As(err, &outageErr)
+}
+
+// restoreWithOutageRetries runs restore and restarts it up to
+// Options.OutageRetries times if it fails with a *BackendOutageError. The
+// wait before each restart starts at Options.OutageBackoff and doubles for
+// each further restart.
+func (res *Restorer) restoreWithOutageRetries(ctx context.Context, restore func(ctx context.Context) (uint64, error)) (uint64, error) {
+	backoff := res.opts.OutageBackoff
+	if backoff <= 0 {
+		backoff = defaultOutageBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		count, err := restore(ctx)
+		if !isOutage(err) || attempt > res.opts.OutageRetries {
+			return count, err
+		}
+
+		res.Info(fmt.Sprintf("%v, restarting the restore in %v (restart %d of %d)", err, backoff, attempt, res.opts.OutageRetries))
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return count, ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		res.resetForRestart()
+	}
+}
+
+// resetForRestart clears the results collected by a failed restore, which are
+// collected anew by the next one.
+func (res *Restorer) resetForRestart() {
+	res.fileList = make(map[string]bool)
+	res.downgrades = nil
+	res.changes = nil
+	res.placeholders = nil
+	res.placeholderBytes = 0
+	res.subvolumes = nil
+}
@@ -0,0 +1,213 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/backend"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestOutageDetector(t *testing.T) {
+	ctx := context.TODO()
+	loadErr := errors.New("connection refused")
+	dataErr := errors.New("ciphertext verification failed")
+
+	d := newOutageDetector(2)
+	rtest.Equals(t, loadErr, d.record(ctx, loadErr, nil, nil))
+	// errors of the blob handler are not caused by the backend
+	rtest.Equals(t, dataErr, d.record(ctx, dataErr, dataErr, nil))
+	rtest.Equals(t, loadErr, d.record(ctx, loadErr, nil, nil))
+	rtest.OK(t, d.record(ctx, nil, nil, nil))
+	// the download failed, but the loader passed the error to the blob handler
+	rtest.OK(t, d.record(ctx, nil, nil, loadErr))
+
+	err := d.record(ctx, loadErr, nil, nil)
+	var outageErr *BackendOutageError
+	rtest.Assert(t, errors.As(err, &outageErr), "expected outage error, got %v", err)
+	rtest.Equals(t, 2, outageErr.Failures)
+	rtest.Assert(t, errors.Is(err, loadErr), "outage error does not wrap %v", loadErr)
+
+	// errors after cancellation are not counted
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	d = newOutageDetector(1)
+	rtest.Equals(t, loadErr, d.record(canceled, loadErr, nil, nil))
+
+	var nilDetector *outageDetector
+	rtest.Equals(t, loadErr, nilDetector.record(ctx, loadErr, nil, nil))
+}
+
+// outageRepo fails the first failures pack downloads.
+type outageRepo struct {
+	restic.Repository
+	failures atomic.Int32
+}
+
+func (r *outageRepo) Connections() uint {
+	return 1
+}
+
+func (r *outageRepo) fail() bool {
+	return r.failures.Add(-1) >= 0
+}
+
+func (r *outageRepo) LoadBlobsFromPack(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+	if r.fail() {
+		return errors.New("connection refused")
+	}
+	return r.Repository.LoadBlobsFromPack(ctx, packID, blobs, handleBlobFn)
+}
+
+func TestRestorerOutageRetries(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		failures int32
+		retries  int
+		restarts int
+		outage   bool
+	}{
+		{name: "recovered", failures: 2, retries: 3, restarts: 2},
+		{name: "exhausted", failures: 3, retries: 2, restarts: 2, outage: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			repo := repository.TestRepository(t)
+			sn, _ := saveSnapshot(t, repo, Snapshot{
+				Nodes: map[string]Node{
+					"foo": File{Data: "content: foo\n"},
+				},
+			}, noopGetGenericAttributes)
+			outage := &outageRepo{Repository: repo}
+			outage.failures.Store(test.failures)
+
+			res := NewRestorer(outage, sn, Options{OutageRetries: test.retries, OutageBackoff: time.Millisecond})
+			var restarts []string
+			res.Info = func(message string) {
+				restarts = append(restarts, message)
+			}
+			res.Error = func(location string, err error) error {
+				t.Errorf("unexpected error for %v: %v", location, err)
+				return err
+			}
+
+			tempdir := rtest.TempDir(t)
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.Equals(t, test.restarts, len(restarts))
+			if test.outage {
+				var outageErr *BackendOutageError
+				rtest.Assert(t, errors.As(err, &outageErr), "expected outage error, got %v", err)
+				return
+			}
+			rtest.OK(t, err)
+			data, err := os.ReadFile(filepath.Join(tempdir, "foo"))
+			rtest.OK(t, err)
+			rtest.Equals(t, "content: foo\n", string(data))
+		})
+	}
+}
+
+// outageBackend fails the first failures loads of data pack files.
+type outageBackend struct {
+	backend.Backend
+	failures atomic.Int32
+}
+
+func (be *outageBackend) Properties() backend.Properties {
+	props := be.Backend.Properties()
+	props.Connections = 1
+	return props
+}
+
+func (be *outageBackend) Load(ctx context.Context, h backend.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	fmt.Println("LOAD", h.Type, h.IsMetadata, be.failures.Load())
+	if h.Type == backend.PackFile && !h.IsMetadata && be.failures.Add(-1) >= 0 {
+		return errors.New("connection refused")
+	}
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+func TestRestorerOutageBackend(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		failures      int32
+		retries       int
+		restarts      int
+		outage        bool
+		decodeWorkers int
+	}{
+		// each attempt downloads the pack and then tries to load the blob on
+		// its own, which LoadBlob retries once
+		{name: "recovered", failures: 6, retries: 3, restarts: 2},
+		{name: "exhausted", failures: 100, retries: 2, restarts: 2, outage: true},
+		// the decode workers only run after the download worker recorded the
+		// failed pack download, such that the outage is detected earlier
+		{name: "decode-workers", failures: 4, retries: 3, restarts: 2, decodeWorkers: 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			be := &outageBackend{Backend: repository.TestBackend(t)}
+			repo, _ := repository.TestRepositoryWithBackend(t, be, 0, repository.Options{})
+			sn, _ := saveSnapshot(t, repo, Snapshot{
+				Nodes: map[string]Node{
+					"foo": File{Data: "content: foo\n"},
+				},
+			}, noopGetGenericAttributes)
+			be.failures.Store(test.failures)
+
+			res := NewRestorer(repo, sn, Options{OutageRetries: test.retries, OutageBackoff: time.Millisecond, DecodeWorkers: test.decodeWorkers})
+			var restarts []string
+			res.Info = func(message string) {
+				restarts = append(restarts, message)
+			}
+			// like the restore command, continue after errors
+			res.Error = func(_ string, _ error) error {
+				return nil
+			}
+
+			tempdir := rtest.TempDir(t)
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.Equals(t, test.restarts, len(restarts))
+			if test.outage {
+				var outageErr *BackendOutageError
+				rtest.Assert(t, errors.As(err, &outageErr), "expected outage error, got %v", err)
+				return
+			}
+			rtest.OK(t, err)
+			data, err := os.ReadFile(filepath.Join(tempdir, "foo"))
+			rtest.OK(t, err)
+			rtest.Equals(t, "content: foo\n", string(data))
+		})
+	}
+}
+
+func TestOutageDetectorLoadBlobsFromPack(t *testing.T) {
+	be := &outageBackend{Backend: repository.TestBackend(t)}
+	repo, _ := repository.TestRepositoryWithBackend(t, be, 0, repository.Options{})
+	var id restic.ID
+	rtest.OK(t, repo.WithBlobUploader(context.TODO(), func(_ context.Context, uploader restic.BlobSaverWithAsync) error {
+		id = saveFile(t, uploader, "content: foo\n")
+		return nil
+	}))
+	h := restic.BlobHandle{Type: restic.DataBlob, ID: id}
+	packID := repo.LookupBlob(h)[0].PackID()
+	be.failures.Store(100)
+
+	d := newOutageDetector(1)
+	var handled []error
+	err := d.wrapLoader(repo.LoadBlobsFromPack)(context.TODO(), packID, []restic.BlobHandle{h}, func(_ restic.BlobHandle, _ []byte, err error) error {
+		// like the restorer, report the error and continue
+		handled = append(handled, err)
+		return nil
+	})
+	rtest.Equals(t, 1, len(handled))
+	rtest.Assert(t, errors.As(handled[0], new(*restic.PackLoadError)), "expected pack load error, got %v", handled[0])
+	rtest.Assert(t, isOutage(err), "expected outage error, got %v", err)
+}
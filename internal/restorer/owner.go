@@ -0,0 +1,42 @@
+package restorer
+
+import "slices"
+
+// OwnerFilter selects the files to restore by the owner stored in the
+// snapshot, see Options.OwnerFilter.
+type OwnerFilter struct {
+	// UIDs and GIDs are the accepted user and group ids. An empty list does
+	// not restrict the files.
+	UIDs []uint32
+	GIDs []uint32
+	// MatchAny selects the files whose user or group id is accepted. By
+	// default, both have to be accepted.
+	MatchAny bool
+}
+
+// Match reports whether a file owned by uid and gid is selected. A nil filter
+// selects all files.
+func (f *OwnerFilter) Match(uid, gid uint32) bool {
+	if f == nil {
+		return true
+	}
+	uidMatches := slices.Contains(f.UIDs, uid)
+	gidMatches := slices.Contains(f.GIDs, gid)
+	switch {
+	case len(f.UIDs) > 0 && len(f.GIDs) > 0 && f.MatchAny:
+		return uidMatches || gidMatches
+	case len(f.UIDs) > 0 && len(f.GIDs) > 0:
+		return uidMatches && gidMatches
+	case len(f.UIDs) > 0:
+		return uidMatches
+	case len(f.GIDs) > 0:
+		return gidMatches
+	}
+	return true
+}
+
+// OwnerSkippedFiles returns the files which were not restored as their owner
+// is not selected by Options.OwnerFilter.
+func (res *Restorer) OwnerSkippedFiles() []string {
+	return res.ownerSkipped
+}
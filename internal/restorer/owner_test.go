@@ -0,0 +1,125 @@
+package restorer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestOwnerFilterMatch(t *testing.T) {
+	for _, test := range []struct {
+		filter   *OwnerFilter
+		uid, gid uint32
+		match    bool
+	}{
+		{nil, 1, 2, true},
+		{&OwnerFilter{}, 1, 2, true},
+		{&OwnerFilter{UIDs: []uint32{1}}, 1, 2, true},
+		{&OwnerFilter{UIDs: []uint32{1}}, 3, 2, false},
+		{&OwnerFilter{GIDs: []uint32{2, 4}}, 3, 4, true},
+		{&OwnerFilter{GIDs: []uint32{2, 4}}, 3, 5, false},
+		{&OwnerFilter{UIDs: []uint32{1}, GIDs: []uint32{2}}, 1, 2, true},
+		{&OwnerFilter{UIDs: []uint32{1}, GIDs: []uint32{2}}, 1, 3, false},
+		{&OwnerFilter{UIDs: []uint32{1}, GIDs: []uint32{2}, MatchAny: true}, 1, 3, true},
+		{&OwnerFilter{UIDs: []uint32{1}, GIDs: []uint32{2}, MatchAny: true}, 3, 2, true},
+		{&OwnerFilter{UIDs: []uint32{1}, GIDs: []uint32{2}, MatchAny: true}, 3, 3, false},
+	} {
+		rtest.Equals(t, test.match, test.filter.Match(test.uid, test.gid), fmt.Sprintf("filter %+v, owner %d:%d", test.filter, test.uid, test.gid))
+	}
+}
+
+func TestRestorerOwnerFilter(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"alice":       File{Data: "content: alice\n", Owner: &FileOwner{1000, 1000}},
+					"alice-staff": File{Data: "content: alice-staff\n", Owner: &FileOwner{1000, 50}},
+					"bob":         File{Data: "content: bob\n", Owner: &FileOwner{1001, 1001}, Links: 2, Inode: 1},
+					"bob-link":    File{Data: "content: bob\n", Owner: &FileOwner{1001, 1001}, Links: 2, Inode: 1},
+					"bob-staff":   File{Data: "content: bob-staff\n", Owner: &FileOwner{1001, 50}},
+				},
+			},
+		},
+	}
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+
+	for _, test := range []struct {
+		name     string
+		filter   OwnerFilter
+		restored []string
+	}{
+		{"uid", OwnerFilter{UIDs: []uint32{1000}}, []string{"alice", "alice-staff"}},
+		{"gid", OwnerFilter{GIDs: []uint32{50}}, []string{"alice-staff", "bob-staff"}},
+		{"uid and gid", OwnerFilter{UIDs: []uint32{1001}, GIDs: []uint32{50}}, []string{"bob-staff"}},
+		{"uid or gid", OwnerFilter{UIDs: []uint32{1001}, GIDs: []uint32{50}, MatchAny: true},
+			[]string{"alice-staff", "bob", "bob-link", "bob-staff"}},
+		{"multiple uids", OwnerFilter{UIDs: []uint32{1000, 1001}}, []string{"alice", "alice-staff", "bob", "bob-link", "bob-staff"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			// the owners are not restored
+			progress := newTestProgress()
+			res := NewRestorer(repo, sn, Options{OwnerFilter: &test.filter, Unprivileged: true, Progress: progress})
+			count, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.OK(t, err)
+			// skipped files are not part of the progress totals
+			state := progress.state()
+			rtest.Equals(t, state.AllBytesTotal, state.AllBytesWritten)
+			rtest.Equals(t, state.FilesTotal, state.FilesFinished)
+
+			restored := make(map[string]bool)
+			for _, name := range test.restored {
+				restored[name] = true
+			}
+			expectedCount := uint64(len(test.restored))
+			if restored["bob-link"] {
+				// hardlinks are not counted
+				expectedCount--
+			}
+			rtest.Equals(t, expectedCount, count)
+			var skipped []string
+			for _, name := range []string{"alice", "alice-staff", "bob", "bob-link", "bob-staff"} {
+				_, err := os.Lstat(filepath.Join(tempdir, "dir", name))
+				if restored[name] {
+					rtest.OK(t, err)
+				} else {
+					rtest.Assert(t, errors.Is(err, os.ErrNotExist), "expected %v to be skipped, got %v", name, err)
+					skipped = append(skipped, "/dir/"+name)
+				}
+			}
+			rtest.Equals(t, skipped, res.OwnerSkippedFiles())
+			_, err = res.VerifyFiles(context.TODO(), tempdir, count, restic.NoopCounter)
+			rtest.OK(t, err)
+		})
+	}
+}
+
+func TestRestorerOwnerFilterDryRun(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"alice": File{Data: "content: alice\n", Owner: &FileOwner{1000, 1000}},
+			"bob":   File{Data: "content: bob\n", Owner: &FileOwner{1001, 1001}},
+		},
+	}, noopGetGenericAttributes)
+
+	progress := newTestProgress()
+	res := NewRestorer(repo, sn, Options{OwnerFilter: &OwnerFilter{UIDs: []uint32{1000}}, DryRun: true, Progress: progress})
+	count, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.OK(t, err)
+	rtest.Equals(t, uint64(1), count)
+	rtest.Equals(t, []string{filepath.FromSlash("/bob")}, res.OwnerSkippedFiles())
+	state := progress.state()
+	rtest.Equals(t, uint64(1), state.FilesTotal)
+	rtest.Equals(t, uint64(len("content: alice\n")), state.AllBytesTotal)
+	rtest.Equals(t, uint64(1), state.FilesSkipped)
+}
@@ -0,0 +1,87 @@
+package restorer
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// PackCheckStats summarizes the packs checked by Options.VerifyPacks, see
+// Restorer.PackCheck.
+type PackCheckStats struct {
+	// Packs is the number of downloaded packs whose blobs were all checked.
+	Packs uint64
+	// Blobs is the number of checked blobs, including those which are not
+	// required to restore the files.
+	Blobs uint64
+	// DamagedBlobs is the number of checked blobs whose data is damaged.
+	DamagedBlobs uint64
+}
+
+// packCheck collects PackCheckStats, it is safe for concurrent use.
+type packCheck struct {
+	packs   atomic.Uint64
+	blobs   atomic.Uint64
+	damaged atomic.Uint64
+}
+
+func (c *packCheck) stats() PackCheckStats {
+	return PackCheckStats{
+		Packs:        c.packs.Load(),
+		Blobs:        c.blobs.Load(),
+		DamagedBlobs: c.damaged.Load(),
+	}
+}
+
+// listPackBlobs records all blobs of packs as listed in the index, such that
+// downloadPack can check the blobs which are not required as well.
+func (r *fileRestorer) listPackBlobs(ctx context.Context, packs map[restic.ID]*packInfo) error {
+	return r.listBlobs(ctx, func(pb restic.PackBlob) {
+		if pack, ok := packs[pb.PackID()]; ok {
+			pack.allBlobs = append(pack.allBlobs, pb.Handle())
+		}
+	})
+}
+
+// extraBlobs returns the blobs of pack which are not contained in blobs.
+func (r *fileRestorer) extraBlobs(pack *packInfo, blobs blobToFileOffsetsMapping) restic.BlobSet {
+	extra := restic.NewBlobSet()
+	for _, h := range pack.allBlobs {
+		if entry, ok := blobs[h.ID]; ok && entry.blob == h {
+			continue
+		}
+		extra.Insert(h)
+	}
+	return extra
+}
+
+// checkHandler returns a callback which counts the blobs of packID loaded
+// for Options.VerifyPacks. Blobs contained in extra are only checked and
+// damaged ones are recorded in r.corrupt, all others are passed on to
+// handleBlobFn.
+func (r *fileRestorer) checkHandler(packID restic.ID, extra restic.BlobSet, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) func(blob restic.BlobHandle, buf []byte, err error) error {
+	return func(h restic.BlobHandle, buf []byte, err error) error {
+		if err == nil || errors.Is(err, restic.ErrInvalidData) {
+			r.packCheck.blobs.Add(1)
+		}
+		if errors.Is(err, restic.ErrInvalidData) {
+			r.packCheck.damaged.Add(1)
+		}
+		if !extra.Has(h) {
+			return handleBlobFn(h, buf, err)
+		}
+		if err != nil {
+			debug.Log("%sunused blob %v in pack %v: %v", r.logPrefix, h, packID.Str(), r.corrupt.record(packID, h, err))
+		}
+		return nil
+	}
+}
+
+// PackCheck returns how many blobs of the downloaded packs were checked for
+// Options.VerifyPacks. It is only available once RestoreTo has completed.
+func (res *Restorer) PackCheck() PackCheckStats {
+	return res.packCheck
+}
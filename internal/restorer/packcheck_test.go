@@ -0,0 +1,69 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRestorerVerifyPacks(t *testing.T) {
+	content := []TestFile{
+		{name: "file1", blobs: []TestBlob{{"data1-1", "pack1"}, {"data1-2", "pack2"}}},
+		// only stores blobs which are not required to restore file1
+		{name: "unused", blobs: []TestBlob{{"unused-1", "pack1"}, {"unused-2", "pack3"}}},
+	}
+	damagedBlob := restic.Hash([]byte("unused-1"))
+
+	for _, damaged := range []bool{false, true} {
+		t.Run(fmt.Sprintf("damaged=%v", damaged), func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			repo := newTestRepo(content)
+			r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+				repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+			r.files = repo.files[:1]
+			r.listBlobs = func(_ context.Context, fn func(restic.PackBlob)) error {
+				for _, packBlobs := range repo.blobs {
+					for _, pb := range packBlobs {
+						fn(pb)
+					}
+				}
+				return nil
+			}
+			r.setFaultInjector(&faultInjector{loadBlob: func(_ restic.ID, blob restic.BlobHandle) error {
+				if damaged && blob.ID.Equal(damagedBlob) {
+					return fmt.Errorf("wrong data returned: %w", restic.ErrInvalidData)
+				}
+				return nil
+			}})
+			r.Error = func(location string, err error) error {
+				t.Errorf("unexpected error for %v: %v", location, err)
+				return nil
+			}
+
+			rtest.OK(t, r.restoreFiles(context.TODO()))
+			data, err := os.ReadFile(r.targetPath("file1"))
+			rtest.OK(t, err)
+			rtest.Equals(t, repo.fileContent(repo.files[0]), string(data))
+
+			// pack3 is not downloaded
+			stats := r.packCheck.stats()
+			rtest.Equals(t, PackCheckStats{Packs: 2, Blobs: 3}, PackCheckStats{Packs: stats.Packs, Blobs: stats.Blobs})
+			if !damaged {
+				rtest.Equals(t, uint64(0), stats.DamagedBlobs)
+				rtest.OK(t, r.corrupt.err())
+				return
+			}
+			rtest.Equals(t, uint64(1), stats.DamagedBlobs)
+			var corruptErr *CorruptBlobsError
+			rtest.Assert(t, errors.As(r.corrupt.err(), &corruptErr), "expected a CorruptBlobsError")
+			rtest.Equals(t, 1, len(corruptErr.Blobs))
+			rtest.Equals(t, damagedBlob, corruptErr.Blobs[0].Blob.ID)
+		})
+	}
+}
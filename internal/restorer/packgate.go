@@ -0,0 +1,72 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// PackDecision is the decision of a PackGate.
+type PackDecision int
+
+// Constants for the different decisions of a PackGate.
+const (
+	// PackDownload downloads the pack now.
+	PackDownload PackDecision = iota
+	// PackDefer enqueues the pack again, such that the other packs are
+	// downloaded first.
+	PackDefer
+	// PackReject skips the pack. The files which use blobs from it are
+	// reported to Restorer.Error with a PackRejectedError.
+	PackReject
+)
+
+// PackGate is consulted before each pack is downloaded, see Options.PackGate.
+// It allows to integrate the restore into an external resource management,
+// for example to enforce a byte quota or the rate limits of a backend. It is
+// only called by a single goroutine. Returning an error aborts the restore.
+type PackGate func(ctx context.Context, pack ScheduledPack) (PackDecision, error)
+
+// PackRejectedError is reported for files which could not be restored
+// completely as a PackGate rejected a pack they use.
+type PackRejectedError struct {
+	ID restic.ID
+}
+
+func (e *PackRejectedError) Error() string {
+	return fmt.Sprintf("download of pack %v was rejected", e.ID.Str())
+}
+
+// Limits for waiting once all remaining packs were deferred in a row. The
+// wait time is doubled each time until a pack is downloaded.
+const (
+	packGateMinBackoff = 50 * time.Millisecond
+	packGateMaxBackoff = 5 * time.Second
+)
+
+// packGateState tracks the deferred packs, such that the scheduling waits
+// instead of spinning once all remaining packs are deferred.
+type packGateState struct {
+	deferred int
+	backoff  time.Duration
+}
+
+// downloaded resets the state once a pack was accepted.
+func (s *packGateState) downloaded() {
+	s.deferred = 0
+	s.backoff = 0
+}
+
+// deferPack records a deferred pack. If all remaining packs were deferred
+// since the last download, it returns how long to wait before asking again.
+func (s *packGateState) deferPack(remaining int) time.Duration {
+	s.deferred++
+	if s.deferred < remaining {
+		return 0
+	}
+	s.deferred = 0
+	s.backoff = min(max(2*s.backoff, packGateMinBackoff), packGateMaxBackoff)
+	return s.backoff
+}
@@ -0,0 +1,121 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func packGateContent() []TestFile {
+	return []TestFile{
+		{name: "file1", blobs: []TestBlob{{"data1-1", "pack1"}, {"data1-2", "pack2"}}},
+		{name: "file2", blobs: []TestBlob{{"data2-1", "pack2"}}},
+		{name: "file3", blobs: []TestBlob{{"data3-1", "pack3"}}},
+	}
+}
+
+func TestFileRestorerPackGate(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	repo := newTestRepo(packGateContent())
+	pack1 := repo.blobs[restic.Hash([]byte("data1-1"))][0].PackID()
+	pack3 := repo.blobs[restic.Hash([]byte("data3-1"))][0].PackID()
+
+	r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	consulted := make(map[restic.ID]int)
+	r.packGate = func(_ context.Context, pack ScheduledPack) (PackDecision, error) {
+		consulted[pack.ID]++
+		switch {
+		case pack.ID.Equal(pack3):
+			rtest.Equals(t, []string{"file3"}, pack.Files)
+			return PackReject, nil
+		case pack.ID.Equal(pack1) && consulted[pack.ID] == 1:
+			return PackDefer, nil
+		}
+		return PackDownload, nil
+	}
+	var failed []string
+	r.Error = func(location string, err error) error {
+		var rejected *PackRejectedError
+		rtest.Assert(t, errors.As(err, &rejected), "unexpected error %v", err)
+		rtest.Equals(t, pack3, rejected.ID)
+		failed = append(failed, location)
+		return nil
+	}
+
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Equals(t, []string{"file3"}, failed)
+	rtest.Equals(t, 2, consulted[pack1])
+	rtest.Equals(t, 1, consulted[pack3])
+	for _, file := range repo.files[:2] {
+		data, err := os.ReadFile(r.targetPath(file.location))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.fileContent(file), string(data))
+	}
+}
+
+func TestFileRestorerPackGateAllDeferred(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	repo := newTestRepo(packGateContent())
+
+	r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	// defer all packs twice, for example until an external quota is available
+	calls := 0
+	r.packGate = func(_ context.Context, _ ScheduledPack) (PackDecision, error) {
+		calls++
+		if calls <= 6 {
+			return PackDefer, nil
+		}
+		return PackDownload, nil
+	}
+
+	start := time.Now()
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Assert(t, time.Since(start) >= 3*packGateMinBackoff, "expected waiting while all packs are deferred")
+	rtest.Equals(t, 9, calls)
+	for _, file := range repo.files {
+		data, err := os.ReadFile(r.targetPath(file.location))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.fileContent(file), string(data))
+	}
+}
+
+func TestFileRestorerPackGateCanceled(t *testing.T) {
+	repo := newTestRepo(packGateContent())
+	r := newFileRestorer(rtest.TempDir(t), repo.loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.packGate = func(_ context.Context, _ ScheduledPack) (PackDecision, error) {
+		cancel()
+		return PackDefer, nil
+	}
+	err := r.restoreFiles(ctx)
+	rtest.Assert(t, errors.Is(err, context.Canceled), "unexpected error %v", err)
+}
+
+func TestPackGateStateBackoff(t *testing.T) {
+	var s packGateState
+	rtest.Equals(t, time.Duration(0), s.deferPack(2))
+	rtest.Equals(t, packGateMinBackoff, s.deferPack(2))
+	rtest.Equals(t, time.Duration(0), s.deferPack(2))
+	rtest.Equals(t, 2*packGateMinBackoff, s.deferPack(2))
+	for i := 0; i < 20; i++ {
+		s.deferPack(1)
+	}
+	rtest.Equals(t, packGateMaxBackoff, s.deferPack(1))
+
+	s.downloaded()
+	rtest.Equals(t, packGateMinBackoff, s.deferPack(1))
+}
@@ -0,0 +1,131 @@
+package restorer
+
+import (
+	"context"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// patchBase provides the nodes of the snapshot which the existing files in
+// the target directory were restored from, see Options.PatchBase.
+type patchBase struct {
+	repo restic.BlobLoader
+	tree restic.ID
+
+	// nodes of the most recently used directory
+	dir   string
+	nodes map[string]*data.Node
+}
+
+func newPatchBase(repo restic.BlobLoader, sn *data.Snapshot) *patchBase {
+	return &patchBase{repo: repo, tree: *sn.Tree}
+}
+
+// lookup returns the node at location or nil if it does not exist.
+func (b *patchBase) lookup(ctx context.Context, location string) (*data.Node, error) {
+	dir, name := path.Split(filepath.ToSlash(location))
+	if b.nodes == nil || dir != b.dir {
+		nodes, err := b.loadDir(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		b.dir = dir
+		b.nodes = nodes
+	}
+	return b.nodes[name], nil
+}
+
+func (b *patchBase) loadDir(ctx context.Context, dir string) (map[string]*data.Node, error) {
+	nodes := make(map[string]*data.Node)
+	treeID := b.tree
+	for _, name := range strings.Split(dir, "/") {
+		if name == "" {
+			continue
+		}
+		tree, err := data.LoadTree(ctx, b.repo, treeID)
+		if err != nil {
+			return nil, err
+		}
+		finder := data.NewTreeFinder(tree)
+		node, err := finder.Find(name)
+		finder.Close()
+		if err != nil {
+			return nil, err
+		}
+		if node == nil || node.Type != data.NodeTypeDir || node.Subtree == nil {
+			// directory does not exist in the base snapshot
+			return nodes, nil
+		}
+		treeID = *node.Subtree
+	}
+
+	tree, err := data.LoadTree(ctx, b.repo, treeID)
+	if err != nil {
+		return nil, err
+	}
+	for item := range tree {
+		if item.Error != nil {
+			return nil, item.Error
+		}
+		nodes[item.Node.Name] = item.Node
+	}
+	return nodes, nil
+}
+
+// patchFileState derives which blobs of newContent are already contained in
+// a file with content oldContent by comparing both lists of blobs. A blob
+// matches if the old file contains the same blob at the same offset. Blobs
+// that were shifted by insertions or deletions must be restored again.
+func patchFileState(oldContent, newContent restic.IDs, lookupSize func(restic.BlobHandle) (uint, bool)) *fileState {
+	old := make(map[int64]restic.ID, len(oldContent))
+	var oldSize int64
+	for _, id := range oldContent {
+		length, found := lookupSize(restic.BlobHandle{Type: restic.DataBlob, ID: id})
+		if !found {
+			return nil
+		}
+		old[oldSize] = id
+		oldSize += int64(length)
+	}
+
+	matches := make([]bool, len(newContent))
+	var offset int64
+	for i, id := range newContent {
+		length, found := lookupSize(restic.BlobHandle{Type: restic.DataBlob, ID: id})
+		if !found {
+			return nil
+		}
+		oldID, ok := old[offset]
+		matches[i] = ok && oldID.Equal(id)
+		offset += int64(length)
+	}
+	return &fileState{matches, offset == oldSize}
+}
+
+// patchFile returns the state of the file at target based on the content of
+// the corresponding file in the base snapshot, without reading the file. It
+// returns nil if the file is not contained in the base snapshot or if its size
+// does not match.
+func (res *Restorer) patchFile(ctx context.Context, target, location string, node *data.Node) *fileState {
+	base, err := res.patchBase.lookup(ctx, location)
+	if err != nil {
+		debug.Log("%sunable to look up %v in base snapshot: %v", res.logPrefix, location, err)
+		return nil
+	}
+	if base == nil || base.Type != data.NodeTypeFile {
+		return nil
+	}
+
+	fi, err := fs.Lstat(target)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != int64(base.Size) {
+		debug.Log("%s%v does not match the base snapshot", res.logPrefix, target)
+		return nil
+	}
+	return patchFileState(base.Content, node.Content, res.repo.LookupBlobSize)
+}
@@ -0,0 +1,113 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestPatchFileState(t *testing.T) {
+	blob := func(s string) restic.ID { return restic.Hash([]byte(s)) }
+	sizes := make(map[restic.ID]uint)
+	for _, s := range []string{"aaaa", "bbbb", "cccc", "xx"} {
+		sizes[blob(s)] = uint(len(s))
+	}
+	lookupSize := func(h restic.BlobHandle) (uint, bool) {
+		size, ok := sizes[h.ID]
+		return size, ok
+	}
+
+	for _, test := range []struct {
+		name        string
+		old, new    restic.IDs
+		matches     []bool
+		sizeMatches bool
+	}{
+		{
+			name:        "unchanged",
+			old:         restic.IDs{blob("aaaa"), blob("bbbb")},
+			new:         restic.IDs{blob("aaaa"), blob("bbbb")},
+			matches:     []bool{true, true},
+			sizeMatches: true,
+		},
+		{
+			name:        "modified",
+			old:         restic.IDs{blob("aaaa"), blob("bbbb"), blob("cccc")},
+			new:         restic.IDs{blob("aaaa"), blob("cccc"), blob("cccc")},
+			matches:     []bool{true, false, true},
+			sizeMatches: true,
+		},
+		{
+			name:    "insertion shifts offsets",
+			old:     restic.IDs{blob("aaaa"), blob("bbbb"), blob("cccc")},
+			new:     restic.IDs{blob("aaaa"), blob("xx"), blob("bbbb"), blob("cccc")},
+			matches: []bool{true, false, false, false},
+		},
+		{
+			name:    "extended",
+			old:     restic.IDs{blob("aaaa")},
+			new:     restic.IDs{blob("aaaa"), blob("bbbb")},
+			matches: []bool{true, false},
+		},
+		{
+			name:    "truncated",
+			old:     restic.IDs{blob("aaaa"), blob("bbbb")},
+			new:     restic.IDs{blob("aaaa")},
+			matches: []bool{true},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			state := patchFileState(test.old, test.new, lookupSize)
+			rtest.Equals(t, &fileState{test.matches, test.sizeMatches}, state)
+		})
+	}
+
+	rtest.Assert(t, patchFileState(restic.IDs{restic.NewRandomID()}, nil, lookupSize) == nil, "expected nil state for unknown blob")
+}
+
+func TestRestorerPatchBase(t *testing.T) {
+	repo := repository.TestRepository(t)
+	base, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file": File{DataParts: []string{"part-1\n", "part-2\n", "part-3\n"}},
+			}},
+		},
+	}, noopGetGenericAttributes)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file": File{DataParts: []string{"part-1\n", "part-X\n", "part-3\n", "part-4\n"}},
+				"new":  File{Data: "new\n"},
+			}},
+		},
+	}, noopGetGenericAttributes)
+
+	tempdir := rtest.TempDir(t)
+	_, err := NewRestorer(repo, base, Options{}).RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	// the existing content is trusted to match the base snapshot. Modify the
+	// first blob to show that only the differing blobs are restored.
+	path := filepath.Join(tempdir, "dir", "file")
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	rtest.OK(t, err)
+	_, err = f.WriteAt([]byte("local"), 0)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+
+	_, err = NewRestorer(repo, sn, Options{PatchBase: base}).RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	data, err := os.ReadFile(path)
+	rtest.OK(t, err)
+	rtest.Equals(t, "local1\npart-X\npart-3\npart-4\n", string(data))
+	data, err = os.ReadFile(filepath.Join(tempdir, "dir", "new"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "new\n", string(data))
+}
@@ -0,0 +1,55 @@
+package restorer
+
+import (
+	"bufio"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
+)
+
+// ReadPathList reads a newline-delimited list of snapshot paths from rd.
+// Empty lines are ignored.
+func ReadPathList(rd io.Reader) ([]string, error) {
+	var paths []string
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "ReadPathList")
+	}
+	return paths, nil
+}
+
+// NewPathListFilter returns a SelectFilter which only selects the given
+// snapshot paths. Paths are interpreted relative to the snapshot root and may
+// contain glob patterns. Directories are restored including their content.
+// Parent directories of selected paths are traversed but not selected, such
+// that their metadata is only restored if a child was restored.
+func NewPathListFilter(paths []string) (func(item string, isDir bool) (selectedForRestore bool, childMayBeSelected bool), error) {
+	patterns := make([]string, 0, len(paths))
+	for _, path := range paths {
+		patterns = append(patterns, filepath.Join(string(filepath.Separator), path))
+	}
+	if err := filter.ValidatePatterns(patterns); err != nil {
+		return nil, err
+	}
+	parsed := filter.ParsePatterns(patterns)
+
+	return func(item string, isDir bool) (selectedForRestore bool, childMayBeSelected bool) {
+		matched, childMayMatch, err := filter.ListWithChild(parsed, item)
+		if err != nil {
+			debug.Log("path list filter for %q failed: %v", item, err)
+			return false, false
+		}
+		return matched, childMayMatch && isDir
+	}, nil
+}
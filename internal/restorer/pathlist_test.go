@@ -0,0 +1,69 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestReadPathList(t *testing.T) {
+	paths, err := ReadPathList(strings.NewReader("/foo\r\n\nbar/baz\n*.txt"))
+	rtest.OK(t, err)
+	rtest.Equals(t, []string{"/foo", "bar/baz", "*.txt"}, paths)
+}
+
+func TestRestorePathList(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{Data: "content: file\n"},
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"file":  File{Data: "content: dir/file\n"},
+					"a.txt": File{Data: "content: dir/a.txt\n"},
+					"subdir": Dir{
+						Nodes: map[string]Node{
+							"file": File{Data: "content: dir/subdir/file\n"},
+						},
+					},
+				},
+			},
+			"other": Dir{
+				Nodes: map[string]Node{
+					"file": File{Data: "content: other/file\n"},
+				},
+			},
+		},
+	}, noopGetGenericAttributes)
+
+	selectFilter, err := NewPathListFilter([]string{"dir/subdir", "/dir/*.txt"})
+	rtest.OK(t, err)
+
+	tempdir := rtest.TempDir(t)
+	res := NewRestorer(repo, sn, Options{})
+	res.SelectFilter = selectFilter
+	_, err = res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	for fn, shouldExist := range map[string]bool{
+		"file":                                 false,
+		filepath.Join("dir", "file"):           false,
+		filepath.Join("dir", "a.txt"):          true,
+		filepath.Join("dir", "subdir", "file"): true,
+		filepath.Join("other"):                 false,
+		filepath.Join("other", "file"):         false,
+	} {
+		_, err := os.Stat(filepath.Join(tempdir, fn))
+		if shouldExist {
+			rtest.OK(t, err)
+		} else {
+			rtest.Assert(t, errors.Is(err, os.ErrNotExist), "file %v: unexpected error got %v, expected ErrNotExist", fn, err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package restorer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/filter"
+)
+
+// pathMapSeparator separates the snapshot path and the target path in a line
+// of a path map file, see ReadPathMap.
+const pathMapSeparator = " => "
+
+// PathMapping restores the items matching Pattern to Target, see
+// Options.PathMap.
+type PathMapping struct {
+	// Pattern is a path in the snapshot, which may contain glob patterns.
+	Pattern string
+	// Target is the path to restore the matching item to. If Pattern
+	// contains glob patterns, Target is the directory into which all matching
+	// items are restored under their base name. Relative paths are
+	// interpreted relative to the target directory.
+	Target string
+}
+
+// isGlob reports whether the pattern of the mapping can match multiple paths.
+func (m PathMapping) isGlob() bool {
+	return strings.ContainsAny(m.Pattern, "\\[]*?")
+}
+
+// ReadPathMap reads the lines of a path map file from rd. Each line contains
+// a snapshot path and a target path separated by " => ", for example
+// "/home/user/.bashrc => /home/user/.bashrc". Empty lines and lines starting
+// with "#" are ignored.
+func ReadPathMap(rd io.Reader) ([]PathMapping, error) {
+	var mappings []PathMapping
+	scanner := bufio.NewScanner(rd)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(strings.TrimSuffix(scanner.Text(), "\r"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern, target, ok := strings.Cut(line, pathMapSeparator)
+		pattern, target = strings.TrimSpace(pattern), strings.TrimSpace(target)
+		if !ok || pattern == "" || target == "" {
+			return nil, errors.Errorf("line %d: expected %q", lineNo, "snapshot-path"+pathMapSeparator+"target-path")
+		}
+		mappings = append(mappings, PathMapping{Pattern: pattern, Target: target})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "ReadPathMap")
+	}
+	return mappings, nil
+}
+
+// ConflictingMappingsError lists the mappings of a PathMap which contradict
+// each other.
+type ConflictingMappingsError struct {
+	Conflicts []string
+}
+
+func (e *ConflictingMappingsError) Error() string {
+	return fmt.Sprintf("%d conflicting path mappings: %s", len(e.Conflicts), strings.Join(e.Conflicts, ", "))
+}
+
+// PathMap restores the non-directory items matching a mapping to the target
+// of the mapping instead of their location below the target directory. If
+// several mappings match, the first one is used. Create it using NewPathMap.
+type PathMap struct {
+	mappings []PathMapping
+	patterns []filter.Pattern
+}
+
+// NewPathMap validates the mappings. Patterns are interpreted relative to the
+// snapshot root. If the same pattern is mapped to different targets or
+// several patterns without glob patterns are mapped to the same target, a
+// ConflictingMappingsError lists all such mappings.
+func NewPathMap(mappings []PathMapping) (*PathMap, error) {
+	m := &PathMap{mappings: make([]PathMapping, 0, len(mappings))}
+	byPattern := make(map[string]string)
+	byTarget := make(map[string]string)
+	var conflicts []string
+	for _, mapping := range mappings {
+		mapping.Pattern = filepath.Join(string(filepath.Separator), mapping.Pattern)
+		mapping.Target = filepath.Clean(mapping.Target)
+		if err := filter.ValidatePatterns([]string{mapping.Pattern}); err != nil {
+			return nil, err
+		}
+
+		if target, ok := byPattern[mapping.Pattern]; ok {
+			if target != mapping.Target {
+				conflicts = append(conflicts, fmt.Sprintf("%v is mapped to %v and %v", mapping.Pattern, target, mapping.Target))
+			}
+			continue
+		}
+		byPattern[mapping.Pattern] = mapping.Target
+		if !mapping.isGlob() {
+			if other, ok := byTarget[mapping.Target]; ok {
+				conflicts = append(conflicts, fmt.Sprintf("%v and %v are both mapped to %v", other, mapping.Pattern, mapping.Target))
+				continue
+			}
+			byTarget[mapping.Target] = mapping.Pattern
+		}
+		m.mappings = append(m.mappings, mapping)
+	}
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return nil, &ConflictingMappingsError{Conflicts: conflicts}
+	}
+
+	for _, mapping := range m.mappings {
+		m.patterns = append(m.patterns, filter.ParsePatterns([]string{mapping.Pattern})...)
+	}
+	return m, nil
+}
+
+// match returns the target of the first mapping matching location, relative
+// to dst. It returns false if no mapping matches.
+func (m *PathMap) match(dst, location string) (string, bool) {
+	for i, pattern := range m.patterns {
+		matched, err := filter.List([]filter.Pattern{pattern}, location)
+		if err != nil {
+			debug.Log("path map pattern %v for %q failed: %v", m.mappings[i].Pattern, location, err)
+			continue
+		}
+		if !matched {
+			continue
+		}
+		target := m.mappings[i].Target
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(dst, target)
+		}
+		if m.mappings[i].isGlob() {
+			target = filepath.Join(target, filepath.Base(location))
+		}
+		return target, true
+	}
+	return "", false
+}
+
+// mappedPaths assigns the targets of the items restored according to
+// Options.PathMap. Targets remain stable for all traversals of the tree. It is
+// safe for concurrent use.
+type mappedPaths struct {
+	m       sync.Mutex
+	dst     string
+	pathMap *PathMap
+	// target by location, empty if the item is not restored
+	targets map[string]string
+	// location by target
+	used map[string]string
+}
+
+func newMappedPaths(dst string, pathMap *PathMap) *mappedPaths {
+	return &mappedPaths{
+		dst:     dst,
+		pathMap: pathMap,
+		targets: make(map[string]string),
+		used:    make(map[string]string),
+	}
+}
+
+// target returns the path to restore the item at location to and whether
+// the item is mapped. An empty path means that the item must be skipped, as
+// its target is already used by another item. The collision is only reported
+// once as an error.
+func (p *mappedPaths) target(location string) (string, bool, error) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	if target, ok := p.targets[location]; ok {
+		return target, true, nil
+	}
+	target, ok := p.pathMap.match(p.dst, location)
+	if !ok {
+		return "", false, nil
+	}
+	if other, ok := p.used[target]; ok {
+		p.targets[location] = ""
+		return "", true, errors.Errorf("mapped target %v is already used by %v", target, other)
+	}
+	p.targets[location] = target
+	p.used[target] = location
+	return target, true, nil
+}
+
+// assigned returns the target already assigned to location.
+func (p *mappedPaths) assigned(location string) (string, bool) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	target, ok := p.targets[location]
+	return target, ok
+}
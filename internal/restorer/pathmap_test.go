@@ -0,0 +1,98 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestReadPathMap(t *testing.T) {
+	mappings, err := ReadPathMap(strings.NewReader("# comment\n/etc/hosts => /srv/hosts\r\n\n  /home/*/.bashrc   =>  skel  \n"))
+	rtest.OK(t, err)
+	rtest.Equals(t, []PathMapping{
+		{Pattern: "/etc/hosts", Target: "/srv/hosts"},
+		{Pattern: "/home/*/.bashrc", Target: "skel"},
+	}, mappings)
+
+	_, err = ReadPathMap(strings.NewReader("/etc/hosts => /srv/hosts\n/etc/passwd\n"))
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "line 2"), "unexpected error %v", err)
+}
+
+func TestNewPathMapConflicts(t *testing.T) {
+	_, err := NewPathMap([]PathMapping{
+		{Pattern: "/a", Target: "/x"},
+		{Pattern: "a", Target: "/x"},
+		{Pattern: "/b", Target: "/x/"},
+		{Pattern: "/c", Target: "/y"},
+		{Pattern: "/c", Target: "/z"},
+		{Pattern: "/d/*", Target: "/x"},
+	})
+	var conflictErr *ConflictingMappingsError
+	rtest.Assert(t, errors.As(err, &conflictErr), "unexpected error %v", err)
+	rtest.Equals(t, []string{
+		filepath.FromSlash("/a and /b are both mapped to /x"),
+		filepath.FromSlash("/c is mapped to /y and /z"),
+	}, conflictErr.Conflicts)
+}
+
+func TestRestorerPathMap(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"etc": Dir{Nodes: map[string]Node{
+				"hosts":  File{Data: "content: hosts\n"},
+				"passwd": File{Data: "content: passwd\n"},
+			}},
+			"home": Dir{Nodes: map[string]Node{
+				"alice": Dir{Nodes: map[string]Node{
+					".bashrc": File{Data: "content: alice\n"},
+				}},
+				"bob": Dir{Nodes: map[string]Node{
+					".bashrc": File{Data: "content: bob\n"},
+				}},
+			}},
+		},
+	}, noopGetGenericAttributes)
+
+	tempdir := rtest.TempDir(t)
+	elsewhere := filepath.Join(rtest.TempDir(t), "elsewhere")
+	pathMap, err := NewPathMap([]PathMapping{
+		{Pattern: "/etc/hosts", Target: filepath.Join(elsewhere, "hosts")},
+		{Pattern: "/home/*/.bashrc", Target: "skel"},
+	})
+	rtest.OK(t, err)
+
+	res := NewRestorer(repo, sn, Options{PathMap: pathMap})
+	var failed []string
+	res.Error = func(location string, _ error) error {
+		failed = append(failed, filepath.ToSlash(location))
+		return nil
+	}
+	_, err = res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	// both files are mapped to skel/.bashrc, only the first one is restored
+	rtest.Equals(t, []string{"/home/bob/.bashrc"}, failed)
+
+	for path, content := range map[string]string{
+		filepath.Join(elsewhere, "hosts"):         "content: hosts\n",
+		filepath.Join(tempdir, "etc", "passwd"):   "content: passwd\n",
+		filepath.Join(tempdir, "skel", ".bashrc"): "content: alice\n",
+	} {
+		data, err := os.ReadFile(path)
+		rtest.OK(t, err)
+		rtest.Equals(t, content, string(data))
+	}
+	for _, path := range []string{
+		filepath.Join(tempdir, "etc", "hosts"),
+		filepath.Join(tempdir, "home", "alice", ".bashrc"),
+	} {
+		_, err := os.Stat(path)
+		rtest.Assert(t, errors.Is(err, os.ErrNotExist), "expected %v not to exist, got %v", path, err)
+	}
+}
@@ -0,0 +1,41 @@
+package restorer
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/restic/restic/internal/data"
+)
+
+// PlaceholderXattr is the extended attribute which marks the empty files
+// created instead of restoring the file content if Options.StructureOnly is
+// set. It contains the size of the file content as a decimal number.
+const PlaceholderXattr = "user.restic.placeholder"
+
+func (res *Restorer) addPlaceholder(location string, size uint64) {
+	if res.placeholders == nil {
+		res.placeholders = make(map[string]struct{})
+	}
+	res.placeholders[location] = struct{}{}
+	res.placeholderBytes += size
+}
+
+// placeholderNode returns node with the extended attribute which marks it as
+// a placeholder, if location is a placeholder file.
+func (res *Restorer) placeholderNode(node *data.Node, location string) *data.Node {
+	if _, ok := res.placeholders[location]; !ok {
+		return node
+	}
+	n := *node
+	n.ExtendedAttributes = append(slices.Clip(node.ExtendedAttributes), data.ExtendedAttribute{
+		Name:  PlaceholderXattr,
+		Value: []byte(strconv.FormatUint(node.Size, 10)),
+	})
+	return &n
+}
+
+// Placeholders returns the number of placeholder files and the total size of
+// the content which was not restored for them, see Options.StructureOnly.
+func (res *Restorer) Placeholders() (count int, size uint64) {
+	return len(res.placeholders), res.placeholderBytes
+}
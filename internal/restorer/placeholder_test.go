@@ -0,0 +1,66 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerStructureOnly(t *testing.T) {
+	modTime := time.Date(2024, 3, 4, 5, 6, 7, 0, time.UTC)
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"file":  File{Data: "content: file\n", ModTime: modTime},
+					"empty": File{Data: ""},
+					"sub":   Dir{},
+				},
+			},
+			"link1": File{Data: "content: link\n", Links: 2, Inode: 1},
+			"link2": File{Data: "content: link\n", Links: 2, Inode: 1},
+		},
+	}
+
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+	tempdir := rtest.TempDir(t)
+
+	res := NewRestorer(repo, sn, Options{StructureOnly: true})
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	count, size := res.Placeholders()
+	rtest.Equals(t, 3, count)
+	rtest.Equals(t, uint64(len("content: file\n")+len("content: link\n")), size)
+
+	fi, err := os.Stat(filepath.Join(tempdir, "dir", "sub"))
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.IsDir(), "expected directory")
+
+	for _, name := range []string{"dir/file", "dir/empty", "link1", "link2"} {
+		fi, err := os.Stat(filepath.Join(tempdir, filepath.FromSlash(name)))
+		rtest.OK(t, err)
+		rtest.Equals(t, int64(0), fi.Size())
+	}
+	fi, err = os.Stat(filepath.Join(tempdir, "dir", "file"))
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.ModTime().Equal(modTime), "unexpected modification time %v", fi.ModTime())
+
+	meta, err := fs.NewLocal().OpenFile(filepath.Join(tempdir, "dir", "file"), fs.O_NOFOLLOW, true)
+	rtest.OK(t, err)
+	node, err := meta.ToNode(false, t.Logf)
+	rtest.OK(t, err)
+	rtest.OK(t, meta.Close())
+	if len(node.ExtendedAttributes) == 0 {
+		t.Skip("filesystem does not support extended attributes")
+	}
+	rtest.Equals(t, PlaceholderXattr, node.ExtendedAttributes[0].Name)
+	rtest.Equals(t, "14", string(node.ExtendedAttributes[0].Value))
+}
@@ -0,0 +1,80 @@
+package restorer
+
+import (
+	"unsafe"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// PlanMemory estimates the memory used by the data structures which plan the
+// download of the file content, see Options.PlanMemory. The estimate is
+// derived from the number of entries and ignores the allocator overhead.
+type PlanMemory struct {
+	// Files is the number of regular files whose content is restored.
+	Files int
+	// Blobs is the number of blobs referenced by these files.
+	Blobs int
+	// Packs is the peak number of packs planned at once, that is for a
+	// single batch if the files are restored in batches.
+	Packs int
+	// PackFiles is the peak number of files referenced by these packs,
+	// counting each file once per pack.
+	PackFiles int
+	// FileBytes, PackBytes is the estimated peak memory used for the files
+	// and packs.
+	FileBytes uint64
+	PackBytes uint64
+}
+
+// Bytes returns the estimated peak memory usage.
+func (m PlanMemory) Bytes() uint64 {
+	return m.FileBytes + m.PackBytes
+}
+
+// mapEntryBytes estimates the memory used by a map entry, including the
+// unused capacity of the map.
+func mapEntryBytes(key, value uintptr) uint64 {
+	return uint64(2 * (key + value))
+}
+
+const pointerBytes = unsafe.Sizeof(uintptr(0))
+
+// addFiles records the memory used for files, which remain in memory until
+// all batches are restored.
+func (m *PlanMemory) addFiles(files []*fileInfo) {
+	m.Files = len(files)
+	m.FileBytes = uint64(len(files)) * uint64(pointerBytes+unsafe.Sizeof(fileInfo{}))
+	for _, file := range files {
+		blobs := len(file.blobs.(restic.IDs))
+		m.Blobs += blobs
+		m.FileBytes += uint64(len(file.location)) + uint64(blobs)*uint64(unsafe.Sizeof(restic.ID{}))
+		if blobs > largeFileBlobCount {
+			// the blobs of large files are additionally indexed by pack
+			m.FileBytes += uint64(blobs) * uint64(unsafe.Sizeof(fileBlobInfo{}))
+		}
+	}
+}
+
+// addPacks records the memory used for the packs of a batch, if it exceeds
+// that of the previous batches.
+func (m *PlanMemory) addPacks(packs map[restic.ID]*packInfo) {
+	packFiles := 0
+	for _, pack := range packs {
+		packFiles += len(pack.files)
+	}
+	// the pack is referenced by the packs map and the scheduling order
+	bytes := uint64(len(packs)) * (mapEntryBytes(unsafe.Sizeof(restic.ID{}), pointerBytes) +
+		uint64(unsafe.Sizeof(restic.ID{})+unsafe.Sizeof(packInfo{})))
+	bytes += uint64(packFiles) * mapEntryBytes(pointerBytes, 0)
+	if bytes > m.PackBytes {
+		m.Packs = len(packs)
+		m.PackFiles = packFiles
+		m.PackBytes = bytes
+	}
+}
+
+// PlanMemory returns the estimated memory used to plan the download of the
+// file content. It returns nil unless Options.PlanMemory is set.
+func (res *Restorer) PlanMemory() *PlanMemory {
+	return res.planMemory
+}
@@ -0,0 +1,55 @@
+package restorer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRestorerPlanMemory(t *testing.T) {
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+				{"data2-2", "pack3"},
+				{"data2-3", "pack3"},
+			},
+		},
+	}
+
+	for _, test := range []struct {
+		sequentialFiles int
+		packs           int
+		packFiles       int
+	}{
+		{0, 3, 4},
+		// each batch uses two packs
+		{1, 2, 2},
+	} {
+		repo := newTestRepo(content)
+		r := newFileRestorer(rtest.TempDir(t), repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+			repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+		r.files = repo.files
+		r.sequentialFiles = test.sequentialFiles
+		r.planMemory = &PlanMemory{}
+		rtest.OK(t, r.restoreFiles(context.TODO()))
+
+		m := r.planMemory
+		rtest.Equals(t, 2, m.Files)
+		rtest.Equals(t, 5, m.Blobs)
+		rtest.Equals(t, test.packs, m.Packs)
+		rtest.Equals(t, test.packFiles, m.PackFiles)
+		rtest.Assert(t, m.FileBytes > 0 && m.PackBytes > 0, "missing memory estimate %v", m)
+		rtest.Equals(t, m.FileBytes+m.PackBytes, m.Bytes())
+	}
+}
@@ -0,0 +1,113 @@
+package restorer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+// PreviewPatchMagic starts each patch written for Options.PreviewPatch.
+//
+// The magic is followed by a sequence of records, each starting with one of
+// the record type bytes below. All integers are encoded as unsigned varints.
+//
+//	PreviewPatchFile: id, path length, path, size, created
+//	PreviewPatchData: id, offset, length, data
+//	PreviewPatchEnd
+//
+// A file record announces the file with the given id, which is used by the
+// data records of the file. The path is its slash-separated location in the
+// snapshot, relative to the target directory. Created is 1 if the file is
+// restored from scratch, replacing an existing file, and 0 if an existing
+// file is updated. The file must be truncated or extended to the given size
+// before applying its data records, which then replace length bytes at
+// offset. Data records of different files are interleaved. The end record
+// marks a complete patch, a patch without it must not be applied.
+const PreviewPatchMagic = "RSTCPAT1"
+
+// Record types of a patch, see PreviewPatchMagic.
+const (
+	PreviewPatchFile byte = 'F'
+	PreviewPatchData byte = 'D'
+	PreviewPatchEnd  byte = 'E'
+)
+
+// previewPatch serializes the changes of the restored files to a patch
+// stream instead of writing them to the target files.
+type previewPatch struct {
+	m      sync.Mutex
+	wr     *bufio.Writer
+	nextID uint64
+	// the first error is returned by all further writes
+	err error
+}
+
+func newPreviewPatch(wr io.Writer) *previewPatch {
+	p := &previewPatch{wr: bufio.NewWriter(wr)}
+	_, p.err = p.wr.WriteString(PreviewPatchMagic)
+	return p
+}
+
+func (p *previewPatch) writeUvarint(v uint64) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = p.wr.Write(binary.AppendUvarint(nil, v))
+}
+
+func (p *previewPatch) writeBytes(buf []byte) {
+	if p.err != nil {
+		return
+	}
+	_, p.err = p.wr.Write(buf)
+}
+
+// addFile writes the file record of file and assigns its id.
+func (p *previewPatch) addFile(file *fileInfo) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	file.patchID = p.nextID
+	p.nextID++
+
+	path := filepath.ToSlash(file.location)
+	created := uint64(0)
+	if file.state == nil {
+		created = 1
+	}
+	p.writeBytes([]byte{PreviewPatchFile})
+	p.writeUvarint(file.patchID)
+	p.writeUvarint(uint64(len(path)))
+	p.writeBytes([]byte(path))
+	p.writeUvarint(uint64(file.size))
+	p.writeUvarint(created)
+	return p.err
+}
+
+// write writes a data record for blob at offset in file.
+func (p *previewPatch) write(file *fileInfo, blob []byte, offset int64) error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.writeBytes([]byte{PreviewPatchData})
+	p.writeUvarint(file.patchID)
+	p.writeUvarint(uint64(offset))
+	p.writeUvarint(uint64(len(blob)))
+	p.writeBytes(blob)
+	return p.err
+}
+
+// finish writes the end record and flushes the patch. It must only be called
+// once the content of all files has been written.
+func (p *previewPatch) finish() error {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.writeBytes([]byte{PreviewPatchEnd})
+	if p.err == nil {
+		p.err = p.wr.Flush()
+	}
+	return p.err
+}
@@ -0,0 +1,136 @@
+package restorer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type patchFile struct {
+	path    string
+	size    uint64
+	created bool
+	// data records of the file by offset
+	data map[uint64]string
+}
+
+// readPreviewPatch decodes a complete patch, indexed by the file path.
+func readPreviewPatch(t *testing.T, buf []byte) map[string]*patchFile {
+	rd := bufio.NewReader(bytes.NewReader(buf))
+	magic := make([]byte, len(PreviewPatchMagic))
+	_, err := io.ReadFull(rd, magic)
+	rtest.OK(t, err)
+	rtest.Equals(t, PreviewPatchMagic, string(magic))
+
+	uvarint := func() uint64 {
+		v, err := binary.ReadUvarint(rd)
+		rtest.OK(t, err)
+		return v
+	}
+	readBytes := func(n uint64) []byte {
+		buf := make([]byte, n)
+		_, err := io.ReadFull(rd, buf)
+		rtest.OK(t, err)
+		return buf
+	}
+
+	byID := make(map[uint64]*patchFile)
+	files := make(map[string]*patchFile)
+	for {
+		typ, err := rd.ReadByte()
+		rtest.OK(t, err)
+		switch typ {
+		case PreviewPatchFile:
+			id := uvarint()
+			file := &patchFile{path: string(readBytes(uvarint())), data: make(map[uint64]string)}
+			file.size = uvarint()
+			file.created = uvarint() == 1
+			byID[id] = file
+			files[file.path] = file
+		case PreviewPatchData:
+			file, ok := byID[uvarint()]
+			rtest.Assert(t, ok, "data record for unknown file")
+			offset := uvarint()
+			file.data[offset] = string(readBytes(uvarint()))
+		case PreviewPatchEnd:
+			_, err := rd.ReadByte()
+			rtest.Equals(t, io.EOF, err)
+			return files
+		default:
+			t.Fatalf("unexpected record type %q", typ)
+		}
+	}
+}
+
+func TestRestorerPreviewPatch(t *testing.T) {
+	repo := repository.TestRepository(t)
+	base, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file":      File{DataParts: []string{"part-1\n", "part-2\n", "part-3\n"}},
+				"truncated": File{DataParts: []string{"part-1\n", "part-2\n"}},
+				"unchanged": File{Data: "unchanged\n"},
+			}},
+		},
+	}, noopGetGenericAttributes)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file":      File{DataParts: []string{"part-1\n", "part-X\n", "part-3\n", "part-4\n"}},
+				"truncated": File{DataParts: []string{"part-1\n"}},
+				"unchanged": File{Data: "unchanged\n"},
+				"new":       File{Data: "new\n"},
+			}},
+		},
+	}, noopGetGenericAttributes)
+
+	tempdir := rtest.TempDir(t)
+	_, err := NewRestorer(repo, base, Options{}).RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	var buf bytes.Buffer
+	_, err = NewRestorer(repo, sn, Options{DryRun: true, PreviewPatch: &buf}).RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	// the target is not modified
+	_, err = os.Stat(filepath.Join(tempdir, "dir", "new"))
+	rtest.Assert(t, os.IsNotExist(err), "expected new file not to exist, got %v", err)
+
+	rtest.Equals(t, map[string]*patchFile{
+		"/dir/file": {
+			path: "/dir/file",
+			size: 28,
+			data: map[uint64]string{7: "part-X\n", 21: "part-4\n"},
+		},
+		"/dir/truncated": {
+			path: "/dir/truncated",
+			size: 7,
+			data: map[uint64]string{},
+		},
+		"/dir/new": {
+			path:    "/dir/new",
+			size:    4,
+			created: true,
+			data:    map[uint64]string{0: "new\n"},
+		},
+	}, readPreviewPatch(t, buf.Bytes()))
+}
+
+func TestRestorerPreviewPatchRequiresDryRun(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{"file": File{Data: "content\n"}},
+	}, noopGetGenericAttributes)
+
+	var buf bytes.Buffer
+	_, err := NewRestorer(repo, sn, Options{PreviewPatch: &buf}).RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.Assert(t, err != nil, "expected an error without a dry run")
+}
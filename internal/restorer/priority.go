@@ -0,0 +1,93 @@
+package restorer
+
+import (
+	"sync"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// filePriorities tracks the priorities set using Restorer.SetFilePriority. It
+// is safe for concurrent use, all methods are no-ops for a nil receiver.
+type filePriorities struct {
+	m          sync.Mutex
+	priorities map[string]int
+	// priorities which were changed since the last call to takeChanged
+	changed map[string]int
+}
+
+func (p *filePriorities) set(location string, priority int) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if p.priorities == nil {
+		p.priorities = make(map[string]int)
+		p.changed = make(map[string]int)
+	}
+	p.priorities[location] = priority
+	p.changed[location] = priority
+}
+
+// get returns the priority of the file at location, which defaults to 0.
+func (p *filePriorities) get(location string) int {
+	if p == nil {
+		return 0
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.priorities[location]
+}
+
+// takeChanged returns the priorities which were changed since the last call
+// and forgets them.
+func (p *filePriorities) takeChanged() map[string]int {
+	if p == nil {
+		return nil
+	}
+	p.m.Lock()
+	defer p.m.Unlock()
+	if len(p.changed) == 0 {
+		return nil
+	}
+	changed := p.changed
+	p.changed = make(map[string]int)
+	return changed
+}
+
+// SetFilePriority sets the priority of the file at location, which defaults to
+// 0. Negative priorities are allowed. The packs used by files with a higher priority are downloaded first, for
+// example to restore the files requested by a user interface before all
+// others. location uses the same format as passed to Error. It can be called at
+// any time, also while RestoreTo is running, but only affects packs which were
+// not yet scheduled. Changing the priority while RestoreTo is running requires
+// a Scheduler which implements PriorityScheduler, both built-in schedulers do.
+func (res *Restorer) SetFilePriority(location string, priority int) {
+	res.priorities.set(location, priority)
+}
+
+// applyPriorities updates the priority of the remaining packs once file
+// priorities were changed while restoring.
+func (r *fileRestorer) applyPriorities(packs map[restic.ID]*packInfo) {
+	changed := r.priorities.takeChanged()
+	if changed == nil {
+		return
+	}
+	scheduler, _ := r.scheduler.(PriorityScheduler)
+	for _, pack := range packs {
+		first := true
+		var priority int
+		for file := range pack.files {
+			if p, ok := changed[file.location]; ok {
+				file.priority = p
+			}
+			if first || file.priority > priority {
+				priority = file.priority
+				first = false
+			}
+		}
+		if priority != pack.priority {
+			pack.priority = priority
+			if scheduler != nil {
+				scheduler.Reprioritize(pack.id, priority)
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func drainScheduler(t *testing.T, s Scheduler) restic.IDs {
+	var scheduled restic.IDs
+	for {
+		id, ok, err := s.Next(context.TODO())
+		rtest.OK(t, err)
+		if !ok {
+			return scheduled
+		}
+		scheduled = append(scheduled, id)
+	}
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	ids := restic.IDs{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	for _, order := range []PackOrder{PackOrderFirstAccess, PackOrderPackID} {
+		t.Run(order.String(), func(t *testing.T) {
+			s := order.NewScheduler().(PriorityScheduler)
+			for i, id := range ids {
+				s.Enqueue(ScheduledPack{ID: id, Order: i, Priority: []int{0, -1, 2, 0}[i]})
+			}
+			s.Reprioritize(ids[3], 1)
+			scheduled := drainScheduler(t, s)
+			rtest.Equals(t, restic.IDs{ids[2], ids[3], ids[0], ids[1]}, scheduled)
+		})
+	}
+}
+
+func priorityContent() []TestFile {
+	var content []TestFile
+	for i := 1; i <= 4; i++ {
+		content = append(content, TestFile{
+			name:  fmt.Sprintf("file%d", i),
+			blobs: []TestBlob{{fmt.Sprintf("data%d", i), fmt.Sprintf("pack%d", i)}},
+		})
+	}
+	return content
+}
+
+func TestFileRestorerPriority(t *testing.T) {
+	repo := newTestRepo(priorityContent())
+	packOf := func(data string) restic.ID {
+		return repo.blobs[restic.Hash([]byte(data))][0].PackID()
+	}
+
+	var loaded restic.IDs
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		loaded = append(loaded, packID)
+		return repo.loader(ctx, packID, handles, handleBlobFn)
+	}
+	r := newFileRestorer(rtest.TempDir(t), loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.priorities = &filePriorities{}
+	r.priorities.set("file3", 1)
+	r.priorities.set("file2", -1)
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+
+	rtest.Equals(t, restic.IDs{packOf("data3"), packOf("data1"), packOf("data4"), packOf("data2")}, loaded)
+}
+
+func TestFileRestorerRaisePriority(t *testing.T) {
+	repo := newTestRepo(priorityContent())
+	packOf := func(data string) restic.ID {
+		return repo.blobs[restic.Hash([]byte(data))][0].PackID()
+	}
+
+	priorities := &filePriorities{}
+	var m sync.Mutex
+	var loaded restic.IDs
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		m.Lock()
+		if len(loaded) == 0 {
+			// requested by the user while the restore is running
+			priorities.set("file4", 5)
+		}
+		loaded = append(loaded, packID)
+		m.Unlock()
+		return repo.loader(ctx, packID, handles, handleBlobFn)
+	}
+	r := newFileRestorer(rtest.TempDir(t), loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.priorities = priorities
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+
+	rtest.Equals(t, 4, len(loaded))
+	// the second pack may already have been scheduled
+	rtest.Assert(t, slices.Index(loaded, packOf("data4")) < slices.Index(loaded, packOf("data3")),
+		"pack of file4 was not downloaded before the pack of file3: %v", loaded)
+	for _, file := range repo.files {
+		data, err := os.ReadFile(r.targetPath(file.location))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.fileContent(file), string(data))
+	}
+}
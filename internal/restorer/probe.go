@@ -0,0 +1,147 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Number of directories which are probed concurrently.
+const nProbeWorkers = 8
+
+// InaccessibleDir is a directory in which the restore cannot create files.
+type InaccessibleDir struct {
+	Path string
+	Err  error
+}
+
+// InaccessibleDirsError is returned by a dry run with Options.ProbeTargets if
+// files cannot be created in some of the target directories.
+type InaccessibleDirsError struct {
+	Dirs []InaccessibleDir
+}
+
+func (e *InaccessibleDirsError) Error() string {
+	return fmt.Sprintf("cannot create files in %d target directories", len(e.Dirs))
+}
+
+// probeTargets checks that files can be created in all directories into which
+// the restore would write an item. Directories which do not exist yet are
+// created by the restore, thus their closest existing parent is checked.
+func (res *Restorer) probeTargets(ctx context.Context, dst string) error {
+	parents := make(map[string]struct{})
+	addParent := func(_ *data.Node, target, _ string) error {
+		parents[filepath.Dir(target)] = struct{}{}
+		return nil
+	}
+	err := res.traverseTree(ctx, dst, *res.sn.Tree, treeVisitor{
+		enterDir: func(node *data.Node, target, location string) error {
+			if node == nil {
+				// the target directory itself
+				parents[target] = struct{}{}
+				return nil
+			}
+			return addParent(node, target, location)
+		},
+		visitNode: addParent,
+	})
+	if err != nil {
+		return err
+	}
+
+	dirs := make(map[string]struct{})
+	for dir := range parents {
+		dirs[existingParent(dir)] = struct{}{}
+	}
+
+	var m sync.Mutex
+	var inaccessible []InaccessibleDir
+	work := make(chan string)
+	wg, ctx := errgroup.WithContext(ctx)
+	wg.Go(func() error {
+		defer close(work)
+		for _, dir := range slices.Sorted(maps.Keys(dirs)) {
+			select {
+			case work <- dir:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+	for i := 0; i < nProbeWorkers; i++ {
+		wg.Go(func() error {
+			for dir := range work {
+				if err := probeDir(dir); err != nil {
+					m.Lock()
+					inaccessible = append(inaccessible, InaccessibleDir{Path: dir, Err: err})
+					m.Unlock()
+				}
+			}
+			return nil
+		})
+	}
+	if err := wg.Wait(); err != nil {
+		return err
+	}
+	if len(inaccessible) == 0 {
+		return nil
+	}
+	slices.SortFunc(inaccessible, func(a, b InaccessibleDir) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return &InaccessibleDirsError{Dirs: inaccessible}
+}
+
+// existingParent returns path if it exists, or otherwise the closest
+// existing parent of path.
+func existingParent(path string) string {
+	for {
+		if _, err := fs.Lstat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
+
+// probeDir creates and removes a file in dir. The timestamps of dir are
+// restored afterwards, such that the probe leaves no trace.
+func probeDir(dir string) error {
+	fi, err := fs.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return errors.Errorf("%v is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".restic-probe-")
+	if err != nil {
+		return err
+	}
+	name := f.Name()
+	err = f.Close()
+	if rerr := fs.Remove(name); err == nil {
+		err = rerr
+	}
+	stat := fs.ExtendedStat(fi)
+	if terr := os.Chtimes(dir, stat.AccessTime, stat.ModTime); terr != nil {
+		debug.Log("unable to restore modification time of %v: %v", dir, terr)
+	}
+	return err
+}
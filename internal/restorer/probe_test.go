@@ -0,0 +1,58 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerProbeTargets(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"sub": Dir{Nodes: map[string]Node{
+					"file": File{Data: "content: file\n"},
+				}},
+			}},
+			"blocked": Dir{Nodes: map[string]Node{
+				"file": File{Data: "content: blocked\n"},
+			}},
+			"file": File{Data: "content: root\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	tempdir := rtest.TempDir(t)
+	rtest.OK(t, os.Mkdir(filepath.Join(tempdir, "dir"), 0o700))
+	// a file in place of a directory cannot be used by the restore
+	rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "blocked"), nil, 0o600))
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	rtest.OK(t, os.Chtimes(filepath.Join(tempdir, "dir"), mtime, mtime))
+
+	_, err := NewRestorer(repo, sn, Options{DryRun: true, ProbeTargets: true}).RestoreTo(context.TODO(), tempdir)
+	var probeErr *InaccessibleDirsError
+	rtest.Assert(t, errors.As(err, &probeErr), "expected InaccessibleDirsError, got %v", err)
+	rtest.Equals(t, 1, len(probeErr.Dirs))
+	rtest.Equals(t, filepath.Join(tempdir, "blocked"), probeErr.Dirs[0].Path)
+
+	// the probes leave no trace
+	entries, err := os.ReadDir(filepath.Join(tempdir, "dir"))
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(entries))
+	fi, err := os.Stat(filepath.Join(tempdir, "dir"))
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.ModTime().Equal(mtime), "unexpected modification time %v", fi.ModTime())
+
+	rtest.OK(t, os.Remove(filepath.Join(tempdir, "blocked")))
+	_, err = NewRestorer(repo, sn, Options{DryRun: true, ProbeTargets: true}).RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	_, err = NewRestorer(repo, sn, Options{ProbeTargets: true}).RestoreTo(context.TODO(), tempdir)
+	rtest.Assert(t, err != nil, "expected error for probing without dry run")
+}
@@ -8,6 +8,7 @@ const (
 	ActionFileRestored  ItemAction = "file restored"
 	ActionFileUpdated   ItemAction = "file updated"
 	ActionFileUnchanged ItemAction = "file unchanged"
+	ActionFileSkipped   ItemAction = "file skipped"
 	ActionOtherRestored ItemAction = "other restored"
 	ActionDeleted       ItemAction = "deleted"
 )
@@ -36,3 +37,50 @@ func progressOrNoop(p ProgressReporter) ProgressReporter {
 	}
 	return p
 }
+
+// SkipReason is the reason why the content of a file was not restored.
+type SkipReason string
+
+// Constants for the different skip reasons.
+const (
+	// SkipUnchanged is used for files whose content is already up to date.
+	SkipUnchanged SkipReason = "unchanged"
+	// SkipNewer is used for existing files which are at least as new as the
+	// file in the snapshot, see OverwriteIfNewer and OverwriteIfNewerAndChanged.
+	SkipNewer SkipReason = "newer"
+	// SkipExisting is used for existing files, see OverwriteNever.
+	SkipExisting SkipReason = "exists"
+	// SkipQuota is used for files which exceed Options.SizeQuota.
+	SkipQuota SkipReason = "quota"
+	// SkipOwner is used for files rejected by Options.OwnerFilter.
+	SkipOwner SkipReason = "owner"
+	// SkipCanceled is used for files which were canceled, for example using
+	// CancelFile or by Options.Deadline.
+	SkipCanceled SkipReason = "canceled"
+)
+
+// SkipReasonReporter is implemented by a ProgressReporter which distinguishes
+// why files were skipped. AddSkippedFileReason is then called instead of
+// AddSkippedFile, with either SkipUnchanged, SkipNewer or SkipExisting.
+type SkipReasonReporter interface {
+	AddSkippedFileReason(name string, size uint64, reason SkipReason)
+}
+
+// ResumedProgress are the progress counters of an interrupted restore.
+type ResumedProgress struct {
+	FilesFinished uint64 `json:"files_finished"`
+	FilesTotal    uint64 `json:"files_total"`
+	BytesWritten  uint64 `json:"bytes_written"`
+	BytesTotal    uint64 `json:"bytes_total"`
+}
+
+// ProgressResumer is implemented by a ProgressReporter which can continue
+// the progress of an interrupted restore. The counters are stored in the
+// journal once a restore is interrupted and passed to the ProgressResumer of
+// the next restore using that journal.
+type ProgressResumer interface {
+	// ResumeProgress is called before restoring the first item.
+	ResumeProgress(state ResumedProgress)
+	// ProgressState returns the counters to store in the journal.
+	ProgressState() ResumedProgress
+}
@@ -0,0 +1,84 @@
+package restorer
+
+import (
+	"sync"
+	"time"
+)
+
+// batchedProgress is the progress of a file which was not yet reported.
+type batchedProgress struct {
+	action ItemAction
+	bytes  uint64
+	total  uint64
+}
+
+// progressBatch coalesces the progress of the written blobs before passing it
+// to the ProgressReporter, see Options.ProgressBatch. The progress of all
+// blobs of a file since the last flush is reported using a single call to
+// AddProgress, thus the totals are exact once flush was called. It is safe for
+// concurrent use.
+type progressBatch struct {
+	progress ProgressReporter
+	// flush after this many updates, zero means no limit
+	maxUpdates int
+	// flush once this duration has passed since the last flush, zero means
+	// no limit
+	interval time.Duration
+
+	m         sync.Mutex
+	pending   map[string]*batchedProgress
+	order     []string
+	updates   int
+	lastFlush time.Time
+}
+
+func newProgressBatch(progress ProgressReporter, maxUpdates int, interval time.Duration) *progressBatch {
+	return &progressBatch{
+		progress:   progress,
+		maxUpdates: maxUpdates,
+		interval:   interval,
+		pending:    make(map[string]*batchedProgress),
+		lastFlush:  time.Now(),
+	}
+}
+
+// add records the progress of a written blob of the file at location.
+func (b *progressBatch) add(location string, action ItemAction, bytes, total uint64) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	p, ok := b.pending[location]
+	if !ok {
+		p = &batchedProgress{total: total}
+		b.pending[location] = p
+		b.order = append(b.order, location)
+	}
+	p.action = action
+	p.bytes += bytes
+	b.updates++
+
+	if (b.maxUpdates > 0 && b.updates >= b.maxUpdates) || (b.interval > 0 && time.Since(b.lastFlush) >= b.interval) {
+		b.flushLocked()
+	}
+}
+
+// flush reports all pending progress. It is a no-op for a nil receiver.
+func (b *progressBatch) flush() {
+	if b == nil {
+		return
+	}
+	b.m.Lock()
+	defer b.m.Unlock()
+	b.flushLocked()
+}
+
+func (b *progressBatch) flushLocked() {
+	for _, location := range b.order {
+		p := b.pending[location]
+		b.progress.AddProgress(location, p.action, p.bytes, p.total)
+		delete(b.pending, location)
+	}
+	b.order = b.order[:0]
+	b.updates = 0
+	b.lastFlush = time.Now()
+}
@@ -0,0 +1,79 @@
+package restorer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// countingProgress counts the calls of AddProgress.
+type countingProgress struct {
+	*testProgress
+	calls int
+}
+
+func (p *countingProgress) AddProgress(name string, action ItemAction, bytesWrittenPortion, bytesTotal uint64) {
+	p.calls++
+	p.testProgress.AddProgress(name, action, bytesWrittenPortion, bytesTotal)
+}
+
+func TestProgressBatch(t *testing.T) {
+	progress := &countingProgress{testProgress: newTestProgress()}
+	b := newProgressBatch(progress, 3, 0)
+
+	b.add("/foo", ActionFileRestored, 10, 30)
+	b.add("/foo", ActionFileRestored, 10, 30)
+	rtest.Equals(t, 0, progress.calls)
+	b.add("/bar", ActionFileRestored, 5, 5)
+	// both files are reported once the limit is reached
+	rtest.Equals(t, 2, progress.calls)
+	rtest.Equals(t, uint64(1), progress.s.FilesFinished)
+	rtest.Equals(t, uint64(25), progress.s.AllBytesWritten)
+
+	b.add("/foo", ActionFileRestored, 10, 30)
+	rtest.Equals(t, 2, progress.calls)
+	b.flush()
+	rtest.Equals(t, 3, progress.calls)
+	rtest.Equals(t, uint64(2), progress.s.FilesFinished)
+	rtest.Equals(t, uint64(35), progress.s.AllBytesWritten)
+
+	// flushing without pending progress reports nothing
+	b.flush()
+	rtest.Equals(t, 3, progress.calls)
+}
+
+func TestProgressInterval(t *testing.T) {
+	progress := &countingProgress{testProgress: newTestProgress()}
+	b := newProgressBatch(progress, 0, time.Millisecond)
+
+	b.add("/foo", ActionFileRestored, 10, 30)
+	time.Sleep(2 * time.Millisecond)
+	b.add("/foo", ActionFileRestored, 10, 30)
+	rtest.Equals(t, 1, progress.calls)
+	rtest.Equals(t, uint64(20), progress.s.AllBytesWritten)
+}
+
+func TestRestorerProgressBatch(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{DataParts: []string{"part-1\n", "part-2\n", "part-3\n"}},
+			"bar": File{Data: "content: bar\n"},
+			"baz": File{Data: ""},
+		},
+	}, noopGetGenericAttributes)
+
+	progress := &countingProgress{testProgress: newTestProgress()}
+	res := NewRestorer(repo, sn, Options{Progress: progress, ProgressBatch: 1000})
+	_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.OK(t, err)
+
+	// the totals are exact, although each file was reported once
+	rtest.Equals(t, 3, progress.calls)
+	rtest.Equals(t, uint64(3), progress.s.FilesFinished)
+	rtest.Equals(t, progress.s.AllBytesTotal, progress.s.AllBytesWritten)
+	rtest.Equals(t, 0, len(progress.progressInfoMap))
+}
@@ -0,0 +1,205 @@
+package restorer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// ProvenanceStorage specifies where the provenance of each restored file is
+// recorded, see Options.Provenance.
+type ProvenanceStorage int
+
+// Constants for the different provenance storages.
+const (
+	// ProvenanceStorageNone does not record the provenance.
+	ProvenanceStorageNone ProvenanceStorage = iota
+	// ProvenanceStorageXattr stores the provenance in the ProvenanceXattr extended
+	// attribute of each file. Filesystems without support for extended
+	// attributes are silently skipped.
+	ProvenanceStorageXattr
+	// ProvenanceStorageSidecar writes the provenance to a file next to each restored
+	// file, named after it with the ProvenanceSidecarSuffix appended.
+	ProvenanceStorageSidecar
+	// ProvenanceStorageManifest appends the provenance of all files to the file at
+	// Options.ProvenanceManifest, using one JSON object per line.
+	ProvenanceStorageManifest
+	ProvenanceStorageInvalid
+)
+
+// ProvenanceXattr is the extended attribute which contains the provenance of
+// a file for ProvenanceStorageXattr.
+const ProvenanceXattr = "user.restic.provenance"
+
+// ProvenanceSidecarSuffix is appended to the name of a file to get the name of
+// its sidecar file for ProvenanceStorageSidecar.
+const ProvenanceSidecarSuffix = ".restic-provenance"
+
+// Set implements the method needed for pflag command flag parsing.
+func (p *ProvenanceStorage) Set(s string) error {
+	switch s {
+	case "none":
+		*p = ProvenanceStorageNone
+	case "xattr":
+		*p = ProvenanceStorageXattr
+	case "sidecar":
+		*p = ProvenanceStorageSidecar
+	case "manifest":
+		*p = ProvenanceStorageManifest
+	default:
+		*p = ProvenanceStorageInvalid
+		return fmt.Errorf("invalid provenance storage %q, must be one of (none|xattr|sidecar|manifest)", s)
+	}
+
+	return nil
+}
+
+func (p *ProvenanceStorage) String() string {
+	switch *p {
+	case ProvenanceStorageNone:
+		return "none"
+	case ProvenanceStorageXattr:
+		return "xattr"
+	case ProvenanceStorageSidecar:
+		return "sidecar"
+	case ProvenanceStorageManifest:
+		return "manifest"
+	default:
+		return "invalid"
+	}
+}
+
+func (p *ProvenanceStorage) Type() string {
+	return "storage"
+}
+
+// Provenance describes where a restored file came from.
+type Provenance struct {
+	// Location is only set in the manifest.
+	Location   string    `json:"location,omitempty"`
+	Snapshot   string    `json:"snapshot"`
+	Repository string    `json:"repository"`
+	RestoredAt time.Time `json:"restored_at"`
+}
+
+// provenanceRecorder records the provenance of the files whose content was
+// restored completely. It is not safe for concurrent use, which is fine as
+// the completion hook is never called concurrently.
+type provenanceRecorder struct {
+	storage ProvenanceStorage
+	base    Provenance
+
+	manifest *os.File
+	w        *bufio.Writer
+	// files which receive the extended attribute once their metadata is
+	// restored, as that removes all unknown extended attributes
+	xattrs map[string]struct{}
+}
+
+func newProvenanceRecorder(storage ProvenanceStorage, manifest string, base Provenance) (*provenanceRecorder, error) {
+	p := &provenanceRecorder{storage: storage, base: base}
+	switch storage {
+	case ProvenanceStorageXattr:
+		p.xattrs = make(map[string]struct{})
+	case ProvenanceStorageManifest:
+		f, err := fs.OpenFile(manifest, fs.O_WRONLY|fs.O_CREATE|fs.O_APPEND, 0600)
+		if err != nil {
+			return nil, errors.Wrap(err, "open provenance manifest")
+		}
+		p.manifest = f
+		p.w = bufio.NewWriter(f)
+	}
+	return p, nil
+}
+
+// record stores the provenance of the file at location, which was restored
+// to target. Files restored into Options.TargetFiles are only recorded in the
+// manifest.
+func (p *provenanceRecorder) record(target, location string, isTargetFile bool) error {
+	switch p.storage {
+	case ProvenanceStorageXattr:
+		if !isTargetFile {
+			p.xattrs[location] = struct{}{}
+		}
+	case ProvenanceStorageSidecar:
+		if isTargetFile {
+			return nil
+		}
+		buf, err := json.Marshal(p.base)
+		if err != nil {
+			return err
+		}
+		f, err := fs.OpenFile(target+ProvenanceSidecarSuffix, fs.O_CREATE|fs.O_WRONLY|fs.O_TRUNC|fs.O_NOFOLLOW, 0600)
+		if err != nil {
+			return errors.Wrap(err, "write provenance")
+		}
+		_, err = f.Write(append(buf, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		return errors.Wrap(err, "write provenance")
+	case ProvenanceStorageManifest:
+		entry := p.base
+		entry.Location = location
+		buf, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = p.w.Write(append(buf, '\n'))
+		return errors.Wrap(err, "write provenance manifest")
+	}
+	return nil
+}
+
+// recordProvenance records the provenance of the file at location once its
+// content was restored completely. Errors are reported via Restorer.Error.
+func (res *Restorer) recordProvenance(target, location string) {
+	if res.provenance == nil || res.provenanceErr != nil {
+		return
+	}
+	_, isTargetFile := res.opts.TargetFiles[location]
+	if err := res.provenance.record(target, location, isTargetFile); err != nil {
+		res.provenanceErr = res.Error(location, err)
+	}
+}
+
+// node returns node with the provenance extended attribute, if it was
+// recorded for location.
+func (p *provenanceRecorder) node(node *data.Node, location string) *data.Node {
+	if p == nil || p.xattrs == nil {
+		return node
+	}
+	if _, ok := p.xattrs[location]; !ok {
+		return node
+	}
+	buf, err := json.Marshal(p.base)
+	if err != nil {
+		return node
+	}
+	n := *node
+	n.ExtendedAttributes = append(slices.Clip(node.ExtendedAttributes), data.ExtendedAttribute{
+		Name:  ProvenanceXattr,
+		Value: buf,
+	})
+	return &n
+}
+
+// Close flushes and closes the manifest.
+func (p *provenanceRecorder) Close() error {
+	if p == nil || p.manifest == nil {
+		return nil
+	}
+	err := p.w.Flush()
+	if cerr := p.manifest.Close(); err == nil {
+		err = cerr
+	}
+	p.manifest = nil
+	return err
+}
@@ -0,0 +1,100 @@
+package restorer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerProvenance(t *testing.T) {
+	repo := repository.TestRepository(t)
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file": File{Data: "content: file\n"},
+			}},
+			"empty": File{Data: ""},
+		},
+	}, noopGetGenericAttributes)
+	// only a loaded snapshot knows its ID
+	sn, err := data.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+
+	checkProvenance := func(t *testing.T, buf []byte, location string) {
+		t.Helper()
+		var p Provenance
+		rtest.OK(t, json.Unmarshal(buf, &p))
+		rtest.Equals(t, location, p.Location)
+		rtest.Equals(t, id.String(), p.Snapshot)
+		rtest.Equals(t, repo.Config().ID, p.Repository)
+		rtest.Assert(t, !p.RestoredAt.IsZero(), "missing restore time")
+	}
+
+	t.Run("sidecar", func(t *testing.T) {
+		tempdir := rtest.TempDir(t)
+		_, err := NewRestorer(repo, sn, Options{Provenance: ProvenanceStorageSidecar}).RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+		for _, name := range []string{"dir/file", "empty"} {
+			buf, err := os.ReadFile(filepath.Join(tempdir, filepath.FromSlash(name)+ProvenanceSidecarSuffix))
+			rtest.OK(t, err)
+			checkProvenance(t, buf, "")
+		}
+
+		// files which are already up to date are not recorded
+		rtest.OK(t, os.Remove(filepath.Join(tempdir, "empty"+ProvenanceSidecarSuffix)))
+		_, err = NewRestorer(repo, sn, Options{Provenance: ProvenanceStorageSidecar}).RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+		_, err = os.Lstat(filepath.Join(tempdir, "empty"+ProvenanceSidecarSuffix))
+		rtest.Assert(t, os.IsNotExist(err), "unexpected sidecar file, got %v", err)
+	})
+
+	t.Run("manifest", func(t *testing.T) {
+		manifest := filepath.Join(rtest.TempDir(t), "manifest")
+		_, err := NewRestorer(repo, sn, Options{Provenance: ProvenanceStorageManifest, ProvenanceManifest: manifest}).RestoreTo(context.TODO(), rtest.TempDir(t))
+		rtest.OK(t, err)
+		buf, err := os.ReadFile(manifest)
+		rtest.OK(t, err)
+		lines := bytes.Split(bytes.TrimSpace(buf), []byte("\n"))
+		rtest.Equals(t, 2, len(lines))
+		locations := make(map[string]struct{})
+		for _, line := range lines {
+			var p Provenance
+			rtest.OK(t, json.Unmarshal(line, &p))
+			locations[p.Location] = struct{}{}
+			checkProvenance(t, line, p.Location)
+		}
+		rtest.Equals(t, map[string]struct{}{
+			filepath.FromSlash("/dir/file"): {},
+			filepath.FromSlash("/empty"):    {},
+		}, locations)
+
+		// the manifest storage requires a manifest file
+		_, err = NewRestorer(repo, sn, Options{Provenance: ProvenanceStorageManifest}).RestoreTo(context.TODO(), rtest.TempDir(t))
+		rtest.Assert(t, err != nil, "expected error for missing manifest file")
+	})
+
+	t.Run("xattr", func(t *testing.T) {
+		tempdir := rtest.TempDir(t)
+		_, err := NewRestorer(repo, sn, Options{Provenance: ProvenanceStorageXattr}).RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+
+		meta, err := fs.NewLocal().OpenFile(filepath.Join(tempdir, "dir", "file"), fs.O_NOFOLLOW, true)
+		rtest.OK(t, err)
+		node, err := meta.ToNode(false, t.Logf)
+		rtest.OK(t, err)
+		rtest.OK(t, meta.Close())
+		if len(node.ExtendedAttributes) == 0 {
+			t.Skip("filesystem does not support extended attributes")
+		}
+		rtest.Equals(t, ProvenanceXattr, node.ExtendedAttributes[0].Name)
+		checkProvenance(t, node.ExtendedAttributes[0].Value, "")
+	})
+}
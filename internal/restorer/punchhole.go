@@ -0,0 +1,34 @@
+package restorer
+
+import (
+	"github.com/restic/restic/internal/debug"
+)
+
+// zeroRegion is a range of a file which only contains zeros.
+type zeroRegion struct {
+	offset int64
+	length int64
+}
+
+// punchHoles deallocates the zero regions of the file at path, such that an
+// existing sparse file stays sparse after its changed blobs were written. The
+// regions already contain zeros, thus filesystems without support for
+// punching holes are left as is.
+func (w *filesWriter) punchHoles(path string, holes []zeroRegion) error {
+	f, ok := w.targets[path]
+	if !ok {
+		var err error
+		if f, err = openFile(w.rootFor(path), path); err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+	}
+
+	for _, h := range holes {
+		if err := punchHole(f, h.offset, h.length); err != nil {
+			debug.Log("unable to punch hole into %v at %d with length %d: %v", path, h.offset, h.length, err)
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+
+package restorer
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// punchHole is not supported on this platform.
+func punchHole(_ *os.File, _, _ int64) error {
+	return errors.New("punching holes is not supported")
+}
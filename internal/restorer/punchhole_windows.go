@@ -0,0 +1,23 @@
+package restorer
+
+import (
+	"os"
+	"unsafe"
+
+	"github.com/restic/restic/internal/debug"
+	"golang.org/x/sys/windows"
+)
+
+// punchHole deallocates the given range of f without changing its size.
+func punchHole(f *os.File, offset, length int64) error {
+	// zeroing a range only deallocates it for sparse files
+	var t uint32
+	err := windows.DeviceIoControl(windows.Handle(f.Fd()), windows.FSCTL_SET_SPARSE, nil, 0, nil, 0, &t, nil)
+	if err != nil {
+		debug.Log("failed to set sparse attribute for %v: %v", f.Name(), err)
+	}
+
+	info := windows.FileZeroDataInformation{FileOffset: offset, BeyondFinalZero: offset + length}
+	return windows.DeviceIoControl(windows.Handle(f.Fd()), windows.FSCTL_SET_ZERO_DATA,
+		(*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)), nil, 0, &t, nil)
+}
@@ -0,0 +1,26 @@
+package restorer
+
+import (
+	"context"
+
+	"github.com/restic/restic/internal/data"
+)
+
+// quickCheckFile decides whether the existing file at target must be restored
+// based only on its size and mtime. A nil fileState restores the file from
+// scratch. The content is only read for files with matching size but
+// different mtime if Options.QuickCheckChecksum is set.
+func (res *Restorer) quickCheckFile(ctx context.Context, target string, node *data.Node, buf []byte) (*fileState, []byte) {
+	fi, err := res.listing.lstat(target)
+	if err != nil || !fi.Mode().IsRegular() || fi.Size() != int64(node.Size) {
+		return nil, buf
+	}
+	if fi.ModTime().Equal(node.ModTime) {
+		return &fileState{nil, true}, buf
+	}
+	if !res.opts.QuickCheckChecksum {
+		return nil, buf
+	}
+	matches, buf, _ := res.verifyFile(ctx, target, node, false, false, buf)
+	return matches, buf
+}
@@ -0,0 +1,84 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestoreQuickCheck(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			// modified, but size and mtime still match
+			"unchanged": File{Data: "content: unchanged\n", ModTime: modTime},
+			// same content, mtime differs
+			"touched": File{Data: "content: touched\n", ModTime: modTime},
+			// modified and mtime differs
+			"modified": File{Data: "content: modified\n", ModTime: modTime},
+			"resized":  File{Data: "content: resized\n", ModTime: modTime},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, test := range []struct {
+		name     string
+		checksum bool
+		skipped  uint64
+	}{
+		{"size and mtime", false, 1},
+		{"checksum", true, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir := filepath.Join(rtest.TempDir(t), "target")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			res := NewRestorer(repo, sn, Options{})
+			_, err := res.RestoreTo(ctx, tempdir)
+			rtest.OK(t, err)
+
+			for name, content := range map[string]string{
+				"unchanged": "content: Unchanged\n",
+				"modified":  "content: Modified\n",
+				"resized":   "content: resized!\n",
+			} {
+				rtest.OK(t, os.WriteFile(filepath.Join(tempdir, name), []byte(content), 0o600))
+			}
+			rtest.OK(t, os.Chtimes(filepath.Join(tempdir, "unchanged"), modTime, modTime))
+			for _, name := range []string{"touched", "modified", "resized"} {
+				rtest.OK(t, os.Chtimes(filepath.Join(tempdir, name), modTime, modTime.Add(time.Hour)))
+			}
+
+			progress := newTestProgress()
+			res = NewRestorer(repo, sn, Options{
+				Overwrite:          OverwriteQuickCheck,
+				QuickCheckChecksum: test.checksum,
+				Progress:           progress,
+			})
+			_, err = res.RestoreTo(ctx, tempdir)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.skipped, progress.s.FilesSkipped)
+
+			for name, content := range map[string]string{
+				"unchanged": "content: Unchanged\n",
+				"touched":   "content: touched\n",
+				"modified":  "content: modified\n",
+				"resized":   "content: resized\n",
+			} {
+				data, err := os.ReadFile(filepath.Join(tempdir, name))
+				rtest.OK(t, err)
+				rtest.Equals(t, content, string(data), "unexpected content of %v", name)
+
+				fi, err := os.Stat(filepath.Join(tempdir, name))
+				rtest.OK(t, err)
+				rtest.Assert(t, fi.ModTime().Equal(modTime), "unexpected mtime %v of %v", fi.ModTime(), name)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package restorer
+
+import (
+	"context"
+	"os"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// setWritePermission changes the write permission of an item in the target
+// directory. Items which were not restored, for example due to the size
+// quota, are ignored.
+func setWritePermission(target string, writable bool) error {
+	err := fs.SetWritePermission(target, writable)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// unlockReadOnly adds the write permission for the owner to all directories
+// of the snapshot which exist in the target directory, such that a tree that
+// was restored with Options.ReadOnly can be updated. Files are made writable
+// on demand when they are replaced. The metadata pass then restores the
+// original permissions from the snapshot.
+func (res *Restorer) unlockReadOnly(ctx context.Context, dst string) error {
+	debug.Log("%smaking directories in %q writable", res.logPrefix, dst)
+	return res.traverseTree(ctx, dst, *res.sn.Tree, treeVisitor{
+		enterDir: func(_ *data.Node, target, _ string) error {
+			return setWritePermission(target, true)
+		},
+		visitNode: func(_ *data.Node, _, _ string) error {
+			return nil
+		},
+	})
+}
+
+// makeReadOnly removes the write permissions from all restored items. It is
+// the final stage of the restore and must only run once the metadata of all
+// items has been restored. Directories are changed after their content,
+// thus the tree is modified deepest-first.
+func (res *Restorer) makeReadOnly(ctx context.Context, dst string) error {
+	debug.Log("%sfinal pass, making %q read-only", res.logPrefix, dst)
+	return res.traverseTree(ctx, dst, *res.sn.Tree, treeVisitor{
+		visitNode: func(_ *data.Node, target, _ string) error {
+			return setWritePermission(target, false)
+		},
+		leaveDir: func(_ *data.Node, target, _ string, _ []string) error {
+			return setWritePermission(target, false)
+		},
+	})
+}
@@ -0,0 +1,73 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerReadOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("directory permissions are not supported on Windows")
+	}
+
+	repo := repository.TestRepository(t)
+	snapshot := func(content string) Snapshot {
+		return Snapshot{
+			Nodes: map[string]Node{
+				"dir": Dir{Nodes: map[string]Node{
+					"file": File{Data: content, Mode: 0640},
+					"sub": Dir{Nodes: map[string]Node{
+						"file": File{Data: "sub\n"},
+					}, Mode: 0750},
+				}},
+				"link": Symlink{Target: "dir/file"},
+			},
+		}
+	}
+	tempdir := rtest.TempDir(t)
+	t.Cleanup(func() {
+		// allow removing the temporary directory
+		_ = filepath.Walk(tempdir, func(path string, _ os.FileInfo, _ error) error {
+			_ = setWritePermission(path, true)
+			return nil
+		})
+	})
+
+	checkModes := func(readOnly bool) {
+		for name, mode := range map[string]os.FileMode{
+			"":             0700,
+			"dir":          0755,
+			"dir/file":     0640,
+			"dir/sub":      0750,
+			"dir/sub/file": 0644,
+		} {
+			if readOnly {
+				mode &^= 0222
+			}
+			fi, err := os.Lstat(filepath.Join(tempdir, filepath.FromSlash(name)))
+			rtest.OK(t, err)
+			rtest.Equals(t, mode, fi.Mode().Perm(), name)
+		}
+	}
+
+	sn, _ := saveSnapshot(t, repo, snapshot("first\n"), noopGetGenericAttributes)
+	_, err := NewRestorer(repo, sn, Options{ReadOnly: true}).RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	checkModes(true)
+
+	// the tree can only be updated after undoing the read-only mode
+	sn, _ = saveSnapshot(t, repo, snapshot("second\n"), noopGetGenericAttributes)
+	_, err = NewRestorer(repo, sn, Options{UndoReadOnly: true}).RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	checkModes(false)
+
+	data, err := os.ReadFile(filepath.Join(tempdir, "dir", "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "second\n", string(data))
+}
@@ -0,0 +1,131 @@
+package restorer
+
+import (
+	"context"
+	"crypto/sha256"
+	"io"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// checkChunkerPolynomial verifies that existing files re-chunked using pol
+// are comparable to the blobs of a repository using repoPol. A zero pol
+// defaults to repoPol.
+func checkChunkerPolynomial(pol, repoPol chunker.Pol) error {
+	if pol == 0 {
+		return nil
+	}
+	if !pol.Irreducible() {
+		return errors.Fatalf("chunker polynomial %v is not irreducible", pol)
+	}
+	if pol != repoPol {
+		return errors.Fatalf("chunker polynomial %v does not match the polynomial %v of the repository, re-chunked files could never match its blobs", pol, repoPol)
+	}
+	return nil
+}
+
+// chunkFile splits the content read from rd into chunks using the content
+// defined chunker and returns the resulting blob IDs keyed by their offset.
+// buf is scratch space which is returned for reuse.
+func chunkFile(ctx context.Context, rd io.Reader, chnker restic.Chunker, buf []byte) (map[int64]restic.ID, []byte, error) {
+	if cap(buf) < 512*1024 {
+		buf = make([]byte, 512*1024)
+	}
+	buf = buf[:cap(buf)]
+
+	chnker.Reset()
+	chunks := make(map[int64]restic.ID)
+	h := sha256.New()
+	var start, pos int64
+
+	finishChunk := func() {
+		var id restic.ID
+		h.Sum(id[:0])
+		chunks[start] = id
+		h.Reset()
+		start = pos
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return nil, buf, ctx.Err()
+		}
+
+		n, err := io.ReadFull(rd, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, buf, err
+		}
+
+		data := buf[:n]
+		for len(data) > 0 {
+			split := chnker.NextSplitPoint(data)
+			if split == -1 {
+				_, _ = h.Write(data)
+				pos += int64(len(data))
+				break
+			}
+			_, _ = h.Write(data[:split])
+			pos += int64(split)
+			data = data[split:]
+			finishChunk()
+		}
+
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+	}
+
+	if pos > start {
+		finishChunk()
+	}
+	return chunks, buf, nil
+}
+
+// rechunkFile splits the existing file at target into chunks using the
+// repository's chunker and marks each blob of node as matching if the file
+// contains a chunk with the same ID at the same offset.
+//
+// buf and the first return value are scratch space, passed around for reuse.
+func (res *Restorer) rechunkFile(ctx context.Context, target string, node *data.Node, buf []byte) (*fileState, []byte, error) {
+	f, err := fs.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, buf, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, buf, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, buf, errors.Errorf("Expected %s to be a regular file", target)
+	}
+
+	chunks, buf, err := chunkFile(ctx, f, res.repo.ChunkerFactory().NewChunker(), buf)
+	if err != nil {
+		return nil, buf, err
+	}
+
+	matches := make([]bool, len(node.Content))
+	var offset int64
+	for i, blobID := range node.Content {
+		length, found := res.repo.LookupBlobSize(restic.BlobHandle{Type: restic.DataBlob, ID: blobID})
+		if !found {
+			return nil, buf, errors.Errorf("Unable to fetch blob %s", blobID)
+		}
+		id, ok := chunks[offset]
+		matches[i] = ok && id.Equal(blobID)
+		offset += int64(length)
+	}
+
+	return &fileState{matches, int64(node.Size) == fi.Size()}, buf, nil
+}
@@ -0,0 +1,110 @@
+package restorer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/restic/chunker"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestChunkFile(t *testing.T) {
+	repo := repository.TestRepository(t)
+	data := rtest.Random(23, 8*1024*1024)
+
+	chunks, _, err := chunkFile(context.TODO(), bytes.NewReader(data), repo.ChunkerFactory().NewChunker(), nil)
+	rtest.OK(t, err)
+	rtest.Assert(t, len(chunks) > 1, "expected multiple chunks, got %d", len(chunks))
+
+	offsets := make([]int64, 0, len(chunks))
+	for offset := range chunks {
+		offsets = append(offsets, offset)
+	}
+	slices.Sort(offsets)
+	rtest.Equals(t, int64(0), offsets[0])
+	for i, offset := range offsets {
+		end := int64(len(data))
+		if i+1 < len(offsets) {
+			end = offsets[i+1]
+		}
+		rtest.Equals(t, restic.Hash(data[offset:end]), chunks[offset])
+	}
+}
+
+func TestRestoreIfContentDiffers(t *testing.T) {
+	origData := "content: foo\n"
+	modData := "content: bar\n"
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"foo":       File{Data: origData},
+			"unchanged": File{Data: origData},
+		},
+	}
+
+	repo := repository.TestRepository(t)
+	tempdir := filepath.Join(rtest.TempDir(t), "target")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+	res := NewRestorer(repo, sn, Options{})
+	_, err := res.RestoreTo(ctx, tempdir)
+	rtest.OK(t, err)
+
+	path := filepath.Join(tempdir, "foo")
+	rtest.OK(t, os.WriteFile(path, []byte(modData), 0o600))
+
+	progress := newTestProgress()
+	res = NewRestorer(repo, sn, Options{Overwrite: OverwriteIfContentDiffers, Progress: progress})
+	_, err = res.RestoreTo(ctx, tempdir)
+	rtest.OK(t, err)
+
+	data, err := os.ReadFile(path)
+	rtest.OK(t, err)
+	rtest.Equals(t, origData, string(data))
+	rtest.Equals(t, uint64(1), progress.state().FilesSkipped)
+	rtest.Equals(t, uint64(len(origData)), progress.state().AllBytesWritten)
+}
+
+func TestRestoreChunkerPolynomial(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n"},
+		},
+	}, noopGetGenericAttributes)
+	pol := repo.Config().ChunkerPolynomial
+	otherPol, err := chunker.DerivePolynomial(bytes.NewReader(rtest.Random(42, 64*1024)))
+	rtest.OK(t, err)
+	rtest.Assert(t, otherPol != pol, "expected a different polynomial")
+
+	for _, test := range []struct {
+		pol chunker.Pol
+		err string
+	}{
+		{0, ""},
+		{pol, ""},
+		{pol + 1, "is not irreducible"},
+		{otherPol, "does not match"},
+	} {
+		t.Run(test.pol.String(), func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			res := NewRestorer(repo, sn, Options{Overwrite: OverwriteIfContentDiffers, ChunkerPolynomial: test.pol})
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			if test.err == "" {
+				rtest.OK(t, err)
+				return
+			}
+			rtest.Assert(t, err != nil && strings.Contains(err.Error(), test.err), "expected error containing %q, got %v", test.err, err)
+			_, err = os.Stat(filepath.Join(tempdir, "foo"))
+			rtest.Assert(t, os.IsNotExist(err), "expected no file to be restored, got %v", err)
+		})
+	}
+}
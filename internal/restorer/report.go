@@ -0,0 +1,206 @@
+package restorer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// ReportStatus is the status of a regular file in a RestoreReport.
+type ReportStatus string
+
+// Constants for the different ReportStatus values.
+const (
+	// ReportRestored is used for files which were created from scratch.
+	ReportRestored ReportStatus = "restored"
+	// ReportUpdated is used for existing files which were updated in place.
+	ReportUpdated ReportStatus = "updated"
+	// ReportSkipped is used for files whose content was not written, as it
+	// was already up to date, must not be overwritten or exceeded the size
+	// quota, or as the file was canceled.
+	ReportSkipped ReportStatus = "skipped"
+	// ReportFailed is used for files for which an error was reported.
+	ReportFailed ReportStatus = "failed"
+)
+
+// ReportVersion is the version of the RestoreReport format. It is only
+// increased for incompatible changes, new fields may be added at any time.
+const ReportVersion = 1
+
+// RestoreReport is written to Options.Report once the restore has completed.
+type RestoreReport struct {
+	Version  int       `json:"version"`
+	Snapshot string    `json:"snapshot_id,omitempty"`
+	Target   string    `json:"target"`
+	DryRun   bool      `json:"dry_run"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	// Files lists the regular files in the order of the snapshot. Hardlinks
+	// to an already listed file are not listed again.
+	Files []ReportFile `json:"files"`
+}
+
+// ReportFile is the entry of a regular file in a RestoreReport.
+type ReportFile struct {
+	Path   string       `json:"path"`
+	Status ReportStatus `json:"status"`
+	// Size is the size of the file in the snapshot.
+	Size uint64 `json:"size"`
+	// BytesWritten is the amount of file content which was written.
+	BytesWritten uint64 `json:"bytes_written"`
+	// Duration is the time from starting the first write of the file
+	// content until the last write completed, in seconds.
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+	// Reason is the reason why a skipped file was not restored.
+	Reason SkipReason `json:"reason,omitempty"`
+}
+
+type reportEntry struct {
+	ReportFile
+	started, finished time.Time
+}
+
+// restoreReport collects the entries of a RestoreReport. Its methods are
+// safe for concurrent use and do nothing for a nil report.
+type restoreReport struct {
+	m       sync.Mutex
+	entries []*reportEntry
+	byPath  map[string]*reportEntry
+}
+
+func newRestoreReport() *restoreReport {
+	return &restoreReport{byPath: make(map[string]*reportEntry)}
+}
+
+// add records the status of the file at location as determined while
+// collecting the files to restore. The reason is only used for skipped files.
+func (r *restoreReport) add(location string, status ReportStatus, size uint64, reason SkipReason) {
+	if r == nil {
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	if _, ok := r.byPath[location]; ok {
+		return
+	}
+	e := &reportEntry{ReportFile: ReportFile{Path: location, Status: status, Size: size}}
+	if status == ReportSkipped {
+		e.Reason = reason
+	}
+	r.entries = append(r.entries, e)
+	r.byPath[location] = e
+}
+
+// written records a write of size bytes to the file at location, which was
+// started at the given time.
+func (r *restoreReport) written(location string, size uint64, started time.Time) {
+	if r == nil {
+		return
+	}
+	now := time.Now()
+	r.m.Lock()
+	defer r.m.Unlock()
+	e, ok := r.byPath[location]
+	if !ok {
+		return
+	}
+	e.BytesWritten += size
+	if e.started.IsZero() || started.Before(e.started) {
+		e.started = started
+	}
+	e.finished = now
+}
+
+// skip marks the file at location as skipped for reason after planning to
+// restore it.
+func (r *restoreReport) skip(location string, reason SkipReason) {
+	if r == nil {
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	if e, ok := r.byPath[location]; ok && e.Status != ReportFailed {
+		e.Status = ReportSkipped
+		e.Reason = reason
+	}
+}
+
+// fail marks the file at location as failed. Errors for other items are
+// ignored. Only the first error of a file is kept.
+func (r *restoreReport) fail(location string, err error) {
+	if r == nil {
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	e, ok := r.byPath[location]
+	if !ok || e.Status == ReportFailed {
+		return
+	}
+	e.Status = ReportFailed
+	if err != nil {
+		e.Error = err.Error()
+	}
+}
+
+func (r *restoreReport) files() []ReportFile {
+	r.m.Lock()
+	defer r.m.Unlock()
+	files := make([]ReportFile, 0, len(r.entries))
+	for _, e := range r.entries {
+		file := e.ReportFile
+		if !e.started.IsZero() {
+			file.Duration = e.finished.Sub(e.started).Seconds()
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// writeReport writes the report for the restore into dst, which started at
+// the given time, to Options.Report. The report is written to a temporary
+// file first, such that an existing report is never replaced by a partial
+// one.
+func (res *Restorer) writeReport(dst string, started time.Time) error {
+	report := RestoreReport{
+		Version: ReportVersion,
+		Target:  dst,
+		DryRun:  res.opts.DryRun,
+		Start:   started,
+		End:     time.Now(),
+		Files:   res.report.files(),
+	}
+	if id := res.sn.ID(); id != nil {
+		report.Snapshot = id.String()
+	}
+
+	path := res.opts.Report
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "create report")
+	}
+	tmp := f.Name()
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(report)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = fs.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = fs.Remove(tmp)
+		return errors.Wrap(err, "write report")
+	}
+	return nil
+}
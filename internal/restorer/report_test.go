@@ -0,0 +1,96 @@
+package restorer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerReport(t *testing.T) {
+	repo := repository.TestRepository(t)
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"created":   File{Data: "content: created\n"},
+			"modified":  File{Data: "content: modified\n"},
+			"unchanged": File{Data: "content: unchanged\n"},
+			"vetoed":    File{Data: "content: vetoed\n"},
+		},
+	}, noopGetGenericAttributes)
+	sn, err := data.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	tempdir := rtest.TempDir(t)
+	rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "modified"), []byte("old"), 0600))
+	rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "unchanged"), []byte("content: unchanged\n"), 0600))
+	reportPath := filepath.Join(rtest.TempDir(t), "report.json")
+	rtest.OK(t, os.WriteFile(reportPath, []byte("old report"), 0600))
+
+	res := NewRestorer(repo, sn, Options{Report: reportPath})
+	res.ScanFile = func(location, _ string) error {
+		if location == "/vetoed" {
+			return errors.New("infected")
+		}
+		return nil
+	}
+	_, err = res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	buf, err := os.ReadFile(reportPath)
+	rtest.OK(t, err)
+	var report RestoreReport
+	rtest.OK(t, json.Unmarshal(buf, &report))
+	rtest.Equals(t, ReportVersion, report.Version)
+	rtest.Equals(t, id.String(), report.Snapshot)
+	rtest.Equals(t, tempdir, report.Target)
+	rtest.Assert(t, !report.End.Before(report.Start), "invalid start %v and end %v", report.Start, report.End)
+
+	for _, file := range report.Files {
+		rtest.Assert(t, file.Duration >= 0, "invalid duration %v for %v", file.Duration, file.Path)
+		file.Duration = 0
+		switch file.Path {
+		case "/created":
+			rtest.Equals(t, ReportFile{Path: file.Path, Status: ReportRestored, Size: 17, BytesWritten: 17}, file)
+		case "/modified":
+			rtest.Equals(t, ReportFile{Path: file.Path, Status: ReportUpdated, Size: 18, BytesWritten: 18}, file)
+		case "/unchanged":
+			rtest.Equals(t, ReportFile{Path: file.Path, Status: ReportSkipped, Size: 19, Reason: SkipUnchanged}, file)
+		case "/vetoed":
+			rtest.Equals(t, ReportFile{Path: file.Path, Status: ReportFailed, Size: 16, BytesWritten: 16, Error: "infected"}, file)
+		default:
+			t.Errorf("unexpected file %v", file.Path)
+		}
+	}
+	rtest.Equals(t, 4, len(report.Files))
+
+	// the temporary file was renamed
+	entries, err := os.ReadDir(filepath.Dir(reportPath))
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(entries))
+}
+
+func TestRestorerReportDryRun(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{Data: "content: file\n"},
+		},
+	}, noopGetGenericAttributes)
+	reportPath := filepath.Join(rtest.TempDir(t), "report.json")
+
+	res := NewRestorer(repo, sn, Options{DryRun: true, Report: reportPath})
+	_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.OK(t, err)
+
+	buf, err := os.ReadFile(reportPath)
+	rtest.OK(t, err)
+	var report RestoreReport
+	rtest.OK(t, json.Unmarshal(buf, &report))
+	rtest.Assert(t, report.DryRun, "missing dry run flag")
+	rtest.Equals(t, []ReportFile{{Path: "/file", Status: ReportRestored, Size: 14}}, report.Files)
+}
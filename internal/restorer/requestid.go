@@ -0,0 +1,29 @@
+package restorer
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx which carries the given request ID.
+// Restore operations using the returned context include the ID in their debug
+// log messages, which allows correlating the logs of concurrent restores.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx by WithRequestID or an empty
+// string if there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// logPrefix returns the prefix for debug log messages of restore operations
+// running with ctx.
+func logPrefix(ctx context.Context) string {
+	id := RequestID(ctx)
+	if id == "" {
+		return ""
+	}
+	return "[" + id + "] "
+}
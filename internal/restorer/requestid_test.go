@@ -0,0 +1,18 @@
+package restorer
+
+import (
+	"context"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRequestID(t *testing.T) {
+	ctx := context.Background()
+	rtest.Equals(t, "", RequestID(ctx))
+	rtest.Equals(t, "", logPrefix(ctx))
+
+	ctx = WithRequestID(ctx, "abc")
+	rtest.Equals(t, "abc", RequestID(ctx))
+	rtest.Equals(t, "[abc] ", logPrefix(ctx))
+}
@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync/atomic"
+	"time"
 
+	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
@@ -24,15 +28,110 @@ type Restorer struct {
 	opts Options
 
 	fileList map[string]bool
+	// prefix for debug log messages, see WithRequestID
+	logPrefix string
+	journal   *restoreJournal
+	patchBase *patchBase
+	delta     *snapshotDelta
+	// effective user id, used by the unprivileged mode
+	euid       int
+	downgrades []Downgrade
+	// files which were not restored as they exceed Options.SizeQuota
+	quotaSkipped []string
+	// files which were not restored as Options.OwnerFilter rejected them
+	ownerSkipped []string
+	estimate     *RestoreEstimate
+	metrics      *schedulerMetrics
+	planMemory   *PlanMemory
+	indexStats   *indexStats
+	seed         *seedIndex
+	// listings of the target directories, see Options.DirListingLimit
+	listing *dirListing
+	// owners of the target directories, see Options.DirOwnerPolicy
+	dirOwner *dirOwnerCheck
+	// file content progress, only tracked for Options.MaxDuration
+	content      *contentProgress
+	skippedBlobs uint64
+	skippedBytes uint64
+	compression  CompressionStats
+	dedup        DedupStats
+	blobCache    BlobCacheStats
+	packCheck    PackCheckStats
+	coalesce     CoalesceStats
+	// placeholder files created by Options.StructureOnly
+	placeholders     map[string]struct{}
+	placeholderBytes uint64
+	// files canceled using CancelFile
+	canceled      canceledFiles
+	canceledFiles []string
+	// priorities set using SetFilePriority
+	priorities filePriorities
+	// changes to the regular files, see Options.ReportChanges
+	changes []FileChange
+	// status of the regular files, see Options.Report
+	report *restoreReport
+	// files are not restored as sparse, see SparseFallback
+	sparseFallback bool
+	// probes the sparse file support, only replaced by tests
+	sparseProbe func(dir string) (bool, error)
+	// directories created as btrfs subvolumes
+	subvolumes            []string
+	subvolumesUnsupported bool
+	// names of the items restored directly into the target, see Options.Flatten
+	flatten *flatNames
+	// names of the items whose path is too long, see Options.LongPaths
+	longPaths *longPaths
+	// targets of the items mapped by Options.PathMap
+	mapped *mappedPaths
+	// partially recovered files, see Options.Salvage
+	salvaged []SalvagedFile
+	// files rejected by ScanFile
+	vetoed []VetoedFile
+	// entries created in sorted order, see Options.SortedEntries
+	sorted *sortedEntries
+	// records the origin of the restored files, see Options.Provenance
+	provenance    *provenanceRecorder
+	provenanceErr error
 
 	Error func(location string, err error) error
-	Warn  func(message string)
-	Info  func(message string)
+	// ErrorSink receives every error before it is passed to Error, which
+	// decides whether the restore is aborted. This allows logging or counting
+	// all errors independent of that decision. It may be called concurrently.
+	// May be nil.
+	ErrorSink func(location string, err error)
+	Warn      func(message string)
+	Info      func(message string)
+	// BlobSkipped is called for each blob which is not restored as the
+	// existing file already contains it at the given offset. May be nil.
+	BlobSkipped func(location string, offset int64, size uint)
+	// Event is called when the restore of an item progresses, see Event for
+	// the order in which events are sent. It is never called concurrently and
+	// not called for a dry run. May be nil.
+	Event func(event Event)
+	// FileCompleted is called once the content of a regular file has been
+	// restored completely, either as the files complete or in the order
+	// specified by Options.CompletionOrder. Its metadata is only restored
+	// afterwards. It is never called concurrently and blocks the restore of
+	// other files while running. May be nil.
+	FileCompleted func(location string)
+	// ScanFile is called once the content of a regular file has been
+	// restored completely, before FileCompleted is called and the metadata
+	// is restored. It can inspect the file at path, for example using a virus
+	// scanner. If it returns an error, the file is vetoed: it is removed or
+	// moved to Options.Quarantine and listed by VetoedFiles with the error
+	// as reason. Files restored into Options.TargetFiles are not scanned.
+	// It may be called concurrently and blocks the download of further
+	// content while running. May be nil.
+	ScanFile func(location, path string) error
 	// SelectFilter determines whether the item is selectedForRestore or whether a childMayBeSelected.
 	// selectedForRestore must not depend on isDir as `removeUnexpectedFiles` always passes false to isDir.
 	SelectFilter func(item string, isDir bool) (selectedForRestore bool, childMayBeSelected bool)
 
 	XattrSelectFilter func(xattrName string) (xattrSelectedForRestore bool)
+
+	// VerifyWritesFilter selects the regular files which are read back with
+	// Options.VerifyWrites. May be nil to check all files.
+	VerifyWritesFilter func(location string) bool
 }
 
 var restorerAbortOnAllErrors = func(_ string, err error) error { return err }
@@ -44,6 +143,383 @@ type Options struct {
 	Overwrite       OverwriteBehavior
 	Delete          bool
 	OwnershipByName bool
+	// IDMap translates the user and group IDs before they are applied, for
+	// example to restore into an idmapped mount or a user namespace. Nil
+	// applies the IDs unchanged.
+	IDMap *fs.IDMap
+	// DeleteAll allows Delete to remove all items of the target directory,
+	// which is otherwise refused with a DeleteAllError if none of them is
+	// contained in the snapshot. For a dry run, this is only a warning.
+	DeleteAll bool
+	// RootNode is the directory node of the snapshot tree which is restored,
+	// if only a subfolder of the snapshot is restored. Its metadata is
+	// restored to the target directory once all items have been restored.
+	RootNode *data.Node
+	// RechunkSizeLimit restricts OverwriteIfContentDiffers to files of at
+	// most the given size. Larger files use the same check as OverwriteAlways.
+	// Zero means no limit.
+	RechunkSizeLimit uint64
+	// ChunkerPolynomial is the polynomial expected to be used for
+	// re-chunking existing files with OverwriteIfContentDiffers. Only chunks
+	// created using the repository's polynomial can be compared to its blobs,
+	// thus RestoreTo fails if both differ. Zero uses the repository's
+	// polynomial.
+	ChunkerPolynomial chunker.Pol
+	// Journal is the path of a file which records the already restored file
+	// content. If a restore is interrupted, the next restore using the same
+	// journal skips the recorded parts of a file without verifying them. The
+	// journal is deleted once the restore has completed successfully. It must
+	// not be located within the target directory.
+	Journal string
+	// Deadline stops restoring file content after the given duration.
+	// Packs which are already being downloaded are completed, afterwards a
+	// DeadlineExceededError lists all files which were not completely
+	// restored. Zero means no deadline.
+	Deadline time.Duration
+	// DeadlineGracePeriod limits how long to wait for in-progress packs once
+	// the deadline has passed. Zero means waiting until all are completed.
+	DeadlineGracePeriod time.Duration
+	// MaxDuration cancels the whole restore once it has run for the given
+	// duration. Unlike Deadline, in-progress downloads are aborted and a
+	// MaxDurationExceededError is returned. Zero means no limit.
+	MaxDuration time.Duration
+	// OutageRetries restarts the whole restore up to the given number of
+	// times if downloading packs failed for all connections to the backend
+	// in a row, which indicates a backend outage rather than damaged data.
+	// Each restart is reported via Restorer.Info. Progress counts the
+	// restarted work again, combine it with Journal or an Overwrite mode
+	// which verifies existing files to skip the already restored content.
+	// Only the download of file content is monitored, errors while loading
+	// trees are returned as usual. Zero disables restarts.
+	OutageRetries int
+	// OutageBackoff is the wait before the first restart, it is doubled for
+	// each further restart. Zero defaults to one minute.
+	OutageBackoff time.Duration
+	// DecodeWorkers decrypts and decompresses the downloaded pack files in a
+	// separate pool of the given number of workers, such that the download
+	// workers do not wait for the CPU-bound decoding. It is only used if the
+	// repository implements restic.PackSectionsLoader. Zero decodes the
+	// blobs within the download workers.
+	DecodeWorkers int
+	// WatchdogThreshold writes the stacks of all goroutines and the packs
+	// being downloaded to WatchdogOutput if no file content was written for
+	// the given duration, which helps diagnosing a deadlock. Each stall is
+	// reported once. Zero disables the watchdog.
+	WatchdogThreshold time.Duration
+	// WatchdogOutput receives the dumps of the watchdog, os.Stderr if nil.
+	// The restore does not wait for a blocking writer.
+	WatchdogOutput io.Writer
+	// WatchdogAbort cancels the restore after the first dump of the watchdog
+	// and returns a StalledError.
+	WatchdogAbort bool
+	// MinFreeSpace pauses downloading further packs while the free space in
+	// the target directory is below the given number of bytes, until enough
+	// space was freed. The pauses are reported via Restorer.Info. Zero
+	// disables the monitoring, which is only supported on Linux.
+	MinFreeSpace uint64
+	// FreeSpaceInterval is how often the free space is checked for
+	// MinFreeSpace. Zero uses a default of 10 seconds.
+	FreeSpaceInterval time.Duration
+	// Provenance records the snapshot ID, repository ID and restore time for
+	// each file whose content was restored. Files which were already up to
+	// date are not recorded.
+	Provenance ProvenanceStorage
+	// ProvenanceManifest is the file to which ProvenanceStorageManifest appends the
+	// provenance of all restored files.
+	ProvenanceManifest string
+	// ProbeTargets makes a dry run check that files can be created in all
+	// directories into which the restore writes, by creating and removing a
+	// file in each. All directories for which this fails are reported
+	// together by an InaccessibleDirsError.
+	ProbeTargets bool
+	// LongPaths specifies how to restore items whose name or whole path
+	// exceeds the limits of the target platform, see Restorer.LongPaths for
+	// the affected items. On Windows, long paths are already supported up to
+	// about 32767 characters. This cannot be combined with Flatten or
+	// DeltaBase.
+	LongPaths LongPathBehavior
+	// VerifyWrites reads back each blob right after writing it and reports a
+	// WriteMismatchError for the file if the data differs. Only the files
+	// selected by Restorer.VerifyWritesFilter are checked. As the data is
+	// usually returned from the page cache, this detects corruption in the
+	// write path rather than on the disk itself. It is expensive and cannot
+	// be combined with Encryption.
+	VerifyWrites bool
+	// Quarantine is the directory to which files vetoed by
+	// Restorer.ScanFile are moved, below their location in the snapshot.
+	// It must not be located within the target directory. If empty, vetoed
+	// files are removed.
+	Quarantine string
+	// DedupeFiles restores only the first of several files with the same
+	// location without reporting an error. Such duplicates only exist in
+	// damaged snapshots, whose trees contain the same name multiple times.
+	DedupeFiles bool
+	// Immutable specifies how to handle existing files which have the
+	// immutable or append-only attribute.
+	Immutable ImmutableBehavior
+	// PatchBase is the snapshot from which the existing files in the target
+	// directory were restored. Instead of reading existing files, only the
+	// blobs which differ between both snapshots are restored. Files whose
+	// size does not match the base snapshot are checked as usual.
+	PatchBase *data.Snapshot
+	// StructureOnly restores the directory structure without downloading any
+	// file content. Instead of regular files, empty placeholders are created,
+	// which carry the PlaceholderXattr extended attribute if supported by
+	// the filesystem. Existing files are checked as specified by Overwrite.
+	StructureOnly bool
+	// SequentialFiles restores the file content in batches of the given
+	// number of files, in the order of the snapshot. All files of a batch are
+	// complete before the next one is started. This requires downloading packs
+	// which are shared between batches multiple times. Zero restores all files
+	// at once.
+	SequentialFiles int
+	// SizeQuota limits the total size of restored file content. Files are
+	// restored in order of their modification time, newest first. Once a file
+	// no longer fits into the quota, it and all older files are skipped, see
+	// Restorer.QuotaSkippedFiles. Zero means no quota.
+	SizeQuota uint64
+	// OwnerFilter only restores the files whose owner stored in the snapshot
+	// is selected by the filter. Other files are skipped, see
+	// Restorer.OwnerSkippedFiles. Directories and other items are restored
+	// regardless of their owner. Nil restores all files.
+	OwnerFilter *OwnerFilter
+	// SlowFileThreshold reports all files whose content takes longer than the
+	// threshold to restore, measured from writing the first to writing the last
+	// blob, via Restorer.Info. Zero disables the reporting.
+	SlowFileThreshold time.Duration
+	// Encryption writes the content of regular files in encrypted form, see
+	// ContentEncryption. It cannot be combined with Journal or PatchBase.
+	Encryption *ContentEncryption
+	// EstimateSamples is the number of packs to download during a dry run to
+	// estimate the restore duration, see Restorer.Estimate. Zero disables the
+	// estimate.
+	EstimateSamples int
+	// BlobCacheSize keeps up to this many bytes of recently downloaded blobs
+	// in memory, such that blobs which are required again are not downloaded
+	// once more, see Restorer.BlobCache. Zero disables the cache.
+	BlobCacheSize int
+	// SampleCache keeps the packs downloaded for the estimate. Pass the same
+	// cache to the restore following the dry run to reuse them.
+	SampleCache *SampleCache
+	// Scheduler decides in which order the packs are downloaded. Nil uses a
+	// FirstAccessScheduler. Priorities set using Restorer.SetFilePriority
+	// while restoring are only applied by a PriorityScheduler.
+	Scheduler Scheduler
+	// PackGate, if set, is consulted before each pack is downloaded and can
+	// defer or reject the download.
+	PackGate PackGate
+	// SortWrites writes the blobs of each pack ordered by file and offset
+	// once the pack was loaded, instead of in the order in which they are
+	// stored in the pack. This results in more sequential writes, which
+	// reduces seeking on hard disks if the files are laid out next to each
+	// other. The blobs of a pack are kept in memory until they are written.
+	SortWrites bool
+	// Tracer, if set, traces the phases of the restore, the download of each
+	// pack and the writes of each file, see SpanRestore and related constants.
+	Tracer Tracer
+	// SchedulerMetrics collects metrics on how busy the download workers
+	// were, see Restorer.SchedulerMetrics.
+	SchedulerMetrics bool
+	// PlanMemory estimates the peak memory used for planning the download
+	// of the file content, see Restorer.PlanMemory.
+	PlanMemory bool
+	// IndexLookupStats counts and times the index lookups while restoring
+	// the file content, see Restorer.IndexLookups.
+	IndexLookupStats bool
+	// DirListingLimit lists each target directory once to check which files
+	// already exist, instead of checking each file individually. For
+	// directories with many new files, this requires far fewer system calls.
+	// Directories with more than the given number of entries are checked per
+	// file, which limits the memory usage. Zero disables the listing.
+	DirListingLimit int
+	// ProgressBatch coalesces the progress updates for the written file
+	// content and passes them to Progress once the given number of updates
+	// has accumulated, which reduces the overhead for snapshots with many
+	// small files. The updates of a file are summed up, thus the completion of
+	// a file may be reported late, but all totals are exact once the file
+	// content is restored. Zero means no limit.
+	ProgressBatch int
+	// ProgressInterval is like ProgressBatch, but passes the coalesced
+	// updates to Progress once the given duration has passed since the last
+	// ones. Both limits can be combined. Zero means no limit.
+	ProgressInterval time.Duration
+	// DirOwnerPolicy verifies the owner of the parent directory before a
+	// regular file is written into it, to avoid restoring files into a
+	// directory controlled by another user. Directories owned by root, by
+	// the user running the restore or by the user stored in the snapshot
+	// (translated using IDMap) are accepted. The check is not available on
+	// Windows.
+	DirOwnerPolicy DirOwnerPolicy
+	// CheckMissingBlobs verifies that all blobs required to restore the file
+	// contents are contained in the index before writing any file content. If
+	// blobs are missing, a MissingBlobsError listing all of them is returned.
+	CheckMissingBlobs bool
+	// Unprivileged skips items which can only be restored with elevated
+	// privileges, like device nodes, and strips setuid and setgid bits from
+	// files owned by other users. All such items are reported by
+	// Restorer.Downgrades.
+	Unprivileged bool
+	// Umask removes the given permission bits from the mode of all restored
+	// items when restoring their metadata, like the umask of a process does
+	// for newly created files. Files and directories are created with
+	// permissions only for the owner and receive their final mode in the
+	// metadata pass. Zero restores the permissions from the snapshot as is.
+	Umask os.FileMode
+	// SkipInodeCheck disables the check that the target filesystem has
+	// enough free inodes for all files which must be created.
+	SkipInodeCheck bool
+	// WriteAlignment coalesces the blobs of newly created files into writes
+	// of the given number of bytes, at offsets which are a multiple of it.
+	// Only the last write of a file may be shorter. Blobs are buffered in
+	// memory until their block is complete. Existing and sparse files are
+	// written blob by blob. It cannot be combined with Journal or Encryption.
+	// Zero writes each blob separately.
+	WriteAlignment int64
+	// Subvolumes lists the directories, as locations within the snapshot,
+	// which are created as btrfs subvolumes before restoring their content.
+	// Existing directories are not converted. If the target filesystem does
+	// not support subvolumes, they are restored as regular directories.
+	Subvolumes []string
+	// ReportChanges records for each regular file whether it is created,
+	// modified or left unchanged, see Restorer.Changes.
+	ReportChanges bool
+	// Report is the path of a file to which a RestoreReport listing the
+	// status of every regular file is written once the restore has
+	// completed. The file is replaced atomically. Empty disables the report.
+	Report string
+	// DirCreateLimit limits the number of files which are created
+	// concurrently in the same directory. This can reduce the contention on
+	// the directory lock of some filesystems. Zero means no limit.
+	DirCreateLimit int
+	// SortedEntries creates the entries of each directory in the order of
+	// their names, independent of the order in which the file content is
+	// downloaded. New files are created empty while traversing the snapshot
+	// and their content is written concurrently afterwards. Hardlinks and
+	// special files are created in order as well. This slows down restores
+	// of many small files. Cannot be combined with Flatten.
+	SortedEntries bool
+	// SparseUnsupported specifies how to handle a target filesystem which
+	// does not support sparse files, which is detected using a probe file in
+	// the target directory. Only used with Sparse.
+	SparseUnsupported SparseUnsupportedBehavior
+	// SparseHoleThreshold additionally skips runs of at least this many zero
+	// bytes within the blobs of sparse files, instead of only blobs which
+	// consist of zeros entirely. This costs some CPU time for scanning the
+	// file content. It requires Sparse, zero disables the check.
+	SparseHoleThreshold int
+	// ReadOnly removes the write permissions from all restored items once
+	// the restore, including their metadata, has completed successfully.
+	// This is not atomic, an interrupted restore leaves a partially
+	// read-only tree. It cannot be combined with Flatten.
+	ReadOnly bool
+	// UndoReadOnly makes the directories of a tree which was restored with
+	// ReadOnly writable again before restoring. The permissions of all items
+	// are then restored from the snapshot, unless ReadOnly is also set.
+	UndoReadOnly bool
+	// Flatten restores all items except directories directly into the target
+	// directory. Their names are derived from their location by replacing
+	// the path separators with underscores, such that "/dir/sub/file" is
+	// restored as "dir_sub_file". The directory structure and the metadata of
+	// directories is lost. FlattenCollision specifies how to handle names
+	// which are already used by a previous item. This cannot be combined with
+	// Delete or Subvolumes.
+	Flatten          bool
+	FlattenCollision FlattenCollisionBehavior
+	// ConflictResolver decides the names of items which cannot be restored
+	// under their desired name, instead of FlattenCollision and LongPaths.
+	// If it is set, too long names are passed to it unless Flatten or
+	// DeltaBase is set.
+	ConflictResolver ConflictResolver
+	// CompletionOrder is the order in which the completed files are passed
+	// to Restorer.FileCompleted, for example SnapshotOrder. Files which
+	// complete early are kept in a buffer until all previous files are
+	// complete. Files which could not be restored are skipped once all other
+	// files of the batch are complete. Nil passes the files as they complete.
+	CompletionOrder func(a, b string) int
+	// CompletionBuffer bounds the number of buffered files for
+	// CompletionOrder. The files are then restored in batches of the given
+	// number of files like with SequentialFiles, which requires downloading
+	// packs shared between batches multiple times. Zero means no bound, then
+	// the buffer can contain an entry for each restored file.
+	CompletionBuffer int
+	// DeltaBase is a snapshot whose restore the target directory contains.
+	// Only the items which were created or changed since DeltaBase are
+	// restored, unchanged directories are skipped without comparing their
+	// content. The content of changed files is patched like with PatchBase.
+	// See Restorer.Delta for the differences. This cannot be combined with
+	// PatchBase or Flatten.
+	DeltaBase *data.Snapshot
+	// DeltaDelete removes the items which were deleted since DeltaBase from
+	// the target directory before restoring the changed items. This also
+	// applies to items whose type changed.
+	DeltaDelete bool
+	// TargetFiles restores the content of the regular files at the given
+	// locations into already open files instead of creating them below the
+	// target directory, for example into a file descriptor inherited from the
+	// parent process. As blobs are written out of order, the files must be
+	// opened for writing and be seekable. Regular files are truncated before
+	// writing the content, other files like block devices are overwritten
+	// in place. The metadata of these files is not restored and they are not
+	// verified by VerifyFiles, hard links to them are restored as separate
+	// files. This cannot be combined with Journal.
+	TargetFiles map[string]*os.File
+	// Salvage continues restoring a file if some of its blobs cannot be
+	// loaded, for example as they are damaged. The affected ranges are filled
+	// with zeros and listed in a report next to the file, whose name has the
+	// SalvageReportSuffix appended, see Restorer.SalvagedFiles. These blobs
+	// are not reported to Restorer.Error, but damaged blobs still result in a
+	// CorruptBlobsError. Errors downloading a whole pack are not affected.
+	Salvage bool
+	// AlternatePacks loads blobs whose data is damaged from another pack, if
+	// the index lists more than one pack for them, for example after a
+	// repack without a subsequent prune. Only if no intact copy exists, the
+	// blob is handled like without this option.
+	AlternatePacks bool
+	// CoalescePacks loads blobs for which the index lists more than one pack
+	// from a pack which is downloaded anyway for other blobs, instead of
+	// always using the first listed pack. This reduces the number of
+	// downloaded packs if many blobs were repacked, see Restorer.Coalesce.
+	CoalescePacks bool
+	// CacheAdvice is passed to the operating system for the restored files.
+	CacheAdvice CacheAdvice
+	// VerifyPacks loads and checks all blobs of each downloaded pack, not
+	// only those required to restore the files, see Restorer.PackCheck.
+	// Damaged blobs are recorded like damaged blobs which are required and
+	// result in a CorruptBlobsError. This turns the restore into a check of
+	// the downloaded packs, but can download considerably more data.
+	VerifyPacks bool
+	// QuickCheckChecksum makes OverwriteQuickCheck verify the content of
+	// existing files whose size matches but whose mtime differs, instead of
+	// restoring them from scratch.
+	QuickCheckChecksum bool
+	// PreviewPatch writes the changes of the regular files to the given
+	// writer as a patch, see PreviewPatchMagic for its format, instead of
+	// applying them. Existing files are compared as specified by Overwrite,
+	// only the differing blobs are contained in the patch. It requires
+	// DryRun and cannot be combined with Encryption or EstimateSamples.
+	// Restorer.ScanFile is not called for the files in the patch.
+	PreviewPatch io.Writer
+	// PathMap restores the regular files and other non-directory items
+	// matching one of its mappings to the target of that mapping, for example
+	// to restore configuration files to their original locations. Parent
+	// directories of the targets are created as necessary, but their metadata
+	// is not restored. If several items are mapped to the same target, only
+	// the first one is restored and the others are reported via
+	// Restorer.Error. Items without a matching mapping are restored below the
+	// target directory as usual. Unlike the target directory, targets outside
+	// of it are not protected against symlinks redirecting the writes. This
+	// cannot be combined with Flatten.
+	PathMap *PathMap
+	// Seed is a local directory which contains files similar to those being
+	// restored, for example an older copy of the restored tree. Its files are
+	// split into chunks using the repository's chunker and blobs contained in
+	// them are copied from the seed files instead of downloading them. The
+	// seed directory is not modified. Blobs whose seed file has changed since
+	// it was indexed are downloaded as usual, see Restorer.Seed.
+	Seed string
+	// SeedIndex is a file which stores the index of Seed. If it exists, the
+	// seed directory is not scanned again, otherwise the index is saved to it.
+	SeedIndex string
 }
 
 type OverwriteBehavior int
@@ -56,6 +532,20 @@ const (
 	OverwriteIfChanged
 	OverwriteIfNewer
 	OverwriteNever
+	// OverwriteIfContentDiffers is like OverwriteAlways except that the existing file
+	// is split into chunks using the repository chunker parameters. Only blobs
+	// which are not part of the resulting chunk list are restored.
+	OverwriteIfContentDiffers
+	// OverwriteQuickCheck only compares the size and mtime of existing files, like
+	// rsync. Files with matching size&mtime are skipped, all other files are
+	// restored from scratch without reading their content, unless
+	// Options.QuickCheckChecksum is set. Metadata is always restored.
+	OverwriteQuickCheck
+	// OverwriteIfNewerAndChanged combines OverwriteIfNewer and OverwriteAlways.
+	// Existing files whose mtime is not older than that of the snapshot are
+	// skipped without reading them. Of the other files, only the blobs which
+	// differ from the existing content are restored.
+	OverwriteIfNewerAndChanged
 	OverwriteInvalid
 )
 
@@ -70,9 +560,15 @@ func (c *OverwriteBehavior) Set(s string) error {
 		*c = OverwriteIfNewer
 	case "never":
 		*c = OverwriteNever
+	case "if-content-differs":
+		*c = OverwriteIfContentDiffers
+	case "quick-check":
+		*c = OverwriteQuickCheck
+	case "if-newer-and-changed":
+		*c = OverwriteIfNewerAndChanged
 	default:
 		*c = OverwriteInvalid
-		return fmt.Errorf("invalid overwrite behavior %q, must be one of (always|if-changed|if-newer|never)", s)
+		return fmt.Errorf("invalid overwrite behavior %q, must be one of (always|if-changed|if-newer|never|if-content-differs|quick-check|if-newer-and-changed)", s)
 	}
 
 	return nil
@@ -88,6 +584,12 @@ func (c *OverwriteBehavior) String() string {
 		return "if-newer"
 	case OverwriteNever:
 		return "never"
+	case OverwriteIfContentDiffers:
+		return "if-content-differs"
+	case OverwriteQuickCheck:
+		return "quick-check"
+	case OverwriteIfNewerAndChanged:
+		return "if-newer-and-changed"
 	default:
 		return "invalid"
 	}
@@ -107,7 +609,9 @@ func NewRestorer(repo restic.Repository, sn *data.Snapshot, opts Options) *Resto
 		Error:             restorerAbortOnAllErrors,
 		SelectFilter:      func(string, bool) (bool, bool) { return true, true },
 		XattrSelectFilter: func(string) bool { return true },
+		Warn:              func(string) {},
 		sn:                sn,
+		euid:              os.Geteuid(),
 	}
 
 	return r
@@ -154,10 +658,10 @@ func (res *Restorer) traverseTree(ctx context.Context, target string, treeID res
 }
 
 func (res *Restorer) traverseTreeInner(ctx context.Context, target, location string, treeID restic.ID, visitor treeVisitor) (filenames []string, hasRestored bool, err error) {
-	debug.Log("%v %v %v", target, location, treeID)
+	debug.Log("%s%v %v %v", res.logPrefix, target, location, treeID)
 	tree, err := data.LoadTree(ctx, res.repo, treeID)
 	if err != nil {
-		debug.Log("error loading tree %v: %v", treeID, err)
+		debug.Log("%serror loading tree %v: %v", res.logPrefix, treeID, err)
 		return nil, hasRestored, res.sanitizeError(location, err)
 	}
 
@@ -166,7 +670,7 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 	}
 	for item := range tree {
 		if item.Error != nil {
-			debug.Log("error iterating tree %v: %v", treeID, item.Error)
+			debug.Log("%serror iterating tree %v: %v", res.logPrefix, treeID, item.Error)
 			return nil, hasRestored, res.sanitizeError(location, item.Error)
 		}
 		node := item.Node
@@ -184,7 +688,7 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 		// top-level directory.
 		nodeName := filepath.Base(filepath.Join(string(filepath.Separator), node.Name))
 		if nodeName != node.Name {
-			debug.Log("node %q has invalid name %q", node.Name, nodeName)
+			debug.Log("%snode %q has invalid name %q", res.logPrefix, node.Name, nodeName)
 			err := res.sanitizeError(location, errors.Errorf("invalid child node name %s", node.Name))
 			if err != nil {
 				return nil, hasRestored, err
@@ -198,8 +702,8 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 		nodeLocation := filepath.Join(location, nodeName)
 
 		if target == nodeTarget || !fs.HasPathPrefix(target, nodeTarget) {
-			debug.Log("target: %v %v", target, nodeTarget)
-			debug.Log("node %q has invalid target path %q", node.Name, nodeTarget)
+			debug.Log("%starget: %v %v", res.logPrefix, target, nodeTarget)
+			debug.Log("%snode %q has invalid target path %q", res.logPrefix, node.Name, nodeTarget)
 			err := res.sanitizeError(nodeLocation, errors.New("node has invalid path"))
 			if err != nil {
 				return nil, hasRestored, err
@@ -209,13 +713,29 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 			continue
 		}
 
-		// sockets cannot be restored
-		if node.Type == data.NodeTypeSocket {
-			continue
-		}
-
 		selectedForRestore, childMayBeSelected := res.SelectFilter(nodeLocation, node.Type == data.NodeTypeDir)
-		debug.Log("SelectFilter returned %v %v for %q", selectedForRestore, childMayBeSelected, nodeLocation)
+		selectedForRestore, childMayBeSelected = res.delta.filter(nodeLocation, selectedForRestore, childMayBeSelected)
+		debug.Log("%sSelectFilter returned %v %v for %q", res.logPrefix, selectedForRestore, childMayBeSelected, nodeLocation)
+
+		if res.longPaths != nil && (selectedForRestore || childMayBeSelected) {
+			name, ok, err := res.longPaths.name(target, nodeLocation, nodeName)
+			if err != nil {
+				if err := res.sanitizeError(nodeLocation, err); err != nil {
+					return nil, hasRestored, err
+				}
+			}
+			if !ok {
+				debug.Log("%sskipping %q, its path is too long", res.logPrefix, nodeLocation)
+				continue
+			}
+			if name != nodeName {
+				nodeTarget = filepath.Join(target, name)
+				if res.opts.Delete {
+					// the item exists under its shortened name
+					filenames[len(filenames)-1] = name
+				}
+			}
+		}
 
 		if selectedForRestore {
 			hasRestored = true
@@ -226,7 +746,8 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 				return nil, hasRestored, errors.Errorf("Dir without subtree in tree %v", treeID.Str())
 			}
 
-			if selectedForRestore && visitor.enterDir != nil {
+			// the directories of a flattened tree are not restored
+			if selectedForRestore && visitor.enterDir != nil && res.flatten == nil {
 				err = res.sanitizeError(nodeLocation, visitor.enterDir(node, nodeTarget, nodeLocation))
 				if err != nil {
 					return nil, hasRestored, err
@@ -252,7 +773,7 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 
 			// metadata need to be restore when leaving the directory in both cases
 			// selected for restore or any child of any subtree have been restored
-			if (selectedForRestore || childHasRestored) && visitor.leaveDir != nil {
+			if (selectedForRestore || childHasRestored) && visitor.leaveDir != nil && res.flatten == nil {
 				err = res.sanitizeError(nodeLocation, visitor.leaveDir(node, nodeTarget, nodeLocation, childFilenames))
 				if err != nil {
 					return nil, hasRestored, err
@@ -262,6 +783,31 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 			continue
 		}
 
+		if selectedForRestore && res.flatten != nil {
+			nodeTarget, err = res.flatten.target(nodeLocation)
+			if err != nil || nodeTarget == "" {
+				err = res.sanitizeError(nodeLocation, err)
+				if err != nil {
+					return nil, hasRestored, err
+				}
+				continue
+			}
+		}
+
+		if selectedForRestore && res.mapped != nil {
+			mappedTarget, ok, err := res.mapped.target(nodeLocation)
+			if err != nil || (ok && mappedTarget == "") {
+				err = res.sanitizeError(nodeLocation, err)
+				if err != nil {
+					return nil, hasRestored, err
+				}
+				continue
+			}
+			if ok {
+				nodeTarget = mappedTarget
+			}
+		}
+
 		if selectedForRestore {
 			err = res.sanitizeError(nodeLocation, visitor.visitNode(node, nodeTarget, nodeLocation))
 			if err != nil {
@@ -274,31 +820,53 @@ func (res *Restorer) traverseTreeInner(ctx context.Context, target, location str
 }
 
 func (res *Restorer) restoreNodeTo(node *data.Node, target, location string) error {
+	if res.requiresPrivileges(node) {
+		res.addDowngrade(location, "skipped, creating "+string(node.Type)+" nodes requires root privileges")
+		return nil
+	}
+
 	if !res.opts.DryRun {
-		debug.Log("restoreNode %v %v %v", node.Name, target, location)
+		debug.Log("%srestoreNode %v %v %v", res.logPrefix, node.Name, target, location)
 		if err := fs.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
 			return errors.Wrap(err, "RemoveNode")
 		}
 
 		err := fs.NodeCreateAt(node, target)
+		if errors.Is(err, fs.ErrSocketUnsupported) {
+			res.Warn(fmt.Sprintf("%v: socket not restored: %v", location, err))
+			return nil
+		}
 		if err != nil {
-			debug.Log("node.CreateAt(%s) error %v", target, err)
+			debug.Log("%snode.CreateAt(%s) error %v", res.logPrefix, target, err)
 			return err
 		}
 	}
 
 	res.opts.Progress.AddProgress(location, ActionOtherRestored, 0, 0)
-	return res.restoreNodeMetadataTo(node, target, location)
+	if err := res.restoreNodeMetadataTo(node, target, location); err != nil {
+		return err
+	}
+	res.sendEvent(EventCompleted, location)
+	return nil
 }
 
 func (res *Restorer) restoreNodeMetadataTo(node *data.Node, target, location string) error {
 	if res.opts.DryRun {
 		return nil
 	}
-	debug.Log("restoreNodeMetadata %v %v %v", node.Name, target, location)
-	err := fs.NodeRestoreMetadata(node, target, res.Warn, res.XattrSelectFilter, res.opts.OwnershipByName)
+	debug.Log("%srestoreNodeMetadata %v %v %v", res.logPrefix, node.Name, target, location)
+	node = res.unprivilegedNode(node, location)
+	node = res.umaskNode(node)
+	node = res.placeholderNode(node, location)
+	node = res.provenance.node(node, location)
+	err := fs.NodeRestoreMetadata(node, target, res.Warn, res.XattrSelectFilter, res.opts.OwnershipByName, res.opts.IDMap)
+	var flagsErr *fs.FileFlagsDowngradedError
+	if errors.As(err, &flagsErr) {
+		res.addDowngrade(location, flagsErr.Error())
+		return nil
+	}
 	if err != nil {
-		debug.Log("node.RestoreMetadata(%s) error %v", target, err)
+		debug.Log("%snode.RestoreMetadata(%s) error %v", res.logPrefix, target, err)
 	}
 	return err
 }
@@ -314,9 +882,18 @@ func (res *Restorer) restoreHardlinkAt(node *data.Node, target, path, location s
 		}
 	}
 
+	return res.restoreHardlinkMetadata(node, path, location)
+}
+
+// restoreHardlinkMetadata completes the restore of the hardlink at path.
+func (res *Restorer) restoreHardlinkMetadata(node *data.Node, path, location string) error {
 	res.opts.Progress.AddProgress(location, ActionOtherRestored, 0, 0)
 	// TODO investigate if hardlinks have separate metadata on any supported system
-	return res.restoreNodeMetadataTo(node, path, location)
+	if err := res.restoreNodeMetadataTo(node, path, location); err != nil {
+		return err
+	}
+	res.sendEvent(EventCompleted, location)
+	return nil
 }
 
 func (res *Restorer) ensureDir(target string) error {
@@ -341,8 +918,38 @@ func (res *Restorer) ensureDir(target string) error {
 }
 
 // RestoreTo creates the directories and files in the snapshot below dst.
-// Before an item is created, res.Filter is called.
+// Before an item is created, res.Filter is called. If damaged blobs were
+// found, a *CorruptBlobsError is returned after the restore has completed.
 func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error) {
+	attrs := []Attribute{StringAttribute(AttrTarget, dst)}
+	if id := res.sn.ID(); id != nil {
+		attrs = append(attrs, StringAttribute(AttrSnapshotID, id.String()))
+	}
+	ctx, span := startSpan(ctx, res.opts.Tracer, SpanRestore, attrs...)
+
+	var count uint64
+	var err error
+	restore := func(ctx context.Context) (uint64, error) {
+		return res.restoreTo(ctx, dst)
+	}
+	if res.opts.OutageRetries > 0 {
+		restoreOnce := restore
+		restore = func(ctx context.Context) (uint64, error) {
+			return res.restoreWithOutageRetries(ctx, restoreOnce)
+		}
+	}
+	if res.opts.MaxDuration > 0 {
+		count, err = res.restoreWithMaxDuration(ctx, restore)
+	} else {
+		count, err = restore(ctx)
+	}
+	endSpan(span, err)
+	return count, err
+}
+
+func (res *Restorer) restoreTo(ctx context.Context, dst string) (uint64, error) {
+	res.logPrefix = logPrefix(ctx)
+	started := time.Now()
 	restoredFileCount := uint64(0)
 	var err error
 	if !filepath.IsAbs(dst) {
@@ -352,6 +959,39 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 		}
 	}
 
+	if res.opts.Report != "" {
+		res.report = newRestoreReport()
+		// failures are recorded for all errors, also those of the file restorer
+		errorFn := res.Error
+		res.Error = func(location string, err error) error {
+			res.report.fail(location, err)
+			return errorFn(location, err)
+		}
+		defer func() {
+			res.Error = errorFn
+		}()
+	}
+	if res.ErrorSink != nil {
+		// wraps all other handlers, such that the sink sees errors first
+		errorFn := res.Error
+		res.Error = func(location string, err error) error {
+			res.ErrorSink(location, err)
+			return errorFn(location, err)
+		}
+		defer func() {
+			res.Error = errorFn
+		}()
+	}
+
+	if res.opts.Delete && !res.opts.DeleteAll {
+		if err := res.checkDeleteAll(ctx, dst); err != nil {
+			if !res.opts.DryRun || !errors.As(err, new(*DeleteAllError)) {
+				return restoredFileCount, err
+			}
+			res.Warn(err.Error())
+		}
+	}
+
 	if !res.opts.DryRun {
 		// ensure that the target directory exists and is actually a directory
 		// Using ensureDir is too aggressive here as it also removes unexpected files
@@ -360,97 +1000,577 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 		}
 	}
 
+	if res.opts.PatchBase != nil {
+		res.patchBase = newPatchBase(res.repo, res.opts.PatchBase)
+	}
+
+	if err := checkChunkerPolynomial(res.opts.ChunkerPolynomial, res.repo.Config().ChunkerPolynomial); err != nil {
+		return restoredFileCount, err
+	}
+	if res.opts.Encryption != nil && (res.opts.Journal != "" || res.opts.PatchBase != nil) {
+		return restoredFileCount, errors.New("content encryption cannot be combined with a journal or patch base")
+	}
+	if res.opts.VerifyWrites && res.opts.Encryption != nil {
+		return restoredFileCount, errors.New("write verification cannot be combined with content encryption")
+	}
+	if res.opts.WriteAlignment > 0 && (res.opts.Journal != "" || res.opts.Encryption != nil) {
+		return restoredFileCount, errors.New("write alignment cannot be combined with a journal or content encryption")
+	}
+	if res.opts.Flatten {
+		if res.opts.Delete || len(res.opts.Subvolumes) > 0 {
+			return restoredFileCount, errors.New("flatten cannot be combined with delete or subvolumes")
+		}
+		res.flatten = newFlatNames(dst, res.conflictResolver())
+	}
+	if res.opts.PathMap != nil {
+		if res.opts.Flatten {
+			return restoredFileCount, errors.New("a path map cannot be combined with flatten")
+		}
+		res.mapped = newMappedPaths(dst, res.opts.PathMap)
+	}
+	if res.opts.ReadOnly && res.opts.Flatten {
+		return restoredFileCount, errors.New("read-only cannot be combined with flatten")
+	}
+	if res.opts.SortedEntries && res.opts.Flatten {
+		return restoredFileCount, errors.New("sorted entries cannot be combined with flatten")
+	}
+	if res.opts.SortedEntries && !res.opts.DryRun {
+		res.sorted = newSortedEntries()
+	}
+	if res.opts.DeltaBase != nil {
+		if res.opts.PatchBase != nil || res.opts.Flatten {
+			return restoredFileCount, errors.New("delta base cannot be combined with patch base or flatten")
+		}
+		res.delta, err = diffSnapshots(ctx, res.repo, *res.opts.DeltaBase.Tree, *res.sn.Tree)
+		if err != nil {
+			return restoredFileCount, err
+		}
+		res.patchBase = newPatchBase(res.repo, res.opts.DeltaBase)
+	}
+	if res.opts.LongPaths != LongPathFail {
+		if res.opts.Flatten || res.opts.DeltaBase != nil {
+			return restoredFileCount, errors.New("long path handling cannot be combined with flatten or delta base")
+		}
+	}
+	if res.opts.LongPaths != LongPathFail || (res.opts.ConflictResolver != nil && !res.opts.Flatten && res.opts.DeltaBase == nil) {
+		res.longPaths = newLongPaths(dst, res.conflictResolver())
+	}
+	if res.opts.ProbeTargets && !res.opts.DryRun {
+		return restoredFileCount, errors.New("probing the target directories requires a dry run")
+	}
+	if res.opts.SeedIndex != "" && res.opts.Seed == "" {
+		return restoredFileCount, errors.New("a seed index requires a seed directory")
+	}
+	if res.opts.Seed != "" && res.seed == nil {
+		res.seed, err = openSeed(ctx, res.opts.Seed, res.opts.SeedIndex, dst, res.repo.ChunkerFactory().NewChunker())
+		if err != nil {
+			return restoredFileCount, err
+		}
+	}
+	if res.opts.PreviewPatch != nil {
+		if !res.opts.DryRun {
+			return restoredFileCount, errors.New("a preview patch requires a dry run")
+		}
+		if res.opts.Encryption != nil || res.opts.EstimateSamples > 0 {
+			return restoredFileCount, errors.New("a preview patch cannot be combined with content encryption or an estimate")
+		}
+	}
+	if len(res.opts.TargetFiles) > 0 && res.opts.Journal != "" {
+		return restoredFileCount, errors.New("target files cannot be combined with a journal")
+	}
+	for _, location := range slices.Sorted(maps.Keys(res.opts.TargetFiles)) {
+		if err := checkTargetFile(location, res.opts.TargetFiles[location], res.opts.Sparse); err != nil {
+			return restoredFileCount, err
+		}
+	}
+	foundTargets := make(map[string]struct{})
+	if res.opts.Provenance == ProvenanceStorageManifest && res.opts.ProvenanceManifest == "" {
+		return restoredFileCount, errors.New("the provenance manifest storage requires a manifest file")
+	}
+	if res.opts.Provenance != ProvenanceStorageManifest && res.opts.ProvenanceManifest != "" {
+		return restoredFileCount, errors.New("a provenance manifest file requires the manifest storage")
+	}
+
+	if res.opts.Provenance != ProvenanceStorageNone && !res.opts.DryRun {
+		base := Provenance{Repository: res.repo.Config().ID, RestoredAt: started}
+		if id := res.sn.ID(); id != nil {
+			base.Snapshot = id.String()
+		}
+		res.provenance, err = newProvenanceRecorder(res.opts.Provenance, res.opts.ProvenanceManifest, base)
+		if err != nil {
+			return restoredFileCount, err
+		}
+		defer func() {
+			_ = res.provenance.Close()
+		}()
+	}
+
+	if res.opts.Journal != "" && !res.opts.DryRun {
+		res.journal, err = openJournal(res.opts.Journal)
+		if err != nil {
+			return restoredFileCount, err
+		}
+		resumer, canResume := res.opts.Progress.(ProgressResumer)
+		if canResume && res.journal.progress != nil {
+			resumer.ResumeProgress(*res.journal.progress)
+		}
+		defer func() {
+			if canResume {
+				// the journal is already closed if the restore has completed
+				_ = res.journal.recordProgress(resumer.ProgressState())
+			}
+			_ = res.journal.Close()
+		}()
+	}
+
+	sparse := res.opts.Sparse
+	if sparse && !res.opts.DryRun {
+		if sparse, err = res.checkSparse(dst); err != nil {
+			return restoredFileCount, err
+		}
+	}
+
 	idx := data.NewHardlinkIndex[string]()
 	filerestorer := newFileRestorer(dst, res.repo.LoadBlobsFromPack, res.repo.LookupBlob,
-		res.repo.Connections(), res.opts.Sparse, res.opts.Delete, res.repo.StartWarmup, res.opts.Progress,
+		res.repo.Connections(), sparse, res.opts.Delete, res.repo.StartWarmup, res.opts.Progress,
 		res.repo.ChunkerFactory().ZeroChunk())
+	if !res.opts.DryRun {
+		root, err := openTargetRoot(dst)
+		if err != nil {
+			return restoredFileCount, fmt.Errorf("cannot open target directory: %w", err)
+		}
+		defer func() {
+			_ = root.Close()
+		}()
+		filerestorer.filesWriter.root = root
+	}
 	filerestorer.Error = res.Error
 	filerestorer.Info = res.Info
+	filerestorer.BlobSkipped = res.BlobSkipped
+	filerestorer.checkMissingBlobs = res.opts.CheckMissingBlobs
+	filerestorer.journal = res.journal
+	if res.opts.Deadline > 0 {
+		filerestorer.deadline = started.Add(res.opts.Deadline)
+		filerestorer.deadlineGracePeriod = res.opts.DeadlineGracePeriod
+	}
+	filerestorer.sizeQuota = res.opts.SizeQuota
+	filerestorer.ownerFilter = res.opts.OwnerFilter
+	if res.opts.MinFreeSpace > 0 && !res.opts.DryRun {
+		filerestorer.spaceWatch = newSpaceWatchdog(dst, res.opts.MinFreeSpace, res.opts.FreeSpaceInterval, res.Info)
+	}
+	filerestorer.content = res.content
+	filerestorer.dedupeFiles = res.opts.DedupeFiles
+	if res.ScanFile != nil && res.opts.PreviewPatch == nil {
+		filerestorer.scan = &fileScanner{fn: res.ScanFile, quarantine: res.opts.Quarantine}
+	}
+	filerestorer.slowFileThreshold = res.opts.SlowFileThreshold
+	filerestorer.encryption = res.opts.Encryption
+	filerestorer.sampleCache = res.opts.SampleCache
+	if res.opts.BlobCacheSize > 0 {
+		filerestorer.blobCache = newBlobCache(res.opts.BlobCacheSize)
+	}
+	filerestorer.sequentialFiles = res.opts.SequentialFiles
+	if res.opts.Scheduler != nil {
+		filerestorer.scheduler = res.opts.Scheduler
+	}
+	filerestorer.packGate = res.opts.PackGate
+	if res.FileCompleted != nil || res.provenance != nil {
+		filerestorer.completion = newFileCompletion(func(location string) {
+			res.recordProvenance(filerestorer.targetPath(location), location)
+			if res.FileCompleted != nil {
+				res.FileCompleted(location)
+			}
+		}, res.opts.CompletionOrder)
+		if res.opts.CompletionOrder != nil && res.opts.CompletionBuffer > 0 &&
+			(res.opts.SequentialFiles == 0 || res.opts.CompletionBuffer < res.opts.SequentialFiles) {
+			filerestorer.sequentialFiles = res.opts.CompletionBuffer
+		}
+	}
+	filerestorer.writeAlignment = res.opts.WriteAlignment
+	filerestorer.canceled = &res.canceled
+	filerestorer.priorities = &res.priorities
+	filerestorer.flatten = res.flatten
+	filerestorer.mapped = res.mapped
+	// mapped targets may be located outside of the target directory
+	filerestorer.filesWriter.allowOutside = res.mapped != nil
+	filerestorer.longPaths = res.longPaths
+	filerestorer.tracer = res.opts.Tracer
+	filerestorer.sortWrites = res.opts.SortWrites
+	filerestorer.report = res.report
+	if res.opts.VerifyWrites {
+		filerestorer.verifyWrites = res.VerifyWritesFilter
+		if filerestorer.verifyWrites == nil {
+			filerestorer.verifyWrites = func(string) bool { return true }
+		}
+	}
+	if res.opts.Salvage {
+		filerestorer.salvage = &salvagedFiles{}
+	}
+	filerestorer.alternatePacks = res.opts.AlternatePacks
+	if res.opts.CoalescePacks {
+		filerestorer.coalesce = &packCoalescer{}
+	}
+	if res.opts.VerifyPacks {
+		filerestorer.listBlobs = res.repo.ListBlobs
+	}
+	if res.opts.WatchdogThreshold > 0 {
+		out := res.opts.WatchdogOutput
+		if out == nil {
+			out = os.Stderr
+		}
+		filerestorer.watchdog = newWatchdog(res.opts.WatchdogThreshold, out, res.opts.WatchdogAbort)
+	}
+	if res.opts.SchedulerMetrics {
+		res.metrics = &schedulerMetrics{}
+		filerestorer.metrics = res.metrics
+	}
+	if res.opts.PlanMemory {
+		res.planMemory = &PlanMemory{}
+		filerestorer.planMemory = res.planMemory
+	}
+	if res.opts.IndexLookupStats {
+		res.indexStats = &indexStats{}
+		filerestorer.idx = res.indexStats.wrap(filerestorer.idx)
+	}
+	if loader, ok := res.repo.(restic.PackSectionsLoader); ok && res.opts.DecodeWorkers > 0 {
+		filerestorer.sectionsLoader = loader.LoadPackSections
+		filerestorer.decodeWorkers = res.opts.DecodeWorkers
+	}
+	filerestorer.seed = res.seed
+	res.dirOwner = newDirOwnerCheck(res.opts.DirOwnerPolicy, res.euid, res.opts.IDMap)
+	res.listing = nil
+	if res.opts.DirListingLimit > 0 {
+		res.listing = newDirListing(res.opts.DirListingLimit)
+	}
+	if res.opts.ProgressBatch > 0 || res.opts.ProgressInterval > 0 {
+		filerestorer.progressBatch = newProgressBatch(filerestorer.progress, res.opts.ProgressBatch, res.opts.ProgressInterval)
+	}
+	if res.opts.OutageRetries > 0 {
+		filerestorer.outage = newOutageDetector(filerestorer.workerCount)
+	}
+	filerestorer.filesWriter.immutable = res.opts.Immutable
+	filerestorer.filesWriter.dirCreateLimit = res.opts.DirCreateLimit
+	filerestorer.filesWriter.holeThreshold = res.opts.SparseHoleThreshold
+	filerestorer.filesWriter.cacheAdvice = res.opts.CacheAdvice
+	if res.opts.PreviewPatch != nil {
+		filerestorer.patch = newPreviewPatch(res.opts.PreviewPatch)
+		// zero blobs must be contained in the patch
+		filerestorer.sparse = false
+	}
 
-	debug.Log("first pass for %q", dst)
+	if res.opts.UndoReadOnly && !res.opts.DryRun {
+		if err := res.unlockReadOnly(ctx, dst); err != nil {
+			return 0, err
+		}
+	}
+
+	if res.delta != nil && res.opts.DeltaDelete {
+		if err := res.removeDeleted(dst); err != nil {
+			return 0, err
+		}
+	}
+
+	debug.Log("%sfirst pass for %q", res.logPrefix, dst)
 
 	var buf []byte
+	// number of filesystem entries which must be created in addition to
+	// the directories created during the first pass
+	var inodesRequired uint64
+	res.ownerSkipped = nil
+	ownerSkipped := make(map[string]struct{})
 
 	// first tree pass: create directories and collect all files to restore
-	err = res.traverseTree(ctx, dst, *res.sn.Tree, treeVisitor{
-		enterDir: func(_ *data.Node, target, location string) error {
-			debug.Log("first pass, enterDir: mkdir %q, leaveDir should restore metadata", location)
+	planCtx, planSpan := startSpan(ctx, res.opts.Tracer, SpanPlan)
+	err = res.traverseTree(planCtx, dst, *res.sn.Tree, treeVisitor{
+		enterDir: func(node *data.Node, target, location string) error {
+			debug.Log("%sfirst pass, enterDir: mkdir %q, leaveDir should restore metadata", res.logPrefix, location)
 			if location != string(filepath.Separator) {
 				res.opts.Progress.AddFile(0)
 			}
+			if node == nil {
+				// the target directory takes the place of the subfolder
+				node = res.opts.RootNode
+			}
+			res.dirOwner.enterDir(node, target)
+			if err := res.ensureSubvolume(target, location); err != nil {
+				return err
+			}
 			return res.ensureDir(target)
 		},
 
 		visitNode: func(node *data.Node, target, location string) error {
-			debug.Log("first pass, visitNode: mkdir %q, leaveDir on second pass should restore metadata", location)
-			if err := res.ensureDir(filepath.Dir(target)); err != nil {
+			debug.Log("%sfirst pass, visitNode: mkdir %q, leaveDir on second pass should restore metadata", res.logPrefix, location)
+			overwriteCheck := res.withOverwriteCheck
+			if f, ok := res.opts.TargetFiles[location]; ok && node.Type == data.NodeTypeFile {
+				// the content is always replaced, thus the path is not used
+				foundTargets[location] = struct{}{}
+				filerestorer.filesWriter.addTargetFile(filerestorer.targetPath(location), f)
+				overwriteCheck = func(_ context.Context, _ *data.Node, _, _ string, _ bool, buf []byte, cb func(updateMetadataOnly bool, matches *fileState) error) ([]byte, error) {
+					return buf, cb(false, nil)
+				}
+			} else if err := res.ensureDir(filepath.Dir(target)); err != nil {
 				return err
 			}
 
 			if node.Type != data.NodeTypeFile {
+				if res.requiresPrivileges(node) {
+					// skipped and reported during the second pass
+					return nil
+				}
 				res.opts.Progress.AddFile(0)
+				inodesRequired++
+				if res.sorted != nil {
+					return res.createSortedNode(ctx, node, target, location)
+				}
+				return nil
+			}
+
+			if !res.opts.OwnerFilter.Match(node.UID, node.GID) {
+				res.ownerSkipped = append(res.ownerSkipped, location)
+				if _, ok := foundTargets[location]; !ok && node.Links > 1 {
+					if idx.Has(node.Inode, node.DeviceID) {
+						// hardlinks share the owner of the skipped link target
+						return nil
+					}
+					idx.Add(node.Inode, node.DeviceID, location)
+				}
+				ownerSkipped[location] = struct{}{}
+				res.report.add(location, ReportSkipped, node.Size, SkipOwner)
+				res.addSkippedFile(location, node.Size, SkipOwner)
 				return nil
 			}
 
-			if node.Links > 1 {
+			if _, ok := foundTargets[location]; !ok {
+				if skip, err := res.checkDirOwner(node, target, location); skip || err != nil {
+					return err
+				}
+			}
+
+			if _, ok := foundTargets[location]; !ok && node.Links > 1 {
 				if idx.Has(node.Inode, node.DeviceID) {
 					// a hardlinked file does not increase the restore size
 					res.opts.Progress.AddFile(0)
+					if res.sorted != nil {
+						return res.createSortedHardlink(ctx, filerestorer, node, target, location, idx.Value(node.Inode, node.DeviceID))
+					}
 					return nil
 				}
 				idx.Add(node.Inode, node.DeviceID, location)
 			}
 
-			buf, err = res.withOverwriteCheck(ctx, node, target, location, false, buf, func(updateMetadataOnly bool, matches *fileState) error {
-				if updateMetadataOnly {
-					res.opts.Progress.AddSkippedFile(location, node.Size)
-				} else {
+			buf, err = overwriteCheck(ctx, node, target, location, false, buf, func(updateMetadataOnly bool, matches *fileState) error {
+				res.recordChange(node, target, location, !updateMetadataOnly, matches)
+				switch {
+				case updateMetadataOnly:
+					res.report.add(location, ReportSkipped, node.Size, SkipUnchanged)
+				case matches == nil:
+					res.report.add(location, ReportRestored, node.Size, "")
+				default:
+					res.report.add(location, ReportUpdated, node.Size, "")
+				}
+				if !updateMetadataOnly {
+					if matches == nil {
+						res.sendEvent(EventCreated, location)
+					} else {
+						res.sendEvent(EventUpdated, location)
+					}
+				}
+				if updateMetadataOnly && res.journal.restored(location) {
+					// written by a previous run, which is part of the progress of the resumed restore
 					res.opts.Progress.AddFile(node.Size)
+					res.opts.Progress.AddProgress(location, ActionFileRestored, node.Size, node.Size)
+				} else if updateMetadataOnly {
+					res.addSkippedFile(location, node.Size, SkipUnchanged)
+				} else if res.opts.StructureOnly {
+					res.opts.Progress.AddFile(0)
 					if !res.opts.DryRun {
-						filerestorer.addFile(location, node.Content, int64(node.Size), matches)
-					} else {
-						action := ActionFileUpdated
-						if matches == nil {
-							action = ActionFileRestored
+						if err := filerestorer.truncateFileToSize(location, 0); err != nil {
+							return res.Error(location, err)
+						}
+						if res.sorted != nil {
+							res.sorted.files[location] = struct{}{}
+						}
+					}
+					res.addPlaceholder(location, node.Size)
+					res.opts.Progress.AddProgress(location, ActionFileRestored, 0, 0)
+				} else {
+					if res.opts.SizeQuota == 0 {
+						// otherwise counted once the size quota is applied
+						res.opts.Progress.AddFile(node.Size)
+					}
+					if !res.opts.DryRun {
+						filerestorer.addFile(location, node.Content, int64(node.Size), node.ModTime, node.UID, node.GID, matches)
+						_, isTarget := foundTargets[location]
+						if res.sorted != nil && matches == nil && !isTarget {
+							if err := res.createSortedFile(filerestorer, location); err != nil {
+								return res.Error(location, err)
+							}
 						}
+					} else if res.opts.PreviewPatch != nil {
+						// the progress is reported while writing the patch
+						filerestorer.addFile(location, node.Content, int64(node.Size), node.ModTime, node.UID, node.GID, matches)
+					} else if res.opts.EstimateSamples > 0 || res.opts.SizeQuota > 0 {
+						// the progress is reported once the size quota is applied
+						filerestorer.addFile(location, node.Content, int64(node.Size), node.ModTime, node.UID, node.GID, matches)
+					}
+					if res.opts.DryRun && res.opts.PreviewPatch == nil && res.opts.SizeQuota == 0 {
 						// immediately mark as completed
-						res.opts.Progress.AddProgress(location, action, node.Size, node.Size)
+						res.opts.Progress.AddProgress(location, dryRunAction(matches), node.Size, node.Size)
 					}
 				}
 				res.trackFile(location, updateMetadataOnly)
 				if !updateMetadataOnly {
 					restoredFileCount++
+					if matches == nil {
+						inodesRequired++
+					}
 				}
 				return nil
 			})
 			return err
 		},
 	})
+	planSpan.SetAttributes(IntAttribute(AttrFiles, int64(restoredFileCount)))
+	endSpan(planSpan, err)
 	if err != nil {
 		return 0, err
 	}
+	for _, location := range slices.Sorted(maps.Keys(res.opts.TargetFiles)) {
+		if _, ok := foundTargets[location]; !ok {
+			return 0, errors.Fatalf("target file location %v is not a regular file selected for restore", location)
+		}
+	}
+
+	quotaSkipped := make(map[string]struct{})
+	if res.opts.SizeQuota > 0 {
+		// skipped files must not be touched by the second pass
+		filerestorer.applySizeQuota()
+		res.quotaSkipped = filerestorer.quotaSkipped
+		for _, location := range filerestorer.quotaSkipped {
+			delete(res.fileList, location)
+			quotaSkipped[location] = struct{}{}
+			res.report.skip(location, SkipQuota)
+			restoredFileCount--
+		}
+		for _, file := range filerestorer.files {
+			res.opts.Progress.AddFile(uint64(file.size))
+			if res.opts.DryRun && res.opts.PreviewPatch == nil {
+				res.opts.Progress.AddProgress(file.location, dryRunAction(file.state), uint64(file.size), uint64(file.size))
+			}
+		}
+	}
+
+	if !res.opts.DryRun && !res.opts.SkipInodeCheck {
+		if err := checkFreeInodes(dst, inodesRequired); err != nil {
+			return 0, err
+		}
+	}
+
+	if res.opts.DryRun && res.opts.EstimateSamples > 0 {
+		res.estimate, err = filerestorer.estimate(ctx, res.opts.EstimateSamples, res.opts.SampleCache)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if res.opts.DryRun && filerestorer.patch != nil {
+		contentCtx, contentSpan := startSpan(ctx, res.opts.Tracer, SpanContent)
+		err = filerestorer.restoreFiles(contentCtx)
+		if err == nil {
+			err = filerestorer.patch.finish()
+		}
+		endSpan(contentSpan, err)
+		if err != nil {
+			return 0, err
+		}
+	}
 
+	canceled := make(map[string]struct{})
 	if !res.opts.DryRun {
-		err = filerestorer.restoreFiles(ctx)
+		contentCtx, contentSpan := startSpan(ctx, res.opts.Tracer, SpanContent)
+		err = filerestorer.watchdog.run(contentCtx, filerestorer.restoreFiles)
+		endSpan(contentSpan, err)
+		if err != nil {
+			return 0, err
+		}
+		res.skippedBlobs, res.skippedBytes = filerestorer.skippedBlobs, filerestorer.skippedBytes
+		res.compression = filerestorer.compression.stats()
+		res.dedup = filerestorer.compression.dedup()
+		res.blobCache = filerestorer.blobCache.stats()
+		res.packCheck = filerestorer.packCheck.stats()
+		res.coalesce = filerestorer.coalesce.stats()
+		if reporter, ok := res.opts.Progress.(DedupReporter); ok {
+			reporter.ReportDedup(res.dedup)
+		}
+		// skipped files must not be touched by the second pass
+		res.canceledFiles, err = filerestorer.removeCanceledFiles()
 		if err != nil {
 			return 0, err
 		}
+		for _, location := range res.canceledFiles {
+			delete(res.fileList, location)
+			canceled[location] = struct{}{}
+			res.report.skip(location, SkipCanceled)
+			restoredFileCount--
+		}
+		res.vetoed = filerestorer.scan.vetoedFiles()
+		for _, file := range res.vetoed {
+			// hardlinks to a vetoed file are skipped like for canceled files
+			delete(res.fileList, file.Location)
+			canceled[file.Location] = struct{}{}
+			res.report.fail(file.Location, file.Reason)
+			restoredFileCount--
+		}
+		if err := res.removeSkippedSortedFiles(filerestorer); err != nil {
+			return 0, err
+		}
 	}
 
-	debug.Log("second pass for %q", dst)
+	debug.Log("%ssecond pass for %q", res.logPrefix, dst)
 
 	// second tree pass: restore special files and filesystem metadata
-	err = res.traverseTree(ctx, dst, *res.sn.Tree, treeVisitor{
+	metadataCtx, metadataSpan := startSpan(ctx, res.opts.Tracer, SpanMetadata)
+	err = res.traverseTree(metadataCtx, dst, *res.sn.Tree, treeVisitor{
 		visitNode: func(node *data.Node, target, location string) error {
-			debug.Log("second pass, visitNode: restore node %q", location)
+			debug.Log("%ssecond pass, visitNode: restore node %q", res.logPrefix, location)
 			if node.Type != data.NodeTypeFile {
+				if _, ok := res.sorted.handled(location); ok {
+					return nil
+				}
 				_, err := res.withOverwriteCheck(ctx, node, target, location, false, nil, func(_ bool, _ *fileState) error {
 					return res.restoreNodeTo(node, target, location)
 				})
 				return err
 			}
 
+			if _, ok := foundTargets[location]; ok {
+				// the metadata can only be restored for a path
+				if _, ok := res.hasRestoredFile(location); ok {
+					res.sendEvent(EventCompleted, location)
+				}
+				return nil
+			}
+
 			if idx.Has(node.Inode, node.DeviceID) && idx.Value(node.Inode, node.DeviceID) != location {
+				if _, ok := quotaSkipped[idx.Value(node.Inode, node.DeviceID)]; ok {
+					// the link target was skipped due to the size quota
+					res.quotaSkipped = append(res.quotaSkipped, location)
+					return res.removeSortedHardlink(target, location)
+				}
+				if _, ok := ownerSkipped[idx.Value(node.Inode, node.DeviceID)]; ok {
+					// already skipped during the first pass
+					return nil
+				}
+				if _, ok := canceled[idx.Value(node.Inode, node.DeviceID)]; ok {
+					// the link target was canceled
+					return res.removeSortedHardlink(target, location)
+				}
+				if linked, ok := res.sorted.handled(location); ok {
+					if !linked {
+						return nil
+					}
+					return res.restoreHardlinkMetadata(node, target, location)
+				}
 				_, err := res.withOverwriteCheck(ctx, node, target, location, true, nil, func(_ bool, _ *fileState) error {
 					return res.restoreHardlinkAt(node, filerestorer.targetPath(idx.Value(node.Inode, node.DeviceID)), target, location)
 				})
@@ -458,7 +1578,11 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 			}
 
 			if _, ok := res.hasRestoredFile(location); ok {
-				return res.restoreNodeMetadataTo(node, target, location)
+				err := res.restoreNodeMetadataTo(node, target, location)
+				if err == nil {
+					res.sendEvent(EventCompleted, location)
+				}
+				return err
 			}
 			// don't touch skipped files
 			return nil
@@ -471,19 +1595,70 @@ func (res *Restorer) RestoreTo(ctx context.Context, dst string) (uint64, error)
 			}
 
 			if node == nil {
-				return nil
+				if res.opts.RootNode == nil {
+					return nil
+				}
+				// the target directory takes the place of the subfolder
+				return res.restoreNodeMetadataTo(res.opts.RootNode, target, location)
 			}
 
 			err := res.restoreNodeMetadataTo(node, target, location)
 			if err == nil {
 				res.opts.Progress.AddProgress(location, ActionDirRestored, 0, 0)
+				res.sendEvent(EventCompleted, location)
 			}
 			return err
 		},
 	})
+	endSpan(metadataSpan, err)
+	// includes the hardlinks to skipped files
+	slices.Sort(res.ownerSkipped)
+	if err == nil {
+		err = filerestorer.reapplyWriteProtection()
+	}
+	if err == nil {
+		// written last, such that removing unexpected files does not delete the reports
+		res.salvaged, err = filerestorer.writeSalvageReports()
+	}
+	if err == nil {
+		err = res.provenanceErr
+	}
+	if err == nil {
+		err = res.provenance.Close()
+	}
+	if err == nil && res.journal != nil {
+		err = res.journal.remove()
+	}
+	if err == nil {
+		err = filerestorer.corrupt.err()
+	}
+	if err == nil && res.opts.ReadOnly && !res.opts.DryRun {
+		err = res.makeReadOnly(ctx, dst)
+	}
+	if err == nil && res.opts.ProbeTargets && res.opts.DryRun {
+		err = res.probeTargets(ctx, dst)
+	}
+	if err == nil && res.report != nil {
+		err = res.writeReport(dst, started)
+	}
 	return restoredFileCount, err
 }
 
+// checkFreeInodes verifies that the filesystem containing dst can hold at
+// least required additional entries. Filesystems which do not report an inode
+// limit always pass the check.
+func checkFreeInodes(dst string, required uint64) error {
+	free, ok, err := freeInodes(dst)
+	if err != nil {
+		debug.Log("unable to determine free inodes for %v: %v", dst, err)
+		return nil
+	}
+	if !ok || free >= required {
+		return nil
+	}
+	return fmt.Errorf("not enough free inodes on target filesystem: %d required, %d available", required, free)
+}
+
 func (res *Restorer) removeUnexpectedFiles(ctx context.Context, target, location string, expectedFilenames []string) error {
 	if !res.opts.Delete {
 		panic("internal error")
@@ -551,6 +1726,37 @@ func (res *Restorer) removeUnexpectedFiles(ctx context.Context, target, location
 	return nil
 }
 
+// LongPaths returns the items whose name or path exceeded the limits of the
+// target platform, sorted by location. It is only available with
+// Options.LongPaths set.
+func (res *Restorer) LongPaths() []LongPath {
+	return res.longPaths.result()
+}
+
+// QuotaSkippedFiles returns the files which were not restored as they do not
+// fit into Options.SizeQuota.
+func (res *Restorer) QuotaSkippedFiles() []string {
+	return res.quotaSkipped
+}
+
+// SchedulerMetrics returns the metrics collected while downloading the file
+// content. It returns nil unless Options.SchedulerMetrics is set.
+func (res *Restorer) SchedulerMetrics() *SchedulerMetrics {
+	return res.metrics.result()
+}
+
+// SkippedBlobs returns the number and total size of the blobs which were not
+// restored as the existing files already contained them.
+func (res *Restorer) SkippedBlobs() (count uint64, size uint64) {
+	return res.skippedBlobs, res.skippedBytes
+}
+
+// Estimate returns the estimated restore duration. It is only available after
+// a dry run with Options.EstimateSamples set.
+func (res *Restorer) Estimate() *RestoreEstimate {
+	return res.estimate
+}
+
 func (res *Restorer) trackFile(location string, metadataOnly bool) {
 	res.fileList[location] = metadataOnly
 }
@@ -561,23 +1767,55 @@ func (res *Restorer) hasRestoredFile(location string) (metadataOnly bool, ok boo
 }
 
 func (res *Restorer) withOverwriteCheck(ctx context.Context, node *data.Node, target, location string, isHardlink bool, buf []byte, cb func(updateMetadataOnly bool, matches *fileState) error) ([]byte, error) {
-	overwrite, err := shouldOverwrite(res.opts.Overwrite, node, target)
+	lstat := fs.Lstat
+	if node.Type == data.NodeTypeFile && !isHardlink {
+		// the listing is only valid before the files are created
+		lstat = res.listing.lstat
+	}
+	// the mtime takes precedence over the content, see OverwriteIfNewerAndChanged
+	overwrite, err := shouldOverwrite(res.opts.Overwrite, node, target, lstat)
 	if err != nil {
 		return buf, err
 	} else if !overwrite {
+		reason := SkipNewer
+		if res.opts.Overwrite == OverwriteNever {
+			reason = SkipExisting
+		}
 		size := node.Size
 		if isHardlink {
 			size = 0
+		} else if node.Type == data.NodeTypeFile {
+			res.recordChange(node, target, location, false, nil)
+			res.report.add(location, ReportSkipped, node.Size, reason)
 		}
-		res.opts.Progress.AddSkippedFile(location, size)
+		res.addSkippedFile(location, size, reason)
 		return buf, nil
 	}
 
 	var matches *fileState
 	updateMetadataOnly := false
-	if node.Type == data.NodeTypeFile && !isHardlink {
-		// if a file fails to verify, then matches is nil which results in restoring from scratch
-		matches, buf, _ = res.verifyFile(ctx, target, node, false, res.opts.Overwrite == OverwriteIfChanged, buf)
+	// encrypted files cannot be compared to the snapshot and are thus restored from scratch
+	if node.Type == data.NodeTypeFile && !isHardlink && res.opts.Encryption == nil {
+		// there is nothing to compare if the listing shows that the file is missing
+		missing := res.listing.missing(target)
+		if res.journal != nil && !missing {
+			// content recorded in the journal was already restored by a previous run
+			matches = res.journal.fileState(target, location, node, res.repo.LookupBlobSize)
+		}
+		if matches == nil && res.patchBase != nil && !missing {
+			// existing file is expected to match the base snapshot
+			matches = res.patchFile(ctx, target, location, node)
+		}
+		if matches == nil && !missing {
+			// if a file fails to verify, then matches is nil which results in restoring from scratch
+			if res.opts.Overwrite == OverwriteIfContentDiffers && (res.opts.RechunkSizeLimit == 0 || node.Size <= res.opts.RechunkSizeLimit) {
+				matches, buf, _ = res.rechunkFile(ctx, target, node, buf)
+			} else if res.opts.Overwrite == OverwriteQuickCheck {
+				matches, buf = res.quickCheckFile(ctx, target, node, buf)
+			} else {
+				matches, buf, _ = res.verifyFile(ctx, target, node, false, res.opts.Overwrite == OverwriteIfChanged, buf)
+			}
+		}
 		// skip files that are already correct completely
 		updateMetadataOnly = !matches.NeedsRestore()
 	}
@@ -585,12 +1823,31 @@ func (res *Restorer) withOverwriteCheck(ctx context.Context, node *data.Node, ta
 	return buf, cb(updateMetadataOnly, matches)
 }
 
-func shouldOverwrite(overwrite OverwriteBehavior, node *data.Node, destination string) (bool, error) {
-	if overwrite == OverwriteAlways || overwrite == OverwriteIfChanged {
+// addSkippedFile reports a file which is not restored for reason to the
+// progress reporter.
+// dryRunAction returns the action reported for a file by a dry run, which
+// is updated if state is set for an existing file.
+func dryRunAction(state *fileState) ItemAction {
+	if state != nil {
+		return ActionFileUpdated
+	}
+	return ActionFileRestored
+}
+
+func (res *Restorer) addSkippedFile(location string, size uint64, reason SkipReason) {
+	if reporter, ok := res.opts.Progress.(SkipReasonReporter); ok {
+		reporter.AddSkippedFileReason(location, size, reason)
+		return
+	}
+	res.opts.Progress.AddSkippedFile(location, size)
+}
+
+func shouldOverwrite(overwrite OverwriteBehavior, node *data.Node, destination string, lstat func(string) (os.FileInfo, error)) (bool, error) {
+	if overwrite == OverwriteAlways || overwrite == OverwriteIfChanged || overwrite == OverwriteIfContentDiffers || overwrite == OverwriteQuickCheck {
 		return true, nil
 	}
 
-	fi, err := fs.Lstat(destination)
+	fi, err := lstat(destination)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return true, nil
@@ -599,7 +1856,7 @@ func shouldOverwrite(overwrite OverwriteBehavior, node *data.Node, destination s
 	}
 
 	switch overwrite {
-	case OverwriteIfNewer:
+	case OverwriteIfNewer, OverwriteIfNewerAndChanged:
 		// return if node is newer
 		return node.ModTime.After(fi.ModTime()), nil
 	case OverwriteNever:
@@ -634,6 +1891,7 @@ func (res *Restorer) VerifyFiles(ctx context.Context, dst string, countRestoredF
 
 	p.SetMax(countRestoredFiles)
 	defer p.Done()
+	res.logPrefix = logPrefix(ctx)
 
 	g, ctx := errgroup.WithContext(ctx)
 
@@ -649,6 +1907,10 @@ func (res *Restorer) VerifyFiles(ctx context.Context, dst string, countRestoredF
 				if metadataOnly, ok := res.hasRestoredFile(location); !ok || metadataOnly {
 					return nil
 				}
+				if _, ok := res.opts.TargetFiles[location]; ok {
+					// the target file may not be readable
+					return nil
+				}
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
@@ -740,14 +2002,36 @@ func (res *Restorer) verifyFile(ctx context.Context, target string, node *data.N
 	}
 
 	matches := make([]bool, len(node.Content))
+	buf, err = res.hashFileBlobs(ctx, f, node, buf, func(i int, offset int64, id restic.ID) error {
+		matches[i] = node.Content[i].Equal(id)
+		if failFast && !matches[i] {
+			return errors.Errorf(
+				"Unexpected content in %s, starting at offset %d",
+				target, offset)
+		}
+		return nil
+	})
+	if err == io.EOF && !failFast {
+		sizeMatches = false
+	} else if err != nil {
+		return nil, buf, err
+	}
+
+	return &fileState{matches, sizeMatches}, buf, nil
+}
+
+// hashFileBlobs reads the content of f in parts of the size of the blobs of
+// node and passes the offset and hash of each part to fn. It returns io.EOF
+// if f is shorter than the content of node.
+func (res *Restorer) hashFileBlobs(ctx context.Context, f io.ReaderAt, node *data.Node, buf []byte, fn func(i int, offset int64, id restic.ID) error) ([]byte, error) {
 	var offset int64
 	for i, blobID := range node.Content {
 		if ctx.Err() != nil {
-			return nil, buf, ctx.Err()
+			return buf, ctx.Err()
 		}
 		length, found := res.repo.LookupBlobSize(restic.BlobHandle{Type: restic.DataBlob, ID: blobID})
 		if !found {
-			return nil, buf, errors.Errorf("Unable to fetch blob %s", blobID)
+			return buf, errors.Errorf("Unable to fetch blob %s", blobID)
 		}
 
 		if length > uint(cap(buf)) {
@@ -755,22 +2039,13 @@ func (res *Restorer) verifyFile(ctx context.Context, target string, node *data.N
 		}
 		buf = buf[:length]
 
-		_, err = f.ReadAt(buf, offset)
-		if err == io.EOF && !failFast {
-			sizeMatches = false
-			break
+		if _, err := f.ReadAt(buf, offset); err != nil {
+			return buf, err
 		}
-		if err != nil {
-			return nil, buf, err
-		}
-		matches[i] = blobID.Equal(restic.Hash(buf))
-		if failFast && !matches[i] {
-			return nil, buf, errors.Errorf(
-				"Unexpected content in %s, starting at offset %d",
-				target, offset)
+		if err := fn(i, offset, restic.Hash(buf)); err != nil {
+			return buf, err
 		}
 		offset += int64(length)
 	}
-
-	return &fileState{matches, sizeMatches}, buf, nil
+	return buf, nil
 }
@@ -12,10 +12,12 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/restic/chunker"
 	"github.com/restic/restic/internal/archiver"
 	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/errors"
@@ -39,14 +41,26 @@ type File struct {
 	Inode      uint64
 	Mode       os.FileMode
 	ModTime    time.Time
+	Owner      *FileOwner // defaults to the current user
 	attributes *FileAttributes
 }
 
+type FileOwner struct {
+	UID, GID uint32
+}
+
 type Symlink struct {
 	Target  string
 	ModTime time.Time
 }
 
+// Special is a node which is neither a file, a directory nor a symlink
+type Special struct {
+	Type    data.NodeType
+	Mode    os.FileMode
+	ModTime time.Time
+}
+
 type Dir struct {
 	Nodes      map[string]Node
 	Mode       os.FileMode
@@ -106,13 +120,17 @@ func saveDir(t testing.TB, repo restic.BlobSaver, nodes map[string]Node, inode u
 			if mode == 0 {
 				mode = 0644
 			}
+			owner := FileOwner{uint32(os.Getuid()), uint32(os.Getgid())}
+			if node.Owner != nil {
+				owner = *node.Owner
+			}
 			tree = append(tree, &data.Node{
 				Type:              data.NodeTypeFile,
 				Mode:              mode,
 				ModTime:           node.ModTime,
 				Name:              name,
-				UID:               uint32(os.Getuid()),
-				GID:               uint32(os.Getgid()),
+				UID:               owner.UID,
+				GID:               owner.GID,
 				Content:           fc,
 				Size:              uint64(size),
 				Inode:             fi,
@@ -131,6 +149,17 @@ func saveDir(t testing.TB, repo restic.BlobSaver, nodes map[string]Node, inode u
 				Inode:      inode,
 				Links:      1,
 			})
+		case Special:
+			tree = append(tree, &data.Node{
+				Type:    node.Type,
+				Mode:    node.Mode,
+				ModTime: node.ModTime,
+				Name:    name,
+				UID:     uint32(os.Getuid()),
+				GID:     uint32(os.Getgid()),
+				Inode:   inode,
+				Links:   1,
+			})
 		case Dir:
 			id := saveDir(t, repo, node.Nodes, inode, getGenericAttributes)
 
@@ -858,6 +887,42 @@ func TestRestorerConsistentTimestampsAndPermissions(t *testing.T) {
 	}
 }
 
+func TestRestorerSubfolderRootMetadata(t *testing.T) {
+	timeForTest := time.Date(2019, time.January, 9, 1, 46, 40, 0, time.UTC)
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"some": Dir{
+				Nodes: map[string]Node{
+					"dir": Dir{
+						Mode:    normalizeFileMode(0750 | os.ModeDir),
+						ModTime: timeForTest,
+						Nodes: map[string]Node{
+							"file": File{Data: "content: file\n"},
+						},
+					},
+				},
+			},
+		},
+	}, noopGetGenericAttributes)
+
+	// restore /some/dir as the target directory
+	node, err := data.FindTreeDirectoryNode(context.TODO(), repo, sn.Tree, "/some/dir")
+	rtest.OK(t, err)
+	sn.Tree = node.Subtree
+	res := NewRestorer(repo, sn, Options{RootNode: node})
+	tempdir := filepath.Join(rtest.TempDir(t), "target")
+	_, err = res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	content, err := os.ReadFile(filepath.Join(tempdir, "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content: file\n", string(content))
+	fi, err := os.Stat(tempdir)
+	rtest.OK(t, err)
+	checkConsistentInfo(t, tempdir, fi, timeForTest, normalizeFileMode(0750|os.ModeDir))
+}
+
 // VerifyFiles must not report cancellation of its context through res.Error.
 func TestVerifyCancel(t *testing.T) {
 	snapshot := Snapshot{
@@ -986,6 +1051,38 @@ func TestRestorerSparseOverwrite(t *testing.T) {
 	saveSnapshotsAndOverwrite(t, baseSnapshot, sparseSnapshot, opts, opts)
 }
 
+func TestRestorerSparseReRestore(t *testing.T) {
+	if sparse, err := probeSparse(rtest.TempDir(t)); err != nil || !sparse {
+		t.Skipf("sparse files are not supported: %v", err)
+	}
+
+	// the zero chunk makes the file sparse
+	zeros := string(make([]byte, chunker.MinSize))
+	data := strings.Repeat("a", 1<<20)
+	for _, test := range []struct {
+		name      string
+		overwrite OverwriteBehavior
+	}{
+		{"always", OverwriteAlways},
+		{"if-changed", OverwriteIfChanged},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opts := Options{Sparse: true, Overwrite: test.overwrite}
+			tempdir := saveSnapshotsAndOverwrite(t,
+				Snapshot{Nodes: map[string]Node{"file": File{DataParts: []string{zeros, data, "tail"}}}},
+				// the data is replaced by zeros
+				Snapshot{Nodes: map[string]Node{"file": File{DataParts: []string{zeros, zeros, "tail2"}}}},
+				opts, opts)
+
+			blocks := getBlockCount(t, filepath.Join(tempdir, "file"))
+			if blocks < 0 {
+				t.Skip("unable to determine the block count")
+			}
+			rtest.Assert(t, blocks*512 < int64(len(zeros)), "file is not sparse, uses %d blocks", blocks)
+		})
+	}
+}
+
 func TestRestorerOverwriteBehavior(t *testing.T) {
 	baseTime := time.Now()
 	baseSnapshot := Snapshot{
@@ -1105,6 +1202,54 @@ func TestRestorerOverwriteBehavior(t *testing.T) {
 	}
 }
 
+func TestRestorerOverwriteIfNewerAndChanged(t *testing.T) {
+	baseTime := time.Now()
+	part := strings.Repeat("a", 1024)
+	baseSnapshot := Snapshot{
+		Nodes: map[string]Node{
+			"changed": File{DataParts: []string{part, "old"}, ModTime: baseTime},
+			"kept":    File{Data: "content: kept\n", ModTime: baseTime},
+			"same":    File{Data: "content: same\n", ModTime: baseTime},
+		},
+	}
+	overwriteSnapshot := Snapshot{
+		Nodes: map[string]Node{
+			// newer, only the differing blob is written
+			"changed": File{DataParts: []string{part, "new"}, ModTime: baseTime.Add(time.Second)},
+			// the existing file is newer, its content is not even read
+			"kept": File{Data: "content: new\n", ModTime: baseTime.Add(-time.Second)},
+			// equal mtime also keeps the existing file
+			"same": File{Data: "content: other\n", ModTime: baseTime},
+		},
+	}
+	reportPath := filepath.Join(rtest.TempDir(t), "report.json")
+	tempdir := saveSnapshotsAndOverwrite(t, baseSnapshot, overwriteSnapshot, Options{},
+		Options{Overwrite: OverwriteIfNewerAndChanged, Report: reportPath})
+
+	for filename, content := range map[string]string{
+		"changed": part + "new",
+		"kept":    "content: kept\n",
+		"same":    "content: same\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(tempdir, filename))
+		rtest.OK(t, err)
+		rtest.Equals(t, content, string(data))
+	}
+
+	buf, err := os.ReadFile(reportPath)
+	rtest.OK(t, err)
+	var report RestoreReport
+	rtest.OK(t, json.Unmarshal(buf, &report))
+	for i := range report.Files {
+		report.Files[i].Duration = 0
+	}
+	rtest.Equals(t, []ReportFile{
+		{Path: "/changed", Status: ReportUpdated, Size: 1027, BytesWritten: 3},
+		{Path: "/kept", Status: ReportSkipped, Size: 13, Reason: SkipNewer},
+		{Path: "/same", Status: ReportSkipped, Size: 15, Reason: SkipNewer},
+	}, report.Files)
+}
+
 func TestRestorerOverwritePartial(t *testing.T) {
 	parts := make([]string, 100)
 	size := 0
@@ -1147,6 +1292,38 @@ func TestRestorerOverwritePartial(t *testing.T) {
 	}, progress.state())
 }
 
+func TestRestorerSkippedBlobs(t *testing.T) {
+	repo := repository.TestRepository(t)
+	tempdir := rtest.TempDir(t)
+	baseTime := time.Now()
+
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{DataParts: []string{"part1\n", "part2\n"}, ModTime: baseTime},
+		},
+	}, noopGetGenericAttributes)
+	_, err := NewRestorer(repo, sn, Options{}).RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	sn, _ = saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{DataParts: []string{"part1\n", "part2\n", "part3\n"}, ModTime: baseTime},
+		},
+	}, noopGetGenericAttributes)
+	res := NewRestorer(repo, sn, Options{Overwrite: OverwriteAlways})
+	var skipped []string
+	res.BlobSkipped = func(location string, offset int64, size uint) {
+		skipped = append(skipped, fmt.Sprintf("%v:%d:%d", location, offset, size))
+	}
+	_, err = res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	rtest.Equals(t, []string{"/foo:0:6", "/foo:6:6"}, skipped)
+	count, size := res.SkippedBlobs()
+	rtest.Equals(t, uint64(2), count)
+	rtest.Equals(t, uint64(12), size)
+}
+
 func TestRestorerOverwriteSpecial(t *testing.T) {
 	baseTime := time.Now()
 	baseSnapshot := Snapshot{
@@ -1532,3 +1709,100 @@ func TestRestorerLongPath(t *testing.T) {
 	_, err = res.VerifyFiles(ctx, tmp, countRestoredFiles, restic.NoopCounter)
 	rtest.OK(t, err)
 }
+
+func TestRestorerSizeQuota(t *testing.T) {
+	now := time.Now()
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"old":    File{Data: "content: old\n", ModTime: now.Add(-2 * time.Hour), Links: 2, Inode: 1},
+					"recent": File{Data: "content: recent\n", ModTime: now},
+					"link":   File{Data: "content: old\n", ModTime: now.Add(-2 * time.Hour), Links: 2, Inode: 1},
+				},
+			},
+		},
+	}
+
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+
+	for _, dryRun := range []bool{false, true} {
+		tempdir := rtest.TempDir(t)
+		progress := newTestProgress()
+		res := NewRestorer(repo, sn, Options{SizeQuota: uint64(len("content: recent\n")), DryRun: dryRun, Progress: progress})
+		count, err := res.RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+		rtest.Equals(t, uint64(1), count)
+		// "link" is visited first and holds the content, "old" is a hardlink to it
+		rtest.Equals(t, []string{"/dir/link", "/dir/old"}, res.QuotaSkippedFiles())
+
+		// skipped files are not part of the progress totals
+		state := progress.state()
+		rtest.Equals(t, uint64(len("content: recent\n")), state.AllBytesTotal)
+		rtest.Equals(t, state.AllBytesTotal, state.AllBytesWritten)
+		if dryRun {
+			continue
+		}
+
+		for _, name := range []string{"old", "link"} {
+			_, err = os.Lstat(filepath.Join(tempdir, "dir", name))
+			rtest.Assert(t, errors.Is(err, os.ErrNotExist), "expected %v to be skipped, got %v", name, err)
+		}
+		_, err = res.VerifyFiles(context.TODO(), tempdir, count, restic.NoopCounter)
+		rtest.OK(t, err)
+	}
+}
+
+func TestCheckFreeInodes(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+
+	rtest.OK(t, checkFreeInodes(tempdir, 1))
+
+	_, ok, err := freeInodes(tempdir)
+	rtest.OK(t, err)
+	if !ok {
+		t.Skip("filesystem does not report free inodes")
+	}
+	err = checkFreeInodes(tempdir, math.MaxUint64)
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "not enough free inodes"), "unexpected error %v", err)
+}
+
+func TestRestorerErrorSink(t *testing.T) {
+	repo := repository.TestRepository(t)
+	longFile := strings.Repeat("f", 300)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			longFile: File{Data: "content: long\n"},
+			"short":  File{Data: "content: short\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, abort := range []bool{false, true} {
+		t.Run(fmt.Sprintf("abort=%v", abort), func(t *testing.T) {
+			res := NewRestorer(repo, sn, Options{})
+			var m sync.Mutex
+			var sunk, handled []string
+			res.ErrorSink = func(location string, _ error) {
+				m.Lock()
+				defer m.Unlock()
+				rtest.Equals(t, len(handled), len(sunk))
+				sunk = append(sunk, location)
+			}
+			res.Error = func(location string, err error) error {
+				m.Lock()
+				defer m.Unlock()
+				handled = append(handled, location)
+				if abort {
+					return err
+				}
+				return nil
+			}
+			_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+			rtest.Equals(t, abort, err != nil)
+			rtest.Assert(t, len(sunk) > 0, "expected errors for the long name")
+			rtest.Equals(t, string(filepath.Separator)+longFile, sunk[0])
+			rtest.Equals(t, sunk, handled)
+		})
+	}
+}
@@ -4,13 +4,17 @@ package restorer
 
 import (
 	"context"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"syscall"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/data"
 	"github.com/restic/restic/internal/repository"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -138,3 +142,130 @@ func TestRestorePermissions(t *testing.T) {
 		rtest.Equals(t, fs.FileMode(0o600), fi.Mode().Perm(), "unexpected permissions")
 	}
 }
+
+func TestRestoreUmask(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Mode: os.ModeDir | 0o777,
+				Nodes: map[string]Node{
+					"exec": File{Data: "content: exec\n", Mode: 0o775},
+					"suid": File{Data: "content: suid\n", Mode: 0o755 | os.ModeSetuid},
+				},
+			},
+			"private": File{Data: "content: private\n", Mode: 0o600},
+		},
+	}
+
+	repo := repository.TestRepository(t)
+	tempdir := rtest.TempDir(t)
+	sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+
+	_, err := NewRestorer(repo, sn, Options{Umask: 0o027}).RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	for _, test := range []struct {
+		path string
+		mode fs.FileMode
+	}{
+		{"dir", fs.ModeDir | 0o750},
+		{"dir/exec", 0o750},
+		// only the permission bits are affected
+		{"dir/suid", 0o750 | fs.ModeSetuid},
+		{"private", 0o600},
+	} {
+		fi, err := os.Lstat(filepath.Join(tempdir, filepath.FromSlash(test.path)))
+		rtest.OK(t, err)
+		rtest.Equals(t, test.mode, fi.Mode()&(fs.ModeType|fs.ModePerm|fs.ModeSetuid), test.path)
+	}
+}
+
+func TestRestoreUnprivileged(t *testing.T) {
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"suid":  File{Data: "content: suid\n", Mode: 0o755 | os.ModeSetuid},
+			"plain": File{Data: "content: plain\n", Mode: 0o644},
+		},
+	}
+
+	repo := repository.TestRepository(t)
+	tempdir := filepath.Join(rtest.TempDir(t), "target")
+	sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+
+	res := NewRestorer(repo, sn, Options{Unprivileged: true})
+	// pretend to run as a different user than the owner of the snapshot files
+	res.euid = os.Geteuid() + 1
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	fi, err := os.Stat(filepath.Join(tempdir, "suid"))
+	rtest.OK(t, err)
+	rtest.Equals(t, fs.FileMode(0o755), fi.Mode()&(fs.ModePerm|fs.ModeSetuid), "setuid bit not removed")
+
+	rtest.Equals(t, []Downgrade{
+		{Location: "/plain", Reason: fmt.Sprintf("ownership %d:%d not restored", os.Getuid(), os.Getgid())},
+		{Location: "/suid", Reason: fmt.Sprintf("ownership %d:%d not restored, setuid/setgid bits removed", os.Getuid(), os.Getgid())},
+	}, res.Downgrades())
+}
+
+func TestRestoreUnprivilegedDevice(t *testing.T) {
+	res := NewRestorer(nil, nil, Options{Unprivileged: true})
+	res.euid = 1000
+	rtest.Assert(t, res.requiresPrivileges(&data.Node{Type: data.NodeTypeDev}), "device node must require privileges")
+	rtest.Assert(t, res.requiresPrivileges(&data.Node{Type: data.NodeTypeCharDev}), "char device node must require privileges")
+	rtest.Assert(t, !res.requiresPrivileges(&data.Node{Type: data.NodeTypeFifo}), "fifo must not require privileges")
+
+	rtest.OK(t, res.restoreNodeTo(&data.Node{Type: data.NodeTypeDev}, filepath.Join(rtest.TempDir(t), "dev"), "/dev"))
+	rtest.Equals(t, 1, len(res.Downgrades()))
+
+	res.euid = 0
+	rtest.Assert(t, !res.requiresPrivileges(&data.Node{Type: data.NodeTypeDev}), "root can create device nodes")
+}
+
+func TestRestoreFifoAndSocket(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"fifo":   Special{Type: data.NodeTypeFifo, Mode: os.ModeNamedPipe | 0o640},
+					"socket": Special{Type: data.NodeTypeSocket, Mode: os.ModeSocket | 0o755},
+					"subdir": Dir{Nodes: map[string]Node{
+						"fifo": Special{Type: data.NodeTypeFifo, Mode: os.ModeNamedPipe | 0o600},
+					}},
+				},
+			},
+		},
+	}, noopGetGenericAttributes)
+
+	tempdir := rtest.TempDir(t)
+	res := NewRestorer(repo, sn, Options{})
+	var warnings []string
+	res.Warn = func(msg string) {
+		warnings = append(warnings, msg)
+	}
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	for _, test := range []struct {
+		path string
+		mode fs.FileMode
+	}{
+		{"dir/fifo", fs.ModeNamedPipe | 0o640},
+		{"dir/subdir/fifo", fs.ModeNamedPipe | 0o600},
+	} {
+		fi, err := os.Lstat(filepath.Join(tempdir, test.path))
+		rtest.OK(t, err)
+		rtest.Equals(t, test.mode, fi.Mode(), "unexpected mode for %v", test.path)
+	}
+
+	fi, err := os.Lstat(filepath.Join(tempdir, "dir", "socket"))
+	if runtime.GOOS == "linux" {
+		rtest.OK(t, err)
+		rtest.Equals(t, fs.ModeSocket|0o755, fi.Mode())
+		rtest.Equals(t, 0, len(warnings))
+	} else if err != nil {
+		// some platforms do not support creating socket files
+		rtest.Assert(t, len(warnings) == 1 && strings.Contains(warnings[0], "socket not restored"), "unexpected warnings %v", warnings)
+	}
+}
@@ -0,0 +1,116 @@
+package restorer
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// SalvageReportSuffix is appended to the name of a partially recovered file
+// to get the name of the report listing its damaged ranges.
+const SalvageReportSuffix = ".restic-damaged"
+
+// DamagedRange is a part of a file whose blob could not be loaded.
+type DamagedRange struct {
+	Offset int64
+	Length uint
+	Blob   restic.ID
+	Err    error
+}
+
+// SalvagedFile is a file which was only partially recovered, see
+// Options.Salvage.
+type SalvagedFile struct {
+	Location string
+	// Report is the path of the report listing the damaged ranges.
+	Report string
+	// Ranges are the damaged ranges, sorted by offset.
+	Ranges []DamagedRange
+}
+
+// salvagedFiles collects the damaged ranges of all files. It is safe for
+// concurrent use, all methods are no-ops for a nil receiver.
+type salvagedFiles struct {
+	m     sync.Mutex
+	files map[*fileInfo][]DamagedRange
+}
+
+func (s *salvagedFiles) add(file *fileInfo, offset int64, length uint, blob restic.ID, err error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.files == nil {
+		s.files = make(map[*fileInfo][]DamagedRange)
+	}
+	s.files[file] = append(s.files[file], DamagedRange{Offset: offset, Length: length, Blob: blob, Err: err})
+}
+
+// has reports whether file has damaged ranges.
+func (s *salvagedFiles) has(file *fileInfo) bool {
+	if s == nil {
+		return false
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	_, ok := s.files[file]
+	return ok
+}
+
+// writeSalvageReports writes the report for each partially recovered file next
+// to it and returns the files sorted by location. Must only be called once
+// restoreFiles has completed.
+func (r *fileRestorer) writeSalvageReports() ([]SalvagedFile, error) {
+	if r.salvage == nil {
+		return nil, nil
+	}
+	r.salvage.m.Lock()
+	defer r.salvage.m.Unlock()
+
+	var salvaged []SalvagedFile
+	for file, ranges := range r.salvage.files {
+		slices.SortFunc(ranges, func(a, b DamagedRange) int {
+			return cmp.Compare(a.Offset, b.Offset)
+		})
+		report := r.targetPath(file.location) + SalvageReportSuffix
+		salvaged = append(salvaged, SalvagedFile{Location: file.location, Report: report, Ranges: ranges})
+		if err := writeSalvageReport(report, file, ranges); err != nil {
+			if errFile := r.sanitizeError(file, err); errFile != nil {
+				return nil, errFile
+			}
+		}
+	}
+	slices.SortFunc(salvaged, func(a, b SalvagedFile) int {
+		return strings.Compare(a.Location, b.Location)
+	})
+	return salvaged, nil
+}
+
+func writeSalvageReport(path string, file *fileInfo, ranges []DamagedRange) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %v was only partially recovered by restic, the following ranges were filled with zeros\n", file.location)
+	fmt.Fprintf(&sb, "# offset length blob error\n")
+	for _, r := range ranges {
+		fmt.Fprintf(&sb, "%d %d %v %v\n", r.Offset, r.Length, r.Blob, r.Err)
+	}
+
+	f, err := fs.OpenFile(path, fs.O_CREATE|fs.O_WRONLY|fs.O_TRUNC|fs.O_NOFOLLOW, 0600)
+	if err != nil {
+		return errors.Wrap(err, "write salvage report")
+	}
+	_, err = f.WriteString(sb.String())
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return errors.Wrap(err, "write salvage report")
+}
+
+// SalvagedFiles returns the files which were only partially recovered,
+// sorted by location, see Options.Salvage.
+func (res *Restorer) SalvagedFiles() []SalvagedFile {
+	return res.salvaged
+}
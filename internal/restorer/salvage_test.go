@@ -0,0 +1,81 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRestorerSalvage(t *testing.T) {
+	tempdir := rtest.TempDir(t)
+	repo := newTestRepo([]TestFile{
+		{
+			name: "damaged",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+				{"data1-3", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "intact",
+			blobs: []TestBlob{
+				{"data2-1", "pack1"},
+			},
+		},
+	})
+
+	damaged := restic.Hash([]byte("data1-2"))
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		return repo.loader(ctx, packID, handles, func(blob restic.BlobHandle, buf []byte, err error) error {
+			if blob.ID == damaged {
+				return handleBlobFn(blob, nil, fmt.Errorf("wrong data returned: %w", restic.ErrInvalidData))
+			}
+			return handleBlobFn(blob, buf, err)
+		})
+	}
+
+	r := newFileRestorer(tempdir, loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.salvage = &salvagedFiles{}
+	r.Error = func(location string, err error) error {
+		t.Errorf("unexpected error for %v: %v", location, err)
+		return nil
+	}
+
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Assert(t, r.corrupt.err() != nil, "expected damaged blob to be reported")
+
+	salvaged, err := r.writeSalvageReports()
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, len(salvaged))
+	rtest.Equals(t, "damaged", salvaged[0].Location)
+	rtest.Equals(t, r.targetPath("damaged")+SalvageReportSuffix, salvaged[0].Report)
+	rtest.Equals(t, 2, len(salvaged[0].Ranges))
+	for i, offset := range []int64{7, 21} {
+		rtest.Equals(t, offset, salvaged[0].Ranges[i].Offset)
+		rtest.Equals(t, uint(7), salvaged[0].Ranges[i].Length)
+		rtest.Equals(t, damaged, salvaged[0].Ranges[i].Blob)
+	}
+
+	zeros := strings.Repeat("\x00", 7)
+	data, err := os.ReadFile(r.targetPath("damaged"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "data1-1"+zeros+"data1-3"+zeros, string(data))
+	data, err = os.ReadFile(r.targetPath("intact"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "data2-1", string(data))
+
+	report, err := os.ReadFile(salvaged[0].Report)
+	rtest.OK(t, err)
+	rtest.Assert(t, strings.Contains(string(report), fmt.Sprintf("\n21 7 %v damaged blob: wrong data returned", damaged)),
+		"unexpected report %q", report)
+}
@@ -0,0 +1,106 @@
+package restorer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// VetoedFile is a restored file which was rejected by Restorer.ScanFile.
+type VetoedFile struct {
+	Location string
+	// Reason is the error returned by Restorer.ScanFile.
+	Reason error
+	// Quarantine is the path to which the file was moved, it is empty if the
+	// file was removed.
+	Quarantine string
+}
+
+// fileScanner passes the completely restored files to Restorer.ScanFile and
+// removes or quarantines vetoed files. It is safe for concurrent use, all
+// methods are no-ops for a nil receiver.
+type fileScanner struct {
+	fn         func(location, path string) error
+	quarantine string
+
+	m      sync.Mutex
+	vetoed []VetoedFile
+}
+
+// scanFile calls Restorer.ScanFile for a file whose content was restored
+// completely and reports whether it was vetoed. Files restored into
+// Options.TargetFiles are not scanned, as they are not stored at their path.
+func (r *fileRestorer) scanFile(file *fileInfo) (bool, error) {
+	s := r.scan
+	if s == nil {
+		return false, nil
+	}
+	path := r.targetPath(file.location)
+	if _, ok := r.filesWriter.targets[path]; ok {
+		return false, nil
+	}
+	// the scanner must see the final content, and a file can only be moved
+	// on all platforms once it is closed
+	r.filesWriter.closeFile(path)
+	reason := s.fn(file.location, path)
+	if reason == nil {
+		return false, nil
+	}
+
+	debug.Log("%sfile %v was vetoed: %v", r.logPrefix, file.location, reason)
+	vetoed := VetoedFile{Location: file.location, Reason: reason}
+	var err error
+	if s.quarantine != "" {
+		vetoed.Quarantine, err = quarantineFile(path, s.quarantine, file.location)
+	}
+	if s.quarantine == "" || err != nil {
+		// never keep a vetoed file in the target directory
+		vetoed.Quarantine = ""
+		if rmErr := fs.Remove(path); rmErr != nil && !errors.Is(rmErr, os.ErrNotExist) && err == nil {
+			err = rmErr
+		}
+	}
+
+	s.m.Lock()
+	s.vetoed = append(s.vetoed, vetoed)
+	s.m.Unlock()
+	return true, err
+}
+
+// quarantineFile moves the file at path to the same location below the
+// quarantine directory. An existing file at the destination is replaced.
+func quarantineFile(path, quarantine, location string) (string, error) {
+	dest := filepath.Join(quarantine, strings.TrimPrefix(location, string(filepath.Separator)))
+	if err := fs.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return "", err
+	}
+	if err := fs.Rename(path, dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+// vetoedFiles returns the vetoed files sorted by their location.
+func (s *fileScanner) vetoedFiles() []VetoedFile {
+	if s == nil {
+		return nil
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	slices.SortFunc(s.vetoed, func(a, b VetoedFile) int {
+		return strings.Compare(a.Location, b.Location)
+	})
+	return s.vetoed
+}
+
+// VetoedFiles returns the files which were rejected by Restorer.ScanFile,
+// sorted by their location. Their metadata was not restored.
+func (res *Restorer) VetoedFiles() []VetoedFile {
+	return res.vetoed
+}
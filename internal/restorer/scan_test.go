@@ -0,0 +1,72 @@
+package restorer
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerScanFile(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"clean": File{Data: "content: clean\n"},
+			"empty": File{Data: ""},
+			"dir": Dir{Nodes: map[string]Node{
+				"infected": File{DataParts: []string{"content: ", "virus\n"}},
+			}},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, quarantine := range []string{"", rtest.TempDir(t)} {
+		tempdir := rtest.TempDir(t)
+		res := NewRestorer(repo, sn, Options{Quarantine: quarantine})
+		var m sync.Mutex
+		var scanned, completed []string
+		res.ScanFile = func(location, path string) error {
+			data, err := os.ReadFile(path)
+			rtest.OK(t, err)
+			m.Lock()
+			defer m.Unlock()
+			scanned = append(scanned, location)
+			if bytes.Contains(data, []byte("virus")) {
+				return errors.New("found a virus")
+			}
+			return nil
+		}
+		res.FileCompleted = func(location string) {
+			completed = append(completed, location)
+		}
+		_, err := res.RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+
+		rtest.Equals(t, 3, len(scanned))
+		rtest.Assert(t, !slices.Contains(completed, filepath.FromSlash("/dir/infected")), "vetoed file was completed")
+		vetoed := res.VetoedFiles()
+		rtest.Equals(t, 1, len(vetoed))
+		rtest.Equals(t, filepath.FromSlash("/dir/infected"), vetoed[0].Location)
+		rtest.Equals(t, "found a virus", vetoed[0].Reason.Error())
+
+		_, err = os.Lstat(filepath.Join(tempdir, "dir", "infected"))
+		rtest.Assert(t, errors.Is(err, os.ErrNotExist), "vetoed file still exists: %v", err)
+		if quarantine == "" {
+			rtest.Equals(t, "", vetoed[0].Quarantine)
+		} else {
+			rtest.Equals(t, filepath.Join(quarantine, "dir", "infected"), vetoed[0].Quarantine)
+			data, err := os.ReadFile(vetoed[0].Quarantine)
+			rtest.OK(t, err)
+			rtest.Equals(t, "content: virus\n", string(data))
+		}
+		data, err := os.ReadFile(filepath.Join(tempdir, "clean"))
+		rtest.OK(t, err)
+		rtest.Equals(t, "content: clean\n", string(data))
+	}
+}
@@ -0,0 +1,277 @@
+package restorer
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"fmt"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// ScheduledPack describes a pack which must be downloaded to restore the
+// content of one or more files.
+type ScheduledPack struct {
+	ID restic.ID
+	// Order is the position at which the pack is first accessed when
+	// restoring the files in order.
+	Order int
+	// Size is the stored size of the blobs required from the pack. Blobs
+	// which are used multiple times are counted each time.
+	Size uint64
+	// Blobs is the number of blobs required from the pack.
+	Blobs int
+	// Files are the sorted locations of the files which use blobs from the
+	// pack.
+	Files []string
+	// Priority is the highest priority of the files, see
+	// Restorer.SetFilePriority.
+	Priority int
+}
+
+// Scheduler decides in which order the packs are downloaded, see
+// Options.Scheduler. For each batch of files, see Options.SequentialFiles,
+// Enqueue is called for all packs of the batch. Afterwards, Next is called
+// until it reports that no packs are left. Packs deferred by a PackGate are
+// enqueued again while calling Next. A Scheduler is only used by a single
+// goroutine.
+type Scheduler interface {
+	// Enqueue adds a pack which must be downloaded.
+	Enqueue(pack ScheduledPack)
+	// Next returns the pack to download next. It returns false once all
+	// enqueued packs were returned. Each enqueued pack must be returned
+	// exactly once. If Next waits, for example to limit the number of
+	// downloads, it must return ctx.Err() once ctx is canceled.
+	Next(ctx context.Context) (restic.ID, bool, error)
+}
+
+// PriorityScheduler is implemented by schedulers which support changing the
+// priority of enqueued packs, see Restorer.SetFilePriority.
+type PriorityScheduler interface {
+	Scheduler
+	// Reprioritize changes the priority of an enqueued pack which was not yet
+	// returned by Next.
+	Reprioritize(id restic.ID, priority int)
+}
+
+// packQueue is a priority queue of packs. Packs with a higher priority are
+// returned first, packs with the same priority are ordered by less.
+type packQueue struct {
+	packs []ScheduledPack
+	index map[restic.ID]int
+	less  func(a, b ScheduledPack) bool
+}
+
+func newPackQueue(less func(a, b ScheduledPack) bool) *packQueue {
+	return &packQueue{index: make(map[restic.ID]int), less: less}
+}
+
+func (q *packQueue) Len() int { return len(q.packs) }
+
+func (q *packQueue) Less(i, j int) bool {
+	if q.packs[i].Priority != q.packs[j].Priority {
+		return q.packs[i].Priority > q.packs[j].Priority
+	}
+	return q.less(q.packs[i], q.packs[j])
+}
+
+func (q *packQueue) Swap(i, j int) {
+	q.packs[i], q.packs[j] = q.packs[j], q.packs[i]
+	q.index[q.packs[i].ID] = i
+	q.index[q.packs[j].ID] = j
+}
+
+func (q *packQueue) Push(x any) {
+	pack := x.(ScheduledPack)
+	q.index[pack.ID] = len(q.packs)
+	q.packs = append(q.packs, pack)
+}
+
+func (q *packQueue) Pop() any {
+	pack := q.packs[len(q.packs)-1]
+	q.packs = q.packs[:len(q.packs)-1]
+	delete(q.index, pack.ID)
+	return pack
+}
+
+func (q *packQueue) enqueue(pack ScheduledPack) {
+	heap.Push(q, pack)
+}
+
+func (q *packQueue) next(ctx context.Context) (restic.ID, bool, error) {
+	if ctx.Err() != nil {
+		return restic.ID{}, false, ctx.Err()
+	}
+	if len(q.packs) == 0 {
+		return restic.ID{}, false, nil
+	}
+	return heap.Pop(q).(ScheduledPack).ID, true, nil
+}
+
+func (q *packQueue) reprioritize(id restic.ID, priority int) {
+	i, ok := q.index[id]
+	if !ok {
+		return
+	}
+	q.packs[i].Priority = priority
+	heap.Fix(q, i)
+}
+
+// FirstAccessScheduler downloads the packs in the order in which they are
+// first accessed by the files. While this cannot guarantee that file chunks
+// are restored sequentially, it offers a good enough approximation to shorten
+// restore times by up to 19% in some test. Packs with a higher priority are
+// downloaded first. This is the default Scheduler.
+type FirstAccessScheduler struct {
+	queue *packQueue
+}
+
+// NewFirstAccessScheduler returns a new FirstAccessScheduler.
+func NewFirstAccessScheduler() *FirstAccessScheduler {
+	return &FirstAccessScheduler{queue: newPackQueue(func(a, b ScheduledPack) bool {
+		return a.Order < b.Order
+	})}
+}
+
+// Enqueue implements Scheduler.
+func (s *FirstAccessScheduler) Enqueue(pack ScheduledPack) {
+	s.queue.enqueue(pack)
+}
+
+// Next implements Scheduler.
+func (s *FirstAccessScheduler) Next(ctx context.Context) (restic.ID, bool, error) {
+	return s.queue.next(ctx)
+}
+
+// Reprioritize implements PriorityScheduler.
+func (s *FirstAccessScheduler) Reprioritize(id restic.ID, priority int) {
+	s.queue.reprioritize(id, priority)
+}
+
+// PackIDScheduler downloads the packs of each batch sorted by their ID. This
+// matches the order in which the backends list and store the pack files. It
+// benefits backends and caches which prefetch or serve objects faster when
+// they are read in their natural order, and ensures that repeated restores of
+// the same files request the packs in the same order. Files are usually
+// completed later than with the FirstAccessScheduler. Packs with a higher
+// priority are downloaded first.
+type PackIDScheduler struct {
+	queue *packQueue
+}
+
+// NewPackIDScheduler returns a new PackIDScheduler.
+func NewPackIDScheduler() *PackIDScheduler {
+	return &PackIDScheduler{queue: newPackQueue(func(a, b ScheduledPack) bool {
+		return bytes.Compare(a.ID[:], b.ID[:]) < 0
+	})}
+}
+
+// Enqueue implements Scheduler.
+func (s *PackIDScheduler) Enqueue(pack ScheduledPack) {
+	s.queue.enqueue(pack)
+}
+
+// Next implements Scheduler.
+func (s *PackIDScheduler) Next(ctx context.Context) (restic.ID, bool, error) {
+	return s.queue.next(ctx)
+}
+
+// Reprioritize implements PriorityScheduler.
+func (s *PackIDScheduler) Reprioritize(id restic.ID, priority int) {
+	s.queue.reprioritize(id, priority)
+}
+
+// SmallestFirstScheduler downloads the packs of each batch in ascending order
+// of the size of the blobs required from them, packs of the same size in the
+// order of first access. Files which only require a few small blobs thus
+// complete early, before the large packs take up the bandwidth. Large files
+// are usually completed later than with the FirstAccessScheduler. Packs with
+// a higher priority are downloaded first.
+type SmallestFirstScheduler struct {
+	queue *packQueue
+}
+
+// NewSmallestFirstScheduler returns a new SmallestFirstScheduler.
+func NewSmallestFirstScheduler() *SmallestFirstScheduler {
+	return &SmallestFirstScheduler{queue: newPackQueue(func(a, b ScheduledPack) bool {
+		if a.Size != b.Size {
+			return a.Size < b.Size
+		}
+		return a.Order < b.Order
+	})}
+}
+
+// Enqueue implements Scheduler.
+func (s *SmallestFirstScheduler) Enqueue(pack ScheduledPack) {
+	s.queue.enqueue(pack)
+}
+
+// Next implements Scheduler.
+func (s *SmallestFirstScheduler) Next(ctx context.Context) (restic.ID, bool, error) {
+	return s.queue.next(ctx)
+}
+
+// Reprioritize implements PriorityScheduler.
+func (s *SmallestFirstScheduler) Reprioritize(id restic.ID, priority int) {
+	s.queue.reprioritize(id, priority)
+}
+
+// PackOrder selects one of the built-in schedulers.
+type PackOrder int
+
+// Constants for the different pack orders.
+const (
+	// PackOrderFirstAccess uses the FirstAccessScheduler.
+	PackOrderFirstAccess PackOrder = iota
+	// PackOrderPackID uses the PackIDScheduler.
+	PackOrderPackID
+	// PackOrderSmallestFirst uses the SmallestFirstScheduler.
+	PackOrderSmallestFirst
+	PackOrderInvalid
+)
+
+// NewScheduler returns a new scheduler for the pack order.
+func (o PackOrder) NewScheduler() Scheduler {
+	switch o {
+	case PackOrderPackID:
+		return NewPackIDScheduler()
+	case PackOrderSmallestFirst:
+		return NewSmallestFirstScheduler()
+	default:
+		return NewFirstAccessScheduler()
+	}
+}
+
+// Set implements the method needed for pflag command flag parsing.
+func (o *PackOrder) Set(s string) error {
+	switch s {
+	case "first-access":
+		*o = PackOrderFirstAccess
+	case "pack-id":
+		*o = PackOrderPackID
+	case "smallest-first":
+		*o = PackOrderSmallestFirst
+	default:
+		*o = PackOrderInvalid
+		return fmt.Errorf("invalid pack order %q, must be one of (first-access|pack-id|smallest-first)", s)
+	}
+
+	return nil
+}
+
+func (o *PackOrder) String() string {
+	switch *o {
+	case PackOrderFirstAccess:
+		return "first-access"
+	case PackOrderPackID:
+		return "pack-id"
+	case PackOrderSmallestFirst:
+		return "smallest-first"
+	default:
+		return "invalid"
+	}
+}
+
+func (o *PackOrder) Type() string {
+	return "order"
+}
@@ -0,0 +1,207 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// reverseScheduler downloads the packs in reverse order of first access. If
+// drop is set, the last pack is never returned.
+type reverseScheduler struct {
+	enqueued []ScheduledPack
+	queue    restic.IDs
+	drop     bool
+}
+
+func (s *reverseScheduler) Enqueue(pack ScheduledPack) {
+	s.enqueued = append(s.enqueued, pack)
+	s.queue = append(s.queue, pack.ID)
+}
+
+func (s *reverseScheduler) Next(ctx context.Context) (restic.ID, bool, error) {
+	if ctx.Err() != nil {
+		return restic.ID{}, false, ctx.Err()
+	}
+	if len(s.queue) == 0 || (s.drop && len(s.queue) == 1) {
+		return restic.ID{}, false, nil
+	}
+	id := s.queue[len(s.queue)-1]
+	s.queue = s.queue[:len(s.queue)-1]
+	return id, true, nil
+}
+
+func TestFileRestorerScheduler(t *testing.T) {
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+				{"data2-2", "pack3"},
+			},
+		},
+	}
+	repo := newTestRepo(content)
+	packOf := func(data string) restic.ID {
+		return repo.blobs[restic.Hash([]byte(data))][0].PackID()
+	}
+
+	var loaded restic.IDs
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		loaded = append(loaded, packID)
+		return repo.loader(ctx, packID, handles, handleBlobFn)
+	}
+
+	scheduler := &reverseScheduler{}
+	r := newFileRestorer(rtest.TempDir(t), loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.scheduler = scheduler
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+
+	rtest.Equals(t, restic.IDs{packOf("data2-2"), packOf("data1-2"), packOf("data1-1")}, loaded)
+	rtest.Equals(t, 3, len(scheduler.enqueued))
+	pack2 := scheduler.enqueued[1]
+	rtest.Equals(t, packOf("data1-2"), pack2.ID)
+	rtest.Equals(t, 1, pack2.Order)
+	rtest.Equals(t, 2, pack2.Blobs)
+	rtest.Equals(t, uint64(len("data1-2")+len("data2-1")), pack2.Size)
+	rtest.Equals(t, []string{"file1", "file2"}, pack2.Files)
+
+	for _, file := range content {
+		data, err := os.ReadFile(r.targetPath(file.name))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.filesPathToContent[file.name], string(data))
+	}
+}
+
+func TestFileRestorerSchedulerMissingPack(t *testing.T) {
+	repo := newTestRepo([]TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+	})
+
+	r := newFileRestorer(rtest.TempDir(t), repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.scheduler = &reverseScheduler{drop: true}
+	err := r.restoreFiles(context.TODO())
+	rtest.Assert(t, err != nil && strings.Contains(err.Error(), "only 1 of 2 packs"), "unexpected error %v", err)
+}
+
+func TestPackIDScheduler(t *testing.T) {
+	ids := restic.IDs{restic.NewRandomID(), restic.NewRandomID(), restic.NewRandomID()}
+	s := NewPackIDScheduler()
+	// two batches
+	for _, batch := range []restic.IDs{ids, ids[1:]} {
+		for i, id := range batch {
+			s.Enqueue(ScheduledPack{ID: id, Order: i})
+		}
+		var scheduled restic.IDs
+		for {
+			id, ok, err := s.Next(context.TODO())
+			rtest.OK(t, err)
+			if !ok {
+				break
+			}
+			scheduled = append(scheduled, id)
+		}
+		expected := append(restic.IDs{}, batch...)
+		sort.Sort(expected)
+		rtest.Equals(t, expected, scheduled)
+	}
+}
+
+func TestFileRestorerSmallestFirstScheduler(t *testing.T) {
+	repo := newTestRepo([]TestFile{
+		{name: "large", blobs: []TestBlob{{"data-large-1", "pack1"}, {"data-large-2", "pack1"}, {"data-large-3", "pack1"}}},
+		{name: "medium", blobs: []TestBlob{{"data-medium-1", "pack2"}, {"data-medium-2", "pack2"}}},
+		{name: "small", blobs: []TestBlob{{"data-small", "pack3"}}},
+		{name: "small2", blobs: []TestBlob{{"data-small", "pack3"}, {"data-tiny", "pack4"}}},
+	})
+	packOf := func(data string) restic.ID {
+		return repo.blobs[restic.Hash([]byte(data))][0].PackID()
+	}
+
+	var loaded restic.IDs
+	loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		loaded = append(loaded, packID)
+		return repo.loader(ctx, packID, handles, handleBlobFn)
+	}
+
+	r := newFileRestorer(rtest.TempDir(t), loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.scheduler = PackOrderSmallestFirst.NewScheduler()
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+
+	// the blob in pack3 is counted for both files which use it
+	rtest.Equals(t, restic.IDs{packOf("data-tiny"), packOf("data-small"), packOf("data-medium-1"), packOf("data-large-1")}, loaded)
+	for _, file := range repo.files {
+		data, err := os.ReadFile(r.targetPath(file.location))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.fileContent(file), string(data))
+	}
+}
+
+// BenchmarkSchedulers is a harness to compare the schedulers. The loader
+// counts the packs which are not requested in ascending ID order, which would
+// require a seek for backends laid out in their natural order. To measure an
+// actual backend, replace the loader.
+func BenchmarkSchedulers(b *testing.B) {
+	var content []TestFile
+	for i := 0; i < 50; i++ {
+		file := TestFile{name: fmt.Sprintf("file%d", i)}
+		for j := 0; j < 8; j++ {
+			file.blobs = append(file.blobs, TestBlob{fmt.Sprintf("data%d-%d", i, j), fmt.Sprintf("pack%d", (i*7+j*13)%40)})
+		}
+		content = append(content, file)
+	}
+
+	zeroChunk := repository.TestRepository(b).ChunkerFactory().ZeroChunk()
+	for _, order := range []PackOrder{PackOrderFirstAccess, PackOrderPackID, PackOrderSmallestFirst} {
+		b.Run(order.String(), func(b *testing.B) {
+			seeks := 0
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				repo := newTestRepo(content)
+				var last restic.ID
+				loader := func(ctx context.Context, packID restic.ID, handles []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+					if !restic.IDs([]restic.ID{last, packID}).Less(0, 1) {
+						seeks++
+					}
+					last = packID
+					return repo.loader(ctx, packID, handles, handleBlobFn)
+				}
+				r := newFileRestorer(b.TempDir(), loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil, zeroChunk)
+				r.files = repo.files
+				r.scheduler = order.NewScheduler()
+				b.StartTimer()
+
+				if err := r.restoreFiles(context.TODO()); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(seeks)/float64(b.N), "seeks/op")
+		})
+	}
+}
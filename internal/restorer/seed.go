@@ -0,0 +1,253 @@
+package restorer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// SeedStats summarizes the file content copied from the seed directory
+// instead of downloading it, see Options.Seed.
+type SeedStats struct {
+	// Blobs is the number of blobs copied from the seed directory.
+	Blobs uint64
+	// Bytes is the size of these blobs.
+	Bytes uint64
+	// Stale is the number of blobs which were downloaded although the seed
+	// index listed them, as the seed file no longer contained them.
+	Stale uint64
+	// FetchedBytes is the size of the blobs downloaded from the repository
+	// after decompression.
+	FetchedBytes uint64
+}
+
+// seedEntry is a chunk of a file in the seed directory. Path is relative to
+// the seed directory. It is also the format of the lines of a seed index file.
+type seedEntry struct {
+	Path   string    `json:"path"`
+	Offset int64     `json:"offset"`
+	Length uint      `json:"length"`
+	ID     restic.ID `json:"id"`
+}
+
+// seedIndex locates the blobs contained in the files of a seed directory. It
+// is safe for concurrent use, all methods are no-ops for a nil receiver.
+type seedIndex struct {
+	dir    string
+	chunks map[restic.ID]seedEntry
+	blobs  atomic.Uint64
+	bytes  atomic.Uint64
+	stale  atomic.Uint64
+}
+
+// openSeed returns the index of the seed directory dir. If indexFile is set
+// and exists, the precomputed index is loaded from it. Otherwise, the files
+// in dir except for those below exclude are split into chunks using the
+// repository's chunker and, if indexFile is set, the index is saved to it.
+func openSeed(ctx context.Context, dir, indexFile, exclude string, chnker restic.Chunker) (*seedIndex, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err = filepath.Abs(exclude)
+	if err != nil {
+		return nil, err
+	}
+	s := &seedIndex{dir: dir, chunks: make(map[restic.ID]seedEntry)}
+	if indexFile != "" {
+		f, err := fs.OpenFile(indexFile, fs.O_RDONLY, 0)
+		if err == nil {
+			defer func() {
+				_ = f.Close()
+			}()
+			return s, s.load(f)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, errors.Wrap(err, "open seed index")
+		}
+	}
+
+	if err := s.scan(ctx, exclude, chnker); err != nil {
+		return nil, err
+	}
+	if indexFile != "" {
+		if err := s.save(indexFile); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *seedIndex) load(rd io.Reader) error {
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry seedEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return errors.Wrap(err, "read seed index")
+		}
+		s.chunks[entry.ID] = entry
+	}
+	return errors.Wrap(scanner.Err(), "read seed index")
+}
+
+func (s *seedIndex) save(indexFile string) error {
+	f, err := fs.OpenFile(indexFile, fs.O_WRONLY|fs.O_CREATE|fs.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "create seed index")
+	}
+	wr := bufio.NewWriter(f)
+	enc := json.NewEncoder(wr)
+	for _, entry := range s.chunks {
+		if err := enc.Encode(entry); err != nil {
+			_ = f.Close()
+			return errors.Wrap(err, "write seed index")
+		}
+	}
+	if err := wr.Flush(); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "write seed index")
+	}
+	return errors.Wrap(f.Close(), "write seed index")
+}
+
+// scan adds the chunks of all regular files in the seed directory. Files
+// which cannot be read are skipped.
+func (s *seedIndex) scan(ctx context.Context, exclude string, chnker restic.Chunker) error {
+	var buf []byte
+	return filepath.WalkDir(s.dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			debug.Log("skipping seed path %v: %v", path, err)
+			return nil
+		}
+		if d.IsDir() && path == exclude {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, path)
+		if err != nil {
+			return err
+		}
+
+		f, err := fs.OpenFile(path, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+		if err != nil {
+			debug.Log("skipping seed file %v: %v", path, err)
+			return nil
+		}
+		var chunks map[int64]restic.ID
+		chunks, buf, err = chunkFile(ctx, f, chnker, buf)
+		var size int64
+		if err == nil {
+			size, err = f.Seek(0, io.SeekCurrent)
+		}
+		_ = f.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			debug.Log("skipping seed file %v: %v", path, err)
+			return nil
+		}
+
+		offsets := make([]int64, 0, len(chunks))
+		for offset := range chunks {
+			offsets = append(offsets, offset)
+		}
+		slices.Sort(offsets)
+		for i, offset := range offsets {
+			end := size
+			if i+1 < len(offsets) {
+				end = offsets[i+1]
+			}
+			s.chunks[chunks[offset]] = seedEntry{Path: rel, Offset: offset, Length: uint(end - offset), ID: chunks[offset]}
+		}
+		return nil
+	})
+}
+
+// contains reports whether the index lists any of the blobs.
+func (s *seedIndex) contains(blobs blobToFileOffsetsMapping) bool {
+	if s == nil {
+		return false
+	}
+	for id := range blobs {
+		if _, ok := s.chunks[id]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// get reads the content of the blob id with the given length from the seed
+// directory. As the seed files may have changed since they were indexed,
+// the content is only returned if its hash matches id.
+func (s *seedIndex) get(id restic.ID, length uint) ([]byte, bool) {
+	if s == nil {
+		return nil, false
+	}
+	entry, ok := s.chunks[id]
+	if !ok || entry.Length != length {
+		return nil, false
+	}
+
+	buf, err := s.read(entry)
+	if err != nil || restic.Hash(buf) != id {
+		debug.Log("seed file %v no longer contains blob %v at offset %d: %v", entry.Path, id.Str(), entry.Offset, err)
+		s.stale.Add(1)
+		return nil, false
+	}
+	s.blobs.Add(1)
+	s.bytes.Add(uint64(length))
+	return buf, true
+}
+
+func (s *seedIndex) read(entry seedEntry) ([]byte, error) {
+	f, err := fs.OpenFile(filepath.Join(s.dir, entry.Path), fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	buf := make([]byte, entry.Length)
+	_, err = f.ReadAt(buf, entry.Offset)
+	return buf, err
+}
+
+func (s *seedIndex) stats() SeedStats {
+	if s == nil {
+		return SeedStats{}
+	}
+	return SeedStats{
+		Blobs: s.blobs.Load(),
+		Bytes: s.bytes.Load(),
+		Stale: s.stale.Load(),
+	}
+}
+
+// Seed returns the statistics of the blobs copied from the seed directory. It
+// is only available once RestoreTo has completed and is empty unless
+// Options.Seed is set.
+func (res *Restorer) Seed() SeedStats {
+	if res.seed == nil {
+		return SeedStats{}
+	}
+	stats := res.seed.stats()
+	stats.FetchedBytes = res.compression.DecompressedBytes
+	return stats
+}
@@ -0,0 +1,64 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerSeed(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n"},
+			"bar": File{Data: "content: bar\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	seed := rtest.TempDir(t)
+	rtest.OK(t, os.MkdirAll(filepath.Join(seed, "old"), 0700))
+	rtest.OK(t, os.WriteFile(filepath.Join(seed, "old", "foo"), []byte("content: foo\n"), 0600))
+	rtest.OK(t, os.WriteFile(filepath.Join(seed, "other"), []byte("content: bar\n"), 0600))
+	index := filepath.Join(rtest.TempDir(t), "seed.index")
+
+	restore := func() SeedStats {
+		tempdir := rtest.TempDir(t)
+		res := NewRestorer(repo, sn, Options{Seed: seed, SeedIndex: index})
+		_, err := res.RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+		for name, content := range map[string]string{"foo": "content: foo\n", "bar": "content: bar\n"} {
+			data, err := os.ReadFile(filepath.Join(tempdir, name))
+			rtest.OK(t, err)
+			rtest.Equals(t, content, string(data))
+		}
+		return res.Seed()
+	}
+
+	// the index is created by the first restore
+	stats := restore()
+	rtest.Equals(t, SeedStats{Blobs: 2, Bytes: 26}, stats)
+	_, err := os.Stat(index)
+	rtest.OK(t, err)
+
+	// the second restore uses the saved index, which is stale for other
+	rtest.OK(t, os.WriteFile(filepath.Join(seed, "other"), []byte("content: baz\n"), 0600))
+	stats = restore()
+	rtest.Equals(t, SeedStats{Blobs: 1, Bytes: 13, Stale: 1, FetchedBytes: 13}, stats)
+}
+
+func TestRestorerSeedIndexRequiresSeed(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"foo": File{Data: "content: foo\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	res := NewRestorer(repo, sn, Options{SeedIndex: filepath.Join(rtest.TempDir(t), "seed.index")})
+	_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+	rtest.Assert(t, err != nil, "expected error for a seed index without seed directory")
+}
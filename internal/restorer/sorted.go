@@ -0,0 +1,140 @@
+package restorer
+
+import (
+	"context"
+	"os"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// sortedEntries records the entries which the first pass created in the
+// order of their names, see Options.SortedEntries. All methods are safe to
+// call on a nil pointer.
+type sortedEntries struct {
+	// regular files which were created before writing their content
+	files map[string]struct{}
+	// hardlinks and special files which were handled completely by the first
+	// pass, the value reports whether a hardlink was created
+	nodes map[string]bool
+}
+
+func newSortedEntries() *sortedEntries {
+	return &sortedEntries{
+		files: make(map[string]struct{}),
+		nodes: make(map[string]bool),
+	}
+}
+
+func (s *sortedEntries) hasFile(location string) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.files[location]
+	return ok
+}
+
+// handled reports whether the first pass already handled the hardlink or
+// special file at location and whether it created a hardlink.
+func (s *sortedEntries) handled(location string) (linked bool, ok bool) {
+	if s == nil {
+		return false, false
+	}
+	linked, ok = s.nodes[location]
+	return linked, ok
+}
+
+// createSortedFile creates an empty file for location, which takes its place
+// among the directory entries before the content is downloaded.
+func (res *Restorer) createSortedFile(fr *fileRestorer, location string) error {
+	if err := fr.truncateFileToSize(location, 0); err != nil {
+		return err
+	}
+	res.sorted.files[location] = struct{}{}
+	return nil
+}
+
+// createSortedNode creates the special file at location during the first
+// pass, which the second pass then skips.
+func (res *Restorer) createSortedNode(ctx context.Context, node *data.Node, target, location string) error {
+	res.sorted.nodes[location] = false
+	_, err := res.withOverwriteCheck(ctx, node, target, location, false, nil, func(_ bool, _ *fileState) error {
+		return res.restoreNodeTo(node, target, location)
+	})
+	return err
+}
+
+// createSortedHardlink creates the hardlink at location to the file at
+// linkTarget during the first pass. Its metadata is restored by the second
+// pass. Hardlinks to files which were not created by the first pass are left
+// to the second pass, as the content pass replaces existing files with
+// multiple links.
+func (res *Restorer) createSortedHardlink(ctx context.Context, fr *fileRestorer, node *data.Node, target, location, linkTarget string) error {
+	if !res.sorted.hasFile(linkTarget) {
+		return nil
+	}
+	res.sorted.nodes[location] = false
+	_, err := res.withOverwriteCheck(ctx, node, target, location, true, nil, func(_ bool, _ *fileState) error {
+		if err := fs.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrap(err, "RemoveCreateHardlink")
+		}
+		path := fr.targetPath(linkTarget)
+		if err := fs.Link(path, target); err != nil {
+			return errors.WithStack(err)
+		}
+		fr.filesWriter.linked[path] = struct{}{}
+		res.sorted.nodes[location] = true
+		return nil
+	})
+	return err
+}
+
+// removeSortedHardlink removes the hardlink created by the first pass if its
+// link target was not restored after all.
+func (res *Restorer) removeSortedHardlink(target, location string) error {
+	if linked, _ := res.sorted.handled(location); !linked {
+		return nil
+	}
+	if err := fs.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrap(err, "RemoveHardlink")
+	}
+	return nil
+}
+
+// removeSkippedSortedFiles removes the files created by the first pass whose
+// content was not restored, for example due to the size quota.
+func (res *Restorer) removeSkippedSortedFiles(fr *fileRestorer) error {
+	if res.sorted == nil {
+		return nil
+	}
+	for location := range res.sorted.files {
+		if _, ok := res.fileList[location]; ok {
+			continue
+		}
+		debug.Log("%sremoving skipped file %v", res.logPrefix, location)
+		if err := fs.Remove(fr.targetPath(location)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			if err := res.sanitizeError(location, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// openLinkedFile opens the file at path for writing like createFile, but
+// keeps the file although it has multiple links. This is used for the files
+// whose hardlinks were created by the first pass.
+func openLinkedFile(root *targetRoot, path string, createSize int64, sparse bool) (*os.File, error) {
+	f, err := openFile(root, path)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return ensureSize(f, fi, createSize, sparse)
+}
@@ -0,0 +1,73 @@
+//go:build !windows
+
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerSortedEntries(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"a": File{Data: "content: a\n", Inode: 1, Links: 2},
+					"b": Symlink{Target: "a"},
+					"c": File{Data: "content: c\n"},
+					"d": File{Data: "content: a\n", Inode: 1, Links: 2},
+					"e": File{Data: "content: e\n"},
+					"f": File{},
+				},
+			},
+		},
+	}, noopGetGenericAttributes)
+
+	tempdir := rtest.TempDir(t)
+	dir := filepath.Join(tempdir, "dir")
+	res := NewRestorer(repo, sn, Options{SortedEntries: true})
+
+	// the events are sent while restoring, thus the entries which appear
+	// between two events must be sorted after all entries which appeared
+	// before
+	var created []string
+	poll := func() {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		var added []string
+		for _, entry := range entries {
+			if !slices.Contains(created, entry.Name()) {
+				added = append(added, entry.Name())
+			}
+		}
+		slices.Sort(added)
+		created = append(created, added...)
+	}
+	res.Event = func(_ Event) {
+		poll()
+	}
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	poll()
+
+	rtest.Equals(t, []string{"a", "b", "c", "d", "e", "f"}, created)
+	for name, content := range map[string]string{"a": "content: a\n", "c": "content: c\n", "d": "content: a\n", "e": "content: e\n", "f": ""} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, content, string(data))
+	}
+	fiA, err := os.Stat(filepath.Join(dir, "a"))
+	rtest.OK(t, err)
+	fiD, err := os.Stat(filepath.Join(dir, "d"))
+	rtest.OK(t, err)
+	rtest.Assert(t, os.SameFile(fiA, fiD), "hardlink was not restored")
+}
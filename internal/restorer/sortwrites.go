@@ -0,0 +1,80 @@
+package restorer
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+// packWrites queues the writes of the blobs of a pack, such that they can be
+// issued ordered by file and offset once the whole pack was loaded. All
+// methods are no-ops for a nil receiver.
+type packWrites struct {
+	m      sync.Mutex
+	writes []packWrite
+}
+
+type packWrite struct {
+	file    *fileInfo
+	offset  int64
+	blob    restic.BlobHandle
+	data    []byte
+	damaged bool
+}
+
+// newPackWrites returns a queue for the writes of a pack if the writes are
+// sorted and nil otherwise.
+func (r *fileRestorer) newPackWrites() *packWrites {
+	if !r.sortWrites {
+		return nil
+	}
+	return &packWrites{}
+}
+
+// add queues writing data to all files at the given offsets. The loader may
+// reuse the buffer for the next blob, thus data is copied.
+func (w *packWrites) add(files map[*fileInfo][]int64, h restic.BlobHandle, data []byte, damaged bool) {
+	data = bytes.Clone(data)
+	w.m.Lock()
+	defer w.m.Unlock()
+	for file, offsets := range files {
+		for _, offset := range offsets {
+			w.writes = append(w.writes, packWrite{file: file, offset: offset, blob: h, data: data, damaged: damaged})
+		}
+	}
+}
+
+// flush writes all queued blobs ordered by file location and offset.
+func (w *packWrites) flush(ctx context.Context, r *fileRestorer) error {
+	if w == nil {
+		return nil
+	}
+	w.m.Lock()
+	writes := w.writes
+	w.writes = nil
+	w.m.Unlock()
+
+	slices.SortFunc(writes, func(a, b packWrite) int {
+		if c := strings.Compare(a.file.location, b.file.location); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.offset, b.offset)
+	})
+	for _, write := range writes {
+		if r.canceled.skip(write.file) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := r.writeBlob(ctx, write.file, write.offset, write.blob, write.data, write.damaged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// interleavedContent returns files whose blobs are interleaved within each
+// pack, like for files which were backed up concurrently. Each file uses
+// blobs/packs consecutive blobs of each pack. The first file only determines
+// the layout of the packs and must not be restored.
+func interleavedContent(files, blobs, packs int) []TestFile {
+	blob := func(i, j int) TestBlob {
+		return TestBlob{fmt.Sprintf("data%d-%d", i, j), fmt.Sprintf("pack%d", j*packs/blobs)}
+	}
+	layout := TestFile{name: "layout"}
+	for j := 0; j < blobs; j++ {
+		for i := 0; i < files; i++ {
+			layout.blobs = append(layout.blobs, blob(i, j))
+		}
+	}
+	content := []TestFile{layout}
+	for i := 0; i < files; i++ {
+		file := TestFile{name: fmt.Sprintf("file%d", i)}
+		for j := 0; j < blobs; j++ {
+			file.blobs = append(file.blobs, blob(i, j))
+		}
+		content = append(content, file)
+	}
+	return content
+}
+
+// writeRecorder records the writes passed to the faultInjector. seeks counts
+// the writes which do not continue the previous write.
+type writeRecorder struct {
+	m      sync.Mutex
+	writes []string
+	seeks  int
+	path   string
+	end    int64
+}
+
+func (w *writeRecorder) injector() *faultInjector {
+	return &faultInjector{writeData: func(path string, offset int64, blob []byte) []byte {
+		w.m.Lock()
+		defer w.m.Unlock()
+		if path != w.path || offset != w.end {
+			w.seeks++
+		}
+		w.path, w.end = path, offset+int64(len(blob))
+		w.writes = append(w.writes, fmt.Sprintf("%s@%03d", filepath.Base(path), offset))
+		return blob
+	}}
+}
+
+func TestFileRestorerSortWrites(t *testing.T) {
+	content := interleavedContent(3, 6, 2)
+	for _, sections := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sections=%v", sections), func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			repo := newTestRepo(content)
+
+			r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+				repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+			r.files = repo.files[1:]
+			r.sortWrites = true
+			if sections {
+				r.decodeWorkers = 2
+				r.sectionsLoader = func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleSectionFn func(section restic.PackSection) error) error {
+					// pass each blob as a separate section
+					for _, blob := range blobs {
+						if err := handleSectionFn(&testPackSection{repo.loader, packID, []restic.BlobHandle{blob}}); err != nil {
+							return err
+						}
+					}
+					return nil
+				}
+			}
+			recorder := &writeRecorder{}
+			r.setFaultInjector(recorder.injector())
+
+			rtest.OK(t, r.restoreFiles(context.TODO()))
+
+			// the writes of each pack are ordered by file and offset
+			perPack := len(recorder.writes) / 2
+			for _, writes := range [][]string{recorder.writes[:perPack], recorder.writes[perPack:]} {
+				for i := 1; i < len(writes); i++ {
+					rtest.Assert(t, writes[i-1] < writes[i], "unsorted writes %v", writes)
+				}
+			}
+			for _, file := range r.files {
+				data, err := os.ReadFile(r.targetPath(file.location))
+				rtest.OK(t, err)
+				rtest.Equals(t, repo.fileContent(file), string(data))
+			}
+		})
+	}
+}
+
+// BenchmarkSortWrites compares the number of writes which do not continue the
+// previous write, which would require a seek on a hard disk. To measure an
+// actual disk, replace the temporary directory.
+func BenchmarkSortWrites(b *testing.B) {
+	content := interleavedContent(20, 16, 4)
+	zeroChunk := repository.TestRepository(b).ChunkerFactory().ZeroChunk()
+	for _, sortWrites := range []bool{false, true} {
+		b.Run(fmt.Sprintf("sort=%v", sortWrites), func(b *testing.B) {
+			seeks := 0
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				repo := newTestRepo(content)
+				r := newFileRestorer(b.TempDir(), repo.loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil, zeroChunk)
+				r.files = repo.files[1:]
+				r.sortWrites = sortWrites
+				recorder := &writeRecorder{}
+				r.setFaultInjector(recorder.injector())
+				b.StartTimer()
+
+				if err := r.restoreFiles(context.TODO()); err != nil {
+					b.Fatal(err)
+				}
+				seeks += recorder.seeks
+			}
+			b.ReportMetric(float64(seeks)/float64(b.N), "seeks/op")
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package restorer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/ui"
+)
+
+// defaultFreeSpaceInterval is used if Options.FreeSpaceInterval is not set.
+const defaultFreeSpaceInterval = 10 * time.Second
+
+// spaceWatchdog pauses scheduling further packs while the free space on the
+// target filesystem is below threshold, for example as another process is
+// filling the disk. Packs which are already being downloaded are completed.
+type spaceWatchdog struct {
+	path      string
+	threshold uint64
+	// the free space is checked at most once per interval
+	interval  time.Duration
+	freeSpace func(path string) (free uint64, ok bool, err error)
+	// reports the pauses, may be nil
+	info func(string)
+
+	lastCheck time.Time
+	disabled  bool
+	// number and total duration of the pauses
+	pauses      int
+	pausedTotal time.Duration
+}
+
+func newSpaceWatchdog(path string, threshold uint64, interval time.Duration, info func(string)) *spaceWatchdog {
+	if interval <= 0 {
+		interval = defaultFreeSpaceInterval
+	}
+	return &spaceWatchdog{
+		path:      path,
+		threshold: threshold,
+		interval:  interval,
+		freeSpace: freeSpace,
+		info:      info,
+	}
+}
+
+func (w *spaceWatchdog) report(msg string) {
+	if w.info != nil {
+		w.info(msg)
+	}
+}
+
+// check returns the free space and whether it is below the threshold. The
+// watchdog disables itself if the free space cannot be determined.
+func (w *spaceWatchdog) check() (uint64, bool) {
+	w.lastCheck = time.Now()
+	free, ok, err := w.freeSpace(w.path)
+	if err != nil || !ok {
+		debug.Log("unable to determine free space for %v: %v", w.path, err)
+		w.disabled = true
+		w.report("free space cannot be determined for the target directory, not monitoring it")
+		return 0, false
+	}
+	return free, free < w.threshold
+}
+
+// wait blocks while the free space is below the threshold. It returns early
+// with true if stop is closed or fires. The nil watchdog never blocks.
+func (w *spaceWatchdog) wait(ctx context.Context, stop <-chan time.Time) (bool, error) {
+	if w == nil || w.disabled || time.Since(w.lastCheck) < w.interval {
+		return false, nil
+	}
+	free, low := w.check()
+	if !low {
+		return false, nil
+	}
+
+	w.pauses++
+	started := time.Now()
+	defer func() {
+		w.pausedTotal += time.Since(started)
+	}()
+	w.report(fmt.Sprintf("pausing the restore, only %v of free space left in the target directory, waiting for %v",
+		ui.FormatBytes(free), ui.FormatBytes(w.threshold)))
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for low {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-stop:
+			return true, nil
+		case <-ticker.C:
+			free, low = w.check()
+		}
+	}
+	w.report(fmt.Sprintf("resuming the restore after %v, %v of free space available",
+		time.Since(started).Round(time.Second), ui.FormatBytes(free)))
+	return false, nil
+}
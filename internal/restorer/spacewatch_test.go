@@ -0,0 +1,105 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testSpaceWatchdog(free ...uint64) (*spaceWatchdog, *[]string) {
+	var messages []string
+	w := newSpaceWatchdog("target", 100, time.Millisecond, func(msg string) {
+		messages = append(messages, msg)
+	})
+	w.freeSpace = func(path string) (uint64, bool, error) {
+		if len(free) == 0 {
+			return 0, false, errors.New("no more values")
+		}
+		next := free[0]
+		free = free[1:]
+		return next, true, nil
+	}
+	return w, &messages
+}
+
+func TestSpaceWatchdog(t *testing.T) {
+	w, messages := testSpaceWatchdog(200, 50, 10, 100)
+	for i := 0; i < 2; i++ {
+		time.Sleep(w.interval)
+		stop, err := w.wait(context.TODO(), nil)
+		rtest.OK(t, err)
+		rtest.Equals(t, false, stop)
+	}
+	rtest.Equals(t, 1, w.pauses)
+	rtest.Equals(t, 2, len(*messages))
+	rtest.Assert(t, strings.HasPrefix((*messages)[0], "pausing the restore, only 50 B of free space left"), "unexpected message %q", (*messages)[0])
+	rtest.Assert(t, strings.Contains((*messages)[1], "100 B of free space available"), "unexpected message %q", (*messages)[1])
+
+	// the free space is checked at most once per interval
+	w.interval = time.Hour
+	stop, err := w.wait(context.TODO(), nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, false, stop)
+}
+
+func TestSpaceWatchdogStop(t *testing.T) {
+	w, _ := testSpaceWatchdog(50, 50, 50, 50)
+	stopCh := make(chan time.Time)
+	close(stopCh)
+	stop, err := w.wait(context.TODO(), stopCh)
+	rtest.OK(t, err)
+	rtest.Equals(t, true, stop)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	time.Sleep(w.interval)
+	_, err = w.wait(ctx, nil)
+	rtest.Assert(t, errors.Is(err, context.Canceled), "expected canceled, got %v", err)
+}
+
+func TestSpaceWatchdogUnsupported(t *testing.T) {
+	w, messages := testSpaceWatchdog()
+	stop, err := w.wait(context.TODO(), nil)
+	rtest.OK(t, err)
+	rtest.Equals(t, false, stop)
+	rtest.Assert(t, w.disabled, "expected watchdog to be disabled")
+	rtest.Equals(t, 1, len(*messages))
+}
+
+func TestFileRestorerSpaceWatchdog(t *testing.T) {
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+		{
+			name:  "file2",
+			blobs: []TestBlob{{"data2-1", "pack3"}},
+		},
+	}
+	repo := newTestRepo(content)
+	tempdir := rtest.TempDir(t)
+	r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	files := repo.files
+	// the free space drops below the threshold before the first pack
+	r.spaceWatch, _ = testSpaceWatchdog(10, 10, 100, 100, 100)
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Equals(t, 1, r.spaceWatch.pauses)
+
+	for _, file := range files {
+		data, err := os.ReadFile(r.targetPath(file.location))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.fileContent(file), string(data))
+	}
+}
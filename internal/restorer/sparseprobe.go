@@ -0,0 +1,137 @@
+package restorer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// SparseUnsupportedBehavior specifies how to handle a target filesystem which
+// does not support sparse files, see Options.SparseUnsupported.
+type SparseUnsupportedBehavior int
+
+// Constants for different sparse unsupported behavior
+const (
+	// SparseFallback writes the files completely, including all zeros.
+	SparseFallback SparseUnsupportedBehavior = iota
+	// SparseWarn is like SparseFallback, but also prints a warning.
+	SparseWarn
+	// SparseFail aborts the restore before any file is written.
+	SparseFail
+	SparseInvalid
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (c *SparseUnsupportedBehavior) Set(s string) error {
+	switch s {
+	case "fallback":
+		*c = SparseFallback
+	case "warn":
+		*c = SparseWarn
+	case "fail":
+		*c = SparseFail
+	default:
+		*c = SparseInvalid
+		return fmt.Errorf("invalid sparse unsupported behavior %q, must be one of (fallback|warn|fail)", s)
+	}
+
+	return nil
+}
+
+func (c *SparseUnsupportedBehavior) String() string {
+	switch *c {
+	case SparseFallback:
+		return "fallback"
+	case SparseWarn:
+		return "warn"
+	case SparseFail:
+		return "fail"
+	default:
+		return "invalid"
+	}
+}
+
+func (c *SparseUnsupportedBehavior) Type() string {
+	return "behavior"
+}
+
+// size of the probe file, which only contains a hole followed by a single byte
+const sparseProbeSize = 1 << 20
+
+// probeSparse reports whether files in dir can be sparse. It creates a probe
+// file which ends with a hole, checks whether the hole uses disk space and
+// removes the file again. The timestamps of dir are restored afterwards.
+func probeSparse(dir string) (bool, error) {
+	fi, err := fs.Lstat(dir)
+	if err != nil {
+		return false, err
+	}
+	f, err := os.CreateTemp(dir, ".restic-sparse-probe-")
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err := fs.Remove(f.Name()); err != nil {
+			debug.Log("unable to remove sparse probe %v: %v", f.Name(), err)
+		}
+		stat := fs.ExtendedStat(fi)
+		if err := os.Chtimes(dir, stat.AccessTime, stat.ModTime); err != nil {
+			debug.Log("unable to restore modification time of %v: %v", dir, err)
+		}
+	}()
+
+	sparse, err := func() (bool, error) {
+		if err := truncateSparse(f, sparseProbeSize); err != nil {
+			return false, err
+		}
+		if _, err := f.WriteAt([]byte{1}, sparseProbeSize-1); err != nil {
+			return false, err
+		}
+		if err := f.Sync(); err != nil {
+			return false, err
+		}
+		return isSparse(f, sparseProbeSize)
+	}()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return sparse, err
+}
+
+// checkSparse probes whether the target filesystem supports sparse files and
+// returns whether files should be restored as sparse according to
+// Options.SparseUnsupported.
+func (res *Restorer) checkSparse(dst string) (bool, error) {
+	probe := res.sparseProbe
+	if probe == nil {
+		probe = probeSparse
+	}
+	sparse, err := probe(dst)
+	if err != nil {
+		return false, errors.Wrap(err, "probing sparse file support")
+	}
+	if sparse {
+		return true, nil
+	}
+
+	debug.Log("%starget filesystem of %v does not support sparse files", res.logPrefix, dst)
+	switch res.opts.SparseUnsupported {
+	case SparseFail:
+		return false, errors.Errorf("target filesystem of %v does not support sparse files", dst)
+	case SparseWarn:
+		res.Warn("target filesystem does not support sparse files, restoring the files completely")
+	default:
+		res.Info("target filesystem does not support sparse files, restoring the files completely")
+	}
+	res.sparseFallback = true
+	return false, nil
+}
+
+// SparseFallback reports whether the files were not restored as sparse as the
+// target filesystem does not support sparse files, see Options.Sparse.
+func (res *Restorer) SparseFallback() bool {
+	return res.sparseFallback
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+
+package restorer
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/fs"
+)
+
+// isSparse reports whether f, which starts with a hole, uses less disk space
+// than its size.
+func isSparse(f *os.File, size int64) (bool, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	// the number of blocks is counted in units of 512 bytes
+	return fs.ExtendedStat(fi).Blocks*512 < size, nil
+}
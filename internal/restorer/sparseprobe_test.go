@@ -0,0 +1,82 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestProbeSparse(t *testing.T) {
+	dir := rtest.TempDir(t)
+	sparse, err := probeSparse(dir)
+	rtest.OK(t, err)
+	t.Logf("sparse files supported: %v", sparse)
+
+	// the probe file was removed
+	entries, err := os.ReadDir(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(entries))
+}
+
+func TestRestorerSparseUnsupported(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{Data: "content: file\n"},
+		},
+	}, noopGetGenericAttributes)
+
+	for _, test := range []struct {
+		name      string
+		supported bool
+		behavior  SparseUnsupportedBehavior
+		fails     bool
+		warnings  int
+		infos     int
+	}{
+		{name: "supported", supported: true, behavior: SparseFail},
+		{name: "fallback", behavior: SparseFallback, infos: 1},
+		{name: "warn", behavior: SparseWarn, warnings: 1},
+		{name: "fail", behavior: SparseFail, fails: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			res := NewRestorer(repo, sn, Options{Sparse: true, SparseUnsupported: test.behavior})
+			res.sparseProbe = func(string) (bool, error) {
+				return test.supported, nil
+			}
+			var warnings, infos int
+			res.Warn = func(string) { warnings++ }
+			res.Info = func(string) { infos++ }
+
+			tempdir := rtest.TempDir(t)
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.Equals(t, test.warnings, warnings)
+			rtest.Equals(t, test.infos, infos)
+			data, rerr := os.ReadFile(filepath.Join(tempdir, "file"))
+			if test.fails {
+				rtest.Assert(t, err != nil, "expected error")
+				rtest.Assert(t, os.IsNotExist(rerr), "file was restored")
+				return
+			}
+			rtest.OK(t, err)
+			rtest.OK(t, rerr)
+			rtest.Equals(t, "content: file\n", string(data))
+			rtest.Equals(t, !test.supported, res.SparseFallback())
+		})
+	}
+}
+
+func TestSparseUnsupportedBehaviorSet(t *testing.T) {
+	for _, s := range []string{"fallback", "warn", "fail"} {
+		var b SparseUnsupportedBehavior
+		rtest.OK(t, b.Set(s))
+		rtest.Equals(t, s, b.String())
+	}
+	var b SparseUnsupportedBehavior
+	rtest.Assert(t, b.Set("other") != nil, "expected error for invalid behavior")
+	rtest.Equals(t, SparseInvalid, b)
+}
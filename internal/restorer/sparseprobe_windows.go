@@ -0,0 +1,17 @@
+package restorer
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// isSparse reports whether f was marked as sparse file by truncateSparse,
+// which fails on filesystems without support for sparse files.
+func isSparse(f *os.File, _ int64) (bool, error) {
+	var info windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(windows.Handle(f.Fd()), &info); err != nil {
+		return false, err
+	}
+	return info.FileAttributes&windows.FILE_ATTRIBUTE_SPARSE_FILE != 0, nil
+}
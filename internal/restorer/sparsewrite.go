@@ -1,6 +1,8 @@
 package restorer
 
 import (
+	"bytes"
+
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -24,6 +26,11 @@ func (f *partialFile) WriteAt(p []byte, offset int64) (n int, err error) {
 		// All zeros, file already big enough. A previous WriteAt or
 		// Truncate will have produced the zeros in f.File.
 
+	case f.holeThreshold > 0:
+		var n2 int
+		n2, err = f.writeSkippingZeros(p, offset)
+		n = skipped + n2
+
 	default:
 		var n2 int
 		n2, err = f.File.WriteAt(p, offset)
@@ -32,3 +39,52 @@ func (f *partialFile) WriteAt(p []byte, offset int64) (n int, err error) {
 
 	return n, err
 }
+
+// writeSkippingZeros writes p to f.File at offset, but skips all runs of at
+// least f.holeThreshold zero bytes. Like for the zero prefix, the file
+// already contains zeros at the skipped ranges.
+func (f *partialFile) writeSkippingZeros(p []byte, offset int64) (n int, err error) {
+	// start of the data which is not yet written
+	start := 0
+	for i := 0; i < len(p); {
+		next := bytes.IndexByte(p[i:], 0)
+		if next < 0 {
+			break
+		}
+		i += next
+		zeros := zeroRunLen(p[i:])
+		if zeros >= f.holeThreshold {
+			if i > start {
+				n2, err := f.File.WriteAt(p[start:i], offset+int64(start))
+				if err != nil {
+					return start + n2, err
+				}
+			}
+			start = i + zeros
+		}
+		i += zeros
+	}
+
+	if start < len(p) {
+		n2, err := f.File.WriteAt(p[start:], offset+int64(start))
+		if err != nil {
+			return start + n2, err
+		}
+	}
+	return len(p), nil
+}
+
+// zeroRunLen returns the number of zero bytes at the start of p. Short runs
+// are common in regular data and are counted without the setup overhead of
+// restic.ZeroPrefixLen.
+func zeroRunLen(p []byte) int {
+	const short = 64
+	n := 0
+	for n < len(p) && n < short && p[n] == 0 {
+		n++
+	}
+	if n == short {
+		n += restic.ZeroPrefixLen(p[short:])
+	}
+	return n
+}
@@ -0,0 +1,81 @@
+package restorer
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestPartialFileHoleThreshold(t *testing.T) {
+	data := bytes.Repeat([]byte{1}, 100)
+	// zero runs of 8, 16 and a trailing run of 20 bytes
+	copy(data[10:], make([]byte, 8))
+	copy(data[40:], make([]byte, 16))
+	copy(data[80:], make([]byte, 20))
+
+	for _, test := range []struct {
+		threshold int
+		skipped   [][2]int
+	}{
+		{0, nil},
+		{8, [][2]int{{10, 18}, {40, 56}, {80, 100}}},
+		{16, [][2]int{{40, 56}, {80, 100}}},
+		{32, nil},
+	} {
+		t.Run(fmt.Sprint(test.threshold), func(t *testing.T) {
+			// skipped ranges keep the previous content, which would be
+			// a hole in a newly created sparse file
+			path := filepath.Join(rtest.TempDir(t), "file")
+			rtest.OK(t, os.WriteFile(path, bytes.Repeat([]byte{0xff}, len(data)), 0o600))
+			f, err := os.OpenFile(path, os.O_WRONLY, 0)
+			rtest.OK(t, err)
+			wr := &partialFile{File: f, sparse: true, holeThreshold: test.threshold}
+			n, err := wr.WriteAt(data, 0)
+			rtest.OK(t, err)
+			rtest.Equals(t, len(data), n)
+			rtest.OK(t, f.Close())
+
+			expected := bytes.Clone(data)
+			for _, r := range test.skipped {
+				copy(expected[r[0]:r[1]], bytes.Repeat([]byte{0xff}, r[1]-r[0]))
+			}
+			content, err := os.ReadFile(path)
+			rtest.OK(t, err)
+			rtest.Equals(t, expected, content)
+		})
+	}
+}
+
+func BenchmarkPartialFileHoleThreshold(b *testing.B) {
+	// random data contains a zero byte about every 256 bytes
+	data := make([]byte, 4<<20)
+	rand.New(rand.NewSource(42)).Read(data)
+	// and some larger zero runs
+	for i := 0; i < len(data); i += 256 << 10 {
+		copy(data[i:], make([]byte, 64<<10))
+	}
+
+	f, err := os.Create(filepath.Join(b.TempDir(), "file"))
+	rtest.OK(b, err)
+	defer func() { _ = f.Close() }()
+	rtest.OK(b, f.Truncate(int64(len(data))))
+
+	for _, threshold := range []int{0, 4096, 64 << 10} {
+		b.Run(fmt.Sprintf("threshold-%d", threshold), func(b *testing.B) {
+			wr := &partialFile{File: f, sparse: true, holeThreshold: threshold}
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				// the first byte prevents skipping a zero prefix
+				data[0] = 1
+				if _, err := wr.WriteAt(data, 0); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
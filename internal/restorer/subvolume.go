@@ -0,0 +1,54 @@
+package restorer
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// ensureSubvolume creates the directory target as a btrfs subvolume, if
+// location is listed in Options.Subvolumes. Existing directories are kept as
+// is. If the target filesystem does not support subvolumes, a warning is
+// printed once and the directory is created as usual by ensureDir.
+func (res *Restorer) ensureSubvolume(target, location string) error {
+	if res.opts.DryRun || len(res.opts.Subvolumes) == 0 || !res.isSubvolume(location) {
+		return nil
+	}
+	if _, err := fs.Lstat(target); !errors.Is(err, os.ErrNotExist) {
+		// existing directories cannot be converted, errors are handled by ensureDir
+		debug.Log("%snot creating subvolume %v: %v", res.logPrefix, location, err)
+		return nil
+	}
+
+	ok, err := createSubvolume(target)
+	if err != nil {
+		return res.sanitizeError(location, err)
+	}
+	if !ok {
+		if !res.subvolumesUnsupported {
+			res.subvolumesUnsupported = true
+			res.Warn("target filesystem does not support btrfs subvolumes, restoring them as regular directories")
+		}
+		return nil
+	}
+	res.subvolumes = append(res.subvolumes, location)
+	return nil
+}
+
+func (res *Restorer) isSubvolume(location string) bool {
+	for _, subvolume := range res.opts.Subvolumes {
+		if filepath.Join(string(filepath.Separator), subvolume) == location {
+			return true
+		}
+	}
+	return false
+}
+
+// Subvolumes returns the directories which were created as btrfs subvolumes,
+// see Options.Subvolumes.
+func (res *Restorer) Subvolumes() []string {
+	return res.subvolumes
+}
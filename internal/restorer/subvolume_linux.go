@@ -0,0 +1,56 @@
+package restorer
+
+import (
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// btrfsIocSubvolCreate is BTRFS_IOC_SUBVOL_CREATE, _IOW(0x94, 14, struct
+// btrfs_ioctl_vol_args), from linux/btrfs.h.
+const btrfsIocSubvolCreate = 0x5000940e
+
+// btrfsVolArgs is struct btrfs_ioctl_vol_args.
+type btrfsVolArgs struct {
+	fd   int64
+	name [4088]byte
+}
+
+// createSubvolume creates a btrfs subvolume at path, which must not exist yet.
+// ok is false if the filesystem containing the parent directory does not
+// support subvolumes.
+func createSubvolume(path string) (ok bool, err error) {
+	parent, name := filepath.Split(path)
+	var st unix.Statfs_t
+	if err := unix.Statfs(parent, &st); err != nil {
+		return false, err
+	}
+	if st.Type != unix.BTRFS_SUPER_MAGIC {
+		return false, nil
+	}
+
+	var args btrfsVolArgs
+	if len(name) >= len(args.name) {
+		return false, unix.ENAMETOOLONG
+	}
+	copy(args.name[:], name)
+
+	fd, err := unix.Open(parent, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = unix.Close(fd)
+	}()
+
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), btrfsIocSubvolCreate, uintptr(unsafe.Pointer(&args)))
+	if errno == 0 {
+		return true, nil
+	}
+	if errno == unix.ENOTTY || errno == unix.EOPNOTSUPP {
+		return false, nil
+	}
+	return false, &os.PathError{Op: "create subvolume", Path: path, Err: errno}
+}
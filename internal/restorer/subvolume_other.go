@@ -0,0 +1,9 @@
+//go:build !linux
+
+package restorer
+
+// createSubvolume is not implemented on this platform and always reports
+// that subvolumes are not supported.
+func createSubvolume(_ string) (ok bool, err error) {
+	return false, nil
+}
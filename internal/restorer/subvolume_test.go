@@ -0,0 +1,47 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerSubvolumes(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"home": Dir{
+				Nodes: map[string]Node{
+					"file": File{Data: "content: file\n"},
+				},
+			},
+			"other": Dir{},
+		},
+	}, noopGetGenericAttributes)
+	tempdir := rtest.TempDir(t)
+
+	ok, err := createSubvolume(filepath.Join(tempdir, "probe"))
+	rtest.OK(t, err)
+	if ok {
+		t.Skip("test requires a filesystem without subvolume support")
+	}
+
+	res := NewRestorer(repo, sn, Options{Subvolumes: []string{"home"}})
+	var warnings []string
+	res.Warn = func(message string) {
+		warnings = append(warnings, message)
+	}
+	_, err = res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	// the subvolume falls back to a regular directory
+	rtest.Equals(t, 1, len(warnings))
+	rtest.Equals(t, 0, len(res.Subvolumes()))
+	data, err := os.ReadFile(filepath.Join(tempdir, "home", "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content: file\n", string(data))
+}
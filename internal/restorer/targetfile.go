@@ -0,0 +1,79 @@
+package restorer
+
+import (
+	"io"
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+)
+
+// checkTargetFile verifies that f can be used to restore the file at location,
+// see Options.TargetFiles. Blobs are written out of order, thus the file must
+// be seekable.
+func checkTargetFile(location string, f *os.File, sparse bool) error {
+	if _, err := f.Seek(0, io.SeekCurrent); err != nil {
+		return errors.Fatalf("target file for %v is not seekable: %v", location, err)
+	}
+	if err := checkWritable(f); err != nil {
+		return errors.Fatalf("target file for %v is not writable: %v", location, err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.Fatalf("target file for %v: %v", location, err)
+	}
+	// holes are only created by resizing the file
+	if sparse && !fi.Mode().IsRegular() {
+		return errors.Fatalf("target file for %v is not a regular file, thus it cannot be restored as sparse file", location)
+	}
+	return nil
+}
+
+// addTargetFile restores the file at path into f instead of creating it.
+// It must be called before writing any file content.
+func (w *filesWriter) addTargetFile(path string, f *os.File) {
+	if w.targets == nil {
+		w.targets = make(map[string]*os.File)
+	}
+	w.targets[path] = f
+}
+
+// writeToTarget writes blob to the target file registered for path. It
+// returns false if there is none. The target file is resized by the first
+// write, for which createSize is not negative.
+func (w *filesWriter) writeToTarget(path string, blob []byte, offset int64, createSize int64, sparse bool) (bool, error) {
+	f, ok := w.targets[path]
+	if !ok {
+		return false, nil
+	}
+	if createSize >= 0 {
+		if err := resizeFile(f, createSize, sparse); err != nil {
+			return true, err
+		}
+	}
+	if len(blob) == 0 {
+		return true, nil
+	}
+	_, err := f.WriteAt(blob, offset)
+	return true, err
+}
+
+// resizeFile replaces the content of f by an empty file of the given size.
+// Other files than regular files, for example block devices, are left as is.
+// Unlike ensureSize, f is not closed on errors.
+func resizeFile(f *os.File, size int64, sparse bool) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+	// existing content is never reused
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if sparse {
+		return truncateSparse(f, size)
+	}
+	return f.Truncate(size)
+}
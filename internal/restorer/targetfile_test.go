@@ -0,0 +1,110 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerTargetFiles(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{
+				Nodes: map[string]Node{
+					"target": File{Data: "content: target\n"},
+					"empty":  File{Data: ""},
+					"other":  File{Data: "content: other\n"},
+				},
+			},
+		},
+	}, noopGetGenericAttributes)
+
+	outside := rtest.TempDir(t)
+	openTarget := func(name string) *os.File {
+		f, err := os.OpenFile(filepath.Join(outside, name), os.O_RDWR|os.O_CREATE, 0o600)
+		rtest.OK(t, err)
+		t.Cleanup(func() { _ = f.Close() })
+		// the existing content must be replaced
+		_, err = f.WriteString("previous content which is longer\n")
+		rtest.OK(t, err)
+		return f
+	}
+
+	tempdir := rtest.TempDir(t)
+	res := NewRestorer(repo, sn, Options{TargetFiles: map[string]*os.File{
+		filepath.FromSlash("/dir/target"): openTarget("target"),
+		filepath.FromSlash("/dir/empty"):  openTarget("empty"),
+	}})
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	for name, content := range map[string]string{"target": "content: target\n", "empty": ""} {
+		data, err := os.ReadFile(filepath.Join(outside, name))
+		rtest.OK(t, err)
+		rtest.Equals(t, content, string(data))
+		_, err = os.Lstat(filepath.Join(tempdir, "dir", name))
+		rtest.Assert(t, errors.Is(err, os.ErrNotExist), "expected %v to be missing in the target directory, got %v", name, err)
+	}
+	data, err := os.ReadFile(filepath.Join(tempdir, "dir", "other"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "content: other\n", string(data))
+
+	count, err := res.VerifyFiles(context.TODO(), tempdir, 1, restic.NoopCounter)
+	rtest.OK(t, err)
+	rtest.Equals(t, 1, count)
+}
+
+func TestRestorerTargetFilesInvalid(t *testing.T) {
+	repo := repository.TestRepository(t)
+	sn, _ := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{Data: "content: file\n"},
+			"dir":  Dir{},
+		},
+	}, noopGetGenericAttributes)
+
+	r, w, err := os.Pipe()
+	rtest.OK(t, err)
+	defer func() {
+		_ = r.Close()
+		_ = w.Close()
+	}()
+	regular, err := os.Create(filepath.Join(rtest.TempDir(t), "target"))
+	rtest.OK(t, err)
+	defer func() { _ = regular.Close() }()
+	readOnly, err := os.Open(regular.Name())
+	rtest.OK(t, err)
+	defer func() { _ = readOnly.Close() }()
+
+	tests := []struct {
+		name     string
+		location string
+		file     *os.File
+	}{
+		{"pipe", "/file", w},
+		{"directory", "/dir", regular},
+		{"missing", "/missing", regular},
+	}
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			name     string
+			location string
+			file     *os.File
+		}{"read-only", "/file", readOnly})
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res := NewRestorer(repo, sn, Options{TargetFiles: map[string]*os.File{filepath.FromSlash(test.location): test.file}})
+			_, err := res.RestoreTo(context.TODO(), rtest.TempDir(t))
+			rtest.Assert(t, errors.IsFatal(err), "expected fatal error, got %v", err)
+		})
+	}
+}
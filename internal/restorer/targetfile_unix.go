@@ -0,0 +1,26 @@
+//go:build !windows
+
+package restorer
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/errors"
+	"golang.org/x/sys/unix"
+)
+
+// checkWritable verifies that f was opened for writing. Files opened in append
+// mode cannot be written at arbitrary offsets.
+func checkWritable(f *os.File) error {
+	flags, err := unix.FcntlInt(f.Fd(), unix.F_GETFL, 0)
+	if err != nil {
+		return err
+	}
+	if flags&unix.O_ACCMODE == unix.O_RDONLY {
+		return errors.New("file is opened read-only")
+	}
+	if flags&unix.O_APPEND != 0 {
+		return errors.New("file is opened in append mode")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package restorer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// targetRoot opens and removes the files written by the filesWriter. All paths
+// are resolved relative to the target directory using an os.Root, which
+// refuses to follow symlinks leading outside of it. This prevents a symlink
+// placed inside the target directory, also while the restore is running, from
+// redirecting writes to arbitrary locations. All methods operate on the paths
+// directly for a nil receiver.
+type targetRoot struct {
+	root *os.Root
+}
+
+// openTargetRoot opens the target directory dst, which must already exist.
+func openTargetRoot(dst string) (*targetRoot, error) {
+	root, err := os.OpenRoot(dst)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &targetRoot{root: root}, nil
+}
+
+func (t *targetRoot) Close() error {
+	if t == nil {
+		return nil
+	}
+	return t.root.Close()
+}
+
+// rel returns path relative to the target directory.
+func (t *targetRoot) rel(path string) (string, error) {
+	rel, err := filepath.Rel(t.root.Name(), path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("path %v is outside of the target directory", path)
+	}
+	return rel, nil
+}
+
+// contains reports whether path is located within the target directory.
+func (t *targetRoot) contains(path string) bool {
+	if t == nil {
+		return true
+	}
+	_, err := t.rel(path)
+	return err == nil
+}
+
+func (t *targetRoot) OpenFile(path string, flag int, perm os.FileMode) (*os.File, error) {
+	if t == nil {
+		return fs.OpenFile(path, flag, perm)
+	}
+	rel, err := t.rel(path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.OpenFileInRoot(t.root, rel, flag, perm)
+}
+
+func (t *targetRoot) Lstat(path string) (os.FileInfo, error) {
+	if t == nil {
+		return fs.Lstat(path)
+	}
+	rel, err := t.rel(path)
+	if err != nil {
+		return nil, err
+	}
+	return t.root.Lstat(rel)
+}
+
+func (t *targetRoot) Remove(path string) error {
+	if t == nil {
+		return fs.Remove(path)
+	}
+	rel, err := t.rel(path)
+	if err != nil {
+		return err
+	}
+	return t.root.Remove(rel)
+}
+
+func (t *targetRoot) RemoveAll(path string) error {
+	if t == nil {
+		return fs.RemoveAll(path)
+	}
+	rel, err := t.rel(path)
+	if err != nil {
+		return err
+	}
+	return t.root.RemoveAll(rel)
+}
+
+// ResetPermissions is like fs.ResetPermissions.
+func (t *targetRoot) ResetPermissions(path string) error {
+	if t == nil {
+		return fs.ResetPermissions(path)
+	}
+	rel, err := t.rel(path)
+	if err != nil {
+		return err
+	}
+	return t.root.Chmod(rel, 0600)
+}
+
+// isSymlink reports whether the item at path is a symlink. Opening a symlink
+// which leads outside of the target directory fails with an error other than
+// ELOOP.
+func (t *targetRoot) isSymlink(path string) bool {
+	fi, err := t.Lstat(path)
+	return err == nil && fi.Mode()&os.ModeSymlink != 0
+}
@@ -0,0 +1,101 @@
+//go:build !windows
+
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// newMaliciousTarget returns a target directory and a directory outside of it.
+// The symlink "link" in the target directory leads to the outside directory.
+func newMaliciousTarget(t *testing.T) (target, outside string) {
+	target = rtest.TempDir(t)
+	outside = rtest.TempDir(t)
+	rtest.OK(t, os.Symlink(outside, filepath.Join(target, "link")))
+	return target, outside
+}
+
+func openTestTargetRoot(t *testing.T, target string) *targetRoot {
+	root, err := openTargetRoot(target)
+	rtest.OK(t, err)
+	t.Cleanup(func() {
+		rtest.OK(t, root.Close())
+	})
+	return root
+}
+
+func assertEmptyDir(t *testing.T, dir string) {
+	entries, err := os.ReadDir(dir)
+	rtest.OK(t, err)
+	rtest.Equals(t, 0, len(entries), "directory %v was written to", dir)
+}
+
+func TestFilesWriterSymlinkEscape(t *testing.T) {
+	target, outside := newMaliciousTarget(t)
+	w := newFilesWriter(1, false)
+	w.root = openTestTargetRoot(t, target)
+
+	err := w.writeToFile(filepath.Join(target, "link", "file"), []byte("data"), 0, 4, false, false)
+	rtest.Assert(t, err != nil, "expected error writing through a symlink leading outside the target")
+	assertEmptyDir(t, outside)
+
+	// symlinks within the target are followed
+	rtest.OK(t, os.Mkdir(filepath.Join(target, "dir"), 0o700))
+	rtest.OK(t, os.Symlink("dir", filepath.Join(target, "inner")))
+	rtest.OK(t, w.writeToFile(filepath.Join(target, "inner", "file"), []byte("data"), 0, 4, false, false))
+	data, err := os.ReadFile(filepath.Join(target, "dir", "file"))
+	rtest.OK(t, err)
+	rtest.Equals(t, "data", string(data))
+}
+
+func TestCreateFileReplacesEscapingSymlink(t *testing.T) {
+	target, outside := newMaliciousTarget(t)
+	victim := filepath.Join(outside, "victim")
+	rtest.OK(t, os.WriteFile(victim, []byte("victim"), 0o600))
+	path := filepath.Join(target, "file")
+	rtest.OK(t, os.Symlink(victim, path))
+
+	f, err := createFile(openTestTargetRoot(t, target), path, 4, false, false)
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+
+	fi, err := os.Lstat(path)
+	rtest.OK(t, err)
+	rtest.Assert(t, fi.Mode().IsRegular(), "symlink was not replaced, mode %v", fi.Mode())
+	data, err := os.ReadFile(victim)
+	rtest.OK(t, err)
+	rtest.Equals(t, "victim", string(data))
+}
+
+func TestFileRestorerSymlinkEscape(t *testing.T) {
+	target, outside := newMaliciousTarget(t)
+	repo := newTestRepo([]TestFile{
+		{name: "link/file1", blobs: []TestBlob{{"data1-1", "pack1"}}},
+		{name: "file2", blobs: []TestBlob{{"data2-1", "pack1"}}},
+	})
+
+	// the directories were created by the first pass, but "link" was replaced
+	// by a symlink afterwards
+	r := newFileRestorer(target, repo.loader, repo.Lookup, 1, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	r.filesWriter.root = openTestTargetRoot(t, target)
+	var failed []string
+	r.Error = func(location string, _ error) error {
+		failed = append(failed, location)
+		return nil
+	}
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+
+	rtest.Equals(t, []string{"link/file1"}, failed)
+	assertEmptyDir(t, outside)
+	data, err := os.ReadFile(filepath.Join(target, "file2"))
+	rtest.OK(t, err)
+	rtest.Equals(t, repo.fileContent(repo.files[1]), string(data))
+}
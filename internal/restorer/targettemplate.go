@@ -0,0 +1,78 @@
+package restorer
+
+import (
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+)
+
+// TargetTimestampFormat is the format of TargetTemplateData.Timestamp. It
+// avoids colons, which are not allowed in file names on Windows.
+const TargetTimestampFormat = "2006-01-02T15-04-05"
+
+// TargetTemplateData contains the fields of a snapshot which can be used in a
+// TargetTemplate.
+type TargetTemplateData struct {
+	// ID is the short ID of the snapshot, LongID the complete one.
+	ID     string
+	LongID string
+	// Time is the local time at which the snapshot was created, Timestamp
+	// contains it formatted using TargetTimestampFormat.
+	Time      time.Time
+	Timestamp string
+	Hostname  string
+	Username  string
+	Tags      []string
+	Paths     []string
+}
+
+// TargetTemplate derives the name of a per-snapshot directory within the
+// target directory from the snapshot, such that multiple snapshots can be
+// restored side by side. It uses the text/template syntax with the fields of
+// TargetTemplateData, for example "{{.Hostname}}/{{.Timestamp}}".
+type TargetTemplate struct {
+	tmpl *template.Template
+}
+
+// NewTargetTemplate parses the template text.
+func NewTargetTemplate(text string) (*TargetTemplate, error) {
+	tmpl, err := template.New("target").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "parse target template")
+	}
+	return &TargetTemplate{tmpl: tmpl}, nil
+}
+
+// Expand returns the directory for sn, relative to the target directory. It
+// returns an error if the directory would not be located within the target
+// directory.
+func (t *TargetTemplate) Expand(sn *data.Snapshot) (string, error) {
+	d := TargetTemplateData{
+		Time:      sn.Time.Local(),
+		Timestamp: sn.Time.Local().Format(TargetTimestampFormat),
+		Hostname:  sn.Hostname,
+		Username:  sn.Username,
+		Tags:      sn.Tags,
+		Paths:     sn.Paths,
+	}
+	if id := sn.ID(); id != nil {
+		d.ID = id.Str()
+		d.LongID = id.String()
+	}
+
+	var buf strings.Builder
+	if err := t.tmpl.Execute(&buf, d); err != nil {
+		return "", errors.Wrap(err, "expand target template")
+	}
+	dir := filepath.Clean(filepath.FromSlash(buf.String()))
+	sep := string(filepath.Separator)
+	if buf.Len() == 0 || dir == "." || filepath.IsAbs(dir) || filepath.VolumeName(dir) != "" || strings.HasPrefix(dir, sep) ||
+		dir == ".." || strings.HasPrefix(dir, ".."+sep) {
+		return "", errors.Errorf("target template expands to %q, which is not a directory within the target", buf.String())
+	}
+	return dir, nil
+}
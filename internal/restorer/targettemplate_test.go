@@ -0,0 +1,56 @@
+package restorer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestTargetTemplate(t *testing.T) {
+	repo := repository.TestRepository(t)
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{Data: "content: file\n"},
+		},
+	}, noopGetGenericAttributes)
+	sn, err := data.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+	sn.Hostname = "host"
+	timestamp := sn.Time.Local().Format(TargetTimestampFormat)
+
+	for _, test := range []struct {
+		template string
+		dir      string
+	}{
+		{"{{.ID}}", id.Str()},
+		{"{{.Hostname}}/{{.Timestamp}}_{{.LongID}}", filepath.Join("host", timestamp+"_"+id.String())},
+		{`{{.Time.Format "2006"}}`, sn.Time.Local().Format("2006")},
+		{"sub/../{{.ID}}", id.Str()},
+	} {
+		tmpl, err := NewTargetTemplate(test.template)
+		rtest.OK(t, err)
+		dir, err := tmpl.Expand(sn)
+		rtest.OK(t, err)
+		rtest.Equals(t, test.dir, dir, test.template)
+	}
+
+	// the directory must be located within the target
+	for _, template := range []string{"", "{{if false}}x{{end}}", ".", "..", "../{{.ID}}", "/{{.ID}}"} {
+		tmpl, err := NewTargetTemplate(template)
+		rtest.OK(t, err)
+		_, err = tmpl.Expand(sn)
+		rtest.Assert(t, err != nil, "expected error for template %q", template)
+	}
+
+	for _, template := range []string{"{{.ID", "{{.Unknown}}"} {
+		tmpl, err := NewTargetTemplate(template)
+		if err == nil {
+			_, err = tmpl.Expand(sn)
+		}
+		rtest.Assert(t, err != nil, "expected error for template %q", template)
+	}
+}
@@ -0,0 +1,95 @@
+package restorer
+
+import "context"
+
+// Names of the spans started by the restorer, see Tracer.
+const (
+	// SpanRestore covers a whole restore.
+	SpanRestore = "restore"
+	// SpanPlan covers the first pass over the snapshot, which creates the
+	// directories and collects the files to restore.
+	SpanPlan = "restore.plan"
+	// SpanContent covers restoring the file content.
+	SpanContent = "restore.content"
+	// SpanPackDownload covers downloading a pack and writing its blobs. With
+	// separate decode workers, it only covers the download.
+	SpanPackDownload = "restore.pack"
+	// SpanFileWrite covers writing a file, from the first to the last blob.
+	// It is a child of the span of the pack from which the first blob was
+	// written.
+	SpanFileWrite = "restore.file"
+	// SpanMetadata covers the second pass over the snapshot, which restores
+	// the metadata and the special files.
+	SpanMetadata = "restore.metadata"
+)
+
+// Keys of the attributes set on the spans.
+const (
+	AttrSnapshotID = "restic.snapshot.id"
+	AttrTarget     = "restic.target"
+	AttrFiles      = "restic.files"
+	AttrPackID     = "restic.pack.id"
+	AttrPackBlobs  = "restic.pack.blobs"
+	AttrPackBytes  = "restic.pack.bytes"
+	AttrWorkerID   = "restic.worker.id"
+	AttrFilePath   = "restic.file.path"
+	AttrFileBytes  = "restic.file.bytes"
+)
+
+// Tracer starts the spans which trace the phases of a restore. It mirrors the
+// parts of the OpenTelemetry tracing API used by the restorer, such that the
+// restorer does not depend on it, see the oteltrace package for an adapter.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span which is a child of the span contained in ctx, if
+	// any. The returned context contains the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer. Its methods may be called concurrently.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	// RecordError marks the span as failed.
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key-value pair attached to a span. Value is either a string
+// or an int64.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// StringAttribute returns an attribute with a string value.
+func StringAttribute(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// IntAttribute returns an attribute with an integer value.
+func IntAttribute(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+// startSpan starts a span using t. A nil t returns ctx and a span which does
+// nothing.
+func startSpan(ctx context.Context, t Tracer, name string, attrs ...Attribute) (context.Context, Span) {
+	if t == nil {
+		return ctx, noopSpan{}
+	}
+	return t.Start(ctx, name, attrs...)
+}
+
+// endSpan records err, if any, and ends span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
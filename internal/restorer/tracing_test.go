@@ -0,0 +1,143 @@
+package restorer
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+type testSpan struct {
+	name   string
+	parent string
+	attrs  map[string]interface{}
+	ended  bool
+}
+
+func (s *testSpan) SetAttributes(attrs ...Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+func (s *testSpan) RecordError(error) {}
+func (s *testSpan) End()              { s.ended = true }
+
+type testSpanKey struct{}
+
+type testTracer struct {
+	m     sync.Mutex
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	span := &testSpan{name: name, attrs: make(map[string]interface{})}
+	if parent, ok := ctx.Value(testSpanKey{}).(*testSpan); ok {
+		span.parent = parent.name
+	}
+	span.SetAttributes(attrs...)
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func TestRestorerTracer(t *testing.T) {
+	repo := repository.TestRepository(t)
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{Nodes: map[string]Node{
+				"file1": File{Data: "content: file1\n"},
+				"file2": File{Data: "content: file2\n"},
+			}},
+		},
+	}, noopGetGenericAttributes)
+	sn, err := data.LoadSnapshot(context.TODO(), repo, id)
+	rtest.OK(t, err)
+
+	tracer := &testTracer{}
+	res := NewRestorer(repo, sn, Options{Tracer: tracer})
+	tempdir := rtest.TempDir(t)
+	_, err = res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	var names, files []string
+	for _, span := range tracer.spans {
+		rtest.Assert(t, span.ended, "span %v was not ended", span.name)
+		names = append(names, span.name)
+		switch span.name {
+		case SpanRestore:
+			rtest.Equals(t, "", span.parent)
+			rtest.Equals(t, tempdir, span.attrs[AttrTarget].(string))
+			rtest.Equals(t, id.String(), span.attrs[AttrSnapshotID].(string))
+		case SpanPlan:
+			rtest.Equals(t, SpanRestore, span.parent)
+			rtest.Equals(t, int64(2), span.attrs[AttrFiles].(int64))
+		case SpanContent, SpanMetadata:
+			rtest.Equals(t, SpanRestore, span.parent)
+		case SpanPackDownload:
+			rtest.Equals(t, SpanContent, span.parent)
+			rtest.Assert(t, span.attrs[AttrPackID].(string) != "", "missing pack id")
+			rtest.Equals(t, int64(2), span.attrs[AttrPackBlobs].(int64))
+			rtest.Assert(t, span.attrs[AttrPackBytes].(int64) > 0, "missing pack size")
+			rtest.Assert(t, span.attrs[AttrWorkerID].(int64) >= 0, "missing worker id")
+		case SpanFileWrite:
+			rtest.Equals(t, SpanPackDownload, span.parent)
+			rtest.Equals(t, int64(len("content: file1\n")), span.attrs[AttrFileBytes].(int64))
+			files = append(files, span.attrs[AttrFilePath].(string))
+		}
+	}
+	sort.Strings(names)
+	rtest.Equals(t, []string{SpanRestore, SpanContent, SpanFileWrite, SpanFileWrite, SpanMetadata, SpanPackDownload, SpanPlan}, names)
+	sort.Strings(files)
+	rtest.Equals(t, []string{filepath.FromSlash("/dir/file1"), filepath.FromSlash("/dir/file2")}, files)
+}
+
+func TestFileRestorerTracerIncompleteFile(t *testing.T) {
+	repo := newTestRepo([]TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack2"},
+			},
+		},
+	})
+	failedPack := repo.blobs[restic.Hash([]byte("data1-2"))][0].PackID()
+	loadError := errors.New("load error")
+	loader := func(ctx context.Context, packID restic.ID, blobs []restic.BlobHandle, handleBlobFn func(blob restic.BlobHandle, buf []byte, err error) error) error {
+		if packID == failedPack {
+			return loadError
+		}
+		return repo.loader(ctx, packID, blobs, handleBlobFn)
+	}
+
+	r := newFileRestorer(rtest.TempDir(t), loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+		repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+	r.files = repo.files
+	tracer := &testTracer{}
+	r.tracer = tracer
+	var errs int
+	r.Error = func(_ string, err error) error {
+		rtest.Assert(t, errors.Is(err, loadError), "unexpected error %v", err)
+		errs++
+		return nil
+	}
+	rtest.OK(t, r.restoreFiles(context.TODO()))
+	rtest.Equals(t, 1, errs)
+
+	var fileSpans int
+	for _, span := range tracer.spans {
+		if span.name == SpanFileWrite {
+			fileSpans++
+			rtest.Assert(t, span.ended, "span of the incomplete file was not ended")
+		}
+	}
+	rtest.Equals(t, 1, fileSpans)
+}
@@ -0,0 +1,223 @@
+package restorer
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// treeHashEntry contains the properties of a file system item which are
+// included in a tree hash.
+type treeHashEntry struct {
+	typ     data.NodeType
+	mode    os.FileMode
+	size    uint64
+	modTime time.Time
+	// data is the hash of the content for files, the hash of the entries for
+	// directories and the target for symlinks.
+	data []byte
+}
+
+// treeHashMode masks the permissions which are part of a tree hash.
+const treeHashMode = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// treeHashMissing is the entry hash of items which do not exist in the target.
+var treeHashMissing = restic.Hash([]byte("missing"))
+
+func (e treeHashEntry) hash() restic.ID {
+	var mode os.FileMode
+	var size uint64
+	var mtime int64
+	// Windows only knows a read-only flag, and the mtime of symlinks cannot
+	// be restored on all platforms.
+	if runtime.GOOS != "windows" && e.typ != data.NodeTypeSymlink {
+		mode = e.mode & treeHashMode
+	}
+	if e.typ == data.NodeTypeFile {
+		size = e.size
+	}
+	if e.typ != data.NodeTypeSymlink {
+		mtime = e.modTime.UnixNano()
+	}
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\x00%o\x00%d\x00%d\x00", e.typ, mode, size, mtime)
+	_, _ = h.Write(e.data)
+	var id restic.ID
+	h.Sum(id[:0])
+	return id
+}
+
+// treeHasher accumulates the entry hashes of the directories which are
+// currently traversed.
+type treeHasher struct {
+	dirs map[string]hash.Hash
+}
+
+func newTreeHasher() *treeHasher {
+	return &treeHasher{dirs: make(map[string]hash.Hash)}
+}
+
+// add records the hash of the entry named name at location in its parent
+// directory.
+func (t *treeHasher) add(location, name string, id restic.ID) {
+	parent := filepath.Dir(location)
+	h, ok := t.dirs[parent]
+	if !ok {
+		h = sha256.New()
+		t.dirs[parent] = h
+	}
+	_, _ = fmt.Fprintf(h, "%s\x00%s\n", name, id)
+}
+
+// leave returns the hash of the entries of the directory at location.
+func (t *treeHasher) leave(location string) []byte {
+	h, ok := t.dirs[location]
+	if !ok {
+		h = sha256.New()
+	}
+	delete(t.dirs, location)
+	return h.Sum(nil)
+}
+
+// TreeHash computes a tree hash over the items of the snapshot which are
+// restored to dst, and the same hash from the items in dst. Both hashes match
+// if the restored items are identical to the snapshot.
+//
+// The hash of a directory covers the names and entry hashes of its items. The
+// entry hash of an item covers its type, permissions and modification time,
+// as well as the size and the hashes of the blobs of files, the target of
+// symlinks and the hash of directories. The content of restored files is
+// hashed in parts of the size of the blobs in the snapshot. Ownership,
+// extended attributes, the target directory itself and items in dst which do
+// not exist in the snapshot are not included.
+//
+// Options which change the restored metadata, for example Umask or
+// Unprivileged, cause the hashes to differ, as do file systems which do not
+// store the modification time with nanosecond precision.
+func (res *Restorer) TreeHash(ctx context.Context, dst string) (snapshot, restored restic.ID, err error) {
+	if res.opts.Flatten {
+		return restic.ID{}, restic.ID{}, errors.New("tree hashes are not supported for flattened restores")
+	}
+
+	fromSnapshot, fromTarget := newTreeHasher(), newTreeHasher()
+	var buf []byte
+
+	visit := func(node *data.Node, target, location string) error {
+		if node == nil {
+			// the target directory is not included
+			return nil
+		}
+
+		var content []byte
+		switch node.Type {
+		case data.NodeTypeFile:
+			h := sha256.New()
+			for _, id := range node.Content {
+				_, _ = h.Write(id[:])
+			}
+			content = h.Sum(nil)
+		case data.NodeTypeDir:
+			content = fromSnapshot.leave(location)
+		case data.NodeTypeSymlink:
+			content = []byte(node.LinkTarget)
+		}
+		entry := treeHashEntry{node.Type, node.Mode, node.Size, node.ModTime, content}
+		fromSnapshot.add(location, node.Name, entry.hash())
+
+		var id restic.ID
+		id, buf, err = res.hashTarget(ctx, node, target, location, fromTarget, buf)
+		if err != nil {
+			return err
+		}
+		fromTarget.add(location, node.Name, id)
+		return nil
+	}
+
+	err = res.traverseTree(ctx, dst, *res.sn.Tree, treeVisitor{
+		visitNode: visit,
+		leaveDir: func(node *data.Node, target, location string, _ []string) error {
+			return visit(node, target, location)
+		},
+	})
+	if err != nil {
+		return restic.ID{}, restic.ID{}, err
+	}
+
+	root := string(filepath.Separator)
+	return restic.Hash(fromSnapshot.leave(root)), restic.Hash(fromTarget.leave(root)), nil
+}
+
+// hashTarget returns the entry hash of the item at target, which was restored
+// from node.
+func (res *Restorer) hashTarget(ctx context.Context, node *data.Node, target, location string, hasher *treeHasher, buf []byte) (restic.ID, []byte, error) {
+	var entries []byte
+	if node.Type == data.NodeTypeDir {
+		// always consume the entries, even if the directory is missing
+		entries = hasher.leave(location)
+	}
+
+	fi, err := fs.Lstat(target)
+	if errors.Is(err, os.ErrNotExist) {
+		return treeHashMissing, buf, nil
+	}
+	if err != nil {
+		return restic.ID{}, buf, err
+	}
+
+	entry := treeHashEntry{
+		typ:     fs.NodeTypeFromFileMode(fi.Mode()),
+		mode:    fi.Mode(),
+		size:    uint64(fi.Size()),
+		modTime: fi.ModTime(),
+	}
+	switch {
+	case entry.typ == data.NodeTypeDir:
+		entry.data = entries
+	case entry.typ == data.NodeTypeSymlink:
+		linkTarget, err := os.Readlink(target)
+		if err != nil {
+			return restic.ID{}, buf, err
+		}
+		entry.data = []byte(linkTarget)
+	case entry.typ == data.NodeTypeFile && node.Type == data.NodeTypeFile:
+		entry.data, buf, err = res.hashFileContent(ctx, target, node, buf)
+		if err != nil {
+			return restic.ID{}, buf, err
+		}
+	}
+	return entry.hash(), buf, nil
+}
+
+// hashFileContent hashes the content of the file at target like the blobs of
+// node are hashed for a tree hash. The hash differs if the file is shorter.
+func (res *Restorer) hashFileContent(ctx context.Context, target string, node *data.Node, buf []byte) ([]byte, []byte, error) {
+	f, err := fs.OpenFile(target, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, buf, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	h := sha256.New()
+	buf, err = res.hashFileBlobs(ctx, f, node, buf, func(_ int, _ int64, id restic.ID) error {
+		_, _ = h.Write(id[:])
+		return nil
+	})
+	if err != nil && err != io.EOF {
+		return nil, buf, err
+	}
+	return h.Sum(nil), buf, nil
+}
@@ -0,0 +1,89 @@
+package restorer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestRestorerTreeHash(t *testing.T) {
+	repo := repository.TestRepository(t)
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	snapshot := Snapshot{
+		Nodes: map[string]Node{
+			"dir": Dir{ModTime: mtime, Mode: 0o750, Nodes: map[string]Node{
+				"file1": File{Data: "content: file1\n", ModTime: mtime, Mode: 0o640},
+				"file2": File{DataParts: []string{"part1", "part2"}, ModTime: mtime, Mode: 0o600},
+			}},
+			"top": File{Data: "content: top\n", ModTime: mtime, Mode: 0o644},
+		},
+	}
+	if runtime.GOOS != "windows" {
+		snapshot.Nodes["link"] = Symlink{Target: "top", ModTime: mtime}
+	}
+	sn, _ := saveSnapshot(t, repo, snapshot, noopGetGenericAttributes)
+
+	tempdir := rtest.TempDir(t)
+	res := NewRestorer(repo, sn, Options{})
+	_, err := res.RestoreTo(context.TODO(), tempdir)
+	rtest.OK(t, err)
+
+	fromSnapshot, restored, err := res.TreeHash(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	rtest.Equals(t, fromSnapshot, restored)
+
+	// the hash is deterministic
+	again, _, err := NewRestorer(repo, sn, Options{}).TreeHash(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	rtest.Equals(t, fromSnapshot, again)
+
+	// files in the target which are not in the snapshot are ignored
+	rtest.OK(t, os.WriteFile(filepath.Join(tempdir, "extra"), []byte("extra"), 0o600))
+	_, restored, err = res.TreeHash(context.TODO(), tempdir)
+	rtest.OK(t, err)
+	rtest.Equals(t, fromSnapshot, restored)
+
+	for _, test := range []struct {
+		name   string
+		modify func(t *testing.T, path string)
+	}{
+		{"content", func(t *testing.T, path string) {
+			rtest.OK(t, os.WriteFile(path, []byte("content: fileX\n"), 0o640))
+		}},
+		{"size", func(t *testing.T, path string) {
+			rtest.OK(t, os.WriteFile(path, []byte("content: file1\nmore"), 0o640))
+		}},
+		{"mtime", func(t *testing.T, path string) {
+			rtest.OK(t, os.Chtimes(path, mtime, mtime.Add(time.Nanosecond)))
+		}},
+		{"missing", func(t *testing.T, path string) {
+			rtest.OK(t, os.Remove(path))
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			res := NewRestorer(repo, sn, Options{})
+			_, err := res.RestoreTo(context.TODO(), tempdir)
+			rtest.OK(t, err)
+
+			path := filepath.Join(tempdir, "dir", "file1")
+			test.modify(t, path)
+			// keep the mtime of the parent directory
+			rtest.OK(t, os.Chtimes(filepath.Join(tempdir, "dir"), mtime, mtime))
+			if test.name != "mtime" && test.name != "missing" {
+				rtest.OK(t, os.Chtimes(path, mtime, mtime))
+			}
+
+			snHash, restored, err := res.TreeHash(context.TODO(), tempdir)
+			rtest.OK(t, err)
+			rtest.Equals(t, fromSnapshot, snHash)
+			rtest.Assert(t, restored != snHash, "expected a different tree hash")
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package restorer
+
+import (
+	"os"
+
+	"github.com/restic/restic/internal/data"
+)
+
+// umaskNode returns a variant of node whose permissions have the bits in
+// Options.Umask removed. Symlinks are returned as is, as their permissions
+// are not restored.
+func (res *Restorer) umaskNode(node *data.Node) *data.Node {
+	umask := res.opts.Umask & os.ModePerm
+	if umask == 0 || node.Type == data.NodeTypeSymlink || node.Mode&umask == 0 {
+		return node
+	}
+	n := *node
+	n.Mode &^= umask
+	return &n
+}
@@ -0,0 +1,60 @@
+package restorer
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/restic/restic/internal/data"
+	"github.com/restic/restic/internal/debug"
+)
+
+// Downgrade describes an item which was not restored completely, as this
+// requires elevated privileges. See Options.Unprivileged.
+type Downgrade struct {
+	Location string
+	Reason   string
+}
+
+// Downgrades returns all items which were skipped or restored with reduced
+// fidelity as they require elevated privileges.
+func (res *Restorer) Downgrades() []Downgrade {
+	return res.downgrades
+}
+
+func (res *Restorer) addDowngrade(location string, reason string) {
+	debug.Log("%s%v: %v", res.logPrefix, location, reason)
+	res.downgrades = append(res.downgrades, Downgrade{Location: location, Reason: reason})
+}
+
+// requiresPrivileges returns whether the node cannot be created in
+// unprivileged mode.
+func (res *Restorer) requiresPrivileges(node *data.Node) bool {
+	if !res.opts.Unprivileged || res.euid == 0 {
+		return false
+	}
+	return node.Type == data.NodeTypeDev || node.Type == data.NodeTypeCharDev
+}
+
+// unprivilegedNode returns a variant of node whose metadata can be restored
+// without elevated privileges and records the necessary downgrades. Files
+// owned by a different user lose their setuid and setgid bits, as these would
+// otherwise apply to the user running the restore.
+func (res *Restorer) unprivilegedNode(node *data.Node, location string) *data.Node {
+	// ownership is irrelevant on Windows, where euid is -1
+	if !res.opts.Unprivileged || res.euid <= 0 {
+		return node
+	}
+	if uid, ok := res.opts.IDMap.MapUID(node.UID); ok && uid == uint32(res.euid) {
+		return node
+	}
+
+	reason := fmt.Sprintf("ownership %d:%d not restored", node.UID, node.GID)
+	if node.Mode&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		n := *node
+		n.Mode &^= os.ModeSetuid | os.ModeSetgid
+		node = &n
+		reason += ", setuid/setgid bits removed"
+	}
+	res.addDowngrade(location, reason)
+	return node
+}
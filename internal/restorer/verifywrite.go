@@ -0,0 +1,50 @@
+package restorer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+)
+
+// WriteMismatchError is reported for a file if the data read back right after
+// writing a blob differs from the written data, see Options.VerifyWrites.
+type WriteMismatchError struct {
+	Offset int64
+	Length int
+}
+
+func (e *WriteMismatchError) Error() string {
+	return fmt.Sprintf("data read back from offset %d differs from the %d bytes written", e.Offset, e.Length)
+}
+
+// verifyWrite reads back the blob which was written to path at offset and
+// compares it to the written data. Files in w.targets are not verified, as
+// they may not be readable.
+func (w *filesWriter) verifyWrite(path string, blob []byte, offset int64) error {
+	if _, ok := w.targets[path]; ok {
+		return nil
+	}
+	f, err := fs.OpenFile(path, fs.O_RDONLY|fs.O_NOFOLLOW, 0)
+	if err != nil {
+		return errors.Wrap(err, "read back")
+	}
+	buf := make([]byte, len(blob))
+	_, err = f.ReadAt(buf, offset)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if errors.Is(err, io.EOF) {
+		// the file is shorter than the written data
+		return &WriteMismatchError{Offset: offset, Length: len(blob)}
+	}
+	if err != nil {
+		return errors.Wrap(err, "read back")
+	}
+	if !bytes.Equal(buf, blob) {
+		return &WriteMismatchError{Offset: offset, Length: len(blob)}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package restorer
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestFileRestorerVerifyWrites(t *testing.T) {
+	content := []TestFile{
+		{
+			name: "file1",
+			blobs: []TestBlob{
+				{"data1-1", "pack1"},
+				{"data1-2", "pack1"},
+			},
+		},
+		{
+			name: "file2",
+			blobs: []TestBlob{
+				{"data2-1", "pack2"},
+			},
+		}}
+
+	for _, test := range []struct {
+		name   string
+		filter func(location string) bool
+		failed []string
+	}{
+		{"all", func(string) bool { return true }, []string{"file2"}},
+		{"filtered", func(location string) bool { return location != "file2" }, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tempdir := rtest.TempDir(t)
+			repo := newTestRepo(content)
+
+			r := newFileRestorer(tempdir, repo.loader, repo.Lookup, 2, false, false, repo.StartWarmup, nil,
+				repository.TestRepository(t).ChunkerFactory().ZeroChunk())
+			r.files = repo.files
+			r.verifyWrites = test.filter
+			// silently flip a bit of the data written to file2
+			r.setFaultInjector(&faultInjector{writeData: func(path string, _ int64, blob []byte) []byte {
+				if path != filepath.Join(tempdir, "file2") {
+					return blob
+				}
+				corrupted := bytes.Clone(blob)
+				corrupted[0] ^= 1
+				return corrupted
+			}})
+
+			var failed []string
+			r.Error = func(location string, err error) error {
+				rtest.Assert(t, errors.As(err, new(*WriteMismatchError)), "unexpected error %v", err)
+				failed = append(failed, location)
+				return nil
+			}
+
+			rtest.OK(t, r.restoreFiles(context.TODO()))
+			rtest.Equals(t, test.failed, failed)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package restorer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// maxStackDumpSize limits the size of the goroutine stacks included in a
+// watchdog dump.
+const maxStackDumpSize = 64 << 20
+
+// StalledError is returned if the watchdog aborted the restore as the file
+// content made no progress for Options.WatchdogThreshold.
+type StalledError struct {
+	Threshold time.Duration
+}
+
+func (e *StalledError) Error() string {
+	return fmt.Sprintf("restore made no progress for %v, aborted by the watchdog", e.Threshold)
+}
+
+// errStalled is the cause of the context cancellation once the watchdog
+// aborts the restore.
+var errStalled = errors.New("restore stalled")
+
+// watchdog dumps the goroutine stacks and the packs being downloaded if no
+// blob was written for the threshold, see Options.WatchdogThreshold. All
+// methods are safe to call on a nil pointer.
+type watchdog struct {
+	threshold time.Duration
+	out       io.Writer
+	abort     bool
+
+	// incremented for every blob which was written or skipped
+	progress atomic.Uint64
+
+	mu       sync.Mutex
+	inFlight map[restic.ID]inFlightPack
+}
+
+// inFlightPack is a pack which is currently downloaded by a worker.
+type inFlightPack struct {
+	worker  int
+	started time.Time
+	blobs   int
+	size    uint64
+	files   int
+}
+
+func newWatchdog(threshold time.Duration, out io.Writer, abort bool) *watchdog {
+	return &watchdog{
+		threshold: threshold,
+		out:       out,
+		abort:     abort,
+		inFlight:  make(map[restic.ID]inFlightPack),
+	}
+}
+
+func (w *watchdog) progressed() {
+	if w != nil {
+		w.progress.Add(1)
+	}
+}
+
+func (w *watchdog) startPack(worker int, pack *packInfo) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inFlight[pack.id] = inFlightPack{worker: worker, started: time.Now(), blobs: pack.blobs, size: pack.size, files: len(pack.files)}
+}
+
+func (w *watchdog) finishPack(id restic.ID) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	delete(w.inFlight, id)
+	w.mu.Unlock()
+	w.progressed()
+}
+
+// run calls restore while monitoring its progress. If the watchdog aborts
+// the restore, the returned error is a *StalledError.
+func (w *watchdog) run(ctx context.Context, restore func(ctx context.Context) error) error {
+	if w == nil {
+		return restore(ctx)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	done := make(chan struct{})
+	var monitor sync.WaitGroup
+	monitor.Go(func() {
+		w.monitor(done, cancel)
+	})
+
+	err := restore(ctx)
+	close(done)
+	monitor.Wait()
+	if err != nil && errors.Is(context.Cause(ctx), errStalled) {
+		return &StalledError{Threshold: w.threshold}
+	}
+	return err
+}
+
+// monitor checks the progress until done is closed. Each stall is dumped
+// once. The dumps are written by a separate goroutine, such that a blocking
+// writer cannot delay aborting the restore.
+func (w *watchdog) monitor(done <-chan struct{}, cancel context.CancelCauseFunc) {
+	dumps := make(chan []byte, 1)
+	defer close(dumps)
+	go func() {
+		for dump := range dumps {
+			if _, err := w.out.Write(dump); err != nil {
+				debug.Log("writing watchdog dump failed: %v", err)
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(max(w.threshold/4, time.Millisecond))
+	defer ticker.Stop()
+	last := w.progress.Load()
+	lastChange := time.Now()
+	dumped := false
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			if current := w.progress.Load(); current != last {
+				last, lastChange, dumped = current, now, false
+				continue
+			}
+			stalled := now.Sub(lastChange)
+			if dumped || stalled < w.threshold {
+				continue
+			}
+			dumped = true
+			debug.Log("restore made no progress for %v, dumping goroutine stacks", stalled)
+			select {
+			case dumps <- w.dump(stalled):
+			default:
+				debug.Log("previous watchdog dump is still being written, skipping dump")
+			}
+			if w.abort {
+				cancel(errStalled)
+			}
+		}
+	}
+}
+
+// dump returns the packs which are currently downloaded and the stacks of all
+// goroutines.
+func (w *watchdog) dump(stalled time.Duration) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "restore made no progress for %v\n", stalled.Round(time.Millisecond))
+
+	w.mu.Lock()
+	ids := make(restic.IDs, 0, len(w.inFlight))
+	for id := range w.inFlight {
+		ids = append(ids, id)
+	}
+	sort.Sort(ids)
+	fmt.Fprintf(&buf, "%d packs in flight:\n", len(ids))
+	for _, id := range ids {
+		pack := w.inFlight[id]
+		fmt.Fprintf(&buf, "  pack %v: worker %d, %d blobs, %d bytes, %d files, started %v ago\n",
+			id, pack.worker, pack.blobs, pack.size, pack.files, time.Since(pack.started).Round(time.Millisecond))
+	}
+	w.mu.Unlock()
+
+	buf.WriteString("\n")
+	buf.Write(goroutineStacks())
+	return buf.Bytes()
+}
+
+// goroutineStacks returns the stacks of all goroutines, truncated to
+// maxStackDumpSize.
+func goroutineStacks() []byte {
+	stacks := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(stacks, true)
+		if n < len(stacks) || len(stacks) >= maxStackDumpSize {
+			return stacks[:n]
+		}
+		stacks = make([]byte, 2*len(stacks))
+	}
+}
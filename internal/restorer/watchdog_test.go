@@ -0,0 +1,71 @@
+package restorer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+// chanWriter passes each write to a channel, which blocks until it is read.
+type chanWriter chan []byte
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- p
+	return len(p), nil
+}
+
+func stalledRestore(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWatchdogDump(t *testing.T) {
+	out := make(chanWriter)
+	w := newWatchdog(20*time.Millisecond, out, true)
+	pack := &packInfo{id: restic.NewRandomID(), blobs: 2, size: 100, files: map[*fileInfo]struct{}{{location: "file"}: {}}}
+	w.startPack(3, pack)
+
+	err := w.run(context.TODO(), stalledRestore)
+	var stalledErr *StalledError
+	rtest.Assert(t, errors.As(err, &stalledErr), "expected StalledError, got %v", err)
+
+	var dump string
+	select {
+	case data := <-out:
+		dump = string(data)
+	case <-time.After(10 * time.Second):
+		t.Fatal("watchdog did not write a dump")
+	}
+	rtest.Assert(t, strings.Contains(dump, "1 packs in flight"), "missing in-flight packs in %q", dump)
+	rtest.Assert(t, strings.Contains(dump, "pack "+pack.id.String()+": worker 3, 2 blobs, 100 bytes, 1 files"), "missing pack in %q", dump)
+	rtest.Assert(t, strings.Contains(dump, "goroutine "), "missing goroutine stacks in %q", dump)
+
+	w.finishPack(pack.id)
+	rtest.Assert(t, !strings.Contains(string(w.dump(0)), pack.id.String()), "finished pack is still in flight")
+}
+
+func TestWatchdogBlockingWriter(t *testing.T) {
+	// nobody reads the dump, which must not prevent aborting the restore
+	w := newWatchdog(20*time.Millisecond, make(chanWriter), true)
+	err := w.run(context.TODO(), stalledRestore)
+	var stalledErr *StalledError
+	rtest.Assert(t, errors.As(err, &stalledErr), "expected StalledError, got %v", err)
+}
+
+func TestWatchdogProgress(t *testing.T) {
+	out := make(chanWriter, 1)
+	w := newWatchdog(time.Second, out, true)
+	rtest.OK(t, w.run(context.TODO(), func(ctx context.Context) error {
+		for i := 0; i < 100; i++ {
+			w.progressed()
+			time.Sleep(2 * time.Millisecond)
+		}
+		return ctx.Err()
+	}))
+	rtest.Equals(t, 0, len(out))
+}
@@ -14,25 +14,36 @@ type jsonPrinter struct {
 
 	terminal  ui.Terminal
 	verbosity uint
+	// formats the messages, see NewLogfmtProgress
+	format func(status interface{}) string
 }
 
 func NewJSONProgress(terminal ui.Terminal, verbosity uint) ProgressPrinter {
+	return newJSONPrinter(terminal, verbosity, ui.ToJSONString)
+}
+
+func newJSONPrinter(terminal ui.Terminal, verbosity uint, format func(status interface{}) string) *jsonPrinter {
 	return &jsonPrinter{
 		Printer:   progress.NewTerminalPrinter(true, verbosity, terminal),
 		terminal:  terminal,
 		verbosity: verbosity,
+		format:    format,
 	}
 }
 
 func (t *jsonPrinter) print(status interface{}) {
-	t.terminal.Print(ui.ToJSONString(status))
+	t.terminal.Print(t.format(status))
 }
 
 func (t *jsonPrinter) error(status interface{}) {
-	t.terminal.Error(ui.ToJSONString(status))
+	t.terminal.Error(t.format(status))
 }
 
 func (t *jsonPrinter) Update(p State, duration time.Duration) {
+	t.print(newStatusUpdate(p, duration))
+}
+
+func newStatusUpdate(p State, duration time.Duration) statusUpdate {
 	status := statusUpdate{
 		MessageType:    "status",
 		SecondsElapsed: uint64(duration / time.Second),
@@ -48,8 +59,7 @@ func (t *jsonPrinter) Update(p State, duration time.Duration) {
 	if p.AllBytesTotal > 0 {
 		status.PercentDone = float64(p.AllBytesWritten) / float64(p.AllBytesTotal)
 	}
-
-	t.print(status)
+	return status
 }
 
 func (t *jsonPrinter) Error(item string, err error) error {
@@ -79,6 +89,8 @@ func (t *jsonPrinter) CompleteItem(messageType restorer.ItemAction, item string,
 		action = "updated"
 	case restorer.ActionFileUnchanged:
 		action = "unchanged"
+	case restorer.ActionFileSkipped:
+		action = "skipped"
 	case restorer.ActionDeleted:
 		action = "deleted"
 	default:
@@ -95,6 +107,10 @@ func (t *jsonPrinter) CompleteItem(messageType restorer.ItemAction, item string,
 }
 
 func (t *jsonPrinter) Finish(p State, duration time.Duration) {
+	t.print(newSummaryOutput(p, duration))
+}
+
+func newSummaryOutput(p State, duration time.Duration) summaryOutput {
 	status := summaryOutput{
 		MessageType:    "summary",
 		SecondsElapsed: uint64(duration / time.Second),
@@ -105,8 +121,26 @@ func (t *jsonPrinter) Finish(p State, duration time.Duration) {
 		TotalBytes:     p.AllBytesTotal,
 		BytesRestored:  p.AllBytesWritten,
 		BytesSkipped:   p.AllBytesSkipped,
+		ContentBytes:   p.ContentBytes,
+		UniqueBytes:    p.UniqueContentBytes,
+	}
+	if p.UniqueContentBytes > 0 {
+		status.DedupRatio = float64(p.ContentBytes) / float64(p.UniqueContentBytes)
+	}
+	return status
+}
+
+func (t *jsonPrinter) ReportChanges(changes []restorer.FileChange) {
+	for _, c := range changes {
+		t.print(changeUpdate{
+			MessageType:  "change",
+			Action:       string(c.Action),
+			Item:         c.Location,
+			Size:         c.Size,
+			OldSize:      c.OldSize,
+			ChangedBytes: c.ChangedBytes,
+		})
 	}
-	t.print(status)
 }
 
 type statusUpdate struct {
@@ -140,14 +174,26 @@ type verboseUpdate struct {
 	Size        uint64 `json:"size"`
 }
 
+type changeUpdate struct {
+	MessageType  string `json:"message_type"` // "change"
+	Action       string `json:"action"`
+	Item         string `json:"item"`
+	Size         uint64 `json:"size"`
+	OldSize      uint64 `json:"old_size"`
+	ChangedBytes uint64 `json:"changed_bytes"`
+}
+
 type summaryOutput struct {
-	MessageType    string `json:"message_type"` // "summary"
-	SecondsElapsed uint64 `json:"seconds_elapsed,omitempty"`
-	TotalFiles     uint64 `json:"total_files,omitempty"`
-	FilesRestored  uint64 `json:"files_restored,omitempty"`
-	FilesSkipped   uint64 `json:"files_skipped,omitempty"`
-	FilesDeleted   uint64 `json:"files_deleted,omitempty"`
-	TotalBytes     uint64 `json:"total_bytes,omitempty"`
-	BytesRestored  uint64 `json:"bytes_restored,omitempty"`
-	BytesSkipped   uint64 `json:"bytes_skipped,omitempty"`
+	MessageType    string  `json:"message_type"` // "summary"
+	SecondsElapsed uint64  `json:"seconds_elapsed,omitempty"`
+	TotalFiles     uint64  `json:"total_files,omitempty"`
+	FilesRestored  uint64  `json:"files_restored,omitempty"`
+	FilesSkipped   uint64  `json:"files_skipped,omitempty"`
+	FilesDeleted   uint64  `json:"files_deleted,omitempty"`
+	TotalBytes     uint64  `json:"total_bytes,omitempty"`
+	BytesRestored  uint64  `json:"bytes_restored,omitempty"`
+	BytesSkipped   uint64  `json:"bytes_skipped,omitempty"`
+	ContentBytes   uint64  `json:"content_bytes,omitempty"`
+	UniqueBytes    uint64  `json:"unique_content_bytes,omitempty"`
+	DedupRatio     float64 `json:"dedup_ratio,omitempty"`
 }
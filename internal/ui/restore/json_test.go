@@ -18,34 +18,40 @@ func createJSONProgress() (*ui.MockTerminal, ProgressPrinter) {
 
 func TestJSONPrintUpdate(t *testing.T) {
 	term, printer := createJSONProgress()
-	printer.Update(State{3, 11, 0, 0, 29, 47, 0}, 5*time.Second)
+	printer.Update(State{3, 11, 0, 0, 29, 47, 0, 0, 0}, 5*time.Second)
 	test.Equals(t, []string{"{\"message_type\":\"status\",\"seconds_elapsed\":5,\"percent_done\":0.6170212765957447,\"total_files\":11,\"files_restored\":3,\"total_bytes\":47,\"bytes_restored\":29}\n"}, term.Output)
 }
 
 func TestJSONPrintUpdateWithSkipped(t *testing.T) {
 	term, printer := createJSONProgress()
-	printer.Update(State{3, 11, 2, 0, 29, 47, 59}, 5*time.Second)
+	printer.Update(State{3, 11, 2, 0, 29, 47, 59, 0, 0}, 5*time.Second)
 	test.Equals(t, []string{"{\"message_type\":\"status\",\"seconds_elapsed\":5,\"percent_done\":0.6170212765957447,\"total_files\":11,\"files_restored\":3,\"files_skipped\":2,\"total_bytes\":47,\"bytes_restored\":29,\"bytes_skipped\":59}\n"}, term.Output)
 }
 
 func TestJSONPrintSummaryOnSuccess(t *testing.T) {
 	term, printer := createJSONProgress()
-	printer.Finish(State{11, 11, 0, 0, 47, 47, 0}, 5*time.Second)
+	printer.Finish(State{11, 11, 0, 0, 47, 47, 0, 0, 0}, 5*time.Second)
 	test.Equals(t, []string{"{\"message_type\":\"summary\",\"seconds_elapsed\":5,\"total_files\":11,\"files_restored\":11,\"total_bytes\":47,\"bytes_restored\":47}\n"}, term.Output)
 }
 
 func TestJSONPrintSummaryOnErrors(t *testing.T) {
 	term, printer := createJSONProgress()
-	printer.Finish(State{3, 11, 0, 0, 29, 47, 0}, 5*time.Second)
+	printer.Finish(State{3, 11, 0, 0, 29, 47, 0, 0, 0}, 5*time.Second)
 	test.Equals(t, []string{"{\"message_type\":\"summary\",\"seconds_elapsed\":5,\"total_files\":11,\"files_restored\":3,\"total_bytes\":47,\"bytes_restored\":29}\n"}, term.Output)
 }
 
 func TestJSONPrintSummaryOnSuccessWithSkipped(t *testing.T) {
 	term, printer := createJSONProgress()
-	printer.Finish(State{11, 11, 2, 0, 47, 47, 59}, 5*time.Second)
+	printer.Finish(State{11, 11, 2, 0, 47, 47, 59, 0, 0}, 5*time.Second)
 	test.Equals(t, []string{"{\"message_type\":\"summary\",\"seconds_elapsed\":5,\"total_files\":11,\"files_restored\":11,\"files_skipped\":2,\"total_bytes\":47,\"bytes_restored\":47,\"bytes_skipped\":59}\n"}, term.Output)
 }
 
+func TestJSONPrintSummaryWithDedup(t *testing.T) {
+	term, printer := createJSONProgress()
+	printer.Finish(State{11, 11, 0, 0, 47, 47, 0, 40, 16}, 5*time.Second)
+	test.Equals(t, []string{"{\"message_type\":\"summary\",\"seconds_elapsed\":5,\"total_files\":11,\"files_restored\":11,\"total_bytes\":47,\"bytes_restored\":47,\"content_bytes\":40,\"unique_content_bytes\":16,\"dedup_ratio\":2.5}\n"}, term.Output)
+}
+
 func TestJSONPrintCompleteItem(t *testing.T) {
 	for _, data := range []struct {
 		action   restorer.ItemAction
@@ -56,6 +62,7 @@ func TestJSONPrintCompleteItem(t *testing.T) {
 		{restorer.ActionFileRestored, 123, "{\"message_type\":\"verbose_status\",\"action\":\"restored\",\"item\":\"test\",\"size\":123}\n"},
 		{restorer.ActionFileUpdated, 123, "{\"message_type\":\"verbose_status\",\"action\":\"updated\",\"item\":\"test\",\"size\":123}\n"},
 		{restorer.ActionFileUnchanged, 123, "{\"message_type\":\"verbose_status\",\"action\":\"unchanged\",\"item\":\"test\",\"size\":123}\n"},
+		{restorer.ActionFileSkipped, 123, "{\"message_type\":\"verbose_status\",\"action\":\"skipped\",\"item\":\"test\",\"size\":123}\n"},
 		{restorer.ActionDeleted, 0, "{\"message_type\":\"verbose_status\",\"action\":\"deleted\",\"item\":\"test\",\"size\":0}\n"},
 	} {
 		term, printer := createJSONProgress()
@@ -69,3 +76,11 @@ func TestJSONError(t *testing.T) {
 	test.Equals(t, printer.Error("/path", errors.New("error \"message\"")), nil)
 	test.Equals(t, []string{"{\"message_type\":\"error\",\"error\":{\"message\":\"error \\\"message\\\"\"},\"during\":\"restore\",\"item\":\"/path\"}\n"}, term.Errors)
 }
+
+func TestJSONReportChanges(t *testing.T) {
+	term, printer := createJSONProgress()
+	printer.ReportChanges([]restorer.FileChange{
+		{Location: "test", Action: restorer.ChangeModified, Size: 123, OldSize: 100, ChangedBytes: 50},
+	})
+	test.Equals(t, []string{"{\"message_type\":\"change\",\"action\":\"modified\",\"item\":\"test\",\"size\":123,\"old_size\":100,\"changed_bytes\":50}\n"}, term.Output)
+}
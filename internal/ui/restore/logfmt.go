@@ -0,0 +1,118 @@
+package restore
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/restic/restic/internal/ui"
+)
+
+// OutputFormat specifies the format of the restore progress output.
+type OutputFormat int
+
+// Constants for the different output formats
+const (
+	// OutputText prints human readable messages.
+	OutputText OutputFormat = iota
+	// OutputJSON prints one JSON object per line, like --json.
+	OutputJSON
+	// OutputLogfmt prints the messages of OutputJSON as key=value lines.
+	OutputLogfmt
+	OutputInvalid
+)
+
+// Set implements the method needed for pflag command flag parsing.
+func (f *OutputFormat) Set(s string) error {
+	switch s {
+	case "text":
+		*f = OutputText
+	case "json":
+		*f = OutputJSON
+	case "logfmt":
+		*f = OutputLogfmt
+	default:
+		*f = OutputInvalid
+		return fmt.Errorf("invalid output format %q, must be one of (text|json|logfmt)", s)
+	}
+
+	return nil
+}
+
+func (f *OutputFormat) String() string {
+	switch *f {
+	case OutputText:
+		return "text"
+	case OutputJSON:
+		return "json"
+	case OutputLogfmt:
+		return "logfmt"
+	default:
+		return "invalid"
+	}
+}
+
+func (f *OutputFormat) Type() string {
+	return "format"
+}
+
+// NewLogfmtProgress returns a printer which prints the same messages as
+// NewJSONProgress, but formatted as logfmt lines.
+func NewLogfmtProgress(terminal ui.Terminal, verbosity uint) ProgressPrinter {
+	return newJSONPrinter(terminal, verbosity, toLogfmtString)
+}
+
+// toLogfmtString formats status as a single logfmt line. It uses the keys of
+// the JSON encoding, the fields of nested objects are joined with a dot.
+func toLogfmtString(status interface{}) string {
+	var sb strings.Builder
+	appendLogfmt(&sb, "", reflect.ValueOf(status))
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+func appendLogfmt(sb *strings.Builder, prefix string, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, opts, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		field := v.Field(i)
+		if strings.Contains(opts, "omitempty") && field.IsZero() {
+			continue
+		}
+		if field.Kind() == reflect.Struct {
+			appendLogfmt(sb, prefix+name+".", field)
+			continue
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(prefix + name)
+		sb.WriteByte('=')
+		switch field.Kind() {
+		case reflect.String:
+			sb.WriteString(logfmtQuote(field.String()))
+		case reflect.Float32, reflect.Float64:
+			sb.WriteString(strconv.FormatFloat(field.Float(), 'f', -1, 64))
+		default:
+			fmt.Fprint(sb, field.Interface())
+		}
+	}
+}
+
+// logfmtQuote quotes s if it is empty or contains spaces, quotes, equal signs
+// or other characters which would break parsing the line.
+func logfmtQuote(s string) string {
+	needsQuoting := s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r == '"' || r == '=' || r == '\\' || unicode.IsSpace(r) || !unicode.IsPrint(r)
+	}) >= 0
+	if needsQuoting {
+		return strconv.Quote(s)
+	}
+	return s
+}
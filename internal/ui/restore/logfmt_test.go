@@ -0,0 +1,62 @@
+package restore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restorer"
+	"github.com/restic/restic/internal/test"
+	"github.com/restic/restic/internal/ui"
+)
+
+func createLogfmtProgress() (*ui.MockTerminal, ProgressPrinter) {
+	term := &ui.MockTerminal{}
+	printer := NewLogfmtProgress(term, 3)
+	return term, printer
+}
+
+func TestLogfmtPrintUpdate(t *testing.T) {
+	term, printer := createLogfmtProgress()
+	printer.Update(State{3, 11, 2, 0, 29, 47, 59, 0, 0}, 5*time.Second)
+	test.Equals(t, []string{"message_type=status seconds_elapsed=5 percent_done=0.6170212765957447 total_files=11 files_restored=3 files_skipped=2 total_bytes=47 bytes_restored=29 bytes_skipped=59\n"}, term.Output)
+}
+
+func TestLogfmtPrintSummary(t *testing.T) {
+	term, printer := createLogfmtProgress()
+	printer.Finish(State{11, 11, 0, 0, 47, 47, 0, 40, 16}, 5*time.Second)
+	test.Equals(t, []string{"message_type=summary seconds_elapsed=5 total_files=11 files_restored=11 total_bytes=47 bytes_restored=47 content_bytes=40 unique_content_bytes=16 dedup_ratio=2.5\n"}, term.Output)
+}
+
+func TestLogfmtPrintCompleteItem(t *testing.T) {
+	for _, data := range []struct {
+		item     string
+		expected string
+	}{
+		{"test", "message_type=verbose_status action=restored item=test size=123\n"},
+		{"with space", "message_type=verbose_status action=restored item=\"with space\" size=123\n"},
+		{"a=b", "message_type=verbose_status action=restored item=\"a=b\" size=123\n"},
+		{"", "message_type=verbose_status action=restored item=\"\" size=123\n"},
+	} {
+		term, printer := createLogfmtProgress()
+		printer.CompleteItem(restorer.ActionFileRestored, data.item, 123)
+		test.Equals(t, []string{data.expected}, term.Output)
+	}
+}
+
+func TestLogfmtError(t *testing.T) {
+	term, printer := createLogfmtProgress()
+	test.Equals(t, printer.Error("/path", errors.New("error \"message\"\n")), nil)
+	test.Equals(t, []string{"message_type=error error.message=\"error \\\"message\\\"\\n\" during=restore item=/path\n"}, term.Errors)
+}
+
+func TestOutputFormatSet(t *testing.T) {
+	for _, format := range []string{"text", "json", "logfmt"} {
+		var f OutputFormat
+		test.OK(t, f.Set(format))
+		test.Equals(t, format, f.String())
+	}
+	var f OutputFormat
+	test.Assert(t, f.Set("xml") != nil, "expected an error for an invalid format")
+	test.Equals(t, OutputInvalid, f)
+}
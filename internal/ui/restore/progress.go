@@ -17,6 +17,10 @@ type State struct {
 	AllBytesWritten uint64
 	AllBytesTotal   uint64
 	AllBytesSkipped uint64
+	// file content written from fetched blobs and the size of the distinct
+	// blobs, only set for the summary
+	ContentBytes       uint64
+	UniqueContentBytes uint64
 }
 
 type Progress struct {
@@ -25,12 +29,17 @@ type Progress struct {
 
 	progressInfoMap map[string]progressInfoEntry
 	s               State
-	started         time.Time
+	// counters of the interrupted restore which is resumed
+	resumed restorer.ResumedProgress
+	started time.Time
 
 	printer ProgressPrinter
 }
 
 var _ restorer.ProgressReporter = (*Progress)(nil)
+var _ restorer.ProgressResumer = (*Progress)(nil)
+var _ restorer.DedupReporter = (*Progress)(nil)
+var _ restorer.SkipReasonReporter = (*Progress)(nil)
 
 type progressInfoEntry struct {
 	bytesWritten uint64
@@ -42,6 +51,8 @@ type ProgressPrinter interface {
 	Error(item string, err error) error
 	CompleteItem(action restorer.ItemAction, item string, size uint64)
 	Finish(progress State, duration time.Duration)
+	// ReportChanges prints the changes to the files in the target.
+	ReportChanges(changes []restorer.FileChange)
 	restic.Printer
 }
 
@@ -66,12 +77,77 @@ func (p *Progress) update(runtime time.Duration, final bool) {
 	defer p.m.Unlock()
 
 	if !final {
-		p.printer.Update(p.s, runtime)
+		p.printer.Update(p.resumedState(), runtime)
 	} else {
 		p.printer.Finish(p.s, runtime)
 	}
 }
 
+// resumedState returns the current state, but at least the progress of the
+// resumed restore. The current state catches up once the restorer has
+// reported the files which were restored by the interrupted run.
+func (p *Progress) resumedState() State {
+	s := p.s
+	s.FilesFinished = max(s.FilesFinished, p.resumed.FilesFinished)
+	s.FilesTotal = max(s.FilesTotal, p.resumed.FilesTotal)
+	s.AllBytesWritten = max(s.AllBytesWritten, p.resumed.BytesWritten)
+	s.AllBytesTotal = max(s.AllBytesTotal, p.resumed.BytesTotal)
+	return s
+}
+
+// ResumeProgress initializes the progress with the counters of an
+// interrupted restore.
+func (p *Progress) ResumeProgress(state restorer.ResumedProgress) {
+	if p == nil {
+		return
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.resumed = state
+}
+
+// ProgressState returns the counters to store for resuming the restore.
+func (p *Progress) ProgressState() restorer.ResumedProgress {
+	if p == nil {
+		return restorer.ResumedProgress{}
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	s := p.resumedState()
+	return restorer.ResumedProgress{
+		FilesFinished: s.FilesFinished,
+		FilesTotal:    s.FilesTotal,
+		BytesWritten:  s.AllBytesWritten,
+		BytesTotal:    s.AllBytesTotal,
+	}
+}
+
+// State returns the current progress and the time since the restore started.
+func (p *Progress) State() (State, time.Duration) {
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	return p.resumedState(), time.Since(p.started)
+}
+
+// ReportDedup records the deduplication of the restored content for the
+// summary.
+func (p *Progress) ReportDedup(stats restorer.DedupStats) {
+	if p == nil {
+		return
+	}
+
+	p.m.Lock()
+	defer p.m.Unlock()
+
+	p.s.ContentBytes = stats.LogicalBytes
+	p.s.UniqueContentBytes = stats.UniqueBytes
+}
+
 // AddFile starts tracking a new file with the given size
 func (p *Progress) AddFile(size uint64) {
 	if p == nil {
@@ -111,6 +187,12 @@ func (p *Progress) AddProgress(name string, action restorer.ItemAction, bytesWri
 }
 
 func (p *Progress) AddSkippedFile(name string, size uint64) {
+	p.AddSkippedFileReason(name, size, restorer.SkipUnchanged)
+}
+
+// AddSkippedFileReason is like AddSkippedFile, but reports existing files
+// which must not be overwritten as skipped instead of unchanged.
+func (p *Progress) AddSkippedFileReason(name string, size uint64, reason restorer.SkipReason) {
 	if p == nil {
 		return
 	}
@@ -121,7 +203,11 @@ func (p *Progress) AddSkippedFile(name string, size uint64) {
 	p.s.FilesSkipped++
 	p.s.AllBytesSkipped += size
 
-	p.printer.CompleteItem(restorer.ActionFileUnchanged, name, size)
+	action := restorer.ActionFileSkipped
+	if reason == restorer.SkipUnchanged {
+		action = restorer.ActionFileUnchanged
+	}
+	p.printer.CompleteItem(action, name, size)
 }
 
 func (p *Progress) ReportDeletion(name string) {
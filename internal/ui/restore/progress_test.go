@@ -56,6 +56,7 @@ func (p *mockPrinter) CompleteItem(action restorer.ItemAction, item string, size
 func (p *mockPrinter) Finish(progress State, _ time.Duration) {
 	p.trace = append(p.trace, printerTraceEntry{progress, mockFinishDuration, true})
 }
+func (p *mockPrinter) ReportChanges(_ []restorer.FileChange) {}
 
 func testProgress(fn func(progress *Progress) bool) (printerTrace, itemTrace, errorTrace) {
 	printer := &mockPrinter{Printer: restic.NewNoopPrinter()}
@@ -75,7 +76,7 @@ func TestNew(t *testing.T) {
 		return false
 	})
 	test.Equals(t, printerTrace{
-		printerTraceEntry{State{0, 0, 0, 0, 0, 0, 0}, 0, false},
+		printerTraceEntry{State{0, 0, 0, 0, 0, 0, 0, 0, 0}, 0, false},
 	}, result)
 	test.Equals(t, itemTrace{}, items)
 }
@@ -88,7 +89,7 @@ func TestAddFile(t *testing.T) {
 		return false
 	})
 	test.Equals(t, printerTrace{
-		printerTraceEntry{State{0, 1, 0, 0, 0, fileSize, 0}, 0, false},
+		printerTraceEntry{State{0, 1, 0, 0, 0, fileSize, 0, 0, 0}, 0, false},
 	}, result)
 	test.Equals(t, itemTrace{}, items)
 }
@@ -103,7 +104,7 @@ func TestFirstProgressOnAFile(t *testing.T) {
 		return false
 	})
 	test.Equals(t, printerTrace{
-		printerTraceEntry{State{0, 1, 0, 0, expectedBytesWritten, expectedBytesTotal, 0}, 0, false},
+		printerTraceEntry{State{0, 1, 0, 0, expectedBytesWritten, expectedBytesTotal, 0, 0, 0}, 0, false},
 	}, result)
 	test.Equals(t, itemTrace{}, items)
 }
@@ -119,7 +120,7 @@ func TestLastProgressOnAFile(t *testing.T) {
 		return false
 	})
 	test.Equals(t, printerTrace{
-		printerTraceEntry{State{1, 1, 0, 0, fileSize, fileSize, 0}, 0, false},
+		printerTraceEntry{State{1, 1, 0, 0, fileSize, fileSize, 0, 0, 0}, 0, false},
 	}, result)
 	test.Equals(t, itemTrace{
 		itemTraceEntry{action: restorer.ActionFileUpdated, item: "test", size: fileSize},
@@ -138,7 +139,7 @@ func TestLastProgressOnLastFile(t *testing.T) {
 		return false
 	})
 	test.Equals(t, printerTrace{
-		printerTraceEntry{State{2, 2, 0, 0, 50 + fileSize, 50 + fileSize, 0}, 0, false},
+		printerTraceEntry{State{2, 2, 0, 0, 50 + fileSize, 50 + fileSize, 0, 0, 0}, 0, false},
 	}, result)
 	test.Equals(t, itemTrace{
 		itemTraceEntry{action: restorer.ActionFileUpdated, item: "test1", size: 50},
@@ -157,7 +158,7 @@ func TestSummaryOnSuccess(t *testing.T) {
 		return true
 	})
 	test.Equals(t, printerTrace{
-		printerTraceEntry{State{2, 2, 0, 0, 50 + fileSize, 50 + fileSize, 0}, mockFinishDuration, true},
+		printerTraceEntry{State{2, 2, 0, 0, 50 + fileSize, 50 + fileSize, 0, 0, 0}, mockFinishDuration, true},
 	}, result)
 }
 
@@ -172,10 +173,43 @@ func TestSummaryOnErrors(t *testing.T) {
 		return true
 	})
 	test.Equals(t, printerTrace{
-		printerTraceEntry{State{1, 2, 0, 0, 50 + fileSize/2, 50 + fileSize, 0}, mockFinishDuration, true},
+		printerTraceEntry{State{1, 2, 0, 0, 50 + fileSize/2, 50 + fileSize, 0, 0, 0}, mockFinishDuration, true},
 	}, result)
 }
 
+func TestResumeProgress(t *testing.T) {
+	resumed := restorer.ResumedProgress{FilesFinished: 1, FilesTotal: 2, BytesWritten: 80, BytesTotal: 100}
+
+	for _, c := range []struct {
+		written  uint64
+		expected State
+	}{
+		// the resumed progress is shown until the restorer catches up
+		{0, State{1, 2, 0, 0, 80, 100, 0, 0, 0}},
+		{20, State{1, 2, 0, 0, 80, 100, 0, 0, 0}},
+		{90, State{1, 2, 0, 0, 90, 100, 0, 0, 0}},
+	} {
+		var state restorer.ResumedProgress
+		result, _, _ := testProgress(func(progress *Progress) bool {
+			progress.ResumeProgress(resumed)
+			progress.AddFile(100)
+			progress.AddFile(0)
+			progress.AddProgress("test", restorer.ActionFileRestored, c.written, 100)
+			state = progress.ProgressState()
+			return false
+		})
+		test.Equals(t, printerTrace{
+			printerTraceEntry{c.expected, 0, false},
+		}, result)
+		test.Equals(t, restorer.ResumedProgress{
+			FilesFinished: c.expected.FilesFinished,
+			FilesTotal:    c.expected.FilesTotal,
+			BytesWritten:  c.expected.AllBytesWritten,
+			BytesTotal:    c.expected.AllBytesTotal,
+		}, state)
+	}
+}
+
 func TestSkipFile(t *testing.T) {
 	fileSize := uint64(100)
 
@@ -184,13 +218,30 @@ func TestSkipFile(t *testing.T) {
 		return true
 	})
 	test.Equals(t, printerTrace{
-		printerTraceEntry{State{0, 0, 1, 0, 0, 0, fileSize}, mockFinishDuration, true},
+		printerTraceEntry{State{0, 0, 1, 0, 0, 0, fileSize, 0, 0}, mockFinishDuration, true},
 	}, result)
 	test.Equals(t, itemTrace{
 		itemTraceEntry{restorer.ActionFileUnchanged, "test", fileSize},
 	}, items)
 }
 
+func TestSkipFileReason(t *testing.T) {
+	fileSize := uint64(100)
+
+	result, items, _ := testProgress(func(progress *Progress) bool {
+		progress.AddSkippedFileReason("unchanged", fileSize, restorer.SkipUnchanged)
+		progress.AddSkippedFileReason("newer", fileSize, restorer.SkipNewer)
+		return true
+	})
+	test.Equals(t, printerTrace{
+		printerTraceEntry{State{0, 0, 2, 0, 0, 0, 2 * fileSize, 0, 0}, mockFinishDuration, true},
+	}, result)
+	test.Equals(t, itemTrace{
+		itemTraceEntry{restorer.ActionFileUnchanged, "unchanged", fileSize},
+		itemTraceEntry{restorer.ActionFileSkipped, "newer", fileSize},
+	}, items)
+}
+
 func TestProgressTypes(t *testing.T) {
 	fileSize := uint64(100)
 
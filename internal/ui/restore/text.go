@@ -58,6 +58,8 @@ func (t *textPrinter) CompleteItem(messageType restorer.ItemAction, item string,
 		action = "updated"
 	case restorer.ActionFileUnchanged:
 		action = "unchanged"
+	case restorer.ActionFileSkipped:
+		action = "skipped"
 	case restorer.ActionDeleted:
 		action = "deleted"
 	default:
@@ -91,6 +93,41 @@ func (t *textPrinter) Finish(p State, duration time.Duration) {
 	if p.FilesDeleted > 0 {
 		summary += fmt.Sprintf(", deleted %v files/dirs", p.FilesDeleted)
 	}
+	if p.UniqueContentBytes > 0 {
+		summary += fmt.Sprintf(", wrote %v from %v of unique content (%.1fx dedup)",
+			ui.FormatBytes(p.ContentBytes), ui.FormatBytes(p.UniqueContentBytes),
+			float64(p.ContentBytes)/float64(p.UniqueContentBytes))
+	}
 
 	t.terminal.Print(summary)
 }
+
+func (t *textPrinter) ReportChanges(changes []restorer.FileChange) {
+	var created, modified, unchanged int
+	var createdBytes, changedBytes uint64
+	for _, c := range changes {
+		switch c.Action {
+		case restorer.ChangeCreated:
+			created++
+			createdBytes += c.ChangedBytes
+			t.P("%-9v %v with size %v", c.Action, c.Location, ui.FormatBytes(c.Size))
+		case restorer.ChangeModified:
+			modified++
+			changedBytes += c.ChangedBytes
+			t.P("%-9v %v with size %v (%v), %v changed", c.Action, c.Location, ui.FormatBytes(c.Size),
+				formatSizeDelta(c.SizeDelta()), ui.FormatBytes(c.ChangedBytes))
+		case restorer.ChangeUnchanged:
+			unchanged++
+			t.V("%-9v %v", c.Action, c.Location)
+		}
+	}
+	t.P("changed files: %d created (%v), %d modified (%v changed), %d unchanged",
+		created, ui.FormatBytes(createdBytes), modified, ui.FormatBytes(changedBytes), unchanged)
+}
+
+func formatSizeDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + ui.FormatBytes(uint64(-delta))
+	}
+	return "+" + ui.FormatBytes(uint64(delta))
+}
@@ -18,34 +18,40 @@ func createTextProgress() (*ui.MockTerminal, ProgressPrinter) {
 
 func TestPrintUpdate(t *testing.T) {
 	term, printer := createTextProgress()
-	printer.Update(State{3, 11, 0, 0, 29, 47, 0}, 5*time.Second)
+	printer.Update(State{3, 11, 0, 0, 29, 47, 0, 0, 0}, 5*time.Second)
 	test.Equals(t, []string{"[0:05] 61.70%  3 files/dirs 29 B, total 11 files/dirs 47 B"}, term.Output)
 }
 
 func TestPrintUpdateWithSkipped(t *testing.T) {
 	term, printer := createTextProgress()
-	printer.Update(State{3, 11, 2, 0, 29, 47, 59}, 5*time.Second)
+	printer.Update(State{3, 11, 2, 0, 29, 47, 59, 0, 0}, 5*time.Second)
 	test.Equals(t, []string{"[0:05] 61.70%  3 files/dirs 29 B, total 11 files/dirs 47 B, skipped 2 files/dirs 59 B"}, term.Output)
 }
 
 func TestPrintSummaryOnSuccess(t *testing.T) {
 	term, printer := createTextProgress()
-	printer.Finish(State{11, 11, 0, 0, 47, 47, 0}, 5*time.Second)
+	printer.Finish(State{11, 11, 0, 0, 47, 47, 0, 0, 0}, 5*time.Second)
 	test.Equals(t, []string{"Summary: Restored 11 files/dirs (47 B) in 0:05"}, term.Output)
 }
 
 func TestPrintSummaryOnErrors(t *testing.T) {
 	term, printer := createTextProgress()
-	printer.Finish(State{3, 11, 0, 0, 29, 47, 0}, 5*time.Second)
+	printer.Finish(State{3, 11, 0, 0, 29, 47, 0, 0, 0}, 5*time.Second)
 	test.Equals(t, []string{"Summary: Restored 3 / 11 files/dirs (29 B / 47 B) in 0:05"}, term.Output)
 }
 
 func TestPrintSummaryOnSuccessWithSkipped(t *testing.T) {
 	term, printer := createTextProgress()
-	printer.Finish(State{11, 11, 2, 0, 47, 47, 59}, 5*time.Second)
+	printer.Finish(State{11, 11, 2, 0, 47, 47, 59, 0, 0}, 5*time.Second)
 	test.Equals(t, []string{"Summary: Restored 11 files/dirs (47 B) in 0:05, skipped 2 files/dirs 59 B"}, term.Output)
 }
 
+func TestPrintSummaryWithDedup(t *testing.T) {
+	term, printer := createTextProgress()
+	printer.Finish(State{11, 11, 0, 0, 47, 47, 0, 40, 16}, 5*time.Second)
+	test.Equals(t, []string{"Summary: Restored 11 files/dirs (47 B) in 0:05, wrote 40 B from 16 B of unique content (2.5x dedup)"}, term.Output)
+}
+
 func TestPrintCompleteItem(t *testing.T) {
 	for _, data := range []struct {
 		action   restorer.ItemAction
@@ -57,6 +63,7 @@ func TestPrintCompleteItem(t *testing.T) {
 		{restorer.ActionOtherRestored, 0, "restored  test"},
 		{restorer.ActionFileUpdated, 123, "updated   test with size 123 B"},
 		{restorer.ActionFileUnchanged, 123, "unchanged test with size 123 B"},
+		{restorer.ActionFileSkipped, 123, "skipped   test with size 123 B"},
 		{restorer.ActionDeleted, 0, "deleted   test"},
 	} {
 		term, printer := createTextProgress()
@@ -70,3 +77,18 @@ func TestError(t *testing.T) {
 	test.Equals(t, printer.Error("/path", errors.New("error \"message\"")), nil)
 	test.Equals(t, []string{"ignoring error for /path: error \"message\"\n"}, term.Errors)
 }
+
+func TestPrintReportChanges(t *testing.T) {
+	term, printer := createTextProgress()
+	printer.ReportChanges([]restorer.FileChange{
+		{Location: "new", Action: restorer.ChangeCreated, Size: 10, ChangedBytes: 10},
+		{Location: "shrunk", Action: restorer.ChangeModified, Size: 100, OldSize: 123, ChangedBytes: 50},
+		{Location: "same", Action: restorer.ChangeUnchanged, Size: 7, OldSize: 7},
+	})
+	test.Equals(t, []string{
+		"created   new with size 10 B",
+		"modified  shrunk with size 100 B (-23 B), 50 B changed",
+		"unchanged same",
+		"changed files: 1 created (10 B), 1 modified (50 B changed), 1 unchanged",
+	}, term.Output)
+}
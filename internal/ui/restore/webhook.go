@@ -0,0 +1,216 @@
+package restore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+)
+
+// WebhookEvent is an event of a restore for which a webhook is notified.
+type WebhookEvent string
+
+// Constants for the different webhook events.
+const (
+	// WebhookStart is sent before the restore starts.
+	WebhookStart WebhookEvent = "start"
+	// WebhookProgress is sent periodically during the restore, see
+	// WebhookOptions.Interval.
+	WebhookProgress WebhookEvent = "progress"
+	// WebhookCompleted is sent once the restore has completed, it contains
+	// the summary of the restore.
+	WebhookCompleted WebhookEvent = "completed"
+	// WebhookFailed is sent if the restore failed, it contains the error.
+	WebhookFailed WebhookEvent = "failed"
+)
+
+// AllWebhookEvents lists all webhook events.
+var AllWebhookEvents = []WebhookEvent{WebhookStart, WebhookProgress, WebhookCompleted, WebhookFailed}
+
+// ParseWebhookEvents parses a comma separated list of webhook events.
+func ParseWebhookEvents(s string) ([]WebhookEvent, error) {
+	var events []WebhookEvent
+	for _, name := range strings.Split(s, ",") {
+		event := WebhookEvent(strings.TrimSpace(name))
+		found := false
+		for _, known := range AllWebhookEvents {
+			found = found || event == known
+		}
+		if !found {
+			return nil, errors.Errorf("unknown webhook event %q, must be one of %v", event, AllWebhookEvents)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// WebhookOptions configure a Webhook.
+type WebhookOptions struct {
+	// URL receives the events as JSON using a POST request.
+	URL string
+	// Header is added to each request, for example for authentication.
+	Header http.Header
+	// Events lists the events to send, all events are sent if it is empty.
+	Events []WebhookEvent
+	// Interval between progress events. Zero disables progress events.
+	Interval time.Duration
+	// Timeout of each request. Zero defaults to ten seconds.
+	Timeout time.Duration
+}
+
+// webhookPayload is the body of each webhook request.
+type webhookPayload struct {
+	Event    WebhookEvent   `json:"event"`
+	Time     time.Time      `json:"time"`
+	Snapshot string         `json:"snapshot_id"`
+	Target   string         `json:"target"`
+	Status   *statusUpdate  `json:"status,omitempty"`
+	Summary  *summaryOutput `json:"summary,omitempty"`
+	Error    *errorObject   `json:"error,omitempty"`
+}
+
+// Webhook notifies a URL about the start, progress, completion and failure of
+// a restore. Requests which fail are reported using warn, but do not affect
+// the restore.
+type Webhook struct {
+	opts   WebhookOptions
+	client *http.Client
+	warn   func(msg string, args ...interface{})
+
+	snapshot string
+	target   string
+	state    func() (State, time.Duration)
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewWebhook returns a webhook which sends the events to opts.URL.
+func NewWebhook(opts WebhookOptions, warn func(msg string, args ...interface{})) *Webhook {
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &Webhook{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		warn:   warn,
+	}
+}
+
+func (w *Webhook) enabled(event WebhookEvent) bool {
+	if len(w.opts.Events) == 0 {
+		return true
+	}
+	for _, e := range w.opts.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Start sends the start event for restoring snapshot to target and starts
+// sending progress events, which contain the result of state.
+func (w *Webhook) Start(ctx context.Context, snapshot, target string, state func() (State, time.Duration)) {
+	w.snapshot = snapshot
+	w.target = target
+	w.state = state
+	if w.enabled(WebhookStart) {
+		progress, duration := state()
+		status := newStatusUpdate(progress, duration)
+		w.send(ctx, webhookPayload{Event: WebhookStart, Status: &status})
+	}
+
+	if !w.enabled(WebhookProgress) || w.opts.Interval <= 0 {
+		return
+	}
+	w.stop = make(chan struct{})
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		ticker := time.NewTicker(w.opts.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				progress, duration := state()
+				status := newStatusUpdate(progress, duration)
+				w.send(ctx, webhookPayload{Event: WebhookProgress, Status: &status})
+			}
+		}
+	}()
+}
+
+// Finish stops the progress events and sends the completed event or, if err
+// is not nil, the failed event.
+func (w *Webhook) Finish(ctx context.Context, err error) {
+	if w.stop != nil {
+		close(w.stop)
+		w.wg.Wait()
+		w.stop = nil
+	}
+	if w.state == nil {
+		return
+	}
+
+	progress, duration := w.state()
+	if err != nil {
+		if w.enabled(WebhookFailed) {
+			status := newStatusUpdate(progress, duration)
+			// the restore may have failed as ctx was canceled
+			w.send(context.WithoutCancel(ctx), webhookPayload{Event: WebhookFailed, Status: &status, Error: &errorObject{err.Error()}})
+		}
+		return
+	}
+	if w.enabled(WebhookCompleted) {
+		summary := newSummaryOutput(progress, duration)
+		w.send(ctx, webhookPayload{Event: WebhookCompleted, Summary: &summary})
+	}
+}
+
+func (w *Webhook) send(ctx context.Context, payload webhookPayload) {
+	payload.Time = time.Now()
+	payload.Snapshot = w.snapshot
+	payload.Target = w.target
+	if err := w.post(ctx, payload); err != nil {
+		debug.Log("webhook %v event failed: %v", payload.Event, err)
+		w.warn("webhook %v event failed: %v", payload.Event, err)
+	}
+}
+
+func (w *Webhook) post(ctx context.Context, payload webhookPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range w.opts.Header {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package restore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/test"
+)
+
+type webhookServer struct {
+	m        sync.Mutex
+	payloads []map[string]interface{}
+	headers  []http.Header
+	status   int
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var payload map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.m.Lock()
+	s.payloads = append(s.payloads, payload)
+	s.headers = append(s.headers, r.Header)
+	s.m.Unlock()
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+	}
+}
+
+func (s *webhookServer) events() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	var events []string
+	for _, payload := range s.payloads {
+		events = append(events, payload["event"].(string))
+	}
+	return events
+}
+
+func testState() (State, time.Duration) {
+	return State{FilesFinished: 3, FilesTotal: 11, AllBytesWritten: 29, AllBytesTotal: 47}, 5 * time.Second
+}
+
+func TestWebhookCompleted(t *testing.T) {
+	server := &webhookServer{}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	var warnings []string
+	hook := NewWebhook(WebhookOptions{
+		URL:    srv.URL,
+		Header: http.Header{"Authorization": []string{"Bearer secret"}},
+	}, func(msg string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(msg, args...))
+	})
+	hook.Start(context.TODO(), "1234", "/target", testState)
+	hook.Finish(context.TODO(), nil)
+
+	test.Equals(t, 0, len(warnings))
+	test.Equals(t, []string{"start", "completed"}, server.events())
+	test.Equals(t, "Bearer secret", server.headers[0].Get("Authorization"))
+	test.Equals(t, "application/json", server.headers[0].Get("Content-Type"))
+	test.Equals(t, interface{}("1234"), server.payloads[0]["snapshot_id"])
+	test.Equals(t, interface{}("/target"), server.payloads[0]["target"])
+	summary := server.payloads[1]["summary"].(map[string]interface{})
+	test.Equals(t, interface{}(float64(3)), summary["files_restored"])
+}
+
+func TestWebhookFailed(t *testing.T) {
+	server := &webhookServer{}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	hook := NewWebhook(WebhookOptions{
+		URL:    srv.URL,
+		Events: []WebhookEvent{WebhookFailed},
+	}, func(msg string, args ...interface{}) {
+		t.Errorf(msg, args...)
+	})
+	ctx, cancel := context.WithCancel(context.TODO())
+	hook.Start(ctx, "1234", "/target", testState)
+	cancel()
+	hook.Finish(ctx, errors.New("boom"))
+
+	test.Equals(t, []string{"failed"}, server.events())
+	errorObj := server.payloads[0]["error"].(map[string]interface{})
+	test.Equals(t, interface{}("boom"), errorObj["message"])
+}
+
+func TestWebhookProgress(t *testing.T) {
+	server := &webhookServer{}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	hook := NewWebhook(WebhookOptions{
+		URL:      srv.URL,
+		Events:   []WebhookEvent{WebhookProgress},
+		Interval: time.Millisecond,
+	}, func(msg string, args ...interface{}) {
+		t.Errorf(msg, args...)
+	})
+	hook.Start(context.TODO(), "1234", "/target", testState)
+	time.Sleep(20 * time.Millisecond)
+	hook.Finish(context.TODO(), nil)
+
+	events := server.events()
+	test.Assert(t, len(events) > 0, "expected progress events")
+	for _, event := range events {
+		test.Equals(t, "progress", event)
+	}
+}
+
+func TestWebhookErrorsAreWarnings(t *testing.T) {
+	server := &webhookServer{status: http.StatusInternalServerError}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	var warnings []string
+	hook := NewWebhook(WebhookOptions{URL: srv.URL}, func(msg string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(msg, args...))
+	})
+	hook.Start(context.TODO(), "1234", "/target", testState)
+	hook.Finish(context.TODO(), nil)
+
+	test.Equals(t, 2, len(warnings))
+	test.Equals(t, []string{"start", "completed"}, server.events())
+}
+
+func TestParseWebhookEvents(t *testing.T) {
+	events, err := ParseWebhookEvents("start, failed")
+	test.OK(t, err)
+	test.Equals(t, []WebhookEvent{WebhookStart, WebhookFailed}, events)
+
+	_, err = ParseWebhookEvents("start,finished")
+	test.Assert(t, err != nil, "expected error for unknown event")
+}